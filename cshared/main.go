@@ -0,0 +1,218 @@
+// Command cshared the converter as a C library, for the GUI applications in other languages (Python, C#, Swift).
+//
+// build it with cgo:
+//
+//	go build -buildmode=c-shared -o libgocomicconverter.so ./cshared
+//
+// it export, with the header libgocomicconverter.h:
+//
+//	long long gocomic_convert(char* options)   start a conversion in the background, return its handle, -1 on invalid options
+//	char*     gocomic_progress(long long h)    the state of the conversion as json, to free with gocomic_free, NULL if unknown
+//	int       gocomic_cancel(long long h)      stop the conversion, 0 if found
+//	int       gocomic_wait(long long h)        wait the end of the conversion, return its exit code (0 if done)
+//	void      gocomic_release(long long h)     forget a conversion ended, once its state is read
+//	char*     gocomic_profiles(void)           the devices as json, to free with gocomic_free
+//	char*     gocomic_last_error(void)         the error of the last gocomic_convert, to free with gocomic_free
+//	void      gocomic_free(char* s)            free a string returned by the library
+//
+// the options are the json options of the EPUB with the profile: {"input": "Series v01.cbz", "output": "Series v01.epub", "profile": "KS"}.
+// The state is {"state": "running", "step": "Processing", "current": 10, "max": 120, "error": "", "outputs": []},
+// the state being running, done, failed or cancelled. The functions are safe to call from any thread.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epub"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// job a conversion in the background.
+type job struct {
+	State   string   `json:"state"`
+	Step    string   `json:"step"`
+	Current int      `json:"current"`
+	Max     int      `json:"max"`
+	Error   string   `json:"error"`
+	Outputs []string `json:"outputs"`
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+var (
+	mu        sync.Mutex
+	jobs      = map[int64]*job{}
+	nextJob   int64
+	lastError string
+)
+
+func main() {}
+
+// defaults the options of the command line without arguments, and the devices.
+func defaults() *converter.Converter {
+	c := converter.New()
+	c.InitParse()
+	return c
+}
+
+//export gocomic_convert
+func gocomic_convert(options *C.char) C.longlong {
+	o, err := parseOptions(C.GoString(options))
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		lastError = err.Error()
+		return -1
+	}
+	lastError = ""
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{State: "running", Outputs: []string{}, cancel: cancel, done: make(chan struct{})}
+	o.Progress = epuboptions.ProgressFunc(func(step epuboptions.ProgressStep, current int) {
+		mu.Lock()
+		defer mu.Unlock()
+		j.Step, j.Current, j.Max = step.Description, current, step.Max
+	})
+	o.Events.OnVolumeFinished = func(e epuboptions.VolumeEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		j.Outputs = append(j.Outputs, e.Output)
+	}
+	nextJob++
+	id := nextJob
+	jobs[id] = j
+
+	go func() {
+		defer close(j.done)
+		defer cancel()
+		err := epub.New(o).WriteContext(ctx)
+		mu.Lock()
+		defer mu.Unlock()
+		j.err = err
+		switch {
+		case err == nil:
+			j.State = "done"
+		case errors.Is(err, context.Canceled):
+			j.State, j.Error = "cancelled", err.Error()
+		default:
+			j.State, j.Error = "failed", err.Error()
+		}
+	}()
+	return C.longlong(id)
+}
+
+// parseOptions the json options over the defaults, with the size of the profile.
+func parseOptions(raw string) (epuboptions.EPUBOptions, error) {
+	c := defaults()
+	o := c.Options.EPUBOptions
+	if err := json.Unmarshal([]byte(raw), &o); err != nil {
+		return o, err
+	}
+	var p struct {
+		Profile string `json:"profile"`
+	}
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return o, err
+	}
+	if p.Profile == "" {
+		p.Profile = c.Options.Profile
+	}
+	profile := c.Options.LookupProfile(p.Profile)
+	if profile == nil {
+		return o, errors.New("unknown profile " + p.Profile)
+	}
+	o.Image.View.Width, o.Image.View.Height = profile.Width, profile.Height
+	o.Quiet, o.Json = true, false
+	if o.Output == "" && o.Input != "" {
+		input := filepath.Clean(o.Input)
+		o.Output = strings.TrimSuffix(input, filepath.Ext(input)) + ".epub"
+	}
+	if o.Title == "" {
+		o.Title = strings.TrimSuffix(filepath.Base(o.Output), filepath.Ext(o.Output))
+	}
+	return o, o.Check()
+}
+
+//export gocomic_progress
+func gocomic_progress(h C.longlong) *C.char {
+	mu.Lock()
+	defer mu.Unlock()
+	j, ok := jobs[int64(h)]
+	if !ok {
+		return nil
+	}
+	data, _ := json.Marshal(j)
+	return C.CString(string(data))
+}
+
+//export gocomic_cancel
+func gocomic_cancel(h C.longlong) C.int {
+	mu.Lock()
+	defer mu.Unlock()
+	j, ok := jobs[int64(h)]
+	if !ok {
+		return -1
+	}
+	j.cancel()
+	return 0
+}
+
+//export gocomic_wait
+func gocomic_wait(h C.longlong) C.int {
+	mu.Lock()
+	j, ok := jobs[int64(h)]
+	mu.Unlock()
+	if !ok {
+		return -1
+	}
+	<-j.done
+	mu.Lock()
+	defer mu.Unlock()
+	return C.int(utils.ExitCode(j.err))
+}
+
+//export gocomic_release
+func gocomic_release(h C.longlong) {
+	mu.Lock()
+	defer mu.Unlock()
+	if j, ok := jobs[int64(h)]; ok && j.State != "running" {
+		delete(jobs, int64(h))
+	}
+}
+
+//export gocomic_profiles
+func gocomic_profiles() *C.char {
+	info, err := defaults().ProfilesInfo()
+	if err != nil {
+		return nil
+	}
+	data, _ := json.Marshal(info.Devices)
+	return C.CString(string(data))
+}
+
+//export gocomic_last_error
+func gocomic_last_error() *C.char {
+	mu.Lock()
+	defer mu.Unlock()
+	return C.CString(lastError)
+}
+
+//export gocomic_free
+func gocomic_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
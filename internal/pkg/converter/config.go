@@ -0,0 +1,235 @@
+package converter
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubschedule"
+)
+
+// Config user config file, with the custom devices and named profiles of options:
+//
+//	devices:
+//	  - code: BooxNA4C
+//	    description: Boox Note Air 4C
+//	    width: 1860
+//	    height: 2480
+//	    palette: 4096
+//	    color: true
+//	profiles:
+//	  kindle-manga:
+//	    profile: KS
+//	    epuboptions:
+//	      image:
+//	        manga: true
+//	schedules:
+//	  - name: nightly
+//	    cron: "0 2 * * *"
+//	    input: /data/comics
+//	    profile_name: kindle-manga
+//	series_profiles:
+//	  Berserk: kindle-manga
+//
+// the devices are available like the built-in profiles.
+// the options of a named profile use the same format as the default config (see -save),
+// only the options set are changed. The schedules are run by the daemon mode,
+// the named profiles of the series (the directories of the library) by the library mode.
+type Config struct {
+	Devices        []Profile            `yaml:"devices"`
+	Profiles       map[string]yaml.Node `yaml:"profiles"`
+	Schedules      []Schedule           `yaml:"schedules"`
+	SeriesProfiles map[string]string    `yaml:"series_profiles"`
+}
+
+// Schedule a batch conversion of a directory run by the daemon mode, like cron.
+type Schedule struct {
+	Name        string `yaml:"name"`
+	Cron        string `yaml:"cron"` // minute hour day month weekday, or @daily, @hourly...
+	Input       string `yaml:"input"`
+	Output      string `yaml:"output"`       // default the output of the daemon
+	ProfileName string `yaml:"profile_name"` // named profile of the options, default the options of the daemon
+}
+
+// ConfigFileName user config file: ~/.config/go-comic-converter/config.yaml
+func ConfigFileName() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-comic-converter", "config.yaml")
+}
+
+// LoadUserConfig load the user config file, empty if missing.
+func LoadUserConfig() (Config, error) {
+	var config Config
+	filename := ConfigFileName()
+	if filename == "" {
+		return config, nil
+	}
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return config, err
+	}
+	defer f.Close()
+	if err = yaml.NewDecoder(f).Decode(&config); err != nil && err.Error() != "EOF" {
+		return config, fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, d := range config.Devices {
+		if d.Code == "" || d.Width <= 0 || d.Height <= 0 || d.Palette < 0 {
+			return config, fmt.Errorf("%s: device %q should have a code, a width and a height > 0, and a palette >= 0", filename, d.Code)
+		}
+	}
+	return config, nil
+}
+
+// ProfileNames sorted names of the named profiles.
+func (c Config) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(c.Profiles))
+}
+
+// applyProfileName apply the options of the named profile.
+//
+// the flags set on the command line take precedence, they are set again after the profile.
+func (c *Converter) applyProfileName() error {
+	if c.Options.ProfileName == "" {
+		return nil
+	}
+	node, ok := c.config.Profiles[c.Options.ProfileName]
+	if !ok {
+		names := c.config.ProfileNames()
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile name %q, no profiles defined in %s", c.Options.ProfileName, ConfigFileName())
+		}
+		return fmt.Errorf("unknown profile name %q, available: %s", c.Options.ProfileName, strings.Join(names, ", "))
+	}
+
+	explicit := map[string]string{}
+	c.Cmd.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	if err := node.Decode(c.Options); err != nil {
+		return fmt.Errorf("profile name %q: %w", c.Options.ProfileName, err)
+	}
+	for name, value := range explicit {
+		if err := c.Cmd.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schedules of the user config.
+func (c *Converter) Schedules() []Schedule {
+	return c.config.Schedules
+}
+
+// validateSeriesProfiles the named profiles of the series should exist.
+func (c *Converter) validateSeriesProfiles() error {
+	for _, series := range slices.Sorted(maps.Keys(c.config.SeriesProfiles)) {
+		if name := c.config.SeriesProfiles[series]; !slices.Contains(c.config.ProfileNames(), name) {
+			return fmt.Errorf("series %s: unknown profile name %q", series, name)
+		}
+	}
+	return nil
+}
+
+// validateSchedules the schedules should have a unique name, a valid cron, a directory as input and a known named profile.
+func (c *Converter) validateSchedules() error {
+	names := map[string]bool{}
+	for _, s := range c.config.Schedules {
+		if s.Name == "" || names[s.Name] {
+			return fmt.Errorf("%s: schedule %q should have a unique name", ConfigFileName(), s.Name)
+		}
+		names[s.Name] = true
+		cron, err := epubschedule.Parse(s.Cron)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", s.Name, err)
+		}
+		if cron.Next(time.Now()).IsZero() {
+			return fmt.Errorf("schedule %s: cron %q never runs", s.Name, s.Cron)
+		}
+		if fi, err := os.Stat(s.Input); err != nil || !fi.IsDir() {
+			return fmt.Errorf("schedule %s: input should be a directory: %s", s.Name, s.Input)
+		}
+		if _, ok := c.config.Profiles[s.ProfileName]; s.ProfileName != "" && !ok {
+			return fmt.Errorf("schedule %s: unknown profile name %q", s.Name, s.ProfileName)
+		}
+	}
+	return nil
+}
+
+// ScheduleConverter the converter of a run of the schedule: the command line of the daemon, with the named profile of the schedule,
+// in batch mode from its input into its output.
+func (c *Converter) ScheduleConverter(s Schedule) (*Converter, error) {
+	other, err := c.withProfileName(s.ProfileName, func(o *Options) {
+		o.Daemon, o.Metrics, o.Watch = "", "", false
+		o.Input, o.Output = s.Input, cmp.Or(s.Output, c.Options.Output)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	return other, nil
+}
+
+// SeriesProfileName the named profile of the series of the library, empty if none.
+func (c *Converter) SeriesProfileName(series string) string {
+	return c.config.SeriesProfiles[series]
+}
+
+// ProfileNameConverter the converter of the command line with the named profile.
+func (c *Converter) ProfileNameConverter(name string) (*Converter, error) {
+	return c.withProfileName(name, func(o *Options) {
+		// already downloaded
+		o.Input, o.Output = c.Options.Input, c.Options.Output
+	})
+}
+
+// withProfileName a converter of the command line with the named profile (if any) applied,
+// its options are changed by fn before being validated.
+func (c *Converter) withProfileName(name string, fn func(o *Options)) (*Converter, error) {
+	other := New()
+	if err := other.LoadConfig(); err != nil {
+		return nil, err
+	}
+	other.InitParse()
+	if err := other.Cmd.Parse(os.Args[1:]); err != nil {
+		return nil, err
+	}
+	if name != "" {
+		other.Options.ProfileName = name
+	}
+	if err := other.applyProfileName(); err != nil {
+		return nil, err
+	}
+	other.applyShortcuts()
+	fn(other.Options)
+	if err := other.Validate(); err != nil {
+		return nil, err
+	}
+	if profile := other.Options.GetProfile(); profile != nil {
+		other.Options.Image.View.Width = profile.Width
+		other.Options.Image.View.Height = profile.Height
+	}
+	return other, nil
+}
+
+// profileNamesUsage list the named profiles for the usage.
+func (c *Converter) profileNamesUsage() string {
+	names := c.config.ProfileNames()
+	if len(names) == 0 {
+		return ""
+	}
+	return "\nAvailable: " + strings.Join(names, ", ")
+}
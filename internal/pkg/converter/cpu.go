@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// cpuLimit number of cores allowed by the cpu limit: a percentage of the cores (50%) or a number of cores (2).
+//
+// 0 = unlimited, a percentage use at least 1 core.
+func (o *Options) cpuLimit() (int, error) {
+	if o.CpuLimit == "" {
+		return 0, nil
+	}
+	if pct, ok := strings.CutSuffix(o.CpuLimit, "%"); ok {
+		v, err := strconv.Atoi(pct)
+		if err != nil || v < 1 || v > 100 {
+			return 0, errors.New("cpu limit should be a percentage between 1% and 100% or a number of cores")
+		}
+		return max(1, runtime.NumCPU()*v/100), nil
+	}
+	v, err := strconv.Atoi(o.CpuLimit)
+	if err != nil || v < 1 {
+		return 0, errors.New("cpu limit should be a percentage between 1% and 100% or a number of cores")
+	}
+	return min(v, runtime.NumCPU()), nil
+}
+
+// LimitCpu apply the cpu limit and the priority, so a background conversion leave the machine usable.
+//
+// the go runtime run on the allowed cores only, and the workers are reduced accordingly.
+func (c *Converter) LimitCpu() error {
+	cores, err := c.Options.cpuLimit()
+	if err != nil {
+		return err
+	}
+	if cores > 0 {
+		runtime.GOMAXPROCS(cores)
+		c.Options.Workers = min(c.Options.Workers, cores)
+	}
+	if c.Options.Nice > 0 {
+		return utils.SetNice(c.Options.Nice)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package converter
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Recommended image settings for a device screen.
+type Recommended struct {
+	Format    string `json:"format"`
+	Quality   int    `json:"quality"`
+	GrayScale bool   `json:"grayscale"`
+}
+
+func (r Recommended) String() string {
+	s := fmt.Sprintf("%s q%d", r.Format, r.Quality)
+	if r.GrayScale {
+		s += " grayscale"
+	}
+	return s
+}
+
+// DeviceInfo a device of the listing, with the named profiles using it.
+type DeviceInfo struct {
+	Profile
+	Custom       bool        `json:"custom"` // defined in the config file
+	Recommended  Recommended `json:"recommended"`
+	ProfileNames []string    `json:"profile_names"`
+}
+
+// ProfileNameInfo a named profile of the listing, with the options it implies.
+type ProfileNameInfo struct {
+	Name    string   `json:"name"`
+	Device  string   `json:"device"`
+	Implies []string `json:"implies"` // the flags set by the profile
+}
+
+// ProfilesInfo the devices and the named profiles.
+type ProfilesInfo struct {
+	Devices      []DeviceInfo      `json:"devices"`
+	ProfileNames []ProfileNameInfo `json:"profile_names"`
+}
+
+// recommended image settings of the profile.
+//
+// the screens in grayscale (eInk) don't need the colors, the ones with few gray levels hide the artifacts of a lower quality.
+func (p Profile) recommended() Recommended {
+	r := Recommended{Format: "jpeg", Quality: 85, GrayScale: !p.Color}
+	switch {
+	case p.Color && p.Palette == 0:
+		r.Quality = 90
+	case !p.Color && p.Palette > 0 && p.Palette <= 4:
+		r.Quality = 75
+	}
+	return r
+}
+
+// ProfilesInfo list the devices, built-in and custom, sorted by code, and the named profiles of the config with the flags they set.
+func (c *Converter) ProfilesInfo() (ProfilesInfo, error) {
+	info := ProfilesInfo{
+		Devices:      make([]DeviceInfo, 0, len(c.Options.profiles)),
+		ProfileNames: make([]ProfileNameInfo, 0, len(c.config.Profiles)),
+	}
+
+	byDevice := map[string][]string{}
+	for _, name := range c.config.ProfileNames() {
+		p, err := c.profileNameInfo(name)
+		if err != nil {
+			return info, err
+		}
+		info.ProfileNames = append(info.ProfileNames, p)
+		byDevice[p.Device] = append(byDevice[p.Device], name)
+	}
+
+	custom := map[string]bool{}
+	for _, d := range c.config.Devices {
+		custom[d.Code] = true
+	}
+	for _, code := range slices.SortedFunc(maps.Keys(c.Options.profiles), func(a, b string) int {
+		return cmp.Compare(strings.ToLower(a), strings.ToLower(b))
+	}) {
+		p := c.Options.profiles[code]
+		names := byDevice[code]
+		if names == nil {
+			names = []string{}
+		}
+		info.Devices = append(info.Devices, DeviceInfo{
+			Profile:      p,
+			Custom:       custom[code],
+			Recommended:  p.recommended(),
+			ProfileNames: names,
+		})
+	}
+	return info, nil
+}
+
+// profileNameInfo apply the named profile on the built-in options, the flags changed are the ones it implies.
+func (c *Converter) profileNameInfo(name string) (ProfileNameInfo, error) {
+	builtin := New()
+	builtin.InitParse()
+	before := builtin.values()
+	node := c.config.Profiles[name]
+	if err := node.Decode(builtin.Options); err != nil {
+		return ProfileNameInfo{}, fmt.Errorf("profile name %q: %w", name, err)
+	}
+
+	p := ProfileNameInfo{Name: name, Implies: make([]string, 0)}
+	builtin.Cmd.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if value == before[f.Name] {
+			return
+		}
+		if f.Name == "profile" {
+			p.Device = value
+		}
+		switch b, ok := f.Value.(interface{ IsBoolFlag() bool }); {
+		case ok && b.IsBoolFlag() && value == "true":
+			p.Implies = append(p.Implies, "-"+f.Name)
+		case ok && b.IsBoolFlag():
+			p.Implies = append(p.Implies, "-"+f.Name+"="+value)
+		case value == "" || strings.ContainsAny(value, " \"'"):
+			p.Implies = append(p.Implies, fmt.Sprintf("-%s %q", f.Name, value))
+		default:
+			p.Implies = append(p.Implies, "-"+f.Name+" "+value)
+		}
+	})
+	return p, nil
+}
+
+// ProfilesInfoString the devices and the named profiles as tables.
+func ProfilesInfoString(info ProfilesInfo) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CODE\tDEVICE\tRESOLUTION\tSCREEN\tRECOMMENDED\tPROFILE NAMES")
+	for _, d := range info.Devices {
+		screen := strings.TrimPrefix(d.screen(), " - ")
+		if screen == "" {
+			screen = "-"
+		}
+		description := d.Description
+		if d.Custom {
+			description += " (custom)"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%dx%d\t%s\t%s\t%s\n",
+			d.Code, description, d.Width, d.Height, screen, d.Recommended, cmp.Or(strings.Join(d.ProfileNames, ", "), "-"),
+		)
+	}
+	_ = w.Flush()
+
+	if len(info.ProfileNames) > 0 {
+		b.WriteString("\n")
+		w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "PROFILE NAME\tDEVICE\tIMPLIES")
+		for _, p := range info.ProfileNames {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, cmp.Or(p.Device, "-"), strings.Join(p.Implies, " "))
+		}
+		_ = w.Flush()
+	}
+	return b.String()
+}
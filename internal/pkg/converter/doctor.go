@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubcalibre"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagejpeg"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// DoctorItem a line of the doctor report.
+type DoctorItem struct {
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Ok      bool   `json:"ok"` // false if missing, some inputs or options won't work
+}
+
+// Doctor report the environment of the conversion: the system, the codecs, the external tools and the config files.
+//
+// the values are the effective ones, with the default config and the command line applied.
+func (c *Converter) Doctor() []DoctorItem {
+	items := make([]DoctorItem, 0)
+	add := func(section, name, value string, ok bool) {
+		items = append(items, DoctorItem{section, name, value, ok})
+	}
+
+	// system
+	version := "unknown"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		version = bi.Main.Version
+	}
+	add("System", "Version", version, true)
+	add("System", "Go", fmt.Sprintf("%s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH), true)
+	add("System", "CPU", fmt.Sprintf("%d cores", runtime.NumCPU()), true)
+	if mem := utils.AvailableMemoryMb(); mem > 0 {
+		add("System", "Available memory", fmt.Sprintf("%d Mb", mem), true)
+	} else {
+		add("System", "Available memory", "unknown (linux only)", true)
+	}
+
+	// defaults
+	workers := c.Options.Workers
+	if cores, err := c.Options.cpuLimit(); err == nil && cores > 0 {
+		workers = min(workers, cores)
+	}
+	add("Conversion", "Workers", utils.IntToString(workers), true)
+	switch {
+	case c.Options.MaxMemory < 0:
+		add("Conversion", "Max memory", "unlimited", true)
+	case c.Options.MaxMemory > 0:
+		add("Conversion", "Max memory", fmt.Sprintf("%d Mb", c.Options.MaxMemory), true)
+	case utils.AvailableMemoryMb() > 0:
+		add("Conversion", "Max memory", fmt.Sprintf("%d Mb (auto)", utils.AvailableMemoryMb()*3/4), true)
+	default:
+		add("Conversion", "Max memory", "unlimited (auto, available memory unknown)", true)
+	}
+
+	// codecs, all built-in except the native jpeg and the videos
+	add("Codecs", "Images", "jpeg, png, webp, tiff, gif (built-in)", true)
+	add("Codecs", "Archives", "zip, cbz, rar, cbr, pdf, directory (built-in)", true)
+	if epubimagejpeg.Available(epubimagejpeg.LibJpeg) {
+		add("Codecs", "JPEG backend", "go, libjpeg", true)
+	} else {
+		add("Codecs", "JPEG backend", "go (libjpeg require a build with cgo and -tags libjpeg)", false)
+	}
+	if cwebp, err := exec.LookPath("cwebp"); err == nil {
+		add("Tools", "cwebp", cwebp, true)
+	} else {
+		add("Tools", "cwebp", "not found, the webp images are only lossless", false)
+	}
+	if avifenc, err := exec.LookPath("avifenc"); err == nil {
+		add("Tools", "avifenc", avifenc, true)
+	} else {
+		add("Tools", "avifenc", "not found, the avif format is not available", false)
+	}
+	if ffmpeg, err := exec.LookPath("ffmpeg"); err == nil {
+		add("Tools", "ffmpeg", ffmpeg, true)
+	} else {
+		add("Tools", "ffmpeg", "not found, the video pages (mp4, webm) are replaced by an error page", false)
+	}
+	if calibredb, err := epubcalibre.Command(); err == nil {
+		add("Tools", "calibredb", calibredb, true)
+	} else {
+		add("Tools", "calibredb", "not found, -calibre is not available", false)
+	}
+	if sqlite3, err := exec.LookPath("sqlite3"); err == nil {
+		add("Tools", "sqlite3", sqlite3, true)
+	} else {
+		add("Tools", "sqlite3", "not found, -kobo-collections is not available", false)
+	}
+
+	// files
+	for _, f := range []struct {
+		name, path string
+	}{
+		{"Default config", c.Options.FileName()},
+		{"User config", ConfigFileName()},
+	} {
+		if _, err := os.Stat(f.path); err == nil {
+			add("Files", f.name, f.path, true)
+		} else {
+			add("Files", f.name, f.path+" (missing)", true)
+		}
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		add("Files", "Cache", dir, true)
+	} else {
+		add("Files", "Cache", err.Error(), false)
+	}
+	return items
+}
+
+// DoctorString format the report by section.
+func DoctorString(items []DoctorItem) string {
+	var b strings.Builder
+	b.WriteString("Go Comic Converter\n")
+	section := ""
+	for _, item := range items {
+		if item.Section != section {
+			section = item.Section
+			b.WriteString("\n" + section + ":\n")
+		}
+		status := "ok"
+		if !item.Ok {
+			status = "!!"
+		}
+		_, _ = fmt.Fprintf(&b, "    [%s] %-27s: %s\n", status, item.Name, item.Value)
+	}
+	return b.String()
+}
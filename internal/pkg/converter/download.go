@@ -0,0 +1,46 @@
+package converter
+
+import (
+	"errors"
+	"os"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubdownload"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// Download the input if it is an url, the input become the downloaded file.
+//
+// the file is downloaded into the temp dir, and the default output is the current directory.
+// return the path of the downloaded file, to remove after the conversion, empty if the input is not an url.
+func (c *Converter) Download() (downloaded string, err error) {
+	if !epubdownload.IsURL(c.Options.Input) {
+		return
+	}
+	if c.Options.Batch {
+		return "", utils.WithExitCode(errors.New("batch mode need a directory as input"), utils.ExitUsage)
+	}
+	if c.Options.DownloadRateLimit < 0 {
+		return "", utils.WithExitCode(errors.New("download rate limit should be 0 or > 0"), utils.ExitUsage)
+	}
+	if c.Options.DownloadRetries < 0 {
+		return "", utils.WithExitCode(errors.New("download retries should be 0 or > 0"), utils.ExitUsage)
+	}
+
+	dir := c.Options.TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if downloaded, err = epubdownload.Download(c.Options.Input, dir, epubdownload.Options{
+		RateLimit: c.Options.DownloadRateLimit * 1024,
+		Retries:   c.Options.DownloadRetries,
+		Quiet:     c.Options.Quiet || c.Options.Json,
+	}); err != nil {
+		return "", utils.WithExitCode(err, utils.ExitInput)
+	}
+
+	c.Options.DownloadURL, c.Options.Input = c.Options.Input, downloaded
+	if c.Options.Output == "" {
+		c.Options.Output = "."
+	}
+	return
+}
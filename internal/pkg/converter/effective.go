@@ -0,0 +1,73 @@
+package converter
+
+import (
+	"encoding/json"
+	"flag"
+)
+
+// sources of the settings, from the lowest to the highest precedence
+const (
+	sourceDefault     = "default"
+	sourceConfig      = "config"
+	sourceRerun       = "rerun"
+	sourceProfileName = "profile-name"
+	sourceShortcut    = "shortcut"
+	sourceCommandLine = "command line"
+)
+
+// values of the flags.
+func (c *Converter) values() map[string]string {
+	values := map[string]string{}
+	c.Cmd.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// trackSources record where the value of each flag come from, comparing the values after each step of the parsing.
+//
+// the steps are: the built-in defaults, the default config, then the values after the rerun, the named profile
+// and the shortcuts. The flags set on the command line take precedence.
+func (c *Converter) trackSources(rerun, profileName, shortcuts map[string]string) {
+	builtin := New()
+	builtin.InitParse()
+
+	explicit := map[string]bool{}
+	c.Cmd.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	c.sources = map[string]string{}
+	c.Cmd.VisitAll(func(f *flag.Flag) {
+		var source string
+		switch {
+		case explicit[f.Name]:
+			source = sourceCommandLine
+		case shortcuts[f.Name] != profileName[f.Name]:
+			source = sourceShortcut
+		case profileName[f.Name] != rerun[f.Name]:
+			source = sourceProfileName
+		case rerun[f.Name] != f.DefValue:
+			source = sourceRerun
+		case f.DefValue != builtin.Cmd.Lookup(f.Name).DefValue:
+			source = sourceConfig
+		default:
+			return
+		}
+		c.sources[f.Name] = source
+	})
+}
+
+// EffectiveConfig the options once merged (defaults, default config, rerun, named profile, shortcuts and command line),
+// with the source of the settings that are not the default ones.
+func (c *Converter) EffectiveConfig() ([]byte, error) {
+	o := *c.Options
+	if profile := o.GetProfile(); profile != nil {
+		o.Image.View.Width = profile.Width
+		o.Image.View.Height = profile.Height
+	}
+	return json.MarshalIndent(map[string]any{
+		"options": o,
+		"sources": c.sources,
+	}, "", "  ")
+}
@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maximum size of a document sent to a Kindle with the Send to Kindle website, and with the app or by email
+// (50 Mb including the encoding of the email, so 40 Mb for the EPUB)
+const (
+	sendToKindleWebsiteMb = 200
+	sendToKindleEmailMb   = 40
+)
+
+// isKindle the profile is a Kindle device, not a Kobo.
+func (p Profile) isKindle() bool {
+	return strings.HasPrefix(p.Code, "K") && !strings.HasPrefix(p.Code, "Ko")
+}
+
+// EstimateLimits the number of parts of an EPUB of this size, and the limits exceeded by the parts.
+//
+// the EPUB is split by -limitmb, each part is checked against the limits of Send to Kindle if the profile is a Kindle.
+func (o *Options) EstimateLimits(size int64) (parts int, warnings []string) {
+	sizeMb := float64(size) / 1024 / 1024
+	parts, partMb := 1, sizeMb
+	if o.LimitMb > 0 && sizeMb > float64(o.LimitMb) {
+		parts = int(math.Ceil(sizeMb / float64(o.LimitMb)))
+		partMb = float64(o.LimitMb)
+	}
+	warnings = make([]string, 0)
+
+	if p := o.GetProfile(); p == nil || !p.isKindle() {
+		return
+	}
+	switch {
+	case partMb > sendToKindleWebsiteMb:
+		warnings = append(warnings, fmt.Sprintf("the EPUB of %.0f Mb exceed the %d Mb of the Send to Kindle website, split it with -limitmb %d", partMb, sendToKindleWebsiteMb, sendToKindleWebsiteMb))
+	case partMb > sendToKindleEmailMb:
+		warnings = append(warnings, fmt.Sprintf("the EPUB of %.0f Mb exceed the 50 Mb of Send to Kindle by email or app, split it with -limitmb %d", partMb, sendToKindleEmailMb))
+	}
+	return
+}
@@ -0,0 +1,278 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kccDevices the presets of KCC with another code or missing here, added as custom devices when imported.
+var kccDevices = map[string]Profile{
+	"K810":  {Code: "K578"},
+	"Rmk1":  {Code: "RM1"},
+	"Rmk2":  {Code: "RM2"},
+	"RmkPP": {Code: "RMP"},
+	"KCS":   {Code: "KCS", Description: "Kindle Colorsoft", Width: 1264, Height: 1680, Palette: 4096, Color: true},
+	"KoCC":  {Code: "KoCC", Description: "Kobo Clara Colour", Width: 1072, Height: 1448, Palette: 4096, Color: true},
+	"KoLC":  {Code: "KoLC", Description: "Kobo Libra Colour", Width: 1264, Height: 1680, Palette: 4096, Color: true},
+}
+
+// KCCImport the named profile and the device mapped from the options of KCC.
+type KCCImport struct {
+	Profile map[string]any // the options of the named profile, in the format of the config
+	Device  *Profile       // the custom device to add, if any
+	Ignored []string       // the options of KCC without equivalent
+}
+
+// ImportKCC map a command line of KCC (kcc-c2e, comic2ebook) onto the options, the source is the command line or a file with it.
+//
+// the defaults of KCC are applied too: the double pages are split and the margins cropped unless disabled.
+func ImportKCC(source string) (KCCImport, error) {
+	if b, err := os.ReadFile(source); err == nil {
+		source = string(b)
+	}
+	args, err := splitArgs(source)
+	if err != nil {
+		return KCCImport{}, err
+	}
+
+	r := KCCImport{}
+	image := map[string]any{}
+	epub := map[string]any{"image": image}
+	r.Profile = map[string]any{"epuboptions": epub}
+
+	splitter, cropping := "0", "2"
+	var device string
+	var width, height int
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		next := func() string {
+			if hasValue {
+				return value
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch name {
+		case "-p", "--profile":
+			device = next()
+		case "-m", "--manga-style", "--mangastyle":
+			image["manga"] = true
+		case "-w", "--webtoon":
+			image["webtoon"] = true
+		case "-r", "--splitter":
+			splitter = next()
+		case "-c", "--cropping":
+			cropping = next()
+		case "--forcecolor":
+			image["grayscale"] = false
+		case "--forcepng":
+			image["format"] = "png"
+		case "-n", "--noprocessing":
+			image["format"] = "copy"
+		case "--blackborders":
+			image["view"] = map[string]any{"color": map[string]any{"background": "000"}}
+		case "--whiteborders":
+			image["view"] = map[string]any{"color": map[string]any{"background": "FFF"}}
+		case "--autolevel":
+			image["auto_levels"] = true
+		case "--ts", "--targetsize":
+			if mb, err := strconv.Atoi(next()); err == nil && mb >= 20 {
+				epub["limit_mb"] = mb
+			}
+		case "--customwidth":
+			width, _ = strconv.Atoi(next())
+		case "--customheight":
+			height, _ = strconv.Atoi(next())
+		case "-u", "--upscale", "-s", "--stretch", "-q", "--hq", "-2", "--two-panel", "--mozjpeg", "--maximizestrips", "--norotate", "--rotatefirst":
+			r.Ignored = append(r.Ignored, name)
+		case "-g", "--gamma", "--cp", "--croppingpower", "--preservemargin", "-f", "--format", "-b", "--batchsplit", "-o", "--output", "-t", "--title", "-a", "--author":
+			r.Ignored = append(r.Ignored, name+" "+next())
+		default:
+			// the program and the inputs
+			if strings.HasPrefix(arg, "-") {
+				r.Ignored = append(r.Ignored, arg)
+			}
+		}
+	}
+
+	// 0 = split, 1 = rotate, 2 = rotate and split
+	switch splitter {
+	case "0":
+		image["auto_split_double_page"], image["keep_double_page_if_split"] = true, false
+	case "1":
+		image["auto_rotate"] = true
+	case "2":
+		image["auto_split_double_page"], image["keep_double_page_if_split"] = true, true
+	default:
+		return r, fmt.Errorf("kcc splitter should be 0, 1 or 2, got %q", splitter)
+	}
+	// 0 = disabled, 1 = margins, 2 = margins and page numbers
+	image["crop"] = map[string]any{"enabled": cropping != "0"}
+
+	switch d, ok := kccDevices[device]; {
+	case device == "":
+		return r, errors.New("kcc profile missing (-p)")
+	case device == "OTHER":
+		if width <= 0 || height <= 0 {
+			return r, errors.New("kcc profile OTHER require --customwidth and --customheight")
+		}
+		r.Device = &Profile{Code: "KCC" + strconv.Itoa(width) + "x" + strconv.Itoa(height), Description: "KCC custom", Width: width, Height: height}
+	case ok && d.Width > 0:
+		r.Device = &d
+	case ok:
+		r.Profile["profile"] = d.Code
+	default:
+		if _, ok := NewProfiles()[device]; !ok {
+			return r, fmt.Errorf("unknown kcc profile %q", device)
+		}
+		r.Profile["profile"] = device
+	}
+	if r.Device != nil {
+		r.Profile["profile"] = r.Device.Code
+	}
+	return r, nil
+}
+
+// splitArgs split the command line like a shell, with the quotes and the backslashes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			if c != '\n' {
+				cur.WriteRune(c)
+				inArg = true
+			}
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in the kcc command line")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// SaveProfileName write the named profile, and the custom device if any, into the user config file.
+//
+// the other profiles, the devices and the comments of the file are kept.
+func SaveProfileName(name string, profile map[string]any, device *Profile) error {
+	filename := ConfigFileName()
+	if filename == "" {
+		return errors.New("no user config directory")
+	}
+	var doc yaml.Node
+	if b, err := os.ReadFile(filename); err == nil {
+		if err = yaml.Unmarshal(b, &doc); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: should be a mapping", filename)
+	}
+
+	var value yaml.Node
+	if err := value.Encode(profile); err != nil {
+		return err
+	}
+	setKey(mappingKey(root, "profiles", yaml.MappingNode), name, &value)
+
+	if device != nil {
+		devices := mappingKey(root, "devices", yaml.SequenceNode)
+		var d yaml.Node
+		if err := d.Encode(device); err != nil {
+			return err
+		}
+		devices.Content = slices.DeleteFunc(devices.Content, func(n *yaml.Node) bool {
+			var p Profile
+			return n.Decode(&p) == nil && p.Code == device.Code
+		})
+		devices.Content = append(devices.Content, &d)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(f)
+	enc.SetIndent(2)
+	if err = enc.Encode(&doc); err == nil {
+		err = enc.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// mappingKey the value of the key of the mapping, added with the kind if missing.
+func mappingKey(m *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			if v := m.Content[i+1]; v.Kind == kind {
+				return v
+			}
+			m.Content[i+1] = &yaml.Node{Kind: kind}
+			return m.Content[i+1]
+		}
+	}
+	v := &yaml.Node{Kind: kind}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+	return v
+}
+
+// setKey set the value of the key of the mapping.
+func setKey(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
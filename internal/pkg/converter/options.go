@@ -3,12 +3,15 @@ package converter
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubdownload"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
 	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
@@ -16,13 +19,47 @@ import (
 type Options struct {
 	epuboptions.EPUBOptions
 
+	// Output
+	Batch          bool   `yaml:"-" json:"-"`
+	BatchWorkers   int    `yaml:"-" json:"-"`
+	BatchName      string `yaml:"-" json:"-"`
+	BatchMirror    bool   `yaml:"-" json:"-"`
+	BatchComicInfo bool   `yaml:"-" json:"-"`
+	Library        bool   `yaml:"-" json:"-"`
+	Watch          bool   `yaml:"-" json:"-"`
+	Queue          string `yaml:"-" json:"-"` // file of the jobs, - for the standard input
+	Daemon         string `yaml:"-" json:"-"` // spool directory of the persisted jobs
+	DaemonRetries  int    `yaml:"-" json:"-"`
+	WatchDebounce  int    `yaml:"-" json:"-"` // seconds
+	Serve          string `yaml:"-" json:"-"` // address of the server mode
+	UI             bool   `yaml:"-" json:"-"`
+	API            bool   `yaml:"-" json:"-"`
+	APIToken       string `yaml:"-" json:"-"` // bearer token of the api, or GO_COMIC_CONVERTER_API_TOKEN
+	ServeKeep      int    `yaml:"-" json:"-"` // finished jobs kept by the server
+	OPDS           string `yaml:"-" json:"-"` // directory of the archives of the OPDS catalog
+	Metrics        string `yaml:"-" json:"-"` // address of the prometheus metrics
+
+	// Download
+	DownloadRateLimit int    `yaml:"download_rate_limit" json:"download_rate_limit"` // KiB/s, 0 = unlimited
+	DownloadRetries   int    `yaml:"download_retries" json:"download_retries"`
+	DownloadURL       string `yaml:"-" json:"-"` // url of the input, once downloaded
+
+	// Cpu
+	CpuLimit string `yaml:"cpu_limit" json:"cpu_limit"` // percentage of the cores or number of cores, empty = unlimited
+	Nice     int    `yaml:"nice" json:"nice"`
+
 	// Config
-	Profile string `yaml:"profile" json:"profile"`
+	Profile     string `yaml:"profile" json:"profile"`
+	ProfileName string `yaml:"-" json:"profile_name,omitempty"`
+	Rerun       string `yaml:"-" json:"rerun,omitempty"`
+	Profiles    bool   `yaml:"-" json:"-"`
 
 	// Default Config
-	Show  bool `yaml:"-" json:"-"`
-	Save  bool `yaml:"-" json:"-"`
-	Reset bool `yaml:"-" json:"-"`
+	Show          bool   `yaml:"-" json:"-"`
+	ShowEffective bool   `yaml:"-" json:"-"`
+	Save          bool   `yaml:"-" json:"-"`
+	Reset         bool   `yaml:"-" json:"-"`
+	ImportKCC     string `yaml:"-" json:"-"` // command line of KCC, or a file with it
 
 	// Shortcut
 	Auto         bool `yaml:"-" json:"-"`
@@ -33,8 +70,35 @@ type Options struct {
 	GoodQuality  bool `yaml:"-" json:"-"`
 
 	// Other
-	Version bool `yaml:"-" json:"-"`
-	Help    bool `yaml:"-" json:"-"`
+	Version      bool   `yaml:"-" json:"-"`
+	Doctor       bool   `yaml:"-" json:"-"`
+	Clean        bool   `yaml:"-" json:"-"`
+	CleanOutputs bool   `yaml:"-" json:"-"`
+	Help         bool   `yaml:"-" json:"-"`
+	PprofCpu     string `yaml:"-" json:"-"`
+	PprofMem     string `yaml:"-" json:"-"`
+	PprofTrace   string `yaml:"-" json:"-"`
+
+	// Preview
+	Preview      string `yaml:"-" json:"-"`
+	PreviewPages int    `yaml:"-" json:"-"`
+	Compare      string `yaml:"-" json:"-"`
+	Estimate     bool   `yaml:"-" json:"-"`
+
+	// Yes confirm the destructive actions without asking
+	Yes bool `yaml:"-" json:"-"`
+
+	// Lang of the messages, empty to detect it from the locale
+	Lang string `yaml:"-" json:"-"`
+
+	// Log
+	Verbose     bool   `yaml:"-" json:"-"`
+	VeryVerbose bool   `yaml:"-" json:"-"`
+	LogFile     string `yaml:"-" json:"-"`
+
+	// Summary of the conversions at the end of the run
+	Summary     bool   `yaml:"-" json:"-"`
+	SummaryFile string `yaml:"-" json:"-"`
 
 	// Internal
 	profiles Profiles
@@ -65,13 +129,29 @@ func NewOptions() *Options {
 						Background: "FFF",
 					},
 				},
-				Resize: true,
-				Format: "jpeg",
+				Border: epuboptions.Border{
+					Color: "000",
+				},
+				Resize:         true,
+				Format:         "jpeg",
+				AvifSpeed:      6,
+				DitherMatrix:   4,
+				ColorProfile:   true,
+				ToneMap:        true,
+				AutoLevelsClip: 0.5,
+				Backend:        "gift",
+				JpegBackend:    "go",
+				TileThreshold:  100,
+				MaxMegapixels:  400,
+				MaxDimension:   50000,
 			},
-			TitlePage:    1,
-			SortPathMode: 1,
+			TitlePage:     1,
+			SortPathMode:  1,
+			OutputFormat:  epuboptions.OutputEPUB,
+			UploadRetries: 5,
 		},
-		profiles: NewProfiles(),
+		DownloadRetries: 5,
+		profiles:        NewProfiles(),
 	}
 }
 
@@ -82,14 +162,29 @@ func (o *Options) Header() string {
 func (o *Options) String() string {
 	var b strings.Builder
 	b.WriteString(o.Header())
+	output := o.Output
+	if o.Mihon {
+		output = o.MihonChapter() + " (mihon)"
+	}
+	switch o.OutputFormat {
+	case epuboptions.OutputKEPUB:
+		output = o.EPUBOutput()
+	case epuboptions.OutputAZW3, epuboptions.OutputMOBI:
+		output = strings.TrimSuffix(o.Output, filepath.Ext(o.Output)) + "." + o.OutputFormat
+	case epuboptions.OutputCBZ:
+		output = o.CBZOutput()
+	case epuboptions.OutputBoth:
+		output += ", " + o.CBZOutput()
+	}
 	for _, v := range []struct {
 		K string
 		V any
 	}{
 		{"Input", o.Input},
-		{"Output", o.Output},
+		{"Output", output},
 		{"Author", o.Author},
 		{"Title", o.Title},
+		{"Overrides", o.Overrides},
 		{"Workers", o.Workers},
 	} {
 		b.WriteString(fmt.Sprintf("\n    %-32s: %v", v.K, v.V))
@@ -169,6 +264,47 @@ func (o *Options) ShowConfig() string {
 		grayscaleMode = "luminance"
 	}
 
+	ditherMode := "error diffusion"
+	if o.Image.DitherMode == 1 {
+		ditherMode = "ordered " + utils.IntToString(o.Image.DitherMatrix) + "x" + utils.IntToString(o.Image.DitherMatrix)
+	}
+
+	splitParts := "auto"
+	if o.Image.SplitParts >= 2 {
+		splitParts = utils.IntToString(o.Image.SplitParts)
+	}
+
+	maxMemory := "auto"
+	if o.MaxMemory > 0 {
+		maxMemory = utils.IntToString(o.MaxMemory) + " Mb"
+	} else if o.MaxMemory < 0 {
+		maxMemory = "unlimited"
+	}
+
+	// the download rows only matter for an url input, or a limit set in the default settings
+	download := o.DownloadURL != "" || epubdownload.IsURL(o.Input) || o.DownloadRateLimit > 0
+	downloadRateLimit := "unlimited"
+	if o.DownloadRateLimit > 0 {
+		downloadRateLimit = utils.IntToString(o.DownloadRateLimit) + " KiB/s"
+	}
+
+	// the password of a content server is not displayed
+	calibre := o.Calibre
+	if u, err := url.Parse(calibre); err == nil && u.User != nil {
+		calibre = u.Redacted()
+	}
+
+	maxImageSize := make([]string, 0, 2)
+	if o.Image.MaxMegapixels > 0 {
+		maxImageSize = append(maxImageSize, utils.IntToString(o.Image.MaxMegapixels)+" MP")
+	}
+	if o.Image.MaxDimension > 0 {
+		maxImageSize = append(maxImageSize, utils.IntToString(o.Image.MaxDimension)+" px")
+	}
+	if len(maxImageSize) == 0 {
+		maxImageSize = append(maxImageSize, "unlimited")
+	}
+
 	var b strings.Builder
 	for _, v := range []struct {
 		Key       string
@@ -177,9 +313,13 @@ func (o *Options) ShowConfig() string {
 	}{
 		{"Profile", profileDesc, true},
 		{"Format", o.Image.Format, true},
-		{"Quality", o.Image.Quality, o.Image.Format == "jpeg"},
+		{"Quality", o.Image.Quality, o.Image.Format == "jpeg" || (o.Image.Format == "webp" && !o.Image.WebpLossless) || o.Image.Format == "avif"},
+		{"WebP lossless", o.Image.WebpLossless, o.Image.Format == "webp"},
+		{"AVIF speed", o.Image.AvifSpeed, o.Image.Format == "avif"},
 		{"Grayscale", o.Image.GrayScale, o.Image.Format != "copy"},
 		{"Grayscale mode", grayscaleMode, o.Image.Format != "copy" && o.Image.GrayScale},
+		{"Dither", o.Image.Dither, o.Image.Format != "copy" && o.Image.GrayScale},
+		{"Dither mode", ditherMode, o.Image.Format != "copy" && o.Image.GrayScale && o.Image.Dither},
 		{"Crop", o.Image.Crop.Enabled, o.Image.Format != "copy"},
 		{"Crop ratio",
 			utils.IntToString(o.Image.Crop.Left) + " Left - " +
@@ -187,28 +327,61 @@ func (o *Options) ShowConfig() string {
 				utils.IntToString(o.Image.Crop.Right) + " Right - " +
 				utils.IntToString(o.Image.Crop.Bottom) + " Bottom - " +
 				"Limit " + utils.IntToString(o.Image.Crop.Limit) + "% - " +
-				"Skip " + utils.BoolToString(o.Image.Crop.SkipIfLimitReached),
+				"Skip " + utils.BoolToString(o.Image.Crop.SkipIfLimitReached) + " - " +
+				"Safe area " + utils.IntToString(o.Image.Crop.SafeArea) + "%",
 			o.Image.Format != "copy" && o.Image.Crop.Enabled},
 		{"Brightness", o.Image.Brightness, o.Image.Format != "copy" && o.Image.Brightness != 0},
 		{"Contrast", o.Image.Contrast, o.Image.Format != "copy" && o.Image.Contrast != 0},
 		{"Auto contrast", o.Image.AutoContrast, o.Image.Format != "copy"},
+		{"Auto levels", o.Image.AutoLevels, o.Image.Format != "copy"},
+		{"Auto levels clip", utils.FloatToString(o.Image.AutoLevelsClip, 2) + "%", o.Image.Format != "copy" && o.Image.AutoLevels},
+		{"Despeckle", utils.IntToString(o.Image.Despeckle) + " px", o.Image.Format != "copy" && o.Image.Despeckle > 0},
+		{"Image hook", o.Image.Hook, o.Image.Format != "copy" && o.Image.Hook != ""},
 		{"Auto rotate", o.Image.AutoRotate, o.Image.Format != "copy"},
 		{"Auto split double page", o.Image.AutoSplitDoublePage, o.Image.Format != "copy" && (o.Image.View.PortraitOnly || !o.Image.AppleBookCompatibility)},
+		{"Split parts", splitParts, o.Image.Format != "copy" && (o.Image.View.PortraitOnly || !o.Image.AppleBookCompatibility) && o.Image.AutoSplitDoublePage},
 		{"Keep double page if split", o.Image.KeepDoublePageIfSplit, o.Image.Format != "copy" && (o.Image.View.PortraitOnly || !o.Image.AppleBookCompatibility) && o.Image.AutoSplitDoublePage},
 		{"Keep split double page aspect", o.Image.KeepSplitDoublePageAspect, o.Image.Format != "copy" && (o.Image.View.PortraitOnly || !o.Image.AppleBookCompatibility) && o.Image.AutoSplitDoublePage},
 		{"No blank image", o.Image.NoBlankImage, o.Image.Format != "copy"},
+		{"Animation badge", o.Image.AnimationBadge, o.Image.Format != "copy"},
 		{"Manga", o.Image.Manga, true},
+		{"Webtoon", o.Image.Webtoon, o.Image.Format != "copy"},
 		{"Has cover", o.Image.HasCover, true},
 		{"Limit", utils.IntToString(o.LimitMb) + " Mb", o.LimitMb != 0},
 		{"Strip first directory from toc", o.StripFirstDirectoryFromToc, true},
 		{"Sort path mode", sortpathmode, true},
 		{"Foreground color", "#" + o.Image.View.Color.Foreground, true},
 		{"Background color", "#" + o.Image.View.Color.Background, true},
+		{"Border", utils.IntToString(o.Image.Border.Width) + "px #" + o.Image.Border.Color, o.Image.Format != "copy" && o.Image.Border.Width > 0},
 		{"Resize", o.Image.Resize, o.Image.Format != "copy"},
+		{"Color profile", o.Image.ColorProfile, o.Image.Format != "copy"},
+		{"Embed sRGB", o.Image.EmbedSRGB, o.Image.Format == "jpeg"},
+		{"Tone map", o.Image.ToneMap, o.Image.Format != "copy"},
+		{"Tone map clip", utils.FloatToString(o.Image.ToneMapClip, 2) + "%", o.Image.Format != "copy" && o.Image.ToneMap},
+		{"Copy unchanged", o.Image.CopyUnchanged, o.Image.Format != "copy"},
 		{"Aspect ratio", aspectRatio, true},
 		{"Portrait only", o.Image.View.PortraitOnly, true},
 		{"Title page", titlePage, true},
 		{"Apple book compatibility", o.Image.AppleBookCompatibility, !o.Image.View.PortraitOnly},
+		{"Backend", o.Image.Backend, o.Image.Format != "copy"},
+		{"JPEG backend", o.Image.JpegBackend, o.Image.Format != "copy"},
+		{"Max image size", strings.Join(maxImageSize, " - "), o.Image.Format != "copy"},
+		{"Tile threshold", utils.IntToString(o.Image.TileThreshold) + " MP", o.Image.Format != "copy" && o.Image.Resize && o.Image.TileThreshold > 0},
+		{"Cache dir", o.CacheDir, o.CacheDir != "" && o.Image.Format != "copy" && o.Image.Hook == ""},
+		{"Temp dir", o.TempDir, o.TempDir != ""},
+		{"Output format", o.OutputFormat, true},
+		{"Post hook", o.PostHook, o.PostHook != ""},
+		{"Calibre", calibre, o.Calibre != ""},
+		{"Kobo", o.Kobo, o.Kobo != ""},
+		{"Kobo collections", o.KoboCollections, o.Kobo != ""},
+		{"Kindle", o.KindleMount, o.KindleMount != ""},
+		{"Upload", o.Upload, o.Upload != ""},
+		{"Upload retries", o.UploadRetries, o.Upload != ""},
+		{"Download rate limit", downloadRateLimit, download},
+		{"Download retries", o.DownloadRetries, download},
+		{"Max memory", maxMemory, o.Image.Format != "copy"},
+		{"Cpu limit", o.CpuLimit, o.CpuLimit != ""},
+		{"Nice", o.Nice, o.Nice > 0},
 	} {
 		if v.Condition {
 			b.WriteString(fmt.Sprintf("\n    %-32s: %v", v.Key, v.Value))
@@ -225,6 +398,42 @@ func (o *Options) ResetConfig() error {
 	return o.LoadConfig()
 }
 
+// ExistingOutputs the files the conversion would overwrite: the output, or its parts if split, and the CBZ.
+func (o *Options) ExistingOutputs() []string {
+	outputs := make([]string, 0)
+	if o.Mihon {
+		if _, err := os.Stat(o.MihonChapter()); err == nil {
+			outputs = append(outputs, o.MihonChapter())
+		}
+		return outputs
+	}
+	if o.HasCBZ() {
+		if _, err := os.Stat(o.CBZOutput()); err == nil {
+			outputs = append(outputs, o.CBZOutput())
+		}
+		if !o.HasEPUB() {
+			return outputs
+		}
+	}
+	output, ext := o.EPUBOutput(), o.EPUBExt()
+	if o.Kindle() {
+		ext = "." + o.OutputFormat
+		output = strings.TrimSuffix(o.Output, filepath.Ext(o.Output)) + ext
+	}
+	if _, err := os.Stat(output); err == nil {
+		outputs = append(outputs, output)
+	}
+	dir, name := filepath.Split(output)
+	part := regexp.MustCompile("^" + regexp.QuoteMeta(name[:len(name)-len(ext)]) + ` Part \d+ of \d+` + regexp.QuoteMeta(ext) + "$")
+	entries, _ := os.ReadDir(filepath.Clean(dir))
+	for _, entry := range entries {
+		if part.MatchString(entry.Name()) {
+			outputs = append(outputs, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return outputs
+}
+
 // SaveConfig save all current settings as default value
 func (o *Options) SaveConfig() error {
 	f, err := os.Create(o.FileName())
@@ -239,7 +448,12 @@ func (o *Options) SaveConfig() error {
 
 // GetProfile shortcut to get current profile
 func (o *Options) GetProfile() *Profile {
-	if p, ok := o.profiles[o.Profile]; ok {
+	return o.LookupProfile(o.Profile)
+}
+
+// LookupProfile get the profile by its code, built-in or user device
+func (o *Options) LookupProfile(code string) *Profile {
+	if p, ok := o.profiles[code]; ok {
 		return &p
 	}
 	return nil
@@ -9,14 +9,34 @@ import (
 )
 
 type Profile struct {
-	Code        string `json:"code"`
-	Description string `json:"description"`
-	Width       int    `json:"width"`
-	Height      int    `json:"height"`
+	Code        string `yaml:"code" json:"code"`
+	Description string `yaml:"description" json:"description"`
+	Width       int    `yaml:"width" json:"width"`
+	Height      int    `yaml:"height" json:"height"`
+	Palette     int    `yaml:"palette" json:"palette,omitempty"` // number of gray levels or colors of the screen, 0 = unknown
+	Color       bool   `yaml:"color" json:"color,omitempty"`
 }
 
 func (p Profile) String() string {
-	return p.Code + " - " + p.Description + " - " + utils.IntToString(p.Width) + "x" + utils.IntToString(p.Height)
+	return p.Code + " - " + p.Description + " - " + utils.IntToString(p.Width) + "x" + utils.IntToString(p.Height) + p.screen()
+}
+
+// screen description of the palette and the color capability, if known
+func (p Profile) screen() string {
+	var s []string
+	if p.Palette > 0 {
+		if p.Color {
+			s = append(s, utils.IntToString(p.Palette)+" colors")
+		} else {
+			s = append(s, utils.IntToString(p.Palette)+" grays")
+		}
+	} else if p.Color {
+		s = append(s, "color")
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	return " - " + strings.Join(s, ", ")
 }
 
 type Profiles map[string]Profile
@@ -24,54 +44,67 @@ type Profiles map[string]Profile
 // NewProfiles Initialize list of all supported profiles.
 func NewProfiles() Profiles {
 	res := make(Profiles)
-	for _, r := range []Profile{
+	for _, r := range []struct {
+		Code, Description string
+		Width, Height     int
+		Palette           int
+		Color             bool
+	}{
 		// High Resolution for Tablet
-		{"HR", "High Resolution", 2400, 3840},
-		{"SR", "Standard Resolution", 1200, 1920},
+		{"HR", "High Resolution", 2400, 3840, 0, true},
+		{"SR", "Standard Resolution", 1200, 1920, 0, true},
 		//Kindle
-		{"K1", "Kindle 1", 600, 670},
-		{"K11", "Kindle 11", 1072, 1448},
-		{"K2", "Kindle 2", 600, 670},
-		{"K34", "Kindle Keyboard/Touch", 600, 800},
-		{"K578", "Kindle", 600, 800},
-		{"KDX", "Kindle DX/DXG", 824, 1000},
-		{"KPW", "Kindle Paperwhite 1/2", 758, 1024},
-		{"KV", "Kindle Paperwhite 3/4/Voyage/Oasis", 1072, 1448},
-		{"KPW5", "Kindle Paperwhite 5/Signature Edition", 1236, 1648},
-		{"KO", "Kindle Oasis 2/3", 1264, 1680},
-		{"KS", "Kindle Scribe", 1860, 2480},
+		{"K1", "Kindle 1", 600, 670, 4, false},
+		{"K11", "Kindle 11", 1072, 1448, 16, false},
+		{"K2", "Kindle 2", 600, 670, 4, false},
+		{"K34", "Kindle Keyboard/Touch", 600, 800, 16, false},
+		{"K578", "Kindle", 600, 800, 16, false},
+		{"KDX", "Kindle DX/DXG", 824, 1000, 16, false},
+		{"KPW", "Kindle Paperwhite 1/2", 758, 1024, 16, false},
+		{"KV", "Kindle Paperwhite 3/4/Voyage/Oasis", 1072, 1448, 16, false},
+		{"KPW5", "Kindle Paperwhite 5/Signature Edition", 1236, 1648, 16, false},
+		{"KO", "Kindle Oasis 2/3", 1264, 1680, 16, false},
+		{"KS", "Kindle Scribe", 1860, 2480, 16, false},
 		// Kobo
-		{"KoMT", "Kobo Mini/Touch", 600, 800},
-		{"KoG", "Kobo Glo", 768, 1024},
-		{"KoGHD", "Kobo Glo HD", 1072, 1448},
-		{"KoA", "Kobo Aura", 758, 1024},
-		{"KoAHD", "Kobo Aura HD", 1080, 1440},
-		{"KoAH2O", "Kobo Aura H2O", 1080, 1430},
-		{"KoAO", "Kobo Aura ONE", 1404, 1872},
-		{"KoN", "Kobo Nia", 758, 1024},
-		{"KoC", "Kobo Clara HD/Kobo Clara 2E", 1072, 1448},
-		{"KoL", "Kobo Libra H2O/Kobo Libra 2", 1264, 1680},
-		{"KoF", "Kobo Forma", 1440, 1920},
-		{"KoS", "Kobo Sage", 1440, 1920},
-		{"KoE", "Kobo Elipsa", 1404, 1872},
+		{"KoMT", "Kobo Mini/Touch", 600, 800, 16, false},
+		{"KoG", "Kobo Glo", 768, 1024, 16, false},
+		{"KoGHD", "Kobo Glo HD", 1072, 1448, 16, false},
+		{"KoA", "Kobo Aura", 758, 1024, 16, false},
+		{"KoAHD", "Kobo Aura HD", 1080, 1440, 16, false},
+		{"KoAH2O", "Kobo Aura H2O", 1080, 1430, 16, false},
+		{"KoAO", "Kobo Aura ONE", 1404, 1872, 16, false},
+		{"KoN", "Kobo Nia", 758, 1024, 16, false},
+		{"KoC", "Kobo Clara HD/Kobo Clara 2E", 1072, 1448, 16, false},
+		{"KoL", "Kobo Libra H2O/Kobo Libra 2", 1264, 1680, 16, false},
+		{"KoF", "Kobo Forma", 1440, 1920, 16, false},
+		{"KoS", "Kobo Sage", 1440, 1920, 16, false},
+		{"KoE", "Kobo Elipsa", 1404, 1872, 16, false},
 		// reMarkable
-		{"RM1", "reMarkable 1", 1404, 1872},
-		{"RM2", "reMarkable 2", 1404, 1872},
-		{"RMP", "reMarkable Paper Pro", 1620, 2160},
+		{"RM1", "reMarkable 1", 1404, 1872, 0, false},
+		{"RM2", "reMarkable 2", 1404, 1872, 0, false},
+		{"RMP", "reMarkable Paper Pro", 1620, 2160, 0, true},
 	} {
-		res[r.Code] = r
+		res[r.Code] = Profile{Code: r.Code, Description: r.Description, Width: r.Width, Height: r.Height, Palette: r.Palette, Color: r.Color}
 	}
 	return res
 }
 
+// Add the user devices, a device with the code of a built-in profile replace it.
+func (p Profiles) Add(devices ...Profile) {
+	for _, d := range devices {
+		p[d.Code] = d
+	}
+}
+
 func (p Profiles) String() string {
 	s := make([]string, 0)
 	for _, v := range p {
 		s = append(s, fmt.Sprintf(
-			"    - %-7s - %4d x %-4d - %s",
+			"    - %-7s - %4d x %-4d - %s%s",
 			v.Code,
 			v.Width, v.Height,
 			v.Description,
+			v.screen(),
 		))
 	}
 	return strings.Join(s, "\n")
@@ -0,0 +1,67 @@
+package converter
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// StartProfiling Start the cpu profile and the trace if requested.
+//
+// the returned function stop them and write the memory profile, it should be called at exit.
+func (c *Converter) StartProfiling() (stop func() error, err error) {
+	var stops []func() error
+
+	stop = func() error {
+		for _, s := range stops {
+			if err := s(); err != nil {
+				return err
+			}
+		}
+		if c.Options.PprofMem != "" {
+			f, err := os.Create(c.Options.PprofMem)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			runtime.GC()
+			return pprof.WriteHeapProfile(f)
+		}
+		return nil
+	}
+
+	if c.Options.PprofCpu != "" {
+		f, err := os.Create(c.Options.PprofCpu)
+		if err != nil {
+			return nil, err
+		}
+		if err = pprof.StartCPUProfile(f); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+
+	if c.Options.PprofTrace != "" {
+		f, err := os.Create(c.Options.PprofTrace)
+		if err != nil {
+			_ = stop()
+			return nil, err
+		}
+		if err = trace.Start(f); err != nil {
+			_ = f.Close()
+			_ = stop()
+			return nil, err
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+
+	return stop, nil
+}
@@ -0,0 +1,67 @@
+package converter
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epub"
+)
+
+// applyRerun apply the settings embedded into a previous EPUB: the input, the output and the options.
+//
+// the input and the output are names, looked up in the directory of the EPUB.
+// the commands, the destinations and the local directories are never taken from the EPUB, only from this run:
+// an EPUB received from someone else can't run its hooks.
+// the profile is the one with the size of the device, or a profile for this size if none match.
+// the flags set on the command line take precedence, they are set again after the settings.
+func (c *Converter) applyRerun() error {
+	if c.Options.Rerun == "" {
+		return nil
+	}
+	settings, err := epub.ReadSettings(c.Options.Rerun)
+	if err != nil {
+		return utils.WithExitCode(err, utils.ExitInput)
+	}
+
+	explicit := map[string]string{}
+	c.Cmd.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	o, cur := settings.Options, c.Options.EPUBOptions
+	dir := filepath.Dir(c.Options.Rerun)
+	o.Input, o.Output = filepath.Join(dir, filepath.Base(o.Input)), filepath.Join(dir, filepath.Base(o.Output))
+	o.Overrides = cur.Overrides
+	o.PostHook, o.Image.Hook, o.Calibre, o.Kobo, o.KindleMount, o.Upload, o.UploadRetries = cur.PostHook, cur.Image.Hook, cur.Calibre, cur.Kobo, cur.KindleMount, cur.Upload, cur.UploadRetries
+	o.CacheDir, o.TempDir = cur.CacheDir, cur.TempDir
+	o.Quiet, o.Json, o.Progress = cur.Quiet, cur.Json, cur.Progress
+	c.Options.EPUBOptions = o
+
+	// the default profile is kept if it has the same size
+	view := o.Image.View
+	if p := c.Options.GetProfile(); p == nil || p.Width != view.Width || p.Height != view.Height {
+		c.Options.Profile = ""
+		for code, p := range c.Options.profiles {
+			if p.Width == view.Width && p.Height == view.Height && (c.Options.Profile == "" || code < c.Options.Profile) {
+				c.Options.Profile = code
+			}
+		}
+	}
+	if c.Options.Profile == "" {
+		c.Options.Profile = "EPUB"
+		c.Options.profiles.Add(Profile{
+			Code:        "EPUB",
+			Description: fmt.Sprintf("Device of %s", filepath.Base(c.Options.Rerun)),
+			Width:       view.Width,
+			Height:      view.Height,
+		})
+	}
+
+	for name, value := range explicit {
+		if err := c.Cmd.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
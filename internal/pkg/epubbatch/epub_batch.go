@@ -0,0 +1,247 @@
+// Package epubbatch find the comics to convert in a directory, and track the conversions already done.
+//
+// The state file keep the hash of each input and the fingerprint of the options used,
+// an input is converted again only if it or the options changed, or if the output is missing.
+package epubbatch
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/sortpath"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// StateFileName name of the state file, in the output directory
+const StateFileName = ".go-comic-converter-state.json"
+
+// Inputs lookup for the archives (cbz, zip, cbr, rar, pdf and the registered readers) in the directory and its subdirectories.
+func Inputs(dir string, sortPathMode int) (inputs []string, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		switch ext := strings.ToLower(filepath.Ext(path)); ext {
+		case ".cbz", ".zip", ".cbr", ".rar", ".pdf":
+			inputs = append(inputs, path)
+		default:
+			if slices.Contains(epuboptions.ArchiveExtensions(), ext) {
+				inputs = append(inputs, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if len(inputs) == 0 {
+		err = utils.WithExitCode(errors.New("no comics found"), utils.ExitNoImages)
+		return
+	}
+	sort.Sort(sortpath.By(inputs, sortPathMode))
+	return
+}
+
+// Fingerprint of the options that change the content of the output.
+func Fingerprint(o epuboptions.EPUBOptions) string {
+	o.Input, o.Output, o.Title = "", "", ""
+	o.Dry, o.DryVerbose, o.Quiet, o.Json, o.Workers = false, false, false, false, 0
+	o.CacheDir, o.TempDir, o.MaxMemory, o.PostHook, o.Calibre = "", "", 0, "", ""
+	o.Kobo, o.KoboCollections, o.KindleMount, o.Upload, o.UploadRetries = "", false, "", "", 0
+	b, _ := json.Marshal(o)
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+type Entry struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Hash        string    `json:"hash"`
+	Fingerprint string    `json:"fingerprint"`
+	Output      string    `json:"output"`
+}
+
+// State of the conversions done, by input.
+type State struct {
+	filename string
+	Entries  map[string]Entry `json:"entries"`
+}
+
+// LoadState read the state file, a missing file is an empty state.
+func LoadState(filename string) (s State, err error) {
+	s = State{filename: filename, Entries: map[string]Entry{}}
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("state %s: %w", filename, err)
+	}
+	// the paths are relative to the state file, whatever the directory of the run
+	entries := make(map[string]Entry, len(s.Entries))
+	for input, entry := range s.Entries {
+		entry.Output = s.resolve(entry.Output)
+		entries[s.resolve(input)] = entry
+	}
+	s.Entries = entries
+	return
+}
+
+// resolve the path of the state file, relative to its directory, into an absolute path.
+func (s State) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	dir, err := filepath.Abs(filepath.Dir(s.filename))
+	if err != nil {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// abs the path given by the run, relative to the current directory, into an absolute path.
+func abs(path string) string {
+	if a, err := filepath.Abs(path); err == nil && path != "" {
+		return a
+	}
+	return path
+}
+
+// Save write the state file atomically, the paths relative to its directory.
+func (s State) Save() error {
+	saved := State{Entries: make(map[string]Entry, len(s.Entries))}
+	dir, _ := filepath.Abs(filepath.Dir(s.filename))
+	rel := func(path string) string {
+		if r, err := filepath.Rel(dir, path); err == nil && path != "" {
+			return r
+		}
+		return path
+	}
+	for input, entry := range s.Entries {
+		entry.Output = rel(entry.Output)
+		saved.Entries[rel(input)] = entry
+	}
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.filename + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
+
+// Check compute the entry of the input, and tell if the output is up to date.
+//
+// the hash is only computed again if the size or the modification time of the input changed.
+func (s State) Check(input, output, fingerprint string) (entry Entry, upToDate bool, err error) {
+	fi, err := os.Stat(input)
+	if err != nil {
+		return
+	}
+	previous, ok := s.Entries[abs(input)]
+	entry = Entry{Size: fi.Size(), ModTime: fi.ModTime().UTC(), Fingerprint: fingerprint, Output: abs(output)}
+	if ok && previous.Size == entry.Size && previous.ModTime.Equal(entry.ModTime) {
+		entry.Hash = previous.Hash
+	} else if entry.Hash, err = hashFile(input); err != nil {
+		return
+	}
+
+	upToDate = ok &&
+		previous.Hash == entry.Hash &&
+		previous.Fingerprint == entry.Fingerprint &&
+		previous.Output == entry.Output &&
+		outputExists(output)
+	return
+}
+
+// Orphans the inputs converted that no longer exist, sorted.
+//
+// an input is only an orphan if its directory still exists: a whole missing directory is rather an unmounted drive.
+func (s State) Orphans() []string {
+	orphans := make([]string, 0)
+	for input := range s.Entries {
+		if _, err := os.Stat(input); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Dir(input)); err == nil && fi.IsDir() {
+			orphans = append(orphans, input)
+		}
+	}
+	slices.Sort(orphans)
+	return orphans
+}
+
+// Outputs the files of the output, the output itself or its parts, and the files of the other output formats.
+func Outputs(output string) []string {
+	base := strings.TrimSuffix(output, ".epub")
+	// the parts of the KEPUB match the parts of the EPUB
+	outputs, _ := filepath.Glob(base + "Part *.epub")
+	if _, err := os.Stat(output); err == nil {
+		outputs = []string{output}
+	}
+	for _, ext := range []string{".kepub.epub", ".azw3", ".mobi", ".cbz"} {
+		if o := base + ext; o != output {
+			if _, err := os.Stat(o); err == nil {
+				outputs = append(outputs, o)
+			}
+		}
+	}
+	for _, ext := range []string{".azw3", ".mobi"} {
+		parts, _ := filepath.Glob(base + "Part *" + ext)
+		outputs = append(outputs, parts...)
+	}
+	return outputs
+}
+
+// Has the input was converted.
+func (s State) Has(input string) bool {
+	_, ok := s.Entries[abs(input)]
+	return ok
+}
+
+// Remove the entry of the input.
+func (s State) Remove(input string) {
+	delete(s.Entries, abs(input))
+}
+
+// Update record the successful conversion of the input.
+func (s State) Update(input string, entry Entry) {
+	entry.Output = abs(entry.Output)
+	s.Entries[abs(input)] = entry
+}
+
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// the output may have been split in many parts: "namePart 1 of 2.epub"
+func outputExists(output string) bool {
+	return len(Outputs(output)) > 0
+}
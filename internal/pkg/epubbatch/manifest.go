@@ -0,0 +1,154 @@
+package epubbatch
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Job an archive to convert in batch mode, with the settings of its row in the manifest.
+//
+// the empty settings take the default of the batch: the title from the name of the archive,
+// the output in the output directory, and the options of the command line.
+type Job struct {
+	Input   string `yaml:"input" json:"input"`
+	Title   string `yaml:"title" json:"title"`
+	Series  string `yaml:"series" json:"series"`
+	Author  string `yaml:"author" json:"author"`
+	Profile string `yaml:"profile" json:"profile"`
+	Output  string `yaml:"output" json:"output"` // EPUB file, relative to the output directory
+}
+
+// Jobs of the archives, without settings.
+func Jobs(inputs []string) []Job {
+	jobs := make([]Job, len(inputs))
+	for i, input := range inputs {
+		jobs[i] = Job{Input: input}
+	}
+	return jobs
+}
+
+// IsManifest tell if the file is a manifest, from its extension.
+func IsManifest(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+/*
+LoadManifest read the list of the archives to convert, with their settings.
+
+A csv file has a header with the name of the columns, only the input is required:
+
+	input,title,series,author,profile,output
+	One Piece/v01.cbz,One Piece 1,One Piece,Eiichiro Oda,KPW5,manga/One Piece 01.epub
+	Saga/v01.cbr,,Saga,,KoL,
+
+A yaml file has the same fields:
+
+	inputs:
+	  - input: One Piece/v01.cbz
+	    title: One Piece 1
+	    series: One Piece
+	    profile: KPW5
+
+The inputs are relative to the directory of the manifest.
+*/
+func LoadManifest(filename string) (jobs []Job, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	if strings.ToLower(filepath.Ext(filename)) == ".csv" {
+		jobs, err = decodeCsv(f)
+	} else {
+		var m struct {
+			Inputs []Job `yaml:"inputs"`
+		}
+		if err = yaml.NewDecoder(f).Decode(&m); errors.Is(err, io.EOF) {
+			err = nil
+		}
+		jobs = m.Inputs
+	}
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", filename, err)
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("manifest %s: no inputs", filename)
+	}
+
+	dir := filepath.Dir(filename)
+	seen := map[string]struct{}{}
+	for i := range jobs {
+		if jobs[i].Input == "" {
+			return nil, fmt.Errorf("manifest %s: input missing at row %d", filename, i+1)
+		}
+		if !filepath.IsAbs(jobs[i].Input) {
+			jobs[i].Input = filepath.Join(dir, jobs[i].Input)
+		}
+		if _, dup := seen[jobs[i].Input]; dup {
+			return nil, fmt.Errorf("manifest %s: input %q listed twice", filename, jobs[i].Input)
+		}
+		seen[jobs[i].Input] = struct{}{}
+	}
+	return
+}
+
+func decodeCsv(r io.Reader) ([]Job, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		switch header[i] {
+		case "input", "title", "series", "author", "profile", "output":
+		default:
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	jobs := make([]Job, 0)
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return jobs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		var job Job
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "input":
+				job.Input = value
+			case "title":
+				job.Title = value
+			case "series":
+				job.Series = value
+			case "author":
+				job.Author = value
+			case "profile":
+				job.Profile = value
+			case "output":
+				job.Output = value
+			}
+		}
+		jobs = append(jobs, job)
+	}
+}
@@ -0,0 +1,105 @@
+package epubbatch
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+var (
+	// tokens of the name: {series}, {volume:2}
+	nameToken = regexp.MustCompile(`\{(\w+)(?::(\d+))?}`)
+	// characters not allowed in a file name on windows
+	nameInvalid = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+	nameSpaces  = regexp.MustCompile(`\s+`)
+	// brackets left empty by a missing metadata: "Series [] v01"
+	nameEmpty = regexp.MustCompile(`\(\s*\)|\[\s*]`)
+)
+
+// ValidateName check the tokens of the name.
+func ValidateName(pattern string) error {
+	for _, m := range nameToken.FindAllStringSubmatch(pattern, -1) {
+		switch m[1] {
+		case "name", "title", "series", "volume", "number", "language", "author", "publisher":
+		default:
+			return fmt.Errorf("unknown token {%s} in the name, available: {name}, {title}, {series}, {volume}, {number}, {language}, {author}, {publisher}", m[1])
+		}
+	}
+	return nil
+}
+
+// Name of the output from the pattern and the metadata, without the extension.
+//
+// the missing metadata are empty, the brackets and the separators left around them are removed.
+// the name of the archive is used if nothing remain.
+func Name(pattern, input string, m epuboptions.Metadata) string {
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	result := nameToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		r := nameToken.FindStringSubmatch(token)
+		var value string
+		switch r[1] {
+		case "name":
+			value = name
+		case "title":
+			value = m.Title
+		case "series":
+			value = m.Series
+		case "volume":
+			value = m.Volume
+		case "number":
+			value = m.Number
+		case "language":
+			value = m.Language
+		case "author":
+			value = m.Author
+		case "publisher":
+			value = m.Publisher
+		}
+		value = strings.TrimSpace(value)
+		if width, err := strconv.Atoi(r[2]); err == nil {
+			if n, err := strconv.Atoi(value); err == nil {
+				value = fmt.Sprintf("%0*d", width, n)
+			}
+		}
+		return value
+	})
+	result = nameEmpty.ReplaceAllString(nameInvalid.ReplaceAllString(result, "_"), "")
+	result = strings.Trim(nameSpaces.ReplaceAllString(result, " "), " -_.")
+	if result == "" {
+		return name
+	}
+	return result
+}
+
+// Mirror the directory of the input relative to the root under the output directory: "Series/Volume.epub".
+//
+// the inputs at the root, or outside of it, stay in the output directory.
+func Mirror(root, input, output string) string {
+	rel, err := filepath.Rel(root, filepath.Dir(input))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return output
+	}
+	return filepath.Join(output, rel)
+}
+
+// Unique add a counter to the output already used by another input: "name (2).epub".
+//
+// used map the outputs to their input, the outputs of the previous runs keep their name.
+func Unique(output, input string, used map[string]string) string {
+	base := strings.TrimSuffix(output, filepath.Ext(output))
+	ext := filepath.Ext(output)
+	// the outputs and the inputs of the state are absolute
+	input = abs(input)
+	for i := 2; ; i++ {
+		key := strings.ToLower(abs(output))
+		if other, ok := used[key]; !ok || other == input {
+			used[key] = input
+			return output
+		}
+		output = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
@@ -0,0 +1,32 @@
+package epubbatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+/*
+DecodeJob read a line of the queue, a json object with the fields of the manifest, only the input is required:
+
+	{"input": "One Piece/v01.cbz", "title": "One Piece 1", "series": "One Piece", "profile": "KPW5"}
+
+The input is relative to dir: the directory of the queue file, or the current directory for the standard input.
+The unknown fields are rejected, a typo would be ignored silently.
+*/
+func DecodeJob(line []byte, dir string) (job Job, err error) {
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.DisallowUnknownFields()
+	if err = d.Decode(&job); err != nil {
+		return job, fmt.Errorf("queue: %w", err)
+	}
+	if job.Input == "" {
+		return job, errors.New("queue: input missing")
+	}
+	if !filepath.IsAbs(job.Input) {
+		job.Input = filepath.Join(dir, job.Input)
+	}
+	return job, nil
+}
@@ -0,0 +1,201 @@
+package epubbatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// directories of the spool, by state of the jobs
+const (
+	SpoolPending = "pending"
+	SpoolRunning = "running"
+	SpoolDone    = "done"
+	SpoolFailed  = "failed"
+)
+
+// SpoolJob a job of the spool, with its attempts.
+type SpoolJob struct {
+	Job
+	Id        string     `json:"id"`
+	Attempts  int        `json:"attempts,omitempty"`
+	NextAt    *time.Time `json:"next_at,omitempty"` // the retry is delayed until then
+	Error     string     `json:"error,omitempty"`   // of the last attempt
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+/*
+Spool the persisted queue of the daemon mode, a directory with a json file by job in the directory of its state:
+
+	pending/<id>.json   waiting, or delayed until its next attempt
+	running/<id>.json   in progress, back to pending if the daemon stop
+	done/<id>.json      converted
+	failed/<id>.json    failed after the retries, with its error
+
+A job is added by writing a file into pending with the fields of the manifest, written elsewhere then moved to be read whole:
+
+	{"input": "One Piece/v01.cbz", "title": "One Piece 1", "profile": "KPW5"}
+
+The input is relative to the spool directory, the jobs are converted in the order of their file names.
+*/
+type Spool struct {
+	dir string
+}
+
+// OpenSpool create the directories of the spool, the jobs left running by a stop or a crash are pending again.
+func OpenSpool(dir string) (Spool, error) {
+	s := Spool{dir}
+	for _, d := range []string{SpoolPending, SpoolRunning, SpoolDone, SpoolFailed} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return s, err
+		}
+	}
+	running, err := s.list(SpoolRunning)
+	if err != nil {
+		return s, err
+	}
+	for _, name := range running {
+		if err = os.Rename(filepath.Join(dir, SpoolRunning, name), filepath.Join(dir, SpoolPending, name)); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// Next move up to n pending jobs ready to run into running, in the order of their file names.
+//
+// a file that is not a valid job is moved to failed with its error. The jobs of the same input wait for the next call,
+// the results of a conversion are by input.
+func (s Spool) Next(n int) ([]SpoolJob, error) {
+	pending, err := s.list(SpoolPending)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]SpoolJob, 0, n)
+	inputs := map[string]bool{}
+	now := time.Now()
+	for _, name := range pending {
+		if len(jobs) >= n {
+			break
+		}
+		j, err := s.read(SpoolPending, name)
+		if err != nil {
+			j.Error = err.Error()
+			if err = s.move(SpoolPending, SpoolFailed, j); err != nil {
+				return jobs, err
+			}
+			continue
+		}
+		if (j.NextAt != nil && now.Before(*j.NextAt)) || inputs[j.Input] {
+			continue
+		}
+		inputs[j.Input] = true
+		if err = s.move(SpoolPending, SpoolRunning, j); err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// Pending the number of jobs waiting, the retries included.
+func (s Spool) Pending() (int, error) {
+	pending, err := s.list(SpoolPending)
+	return len(pending), err
+}
+
+// Done the job converted.
+func (s Spool) Done(j SpoolJob) error {
+	j.Error, j.NextAt = "", nil
+	return s.move(SpoolRunning, SpoolDone, j)
+}
+
+// Retry the job that failed after a delay, doubled on each attempt, or mark it failed after the retries.
+func (s Spool) Retry(j SpoolJob, cause error, retries int, delay time.Duration) error {
+	j.Attempts++
+	j.Error = cause.Error()
+	if j.Attempts > retries {
+		j.NextAt = nil
+		return s.move(SpoolRunning, SpoolFailed, j)
+	}
+	next := time.Now().Add(delay << (j.Attempts - 1)).UTC()
+	j.NextAt = &next
+	return s.move(SpoolRunning, SpoolPending, j)
+}
+
+// Requeue the running job, not attempted.
+func (s Spool) Requeue(j SpoolJob) error {
+	return s.move(SpoolRunning, SpoolPending, j)
+}
+
+// list the json files of the state, sorted.
+func (s Spool) list(state string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, state))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") && filepath.Ext(e.Name()) == ".json" {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// read a job, the files added by hand are named after their id.
+func (s Spool) read(state, name string) (j SpoolJob, err error) {
+	j.Id = strings.TrimSuffix(name, filepath.Ext(name))
+	data, err := os.ReadFile(filepath.Join(s.dir, state, name))
+	if err != nil {
+		return
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err = d.Decode(&j); err != nil {
+		return j, fmt.Errorf("spool: %w", err)
+	}
+	j.Id = strings.TrimSuffix(name, filepath.Ext(name))
+	if j.Input == "" {
+		return j, errors.New("spool: input missing")
+	}
+	if !filepath.IsAbs(j.Input) {
+		j.Input = filepath.Join(s.dir, j.Input)
+	}
+	return
+}
+
+// move the job to the state, with its updated content.
+func (s Spool) move(from, to string, j SpoolJob) error {
+	j.UpdatedAt = time.Now().UTC()
+	if err := s.write(to, j); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.dir, from, j.Id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// write the job atomically.
+func (s Spool) write(state string, j SpoolJob) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(s.dir, state, j.Id+".json")
+	// the temporary file is ignored by the reads
+	tmp := filepath.Join(s.dir, state, "."+j.Id+".tmp")
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
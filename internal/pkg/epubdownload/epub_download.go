@@ -0,0 +1,221 @@
+// Package epubdownload download a remote input, with retries and resume on flaky connections.
+package epubdownload
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+type Options struct {
+	RateLimit int // bytes per second, 0 = unlimited
+	Retries   int // number of attempts after the first failure
+	Quiet     bool
+}
+
+// maxDelay between 2 attempts, the delay double after each failure from 1s.
+const maxDelay = 30 * time.Second
+
+var client = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// permanentError failure that will not be fixed by a retry (not found, forbidden, ...)
+type permanentError struct {
+	error
+}
+
+// IsURL check if the input is an http or https url.
+func IsURL(input string) bool {
+	u, err := url.Parse(input)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Download the url into dir, return the path of the file.
+//
+// the data are written into a .part file named after the hash of the url, so 2 urls with the same file name never mix.
+// It is resumed on the next attempt if the server support it and the file did not change since (If-Range),
+// then renamed once complete.
+func Download(rawURL string, dir string, o Options) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".cbz", ".zip", ".cbr", ".rar", ".pdf":
+	default:
+		return "", errors.New("url should end with .cbz, .zip, .cbr, .rar or .pdf")
+	}
+
+	filename := filepath.Join(dir, name)
+	hash := sha256.Sum256([]byte(rawURL))
+	part := filepath.Join(dir, fmt.Sprintf("%s.%x.part", name, hash[:8]))
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		if !o.Quiet {
+			utils.Printf("Downloading %s\n", rawURL)
+		}
+		if err = fetch(rawURL, part, o.RateLimit); err == nil {
+			_ = os.Remove(part + ".validator")
+			return filename, os.Rename(part, filename)
+		}
+		var perr permanentError
+		if errors.As(err, &perr) || attempt >= o.Retries {
+			// keep the partial data for the next run
+			if fi, serr := os.Stat(part); serr == nil && fi.Size() == 0 {
+				_ = os.Remove(part)
+				_ = os.Remove(part + ".validator")
+			}
+			return "", err
+		}
+		slog.Warn("download failed, retrying", "url", rawURL, "error", err, "delay", delay)
+		time.Sleep(delay)
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// fetch the url into part, from its current size if the server accept a range for the same file.
+//
+// the ETag or the Last-Modified of the file is kept next to the part, and sent back with If-Range:
+// the server send the whole file if it changed. Without them, the download restart from the beginning.
+func fetch(rawURL string, part string, rateLimit int) error {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return permanentError{err}
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return permanentError{err}
+	}
+	validator, _ := os.ReadFile(part + ".validator")
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return permanentError{err}
+	}
+	if offset > 0 && len(validator) > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", string(validator))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	restart := func() error {
+		if err := f.Truncate(0); err != nil {
+			return permanentError{err}
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return permanentError{err}
+		}
+		return nil
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && req.Header.Get("Range") != "":
+		// resume, if the range start where the part stop
+		if start, _, ok := contentRange(resp.Header.Get("Content-Range")); !ok || start != offset {
+			_ = restart()
+			return fmt.Errorf("download %s: unexpected range %q", rawURL, resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode == http.StatusOK:
+		// range not supported, or the file changed: restart from the beginning
+		if err = restart(); err != nil {
+			return err
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && req.Header.Get("Range") != "":
+		// already complete if the part has the size of the file, else it is not the same file
+		if _, size, ok := contentRange(resp.Header.Get("Content-Range")); ok && size == offset {
+			return nil
+		}
+		if err = restart(); err != nil {
+			return err
+		}
+		return fmt.Errorf("download %s: the partial file does not match, restarting", rawURL)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return permanentError{fmt.Errorf("download %s: %s", rawURL, resp.Status)}
+	default:
+		return fmt.Errorf("download %s: %s", rawURL, resp.Status)
+	}
+
+	// the validator of the file received, a weak ETag can not be used with If-Range
+	if resp.StatusCode == http.StatusOK {
+		v := resp.Header.Get("ETag")
+		if v == "" || strings.HasPrefix(v, "W/") {
+			v = resp.Header.Get("Last-Modified")
+		}
+		if err = os.WriteFile(part+".validator", []byte(v), 0644); err != nil {
+			return permanentError{err}
+		}
+	}
+
+	var body io.Reader = resp.Body
+	if rateLimit > 0 {
+		body = &throttledReader{r: body, rate: rateLimit, start: time.Now()}
+	}
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// contentRange parse "bytes 100-199/1000" or "bytes */1000", the start (-1 if none) and the size of the file (-1 if unknown).
+func contentRange(s string) (start, size int64, ok bool) {
+	r, total, found := strings.Cut(strings.TrimPrefix(s, "bytes "), "/")
+	if !found || !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, false
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if total == "*" {
+		size, err = -1, nil
+	}
+	if err != nil {
+		return 0, 0, false
+	}
+	if r == "*" {
+		return -1, size, true
+	}
+	first, _, found := strings.Cut(r, "-")
+	if start, err = strconv.ParseInt(first, 10, 64); !found || err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// throttledReader keep the average rate under the limit.
+type throttledReader struct {
+	r     io.Reader
+	rate  int
+	start time.Time
+	n     int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// at most 1/10s of data per read, for a smooth rate
+	if chunk := max(1, t.rate/10); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	if wait := time.Duration(float64(t.n)/float64(t.rate)*float64(time.Second)) - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
@@ -0,0 +1,50 @@
+// Package epubevent write the events of the json mode, one json line on stdout for each event.
+//
+// each line is an object with the type of the event and its data: {"type": "start", "data": {...}}.
+// the types are documented in the README, a new field may be added to the data, never removed.
+package epubevent
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// types of the events
+const (
+	Options  = "options"      // the options of the conversion
+	Start    = "start"        // the conversion of an input start
+	Progress = "epubprogress" // the progress of a step
+	Page     = "page"         // a source page is processed
+	Warning  = "warning"      // a problem that does not stop the conversion
+	Split    = "split"        // the EPUB is split into parts
+	Part     = "part"         // a part of the EPUB is written
+	Finished = "finished"     // the conversion of an input is done
+	Error    = "error"        // the conversion of an input failed
+	Plan     = "plan"         // the plan of the dry run
+	Preview  = "preview"      // the pages of the preview
+	Compare  = "compare"      // the pages of the comparison
+	Batch    = "batch"        // summary of the batch mode
+	Library  = "library"      // summary of the library mode
+	Stats    = "stats"        // elapsed time and memory usage, last event
+	Doctor   = "doctor"       // the environment report
+	Estimate = "estimate"     // the estimated size and duration, before the conversion
+	Profiles = "profiles"     // the devices and the named profiles
+	Summary  = "summary"      // the stats of the conversions of the run
+	Clean    = "clean"        // the files removed by -clean
+)
+
+var (
+	mu      sync.Mutex
+	encoder = json.NewEncoder(os.Stdout)
+)
+
+// Emit the event, the lines of concurrent conversions are not mixed.
+func Emit(typ string, data any) {
+	mu.Lock()
+	defer mu.Unlock()
+	_ = encoder.Encode(map[string]any{
+		"type": typ,
+		"data": data,
+	})
+}
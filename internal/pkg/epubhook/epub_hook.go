@@ -0,0 +1,60 @@
+// Package epubhook run the user commands after a conversion, to sync or notify.
+//
+// the command is run by the shell (sh, cmd on windows) with the environment describing the EPUB written:
+//
+//	COMIC_INPUT   the source of the conversion
+//	COMIC_OUTPUT  the EPUB file
+//	COMIC_TITLE   the title of the EPUB
+//	COMIC_PAGES   the number of pages of the EPUB
+//	COMIC_SIZE    the size of the EPUB in bytes
+//	COMIC_PART    the part of the EPUB, from 1
+//	COMIC_PARTS   the number of parts
+package epubhook
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Output an EPUB written.
+type Output struct {
+	Input string
+	Path  string
+	Title string
+	Pages int
+	Size  int64
+	Part  int
+	Parts int
+}
+
+// Env the variables describing the output.
+func (o Output) Env() []string {
+	return []string{
+		"COMIC_INPUT=" + o.Input,
+		"COMIC_OUTPUT=" + o.Path,
+		"COMIC_TITLE=" + o.Title,
+		"COMIC_PAGES=" + strconv.Itoa(o.Pages),
+		"COMIC_SIZE=" + strconv.FormatInt(o.Size, 10),
+		"COMIC_PART=" + strconv.Itoa(o.Part),
+		"COMIC_PARTS=" + strconv.Itoa(o.Parts),
+	}
+}
+
+// Run the command for the output, its messages are written on stderr, stdout is kept for the json events.
+func Run(command string, o Output) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), o.Env()...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("post hook on %s: %w", o.Path, err)
+	}
+	return nil
+}
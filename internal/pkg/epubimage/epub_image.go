@@ -6,11 +6,13 @@ import (
 	"strings"
 
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
 
 type EPUBImage struct {
 	Id                  int
 	Part                int
+	Parts               int // number of parts of the split double page, 0 for the page itself
 	Raw                 image.Image
 	Width               int
 	Height              int
@@ -39,6 +41,26 @@ func (i EPUBImage) EPUBSpacePath() string {
 	return "OEBPS/" + i.SpacePath()
 }
 
+// EndSpaceKey key name of the blank page after the last part of a page split into an odd number of parts
+func (i EPUBImage) EndSpaceKey() string {
+	return i.SpaceKey() + "_end"
+}
+
+// EndSpacePath path of the blank page after the last part
+func (i EPUBImage) EndSpacePath() string {
+	return "Text/" + i.EndSpaceKey() + ".xhtml"
+}
+
+// EPUBEndSpacePath path of the blank page after the last part into the EPUB
+func (i EPUBImage) EPUBEndSpacePath() string {
+	return "OEBPS/" + i.EndSpacePath()
+}
+
+// HasEndSpace the last part of a page split into an odd number of parts, the next page would share its spread.
+func (i EPUBImage) HasEndSpace() bool {
+	return i.Part > 0 && i.Part == i.Parts && i.Parts%2 == 1
+}
+
 func (i EPUBImage) PartKey() string {
 	return utils.IntToString(i.Id) + "_p" + utils.IntToString(i.Part)
 }
@@ -75,6 +97,9 @@ func (i EPUBImage) EPUBImgPath() string {
 
 // MediaType of the epub image
 func (i EPUBImage) MediaType() string {
+	if e, ok := epuboptions.LookupEncoder(i.Format); ok && e.MediaType != "" {
+		return e.MediaType
+	}
 	return "image/" + i.Format
 }
 
@@ -0,0 +1,297 @@
+package epubimage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"iter"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// Index of the images of the EPUB, ordered by id and part.
+//
+// the metadata are stored into a file, one json line per image, so a merge of 10k+ pages is not kept in memory:
+// the layout and the content of each part are generated by reading them back.
+// only the first image (the cover) is kept in memory, with its raw image.
+// without a filename, the index stay in memory (dry run).
+type Index struct {
+	filename string
+	memory   []EPUBImage
+	first    EPUBImage
+	size     int
+	sources  int
+	start    int
+	end      int
+	err      *error
+}
+
+// indexEntry stored metadata of an image, the raw image is not kept.
+type indexEntry struct {
+	Id                  int     `json:"id"`
+	Part                int     `json:"part"`
+	Parts               int     `json:"parts,omitempty"`
+	Width               int     `json:"width"`
+	Height              int     `json:"height"`
+	IsBlank             bool    `json:"is_blank,omitempty"`
+	DoublePage          bool    `json:"double_page,omitempty"`
+	Path                string  `json:"path"`
+	Name                string  `json:"name"`
+	Format              string  `json:"format"`
+	OriginalAspectRatio float64 `json:"original_aspect_ratio"`
+	Error               string  `json:"error,omitempty"`
+}
+
+// Len number of images
+func (i Index) Len() int {
+	return i.end - i.start
+}
+
+// Sources number of source pages added, including the ones without images (blank page removed).
+func (i Index) Sources() int {
+	return i.sources
+}
+
+// First image, with the raw image for the first one of the index.
+func (i Index) First() EPUBImage {
+	if i.start == 0 {
+		return i.first
+	}
+	for _, img := range i.All() {
+		return img
+	}
+	return EPUBImage{}
+}
+
+// Slice of the images from start to end (excluded), relative to this index.
+func (i Index) Slice(start, end int) Index {
+	i.start, i.end = i.start+start, i.start+end
+	return i
+}
+
+// All images of the index with their position, read sequentially from the file.
+//
+// a read error stop the iteration, it is reported by Err.
+func (i Index) All() iter.Seq2[int, EPUBImage] {
+	return func(yield func(int, EPUBImage) bool) {
+		if i.filename == "" {
+			for n, img := range i.memory[i.start:i.end] {
+				if !yield(n, img) {
+					return
+				}
+			}
+			return
+		}
+
+		fh, err := os.Open(i.filename)
+		if err != nil {
+			i.setErr(err)
+			return
+		}
+		defer fh.Close()
+
+		scanner := bufio.NewScanner(fh)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for n := 0; n < i.end && scanner.Scan(); n++ {
+			if n < i.start {
+				continue
+			}
+			if n == 0 {
+				if !yield(0, i.first) {
+					return
+				}
+				continue
+			}
+			var entry indexEntry
+			if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				i.setErr(err)
+				return
+			}
+			if !yield(n-i.start, entry.image()) {
+				return
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			i.setErr(err)
+		}
+	}
+}
+
+// Err first error while reading the index.
+func (i Index) Err() error {
+	if i.err == nil {
+		return nil
+	}
+	return *i.err
+}
+
+func (i Index) setErr(err error) {
+	if *i.err == nil {
+		*i.err = err
+	}
+}
+
+// Remove the index file.
+func (i Index) Remove() error {
+	if i.filename == "" {
+		return nil
+	}
+	return os.Remove(i.filename)
+}
+
+func (e indexEntry) image() EPUBImage {
+	img := EPUBImage{
+		Id:                  e.Id,
+		Part:                e.Part,
+		Parts:               e.Parts,
+		Width:               e.Width,
+		Height:              e.Height,
+		IsBlank:             e.IsBlank,
+		DoublePage:          e.DoublePage,
+		Path:                e.Path,
+		Name:                e.Name,
+		Format:              e.Format,
+		OriginalAspectRatio: e.OriginalAspectRatio,
+	}
+	if e.Error != "" {
+		img.Error = errors.New(e.Error)
+	}
+	return img
+}
+
+// ReadIndex the images of an index file, by id, like kept by an interrupted conversion.
+func ReadIndex(filename string) (map[int][]EPUBImage, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	images := map[int][]EPUBImage{}
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry indexEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		images[entry.Id] = append(images[entry.Id], entry.image())
+	}
+	return images, scanner.Err()
+}
+
+// IndexWriter append the images into the index.
+//
+// the images may come in any order, they are written in the order of their id,
+// keeping in memory only the ones waiting for a previous id.
+type IndexWriter struct {
+	fh      *os.File
+	w       *bufio.Writer
+	index   Index
+	pending map[int][]EPUBImage
+	next    int
+}
+
+// NewIndexWriter create the index file, or an index in memory without filename.
+func NewIndexWriter(filename string) (*IndexWriter, error) {
+	w := &IndexWriter{
+		index:   Index{filename: filename, err: new(error)},
+		pending: map[int][]EPUBImage{},
+	}
+	if filename != "" {
+		fh, err := os.Create(filename)
+		if err != nil {
+			return nil, utils.WithExitCode(err, utils.ExitOutput)
+		}
+		w.fh, w.w = fh, bufio.NewWriter(fh)
+	}
+	return w, nil
+}
+
+// Add the images of the id, sorted by part. The id may have no images (blank page removed).
+func (w *IndexWriter) Add(id int, images ...EPUBImage) error {
+	w.pending[id] = images
+	for images, ok := w.pending[w.next]; ok; images, ok = w.pending[w.next] {
+		delete(w.pending, w.next)
+		w.next++
+		if err := w.write(images); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *IndexWriter) write(images []EPUBImage) error {
+	w.index.sources++
+	slices.SortFunc(images, func(a, b EPUBImage) int {
+		return a.Part - b.Part
+	})
+	// the parts of a split double page come with the page
+	parts := 0
+	for _, img := range images {
+		if img.Part > 0 {
+			parts++
+		}
+	}
+	for _, img := range images {
+		if img.Part > 0 {
+			img.Parts = parts
+		}
+		if w.index.size == 0 {
+			w.index.first = img
+		}
+		w.index.size++
+		if w.fh == nil {
+			w.index.memory = append(w.index.memory, img)
+			continue
+		}
+		entry := indexEntry{
+			Id:                  img.Id,
+			Part:                img.Part,
+			Parts:               img.Parts,
+			Width:               img.Width,
+			Height:              img.Height,
+			IsBlank:             img.IsBlank,
+			DoublePage:          img.DoublePage,
+			Path:                img.Path,
+			Name:                img.Name,
+			Format:              img.Format,
+			OriginalAspectRatio: img.OriginalAspectRatio,
+		}
+		if img.Error != nil {
+			entry.Error = img.Error.Error()
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err = w.w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close write the images left after a missing id, then return the index.
+func (w *IndexWriter) Close() (Index, error) {
+	var err error
+	for _, id := range slices.Sorted(maps.Keys(w.pending)) {
+		if err = w.write(w.pending[id]); err != nil {
+			break
+		}
+	}
+	clear(w.pending)
+	if w.fh != nil {
+		if ferr := w.w.Flush(); err == nil {
+			err = ferr
+		}
+		if cerr := w.fh.Close(); err == nil {
+			err = cerr
+		}
+	}
+	w.index.end = w.index.size
+	return w.index, err
+}
@@ -0,0 +1,141 @@
+/*
+Package epubimageavif encode the images into avif.
+
+The avif are encoded by avifenc, the command of libavif, it must be in the PATH.
+The pages of the cache and of the comparison are read back by Decode with avifdec, through the temporary directory
+of the conversion. The format is registered for image.DecodeConfig only, image.Decode return an error.
+*/
+package epubimageavif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+)
+
+func init() {
+	image.RegisterFormat("avif", "????ftypavi", decodeUnsupported, DecodeConfig)
+}
+
+var errDecodeUnsupported = errors.New("avif: decoded by epubimageavif.Decode only, with the temporary directory")
+
+// decodeUnsupported avifdec need a temporary directory, image.Decode can't give it.
+func decodeUnsupported(io.Reader) (image.Image, error) {
+	return nil, errDecodeUnsupported
+}
+
+// Is the data an avif, with the same signature than the registered format.
+func Is(data []byte) bool {
+	return len(data) >= 11 && string(data[4:11]) == "ftypavi"
+}
+
+// DefaultSpeed the speed of avifenc, a good balance between the time and the size.
+const DefaultSpeed = 6
+
+// Available check that avifenc and avifdec are available.
+func Available() error {
+	for _, command := range []string{"avifenc", "avifdec"} {
+		if _, err := exec.LookPath(command); err != nil {
+			return fmt.Errorf("%s not found, install libavif (the libavif-bin or libavif package)", command)
+		}
+	}
+	return nil
+}
+
+// Encode the image into avif with the quality (0-100) and the speed (0 slowest and smallest, 10 fastest).
+//
+// avifenc only read and write files, the image is given uncompressed through the tempDir, the system one if empty.
+func Encode(w io.Writer, img image.Image, quality int, speed int, tempDir string) error {
+	var data bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&data, img); err != nil {
+		return err
+	}
+	in, out, err := tempFiles(tempDir, ".png", ".avif")
+	if err != nil {
+		return err
+	}
+	defer removeTempFiles(in, out)
+	if err = os.WriteFile(in, data.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	// the pages are already encoded in parallel, one thread each
+	var stderr bytes.Buffer
+	cmd := exec.Command("avifenc", "-q", strconv.Itoa(quality), "-s", strconv.Itoa(speed), "-j", "1", in, out)
+	cmd.Stdout, cmd.Stderr = &stderr, &stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("avifenc: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Decode the avif with avifdec, through the tempDir, the system one if empty.
+func Decode(r io.Reader, tempDir string) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	in, out, err := tempFiles(tempDir, ".avif", ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer removeTempFiles(in, out)
+	if err = os.WriteFile(in, data, 0644); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("avifdec", "-j", "1", in, out)
+	cmd.Stdout, cmd.Stderr = &stderr, &stderr
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("avifdec: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return png.Decode(f)
+}
+
+// tempFiles the input and the output of the command, tracked to be removed if the program die.
+//
+// the input is created with a unique name, the output share it with its own extension.
+func tempFiles(tempDir, inExt, outExt string) (in, out string, err error) {
+	f, err := os.CreateTemp(tempDir, "go-comic-converter-avif-*"+inExt)
+	if err != nil {
+		return
+	}
+	in = f.Name()
+	out = strings.TrimSuffix(in, inExt) + outExt
+	epubtemp.Track(in)
+	epubtemp.Track(out)
+	if err = f.Close(); err != nil {
+		removeTempFiles(in, out)
+	}
+	return
+}
+
+func removeTempFiles(files ...string) {
+	for _, f := range files {
+		_ = os.Remove(f)
+		epubtemp.Untrack(f)
+	}
+}
@@ -0,0 +1,159 @@
+package epubimageavif
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"iter"
+)
+
+var errNoSize = errors.New("avif: size of the primary image not found")
+
+// DecodeConfig the size of the avif, read from the ispe property of its primary image without decoding it.
+//
+// the meta box give the primary item (pitm), its properties (ipco) and the properties of each item (ipma).
+// a rotation of 90° or 270° (irot) swap the width and the height.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	meta, ok := findBox(data, "meta")
+	if !ok || len(meta) < 4 {
+		return image.Config{}, errNoSize
+	}
+	meta = meta[4:] // full box: version and flags
+
+	var primary uint32
+	var properties [][]byte
+	var associations map[uint32][]int
+	for typ, b := range boxes(meta) {
+		switch typ {
+		case "pitm":
+			if len(b) >= 6 && b[0] == 0 {
+				primary = uint32(binary.BigEndian.Uint16(b[4:]))
+			} else if len(b) >= 8 {
+				primary = binary.BigEndian.Uint32(b[4:])
+			}
+		case "iprp":
+			for typ, b := range boxes(b) {
+				switch typ {
+				case "ipco":
+					for typ, b := range boxes(b) {
+						properties = append(properties, append([]byte(typ), b...))
+					}
+				case "ipma":
+					associations = itemProperties(b)
+				}
+			}
+		}
+	}
+
+	c := image.Config{ColorModel: color.NRGBAModel}
+	rotated := false
+	for _, index := range associations[primary] {
+		if index < 1 || index > len(properties) {
+			continue
+		}
+		p := properties[index-1]
+		switch typ, b := string(p[:4]), p[4:]; typ {
+		case "ispe":
+			if len(b) >= 12 {
+				c.Width, c.Height = int(binary.BigEndian.Uint32(b[4:])), int(binary.BigEndian.Uint32(b[8:]))
+			}
+		case "irot":
+			rotated = len(b) >= 1 && b[0]&1 == 1
+		}
+	}
+	if c.Width == 0 || c.Height == 0 {
+		return image.Config{}, errNoSize
+	}
+	if rotated {
+		c.Width, c.Height = c.Height, c.Width
+	}
+	return c, nil
+}
+
+// boxes of the ISOBMFF data: their type and their content.
+func boxes(data []byte) iter.Seq2[string, []byte] {
+	return func(yield func(string, []byte) bool) {
+		for len(data) >= 8 {
+			size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+			switch size {
+			case 0: // up to the end
+				size = uint64(len(data))
+			case 1: // 64 bits size
+				if len(data) < 16 {
+					return
+				}
+				size, header = binary.BigEndian.Uint64(data[8:]), 16
+			}
+			if size < header || size > uint64(len(data)) {
+				return
+			}
+			if !yield(string(data[4:8]), data[header:size]) {
+				return
+			}
+			data = data[size:]
+		}
+	}
+}
+
+// findBox the content of the first top level box of the type.
+func findBox(data []byte, typ string) ([]byte, bool) {
+	for t, b := range boxes(data) {
+		if t == typ {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// itemProperties the index (from 1) of the properties of each item of the ipma box.
+func itemProperties(b []byte) map[uint32][]int {
+	result := map[uint32][]int{}
+	if len(b) < 8 {
+		return result
+	}
+	version, large := b[0], b[3]&1 == 1
+	count := binary.BigEndian.Uint32(b[4:])
+	p := 8
+	for ; count > 0; count-- {
+		var item uint32
+		if version < 1 {
+			if p+2 > len(b) {
+				break
+			}
+			item, p = uint32(binary.BigEndian.Uint16(b[p:])), p+2
+		} else {
+			if p+4 > len(b) {
+				break
+			}
+			item, p = binary.BigEndian.Uint32(b[p:]), p+4
+		}
+		if p+1 > len(b) {
+			break
+		}
+		n := int(b[p])
+		p++
+		for ; n > 0; n-- {
+			// the first bit is the essential flag
+			if large {
+				if p+2 > len(b) {
+					return result
+				}
+				result[item] = append(result[item], int(binary.BigEndian.Uint16(b[p:])&0x7fff))
+				p += 2
+			} else {
+				if p+1 > len(b) {
+					return result
+				}
+				result[item] = append(result[item], int(b[p]&0x7f))
+				p++
+			}
+		}
+	}
+	return result
+}
@@ -3,15 +3,11 @@ package epubimagefilters
 import (
 	"image"
 	"image/color"
-
-	"github.com/disintegration/gift"
 )
 
-// AutoCrop Lookup for margin and crop
-func AutoCrop(img image.Image, bounds image.Rectangle, cutRatioLeft, cutRatioUp, cutRatioRight, cutRatioBottom int, limit int, skipIfLimitReached bool) gift.Filter {
-	return gift.Crop(
-		findMargin(img, bounds, cutRatioOptions{cutRatioLeft, cutRatioUp, cutRatioRight, cutRatioBottom}, limit, skipIfLimitReached),
-	)
+// Margin Lookup for margin: the area of the image to keep with a crop, empty if the image is blank.
+func Margin(img image.Image, bounds image.Rectangle, cutRatioLeft, cutRatioUp, cutRatioRight, cutRatioBottom int, limit int, skipIfLimitReached bool, safeArea int) image.Rectangle {
+	return findMargin(img, bounds, cutRatioOptions{cutRatioLeft, cutRatioUp, cutRatioRight, cutRatioBottom}, limit, skipIfLimitReached, safeArea)
 }
 
 // check if the color is blank enough
@@ -25,7 +21,7 @@ type cutRatioOptions struct {
 	Left, Up, Right, Bottom int
 }
 
-func findMargin(img image.Image, bounds image.Rectangle, cutRatio cutRatioOptions, limit int, skipIfLimitReached bool) image.Rectangle {
+func findMargin(img image.Image, bounds image.Rectangle, cutRatio cutRatioOptions, limit int, skipIfLimitReached bool, safeArea int) image.Rectangle {
 	imgArea := bounds
 
 LEFT:
@@ -84,8 +80,23 @@ BOTTOM:
 		imgArea.Max.Y--
 	}
 
-	// no limit or blankImage
-	if limit == 0 || imgArea.Dx() == 0 || imgArea.Dy() == 0 {
+	// blankImage
+	if imgArea.Dx() == 0 || imgArea.Dy() == 0 {
+		return imgArea
+	}
+
+	// never cut more than the safe area on each side, to protect art running to the edge
+	if safeArea > 0 {
+		imgArea = imgArea.Union(image.Rect(
+			bounds.Min.X+bounds.Dx()*safeArea/100,
+			bounds.Min.Y+bounds.Dy()*safeArea/100,
+			bounds.Max.X-bounds.Dx()*safeArea/100,
+			bounds.Max.Y-bounds.Dy()*safeArea/100,
+		))
+	}
+
+	// no limit
+	if limit == 0 {
 		return imgArea
 	}
 
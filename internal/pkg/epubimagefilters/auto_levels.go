@@ -0,0 +1,76 @@
+package epubimagefilters
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+// AutoLevels Stretch each color channel independently to restore faded colors.
+//
+// clipPercent is the percentage of the darkest and lightest pixels of each channel allowed to be clipped.
+func AutoLevels(clipPercent float64) gift.Filter {
+	return autoLevels{clipPercent}
+}
+
+type autoLevels struct {
+	clipPercent float64
+}
+
+// compute the darkest and lightest value to keep for each channel, between 0 and 1
+func (f autoLevels) levels(src image.Image) (low, high [3]float32) {
+	var bucket [3][256]int
+	for x := src.Bounds().Min.X; x < src.Bounds().Max.X; x++ {
+		for y := src.Bounds().Min.Y; y < src.Bounds().Max.Y; y++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			bucket[0][c.R]++
+			bucket[1][c.G]++
+			bucket[2][c.B]++
+		}
+	}
+
+	limit := int(float64(src.Bounds().Dx()*src.Bounds().Dy()) * f.clipPercent / 100)
+	for c := range bucket {
+		lowIdx, highIdx := 0, 255
+		for count := 0; lowIdx < highIdx; lowIdx++ {
+			if count += bucket[c][lowIdx]; count > limit {
+				break
+			}
+		}
+		for count := 0; highIdx > lowIdx; highIdx-- {
+			if count += bucket[c][highIdx]; count > limit {
+				break
+			}
+		}
+		low[c], high[c] = float32(lowIdx)/255, float32(highIdx)/255
+	}
+	return
+}
+
+func (f autoLevels) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	low, high := f.levels(src)
+
+	stretch := func(v float32, c int) float32 {
+		if high[c] <= low[c] {
+			return v
+		}
+		v = (v - low[c]) / (high[c] - low[c])
+		if v < 0 {
+			return 0
+		}
+		if v > 1 {
+			return 1
+		}
+		return v
+	}
+	gift.ColorFunc(func(r0, g0, b0, a0 float32) (r float32, g float32, b float32, a float32) {
+		return stretch(r0, 0), stretch(g0, 1), stretch(b0, 2), a0
+	}).Draw(dst, src, options)
+}
+
+func (f autoLevels) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
+	dstBounds = srcBounds
+	return
+}
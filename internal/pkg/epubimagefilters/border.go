@@ -0,0 +1,31 @@
+package epubimagefilters
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+// Border Draw a frame of width pixels around the image.
+//
+// The image is enlarged by width on each side, so the content is never hidden.
+func Border(width int, c color.Color) gift.Filter {
+	return border{width, c}
+}
+
+type border struct {
+	width int
+	color color.Color
+}
+
+func (f border) Draw(dst draw.Image, src image.Image, _ *gift.Options) {
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(f.color), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds().Inset(f.width), src, src.Bounds().Min, draw.Src)
+}
+
+func (f border) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
+	dstBounds = image.Rect(0, 0, srcBounds.Dx()+2*f.width, srcBounds.Dy()+2*f.width)
+	return
+}
@@ -7,30 +7,23 @@ import (
 	"github.com/disintegration/gift"
 )
 
-// CropSplitDoublePage Cut a double page in 2 part: left and right.
+// CropSplitDoublePage Cut a page in n parts from left to right, and keep the part at index.
 //
-// This will cut in the middle of the page.
-func CropSplitDoublePage(right bool) gift.Filter {
-	return cropSplitDoublePage{right}
+// A double page is cut in 2 parts, a triptych in 3, ...
+func CropSplitDoublePage(index int, parts int) gift.Filter {
+	return cropSplitDoublePage{index, parts}
 }
 
 type cropSplitDoublePage struct {
-	right bool
+	index int
+	parts int
 }
 
 func (p cropSplitDoublePage) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
-	if p.right {
-		dstBounds = image.Rect(
-			srcBounds.Max.X/2, srcBounds.Min.Y,
-			srcBounds.Max.X, srcBounds.Max.Y,
-		)
-	} else {
-		dstBounds = image.Rect(
-			srcBounds.Min.X, srcBounds.Min.Y,
-			srcBounds.Max.X/2, srcBounds.Max.Y,
-		)
-	}
-	return
+	return image.Rect(
+		srcBounds.Min.X+srcBounds.Dx()*p.index/p.parts, srcBounds.Min.Y,
+		srcBounds.Min.X+srcBounds.Dx()*(p.index+1)/p.parts, srcBounds.Max.Y,
+	)
 }
 
 func (p cropSplitDoublePage) Draw(dst draw.Image, src image.Image, options *gift.Options) {
@@ -0,0 +1,96 @@
+package epubimagefilters
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+// Despeckle Remove isolated dark or light specks (dust, scan noise) of at most size pixels.
+//
+// The specks are filled with the average color around them.
+func Despeckle(size int) gift.Filter {
+	return despeckle{size}
+}
+
+type despeckle struct {
+	size int
+}
+
+func (f despeckle) Draw(dst draw.Image, src image.Image, _ *gift.Options) {
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	b := dst.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dark := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dark[y*w+x] = color.GrayModel.Convert(dst.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y < 0x80
+		}
+	}
+
+	// 8-connected neighbours of a pixel
+	neighbours := func(i int, yield func(int)) {
+		x, y := i%w, i/w
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dx != 0 || dy != 0) && x+dx >= 0 && x+dx < w && y+dy >= 0 && y+dy < h {
+					yield((y+dy)*w + x + dx)
+				}
+			}
+		}
+	}
+
+	visited := make([]bool, w*h)
+	var component, stack []int
+	for start := range dark {
+		if visited[start] {
+			continue
+		}
+
+		// walk the whole component, only the first pixels are kept
+		component, stack = component[:0], append(stack[:0], start)
+		visited[start] = true
+		count := 0
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if count++; count <= f.size {
+				component = append(component, i)
+			}
+			neighbours(i, func(n int) {
+				if !visited[n] && dark[n] == dark[start] {
+					visited[n] = true
+					stack = append(stack, n)
+				}
+			})
+		}
+		if count > f.size {
+			continue
+		}
+
+		var r, g, bl, a, n uint64
+		for _, i := range component {
+			neighbours(i, func(j int) {
+				if dark[j] != dark[start] {
+					cr, cg, cb, ca := dst.At(b.Min.X+j%w, b.Min.Y+j/w).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			})
+		}
+		if n == 0 {
+			continue
+		}
+		c := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)}
+		for _, i := range component {
+			dst.Set(b.Min.X+i%w, b.Min.Y+i/w, c)
+		}
+	}
+}
+
+func (f despeckle) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
+	dstBounds = srcBounds
+	return
+}
@@ -0,0 +1,145 @@
+package epubimagefilters
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+// Dither Reduce the image to the 16 levels of gray of the e-ink screens, with a Floyd–Steinberg error diffusion.
+//
+// The rounding error of each pixel is spread to its neighbours, the gradients become a fine grain instead of bands.
+func Dither() gift.Filter {
+	return dither{}
+}
+
+type dither struct {
+}
+
+// quantize round the gray value (0-255) to the nearest of the 16 levels: 0x00, 0x11, ..., 0xFF.
+func quantize(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 0xff {
+		return 0xff
+	}
+	return uint8(int(v+8.5)/0x11) * 0x11
+}
+
+func (f dither) Draw(dst draw.Image, src image.Image, _ *gift.Options) {
+	b := dst.Bounds()
+	w, h := b.Dx(), b.Dy()
+	sb := src.Bounds()
+
+	// the errors of the current and the next row
+	cur, next := make([]float32, w+2), make([]float32, w+2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float32
+			if g, ok := src.(*image.Gray); ok {
+				v = float32(g.GrayAt(sb.Min.X+x, sb.Min.Y+y).Y)
+			} else {
+				v = float32(color.GrayModel.Convert(src.At(sb.Min.X+x, sb.Min.Y+y)).(color.Gray).Y)
+			}
+			v += cur[x+1]
+			q := quantize(v)
+			if g, ok := dst.(*image.Gray); ok {
+				g.SetGray(b.Min.X+x, b.Min.Y+y, color.Gray{Y: q})
+			} else {
+				dst.Set(b.Min.X+x, b.Min.Y+y, color.Gray{Y: q})
+			}
+
+			e := v - float32(q)
+			cur[x+2] += e * 7 / 16
+			next[x] += e * 3 / 16
+			next[x+1] += e * 5 / 16
+			next[x+2] += e * 1 / 16
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+}
+
+func (f dither) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
+	dstBounds = srcBounds
+	return
+}
+
+// OrderedDither Reduce the image to the 16 levels of gray of the e-ink screens, with a Bayer matrix of size x size (2, 4 or 8).
+//
+// Each pixel is rounded up or down by a threshold of the matrix repeated over the image: a regular pattern,
+// without the worms of the error diffusion on the screentones, that compress better in JPEG.
+func OrderedDither(size int) gift.Filter {
+	return orderedDither{bayer(size)}
+}
+
+type orderedDither struct {
+	matrix [][]float32
+}
+
+// bayer the thresholds of the Bayer matrix of the size (a power of 2), between 0 and 1.
+func bayer(size int) [][]float32 {
+	m := [][]int{{0}}
+	for n := 1; n < size; n *= 2 {
+		next := make([][]int, 2*n)
+		for y := range next {
+			next[y] = make([]int, 2*n)
+			for x := range next[y] {
+				// each quadrant repeat the matrix, offset by 0, 2, 3 and 1
+				v := 4 * m[y%n][x%n]
+				switch {
+				case y < n && x >= n:
+					v += 2
+				case y >= n && x < n:
+					v += 3
+				case y >= n && x >= n:
+					v += 1
+				}
+				next[y][x] = v
+			}
+		}
+		m = next
+	}
+
+	thresholds := make([][]float32, len(m))
+	for y := range m {
+		thresholds[y] = make([]float32, len(m))
+		for x := range m[y] {
+			thresholds[y][x] = (float32(m[y][x]) + 0.5) / float32(len(m)*len(m))
+		}
+	}
+	return thresholds
+}
+
+func (f orderedDither) Draw(dst draw.Image, src image.Image, _ *gift.Options) {
+	b := dst.Bounds()
+	sb := src.Bounds()
+	size := len(f.matrix)
+	for y := 0; y < b.Dy(); y++ {
+		row := f.matrix[y%size]
+		for x := 0; x < b.Dx(); x++ {
+			var v uint8
+			if g, ok := src.(*image.Gray); ok {
+				v = g.GrayAt(sb.Min.X+x, sb.Min.Y+y).Y
+			} else {
+				v = color.GrayModel.Convert(src.At(sb.Min.X+x, sb.Min.Y+y)).(color.Gray).Y
+			}
+			// the level below, plus one if the remainder is above the threshold
+			level := min(15, int(float32(v)/0x11+row[x%size]))
+			q := uint8(level * 0x11)
+			if g, ok := dst.(*image.Gray); ok {
+				g.SetGray(b.Min.X+x, b.Min.Y+y, color.Gray{Y: q})
+			} else {
+				dst.Set(b.Min.X+x, b.Min.Y+y, color.Gray{Y: q})
+			}
+		}
+	}
+}
+
+func (f orderedDither) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
+	dstBounds = srcBounds
+	return
+}
@@ -0,0 +1,50 @@
+package epubimagefilters
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+type Region struct {
+	Rect image.Rectangle
+	Blur bool
+}
+
+// Redact Hide some regions of the image, by blurring them or filling them with white.
+//
+// Useful to remove watermarks or ads.
+func Redact(regions []Region) gift.Filter {
+	return redact{regions}
+}
+
+type redact struct {
+	regions []Region
+}
+
+func (p redact) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
+	return srcBounds
+}
+
+func (p redact) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	for _, region := range p.regions {
+		r := region.Rect.Add(src.Bounds().Min).Intersect(src.Bounds())
+		if r.Empty() {
+			continue
+		}
+		if !region.Blur {
+			draw.Draw(dst, r.Sub(src.Bounds().Min).Add(dst.Bounds().Min), image.White, image.Point{}, draw.Src)
+			continue
+		}
+
+		// strong enough to hide any details
+		sigma := float32(min(r.Dx(), r.Dy())) / 4
+		sigma = max(2, min(sigma, 50))
+		g := gift.New(gift.Crop(r), gift.GaussianBlur(sigma))
+		tmp := image.NewNRGBA64(g.Bounds(src.Bounds()))
+		g.Draw(tmp, src)
+		draw.Draw(dst, r.Sub(src.Bounds().Min).Add(dst.Bounds().Min), tmp, tmp.Bounds().Min, draw.Src)
+	}
+}
@@ -0,0 +1,74 @@
+package epubimagefilters
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+// ToneMap Stretch the range low-high (between 0 and 1) of a 16 bits image before it is reduced to 8 bits.
+//
+// Archival scans rarely use the full range, a simple truncation lose the shadow details.
+// The range is computed once on the source page with ToneMapLevels, the parts of a split page get the same levels.
+func ToneMap(low, high float32) gift.Filter {
+	return toneMap{low, high}
+}
+
+type toneMap struct {
+	low, high float32
+}
+
+// ToneMapLevels the darkest and lightest value to keep, between 0 and 1.
+//
+// clipPercent is the percentage of the darkest and lightest pixels allowed to be clipped.
+func ToneMapLevels(src image.Image, clipPercent float64) (low, high float32) {
+	bucket := make([]int, 1<<16)
+	for x := src.Bounds().Min.X; x < src.Bounds().Max.X; x++ {
+		for y := src.Bounds().Min.Y; y < src.Bounds().Max.Y; y++ {
+			bucket[color.Gray16Model.Convert(src.At(x, y)).(color.Gray16).Y]++
+		}
+	}
+
+	limit := int(float64(src.Bounds().Dx()*src.Bounds().Dy()) * clipPercent / 100)
+	lowIdx, highIdx := 0, len(bucket)-1
+	for count := 0; lowIdx < highIdx; lowIdx++ {
+		if count += bucket[lowIdx]; count > limit {
+			break
+		}
+	}
+	for count := 0; highIdx > lowIdx; highIdx-- {
+		if count += bucket[highIdx]; count > limit {
+			break
+		}
+	}
+	return float32(lowIdx) / 0xffff, float32(highIdx) / 0xffff
+}
+
+func (f toneMap) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	low, high := f.low, f.high
+	if high <= low {
+		draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+		return
+	}
+
+	stretch := func(v float32) float32 {
+		v = (v - low) / (high - low)
+		if v < 0 {
+			return 0
+		}
+		if v > 1 {
+			return 1
+		}
+		return v
+	}
+	gift.ColorFunc(func(r0, g0, b0, a0 float32) (r float32, g float32, b float32, a float32) {
+		return stretch(r0), stretch(g0), stretch(b0), a0
+	}).Draw(dst, src, options)
+}
+
+func (f toneMap) Bounds(srcBounds image.Rectangle) (dstBounds image.Rectangle) {
+	dstBounds = srcBounds
+	return
+}
@@ -0,0 +1,351 @@
+/*
+Package epubimageicc Handle ICC color profiles embedded into the source images.
+
+The RGB profiles based on matrix and tone curves are converted (sRGB, Adobe RGB, Display P3, ProPhoto, ...),
+and the RGB and CMYK profiles based on lookup tables through their perceptual table (A2B0).
+The other profiles are reported by ToSRGB, the image keep the default conversion.
+*/
+package epubimageicc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/disintegration/gift"
+)
+
+var (
+	errUnsupportedProfile = errors.New("unsupported icc profile")
+	// ErrLUTProfile a lookup table of an unsupported type or size, the colors are converted without it.
+	ErrLUTProfile = errors.New("icc lookup table not supported")
+)
+
+// Extract the ICC profile of an encoded image. Support jpeg and png.
+//
+// return nil if no profile is found.
+func Extract(format string, data []byte) []byte {
+	switch format {
+	case "jpeg":
+		return extractJpeg(data)
+	case "png":
+		return extractPng(data)
+	default:
+		return nil
+	}
+}
+
+// profile can be split into multiple APP2 segments in a JPEG.
+func extractJpeg(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	type chunk struct {
+		seq  byte
+		data []byte
+	}
+	var chunks []chunk
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE2 && len(seg) > 14 && bytes.HasPrefix(seg, iccJpegPrefix) {
+			chunks = append(chunks, chunk{seg[12], seg[14:]})
+		}
+		i += 2 + size
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	var profile []byte
+	for _, c := range chunks {
+		profile = append(profile, c.data...)
+	}
+	return profile
+}
+
+// profile is stored zlib compressed in the iCCP chunk of a PNG.
+func extractPng(data []byte) []byte {
+	if len(data) < 8 || string(data[:8]) != "\x89PNG\r\n\x1a\n" {
+		return nil
+	}
+	for i := 8; i+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		if size < 0 || i+12+size > len(data) {
+			return nil
+		}
+		switch kind {
+		case "iCCP":
+			chunk := data[i+8 : i+8+size]
+			// profile name, null separator, compression method
+			nameEnd := bytes.IndexByte(chunk, 0)
+			if nameEnd < 0 || nameEnd+2 > len(chunk) {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(chunk[nameEnd+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := io.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			return profile
+		case "IDAT", "IEND":
+			// iCCP should be before the image data
+			return nil
+		}
+		i += 12 + size
+	}
+	return nil
+}
+
+// curve convert encoded value between 0 and 1 into linear value
+type curve func(float64) float64
+
+type profile struct {
+	space     string
+	colorants [3][3]float64 // XYZ of red, green, blue in D50
+	curves    [3]curve
+	lut       *lutConverter // the profiles based on lookup tables
+}
+
+// parse a matrix/TRC RGB profile, or a RGB or CMYK profile with a perceptual lookup table
+func parse(data []byte) (p profile, err error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return p, errUnsupportedProfile
+	}
+	p.space = string(data[16:20])
+	pcs := string(data[20:24])
+	if (p.space != "RGB " && p.space != "CMYK") || (pcs != "XYZ " && pcs != "Lab ") {
+		return p, errUnsupportedProfile
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for n := range count {
+		entry := 132 + n*12
+		if entry+12 > len(data) {
+			return p, errUnsupportedProfile
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return p, errUnsupportedProfile
+		}
+		tags[string(data[entry:entry+4])] = data[offset : offset+size]
+	}
+
+	// the lookup tables take precedence over the matrix for the perceptual intent
+	if a2b, ok := tags["A2B0"]; ok {
+		l, err := parseLut(a2b)
+		if err != nil {
+			return p, err
+		}
+		if l.inputs != map[string]int{"RGB ": 3, "CMYK": 4}[p.space] {
+			return p, ErrLUTProfile
+		}
+		p.lut = newLutConverter(l, pcs, string(a2b[:4]) == "mft2")
+		return p, nil
+	}
+	if p.space != "RGB " || pcs != "XYZ " {
+		return p, errUnsupportedProfile
+	}
+	for i, name := range []string{"r", "g", "b"} {
+		xyz, ok := tags[name+"XYZ"]
+		if !ok || len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+			return p, errUnsupportedProfile
+		}
+		for j := range 3 {
+			p.colorants[i][j] = s15Fixed16(xyz[8+j*4:])
+		}
+		trc, ok := tags[name+"TRC"]
+		if !ok {
+			return p, errUnsupportedProfile
+		}
+		if p.curves[i], err = parseCurve(trc); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// parse curv and para tag type
+func parseCurve(b []byte) (curve, error) {
+	if len(b) < 12 {
+		return nil, errUnsupportedProfile
+	}
+	switch string(b[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		switch {
+		case n == 0:
+			return func(v float64) float64 { return v }, nil
+		case n == 1 && len(b) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(b[12:])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }, nil
+		case len(b) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(b[12+2*i:])) / 65535
+			}
+			return func(v float64) float64 {
+				pos := v * float64(n-1)
+				i := int(pos)
+				if i >= n-1 {
+					return table[n-1]
+				}
+				return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+			}, nil
+		}
+	case "para":
+		nbParams := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}
+		kind := binary.BigEndian.Uint16(b[8:])
+		n, ok := nbParams[kind]
+		if !ok || len(b) < 12+4*n {
+			return nil, errUnsupportedProfile
+		}
+		var params [7]float64
+		for i := range n {
+			params[i] = s15Fixed16(b[12+4*i:])
+		}
+		g, a, pb, c, d, e, f := params[0], params[1], params[2], params[3], params[4], params[5], params[6]
+		switch kind {
+		case 0:
+			return func(v float64) float64 { return math.Pow(v, g) }, nil
+		case 1:
+			return func(v float64) float64 {
+				if v >= -pb/a {
+					return math.Pow(a*v+pb, g)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(v float64) float64 {
+				if v >= -pb/a {
+					return math.Pow(a*v+pb, g) + c
+				}
+				return c
+			}, nil
+		case 3:
+			return func(v float64) float64 {
+				if v >= d {
+					return math.Pow(a*v+pb, g)
+				}
+				return c * v
+			}, nil
+		case 4:
+			return func(v float64) float64 {
+				if v >= d {
+					return math.Pow(a*v+pb, g) + e
+				}
+				return c*v + f
+			}, nil
+		}
+	}
+	return nil, errUnsupportedProfile
+}
+
+// check if the colorants are the same as sRGB, in that case no conversion is needed
+func (p profile) isSRGB() bool {
+	if p.lut != nil {
+		return false
+	}
+	for i := range 3 {
+		for j := range 3 {
+			if math.Abs(p.colorants[i][j]-srgbColorants[i][j]) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToSRGB Filter that convert the colors of the profile into sRGB.
+//
+// return nil if the profile is missing or already sRGB, or with the error if it is not supported.
+// The gray profiles are left as is.
+//
+// The filter of a CMYK profile need the *image.CMYK decoded, before any other filter.
+func ToSRGB(iccProfile []byte) (gift.Filter, error) {
+	if iccProfile == nil || (len(iccProfile) >= 20 && string(iccProfile[16:20]) == "GRAY") {
+		return nil, nil
+	}
+	p, err := parse(iccProfile)
+	if err != nil || p.isSRGB() {
+		return nil, err
+	}
+	if p.lut != nil {
+		if p.space == "CMYK" {
+			return cmykFilter{p.lut}, nil
+		}
+		return p.lut.rgb(), nil
+	}
+
+	// source RGB -> XYZ D50 -> linear sRGB
+	var m [3][3]float64
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				m[i][j] += xyzToSRGB[i][k] * p.colorants[j][k]
+			}
+		}
+	}
+
+	const lutSize = 4096
+	var in [3][lutSize]float64
+	for c := range 3 {
+		for i := range lutSize {
+			in[c][i] = p.curves[c](float64(i) / (lutSize - 1))
+		}
+	}
+	var out [lutSize]float32
+	for i := range lutSize {
+		out[i] = float32(srgbEncode(float64(i) / (lutSize - 1)))
+	}
+
+	lookup := func(v float64) float32 {
+		if v <= 0 {
+			return 0
+		}
+		if v >= 1 {
+			return 1
+		}
+		return out[int(v*(lutSize-1)+0.5)]
+	}
+
+	return gift.ColorFunc(func(r0, g0, b0, a0 float32) (r float32, g float32, b float32, a float32) {
+		lr := in[0][int(r0*(lutSize-1)+0.5)]
+		lg := in[1][int(g0*(lutSize-1)+0.5)]
+		lb := in[2][int(b0*(lutSize-1)+0.5)]
+		return lookup(m[0][0]*lr + m[0][1]*lg + m[0][2]*lb),
+			lookup(m[1][0]*lr + m[1][1]*lg + m[1][2]*lb),
+			lookup(m[2][0]*lr + m[2][1]*lg + m[2][2]*lb),
+			a0
+	}), nil
+}
@@ -0,0 +1,231 @@
+package epubimageicc
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/gift"
+)
+
+// profile with the tags, each aligned on 4 bytes.
+func buildProfile(space, pcs string, tags map[string][]byte) []byte {
+	header := make([]byte, 132+12*len(tags))
+	copy(header[16:], space)
+	copy(header[20:], pcs)
+	copy(header[36:], "acsp")
+	binary.BigEndian.PutUint32(header[128:], uint32(len(tags)))
+	data := header
+	n := 0
+	for sig, tag := range tags {
+		entry := header[132+12*n:]
+		copy(entry, sig)
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(data)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(tag)))
+		data = append(data, tag...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+		n++
+	}
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+// D50 Lab of a sRGB color
+func srgbToLab(rgb [3]float64) [3]float64 {
+	var xyz [3]float64
+	for j, v := range rgb {
+		for i := range 3 {
+			xyz[i] += srgbColorants[j][i] * srgbDecode(v)
+		}
+	}
+	f := func(t float64) float64 {
+		if t > math.Pow(6.0/29, 3) {
+			return math.Cbrt(t)
+		}
+		return t/(3*(6.0/29)*(6.0/29)) + 4.0/29
+	}
+	fx, fy, fz := f(xyz[0]/d50[0]), f(xyz[1]/d50[1]), f(xyz[2]/d50[2])
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// naive conversion of the corners of the CMYK grid
+func cmykCorner(c, m, y, k int) [3]float64 {
+	return [3]float64{float64((1 - c) * (1 - k)), float64((1 - m) * (1 - k)), float64((1 - y) * (1 - k))}
+}
+
+// lut8 or lut16 tag of a CMYK to Lab grid of 2 points, the corners with the naive conversion.
+func cmykLut(size int) []byte {
+	tag := []byte("mft1\x00\x00\x00\x00\x04\x03\x02\x00")
+	if size == 2 {
+		tag[3] = '2'
+	}
+	for i := range 9 {
+		v := int32(0)
+		if i%4 == 0 {
+			v = 1 << 16
+		}
+		tag = binary.BigEndian.AppendUint32(tag, uint32(v))
+	}
+	put := func(v float64) {
+		if size == 1 {
+			tag = append(tag, uint8(math.Round(v*255)))
+		} else {
+			tag = binary.BigEndian.AppendUint16(tag, uint16(math.Round(v*65535)))
+		}
+	}
+	entries := 256
+	if size == 2 {
+		entries = 2
+		tag = binary.BigEndian.AppendUint16(tag, 2)
+		tag = binary.BigEndian.AppendUint16(tag, 2)
+	}
+	identity := func(n int) {
+		for range n {
+			for i := range entries {
+				put(float64(i) / float64(entries-1))
+			}
+		}
+	}
+	identity(4)
+	// legacy 16 bits encoding, 0xff00 is the maximum
+	scale := 1.0
+	if size == 2 {
+		scale = 65280.0 / 65535
+	}
+	for c := range 2 {
+		for m := range 2 {
+			for y := range 2 {
+				for k := range 2 {
+					lab := srgbToLab(cmykCorner(c, m, y, k))
+					put(lab[0] / 100 * scale)
+					put((lab[1] + 128) / 255 * scale)
+					put((lab[2] + 128) / 255 * scale)
+				}
+			}
+		}
+	}
+	identity(3)
+	return tag
+}
+
+func s15(v float64) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(v*65536))))
+}
+
+// lutAtoB tag of sRGB to XYZ: the sRGB curves and the colorants matrix, without grid.
+func srgbLutAtoB() []byte {
+	tag := make([]byte, 32)
+	copy(tag, "mAB ")
+	tag[8], tag[9] = 3, 3
+	identity := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x00")
+
+	binary.BigEndian.PutUint32(tag[12:], uint32(len(tag)))
+	for range 3 {
+		tag = append(tag, identity...)
+	}
+	binary.BigEndian.PutUint32(tag[16:], uint32(len(tag)))
+	for i := range 3 {
+		for j := range 3 {
+			tag = append(tag, s15(srgbColorants[j][i]*32768/65535)...)
+		}
+	}
+	for range 3 {
+		tag = append(tag, s15(0)...)
+	}
+	binary.BigEndian.PutUint32(tag[20:], uint32(len(tag)))
+	for range 3 {
+		tag = append(tag, identity...)
+	}
+	binary.BigEndian.PutUint32(tag[28:], uint32(len(tag)))
+	for range 3 {
+		tag = append(tag, "para\x00\x00\x00\x00\x00\x03\x00\x00"...)
+		for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+			tag = append(tag, s15(v)...)
+		}
+	}
+	return tag
+}
+
+// TestToSRGBLut the profiles based on lookup tables give the colors of their table.
+func TestToSRGBLut(t *testing.T) {
+	cmykColors := []struct {
+		c, m, y, k int
+	}{{0, 0, 0, 0}, {1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 1, 1, 0}, {0, 0, 0, 1}, {1, 1, 1, 1}}
+	rgbColors := []color.RGBA{{0, 0, 0, 255}, {255, 255, 255, 255}, {200, 30, 90, 255}, {12, 140, 250, 255}}
+
+	for _, tc := range []struct {
+		name      string
+		profile   []byte
+		tolerance int
+	}{
+		{"cmyk lut16", buildProfile("CMYK", "Lab ", map[string][]byte{"A2B0": cmykLut(2)}), 1},
+		// the 8 bits Lab are too coarse for the saturated colors
+		{"cmyk lut8", buildProfile("CMYK", "Lab ", map[string][]byte{"A2B0": cmykLut(1)}), 8},
+		{"rgb lutAtoB", buildProfile("RGB ", "XYZ ", map[string][]byte{"A2B0": srgbLutAtoB()}), 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ToSRGB(tc.profile)
+			if err != nil || f == nil {
+				t.Fatalf("filter %v, error %v", f, err)
+			}
+
+			var src image.Image
+			var want []color.RGBA
+			if tc.profile[16] == 'C' {
+				cmyk := image.NewCMYK(image.Rect(0, 0, len(cmykColors), 1))
+				for x, c := range cmykColors {
+					cmyk.SetCMYK(x, 0, color.CMYK{uint8(255 * c.c), uint8(255 * c.m), uint8(255 * c.y), uint8(255 * c.k)})
+					rgb := cmykCorner(c.c, c.m, c.y, c.k)
+					want = append(want, color.RGBA{uint8(255 * rgb[0]), uint8(255 * rgb[1]), uint8(255 * rgb[2]), 255})
+				}
+				src = cmyk
+			} else {
+				rgba := image.NewRGBA(image.Rect(0, 0, len(rgbColors), 1))
+				for x, c := range rgbColors {
+					rgba.SetRGBA(x, 0, c)
+				}
+				src, want = rgba, rgbColors
+			}
+
+			dst := image.NewRGBA(src.Bounds())
+			gift.New(f).Draw(dst, src)
+			for x, w := range want {
+				got := dst.RGBAAt(x, 0)
+				for i, d := range []int{int(got.R) - int(w.R), int(got.G) - int(w.G), int(got.B) - int(w.B)} {
+					if d > tc.tolerance || -d > tc.tolerance {
+						t.Errorf("pixel %d channel %d: got %v, want %v", x, i, got, w)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestToSRGBUnsupported the truncated or unsupported tables are reported, the gray profiles are left as is.
+func TestToSRGBUnsupported(t *testing.T) {
+	lut16 := cmykLut(2)
+	for _, tc := range []struct {
+		name    string
+		profile []byte
+		want    error
+	}{
+		{"truncated lut16", buildProfile("CMYK", "Lab ", map[string][]byte{"A2B0": lut16[:len(lut16)-20]}), ErrLUTProfile},
+		{"wrong inputs", buildProfile("RGB ", "Lab ", map[string][]byte{"A2B0": lut16}), ErrLUTProfile},
+		{"unknown type", buildProfile("CMYK", "Lab ", map[string][]byte{"A2B0": []byte("mBA \x00\x00\x00\x00\x04\x03\x00\x00" + string(make([]byte, 20)))}), ErrLUTProfile},
+		{"cmyk without table", buildProfile("CMYK", "Lab ", nil), errUnsupportedProfile},
+		{"gray", buildProfile("GRAY", "XYZ ", nil), nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ToSRGB(tc.profile)
+			if f != nil || !errors.Is(err, tc.want) {
+				t.Errorf("filter %v, error %v, want %v", f, err, tc.want)
+			}
+		})
+	}
+}
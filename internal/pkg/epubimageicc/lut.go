@@ -0,0 +1,407 @@
+package epubimageicc
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/disintegration/gift"
+)
+
+// lut the A2B0 tag of a profile: device values between 0 and 1 into the PCS (Lab or XYZ) between 0 and 1.
+//
+// lut8 and lut16: input curves, grid, output curves.
+// lutAtoB: A curves, grid, M curves, matrix, B curves. Each stage but the B curves is optional.
+type lut struct {
+	inputs int
+	a      []curve
+	grid   []int     // points by input
+	clut   []float64 // 3 outputs by point, the first input vary the slowest
+	m      []curve
+	matrix *[12]float64 // 3x3 then the offset
+	b      []curve
+}
+
+// curveSteps resolution of the curves once sampled, the parametric curves are too slow by pixel.
+const curveSteps = 4096
+
+// sampled curve, linear interpolation between the steps.
+func sampled(c curve) curve {
+	table := make([]float64, curveSteps)
+	for i := range table {
+		table[i] = c(float64(i) / (curveSteps - 1))
+	}
+	return func(v float64) float64 {
+		if v <= 0 {
+			return table[0]
+		}
+		if v >= 1 {
+			return table[curveSteps-1]
+		}
+		pos := v * (curveSteps - 1)
+		i := int(pos)
+		if i >= curveSteps-1 {
+			return table[curveSteps-1]
+		}
+		return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+	}
+}
+
+// table curve of n values, 8 or 16 bits.
+func tableCurve(b []byte, n int, size int) curve {
+	table := make([]float64, n)
+	for i := range table {
+		table[i] = readUnit(b[i*size:], size)
+	}
+	return func(v float64) float64 {
+		pos := math.Max(0, math.Min(1, v)) * float64(n-1)
+		i := int(pos)
+		if i >= n-1 {
+			return table[n-1]
+		}
+		return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+	}
+}
+
+func readUnit(b []byte, size int) float64 {
+	if size == 1 {
+		return float64(b[0]) / 255
+	}
+	return float64(binary.BigEndian.Uint16(b)) / 65535
+}
+
+// parseLut parse the lut8 (mft1), lut16 (mft2) and lutAtoB (mAB) tag types with 3 outputs.
+func parseLut(b []byte) (*lut, error) {
+	if len(b) < 32 {
+		return nil, ErrLUTProfile
+	}
+	inputs, outputs := int(b[8]), int(b[9])
+	if inputs < 1 || inputs > 4 || outputs != 3 {
+		return nil, ErrLUTProfile
+	}
+	switch string(b[:4]) {
+	case "mft1", "mft2":
+		return parseLutN(b, inputs)
+	case "mAB ":
+		return parseLutAtoB(b, inputs)
+	}
+	return nil, ErrLUTProfile
+}
+
+// lut8 and lut16, the matrix only apply to the XYZ input and is ignored.
+func parseLutN(b []byte, inputs int) (*lut, error) {
+	size, inEntries, outEntries, offset := 1, 256, 256, 48
+	if string(b[:4]) == "mft2" {
+		if len(b) < 52 {
+			return nil, ErrLUTProfile
+		}
+		size, offset = 2, 52
+		inEntries, outEntries = int(binary.BigEndian.Uint16(b[48:])), int(binary.BigEndian.Uint16(b[50:]))
+	}
+	points := int(b[10])
+	if inEntries < 2 || outEntries < 2 || points < 2 {
+		return nil, ErrLUTProfile
+	}
+	grid := make([]int, inputs)
+	count := 1
+	for i := range grid {
+		grid[i] = points
+		count *= points
+	}
+	if len(b) < offset+(inputs*inEntries+count*3+3*outEntries)*size {
+		return nil, ErrLUTProfile
+	}
+
+	l := &lut{inputs: inputs, grid: grid}
+	for range inputs {
+		l.a = append(l.a, sampled(tableCurve(b[offset:], inEntries, size)))
+		offset += inEntries * size
+	}
+	l.clut = make([]float64, count*3)
+	for i := range l.clut {
+		l.clut[i] = readUnit(b[offset+i*size:], size)
+	}
+	offset += count * 3 * size
+	for range 3 {
+		l.b = append(l.b, sampled(tableCurve(b[offset:], outEntries, size)))
+		offset += outEntries * size
+	}
+	return l, nil
+}
+
+func parseLutAtoB(b []byte, inputs int) (l *lut, err error) {
+	at := func(pos int) (int, bool) {
+		o := int(binary.BigEndian.Uint32(b[pos:]))
+		return o, o > 0 && o < len(b)
+	}
+	l = &lut{inputs: inputs}
+
+	if o, ok := at(12); !ok {
+		return nil, ErrLUTProfile
+	} else if l.b, err = parseCurves(b[o:], 3); err != nil {
+		return nil, err
+	}
+	if o, ok := at(16); ok {
+		if o+48 > len(b) {
+			return nil, ErrLUTProfile
+		}
+		l.matrix = &[12]float64{}
+		for i := range l.matrix {
+			l.matrix[i] = s15Fixed16(b[o+4*i:])
+		}
+	}
+	if o, ok := at(20); ok {
+		if l.m, err = parseCurves(b[o:], 3); err != nil {
+			return nil, err
+		}
+	}
+	if o, ok := at(24); ok {
+		if o+20 > len(b) || (b[o+16] != 1 && b[o+16] != 2) {
+			return nil, ErrLUTProfile
+		}
+		size, count := int(b[o+16]), 1
+		l.grid = make([]int, inputs)
+		for i := range l.grid {
+			if l.grid[i] = int(b[o+i]); l.grid[i] < 2 {
+				return nil, ErrLUTProfile
+			}
+			count *= l.grid[i]
+		}
+		if o+20+count*3*size > len(b) {
+			return nil, ErrLUTProfile
+		}
+		l.clut = make([]float64, count*3)
+		for i := range l.clut {
+			l.clut[i] = readUnit(b[o+20+i*size:], size)
+		}
+	} else if inputs != 3 {
+		return nil, ErrLUTProfile
+	}
+	if o, ok := at(28); ok {
+		if l.a, err = parseCurves(b[o:], inputs); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// parseCurves a sequence of n curv or para, each aligned on 4 bytes.
+func parseCurves(b []byte, n int) ([]curve, error) {
+	curves := make([]curve, n)
+	offset := 0
+	for i := range curves {
+		if offset >= len(b) {
+			return nil, ErrLUTProfile
+		}
+		c, size, err := parseCurveSize(b[offset:])
+		if err != nil {
+			return nil, err
+		}
+		curves[i] = sampled(c)
+		offset += (size + 3) &^ 3
+	}
+	return curves, nil
+}
+
+// parseCurveSize parse a curve and return the number of bytes used.
+func parseCurveSize(b []byte) (curve, int, error) {
+	c, err := parseCurve(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	if string(b[:4]) == "curv" {
+		return c, 12 + 2*int(binary.BigEndian.Uint32(b[8:])), nil
+	}
+	return c, 12 + 4*[]int{1, 3, 4, 5, 7}[binary.BigEndian.Uint16(b[8:])], nil
+}
+
+// eval the lookup table on device values between 0 and 1.
+func (l *lut) eval(in []float64) (out [3]float64) {
+	var v [4]float64
+	for i := range l.inputs {
+		v[i] = in[i]
+		if l.a != nil {
+			v[i] = l.a[i](v[i])
+		}
+	}
+	if l.clut != nil {
+		out = l.interpolate(v[:l.inputs])
+	} else {
+		copy(out[:], v[:3])
+	}
+	if l.m != nil {
+		for i := range 3 {
+			out[i] = l.m[i](out[i])
+		}
+	}
+	if m := l.matrix; m != nil {
+		out = [3]float64{
+			m[0]*out[0] + m[1]*out[1] + m[2]*out[2] + m[9],
+			m[3]*out[0] + m[4]*out[1] + m[5]*out[2] + m[10],
+			m[6]*out[0] + m[7]*out[1] + m[8]*out[2] + m[11],
+		}
+	}
+	for i := range 3 {
+		out[i] = l.b[i](out[i])
+	}
+	return
+}
+
+// interpolate the grid, multilinear between the 2^inputs points around the values.
+func (l *lut) interpolate(v []float64) (out [3]float64) {
+	var base [4]int
+	var frac [4]float64
+	for i, g := range l.grid {
+		pos := math.Max(0, math.Min(1, v[i])) * float64(g-1)
+		base[i] = min(int(pos), g-2)
+		frac[i] = pos - float64(base[i])
+	}
+	for corner := range 1 << len(l.grid) {
+		w, index := 1.0, 0
+		for i, g := range l.grid {
+			p := base[i]
+			if corner&(1<<i) != 0 {
+				p++
+				w *= frac[i]
+			} else {
+				w *= 1 - frac[i]
+			}
+			index = index*g + p
+		}
+		if w == 0 {
+			continue
+		}
+		for k := range 3 {
+			out[k] += w * l.clut[index*3+k]
+		}
+	}
+	return
+}
+
+// D50 white of the PCS
+var d50 = [3]float64{0.9642, 1, 0.8249}
+
+// pcsToXYZ decode the output of the lookup table into XYZ D50.
+//
+// the lut16 use the legacy 16 bits Lab encoding, where 0xff00 is the maximum.
+func pcsToXYZ(pcs string, legacy bool, v [3]float64) [3]float64 {
+	if pcs == "XYZ " {
+		return [3]float64{v[0] * 65535 / 32768, v[1] * 65535 / 32768, v[2] * 65535 / 32768}
+	}
+	if legacy {
+		for i := range v {
+			v[i] *= 65535.0 / 65280
+		}
+	}
+	l, a, b := v[0]*100, v[1]*255-128, v[2]*255-128
+	fy := (l + 16) / 116
+	f := [3]float64{fy + a/500, fy, fy - b/200}
+	var xyz [3]float64
+	for i, t := range f {
+		if t > 6.0/29 {
+			xyz[i] = d50[i] * t * t * t
+		} else {
+			xyz[i] = d50[i] * 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+		}
+	}
+	return xyz
+}
+
+// lutConverter convert device values into sRGB between 0 and 1 through the lookup table.
+type lutConverter struct {
+	lut    *lut
+	pcs    string
+	legacy bool
+	encode [curveSteps]float32
+}
+
+func newLutConverter(l *lut, pcs string, legacy bool) *lutConverter {
+	c := &lutConverter{lut: l, pcs: pcs, legacy: legacy}
+	for i := range c.encode {
+		c.encode[i] = float32(srgbEncode(float64(i) / (curveSteps - 1)))
+	}
+	return c
+}
+
+func (c *lutConverter) convert(in []float64) (rgb [3]float32) {
+	xyz := pcsToXYZ(c.pcs, c.legacy, c.lut.eval(in))
+	for i := range 3 {
+		v := xyzToSRGB[i][0]*xyz[0] + xyzToSRGB[i][1]*xyz[1] + xyzToSRGB[i][2]*xyz[2]
+		switch {
+		case v <= 0:
+			rgb[i] = 0
+		case v >= 1:
+			rgb[i] = 1
+		default:
+			rgb[i] = c.encode[int(v*(curveSteps-1)+0.5)]
+		}
+	}
+	return
+}
+
+// rgb the filter of the RGB profiles.
+func (c *lutConverter) rgb() gift.Filter {
+	return gift.ColorFunc(func(r0, g0, b0, a0 float32) (float32, float32, float32, float32) {
+		rgb := c.convert([]float64{float64(r0), float64(g0), float64(b0)})
+		return rgb[0], rgb[1], rgb[2], a0
+	})
+}
+
+// cmykFilter convert the inks of a CMYK image with its profile. Any other image is copied.
+type cmykFilter struct {
+	*lutConverter
+}
+
+func (f cmykFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return srcBounds
+}
+
+func (f cmykFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	cmyk, ok := src.(*image.CMYK)
+	if !ok {
+		draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+		return
+	}
+	sb, db := src.Bounds(), dst.Bounds()
+	w, h := min(sb.Dx(), db.Dx()), min(sb.Dy(), db.Dy())
+	rgba, _ := dst.(*image.RGBA)
+
+	drawRows := func(y0, y1 int) {
+		in := make([]float64, 4)
+		for y := y0; y < y1; y++ {
+			for x := range w {
+				p := cmyk.Pix[cmyk.PixOffset(sb.Min.X+x, sb.Min.Y+y):]
+				for i := range in {
+					in[i] = float64(p[i]) / 255
+				}
+				rgb := f.convert(in)
+				c := color.RGBA{uint8(rgb[0]*255 + 0.5), uint8(rgb[1]*255 + 0.5), uint8(rgb[2]*255 + 0.5), 0xff}
+				if rgba != nil {
+					copy(rgba.Pix[rgba.PixOffset(db.Min.X+x, db.Min.Y+y):], []uint8{c.R, c.G, c.B, c.A})
+				} else {
+					dst.Set(db.Min.X+x, db.Min.Y+y, c)
+				}
+			}
+		}
+	}
+
+	procs := runtime.GOMAXPROCS(0)
+	if options != nil && !options.Parallelization || procs == 1 || h < 2*procs {
+		drawRows(0, h)
+		return
+	}
+	step := (h + procs - 1) / procs
+	var wg sync.WaitGroup
+	for y := 0; y < h; y += step {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			drawRows(y0, y1)
+		}(y, min(y+step, h))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,162 @@
+package epubimageicc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+var iccJpegPrefix = []byte("ICC_PROFILE\x00")
+
+// XYZ of the sRGB colorants adapted to D50
+var srgbColorants = [3][3]float64{
+	{0.4360747, 0.2225045, 0.0139322},
+	{0.3850649, 0.7168786, 0.0971045},
+	{0.1430804, 0.0606169, 0.7141733},
+}
+
+// XYZ D50 to linear sRGB, inverse of the colorants matrix
+var xyzToSRGB = func() (inv [3][3]float64) {
+	// colorants are the columns of the RGB to XYZ matrix
+	var m [3][3]float64
+	for i := range 3 {
+		for j := range 3 {
+			m[i][j] = srgbColorants[j][i]
+		}
+	}
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	inv[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+	inv[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+	inv[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+	inv[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+	inv[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+	inv[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+	inv[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+	inv[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+	inv[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+	return
+}()
+
+// linear to sRGB transfer function
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// sRGB to linear transfer function
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// SRGB a compact ICC v2 sRGB profile.
+func SRGB() []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+
+	xyz := func(x, y, z float64) []byte {
+		b := bytes.NewBufferString("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			_ = binary.Write(b, binary.BigEndian, int32(math.Round(v*65536)))
+		}
+		return b.Bytes()
+	}
+
+	trc := bytes.NewBufferString("curv\x00\x00\x00\x00")
+	_ = binary.Write(trc, binary.BigEndian, uint32(256))
+	for i := range 256 {
+		_ = binary.Write(trc, binary.BigEndian, uint16(math.Round(srgbDecode(float64(i)/255)*65535)))
+	}
+
+	text := func(s string) []byte {
+		return append([]byte("text\x00\x00\x00\x00"+s), 0)
+	}
+
+	desc := func(s string) []byte {
+		b := bytes.NewBufferString("desc\x00\x00\x00\x00")
+		_ = binary.Write(b, binary.BigEndian, uint32(len(s)+1))
+		b.WriteString(s)
+		b.WriteByte(0)
+		// no unicode and scriptcode description
+		b.Write(make([]byte, 4+4+2+1+67))
+		return b.Bytes()
+	}
+
+	tags := []tag{
+		{"desc", desc("sRGB")},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"rXYZ", xyz(srgbColorants[0][0], srgbColorants[0][1], srgbColorants[0][2])},
+		{"gXYZ", xyz(srgbColorants[1][0], srgbColorants[1][1], srgbColorants[1][2])},
+		{"bXYZ", xyz(srgbColorants[2][0], srgbColorants[2][1], srgbColorants[2][2])},
+		{"rTRC", trc.Bytes()},
+		{"gTRC", trc.Bytes()},
+		{"bTRC", trc.Bytes()},
+	}
+
+	// header + tag count + tag table, then data aligned on 4 bytes
+	offset := 128 + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	_ = binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	offsets := map[*byte]int{}
+	for _, t := range tags {
+		pos, ok := offsets[&t.data[0]]
+		if !ok {
+			pos = offset + data.Len()
+			offsets[&t.data[0]] = pos
+			data.Write(t.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		_ = binary.Write(&table, binary.BigEndian, uint32(pos))
+		_ = binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(offset+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntrRGB XYZ ")
+	binary.BigEndian.PutUint16(header[24:], 2000) // date 2000-01-01
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+	// D50 illuminant
+	for i, v := range []float64{0.9642, 1, 0.8249} {
+		binary.BigEndian.PutUint32(header[68+i*4:], uint32(int32(math.Round(v*65536))))
+	}
+
+	return append(append(header, table.Bytes()...), data.Bytes()...)
+}
+
+// EmbedJpeg insert the ICC profile into a JPEG, right after the start of image.
+func EmbedJpeg(jpeg []byte, iccProfile []byte) []byte {
+	if len(jpeg) < 2 || len(iccProfile) == 0 {
+		return jpeg
+	}
+	// a segment is limited to 65535 bytes including its size
+	const maxChunk = 65535 - 2 - 14
+	nbChunks := (len(iccProfile) + maxChunk - 1) / maxChunk
+
+	var b bytes.Buffer
+	b.Write(jpeg[:2])
+	for i := range nbChunks {
+		chunk := iccProfile[i*maxChunk : min((i+1)*maxChunk, len(iccProfile))]
+		b.Write([]byte{0xFF, 0xE2})
+		_ = binary.Write(&b, binary.BigEndian, uint16(2+len(iccJpegPrefix)+2+len(chunk)))
+		b.Write(iccJpegPrefix)
+		b.Write([]byte{byte(i + 1), byte(nbChunks)})
+		b.Write(chunk)
+	}
+	b.Write(jpeg[2:])
+	return b.Bytes()
+}
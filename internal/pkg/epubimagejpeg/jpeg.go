@@ -0,0 +1,56 @@
+/*
+Package epubimagejpeg Decode and encode jpeg with the selected backend.
+
+The go backend use the standard library. The libjpeg backend use the native libjpeg-turbo library,
+it is only available if the program is built with cgo and the libjpeg tag:
+
+	go build -tags libjpeg
+*/
+package epubimagejpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// Backends of the jpeg codec
+const (
+	Go      = "go"
+	LibJpeg = "libjpeg"
+)
+
+// Available check if the backend is compiled in.
+func Available(backend string) bool {
+	switch backend {
+	case Go:
+		return true
+	case LibJpeg:
+		return nativeAvailable
+	default:
+		return false
+	}
+}
+
+// Decode the image like image.Decode, the jpeg are decoded with the backend.
+//
+// CMYK jpeg are always decoded by the standard library.
+func Decode(backend string, data []byte) (image.Image, string, error) {
+	if backend == LibJpeg && nativeAvailable && bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		if img, err := nativeDecode(data); err != errUnsupported {
+			return img, "jpeg", err
+		}
+	}
+	return image.Decode(bytes.NewReader(data))
+}
+
+// Encode the image into jpeg with the backend.
+func Encode(backend string, w io.Writer, img image.Image, quality int) error {
+	if backend == LibJpeg && nativeAvailable {
+		if err := nativeEncode(w, img, quality); err != errUnsupported {
+			return err
+		}
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
@@ -0,0 +1,192 @@
+//go:build cgo && libjpeg
+
+package epubimagejpeg
+
+/*
+#cgo LDFLAGS: -ljpeg
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <setjmp.h>
+#include <jpeglib.h>
+
+// the default error handler exit the program, jump back with the message instead
+struct gcc_error {
+	struct jpeg_error_mgr pub;
+	jmp_buf jmp;
+	char *msg;
+};
+
+static void gcc_error_exit(j_common_ptr cinfo) {
+	struct gcc_error *err = (struct gcc_error *)cinfo->err;
+	(*cinfo->err->format_message)(cinfo, err->msg);
+	longjmp(err->jmp, 1);
+}
+
+// read the size and the number of components of the output: 1 = gray, 4 = rgba, 0 = unsupported (cmyk)
+static int gcc_jpeg_header(const unsigned char *data, unsigned long size, int *width, int *height, int *components, char *msg) {
+	struct jpeg_decompress_struct cinfo;
+	struct gcc_error err;
+	cinfo.err = jpeg_std_error(&err.pub);
+	err.pub.error_exit = gcc_error_exit;
+	err.msg = msg;
+	if (setjmp(err.jmp)) {
+		jpeg_destroy_decompress(&cinfo);
+		return 0;
+	}
+	jpeg_create_decompress(&cinfo);
+	jpeg_mem_src(&cinfo, data, size);
+	jpeg_read_header(&cinfo, TRUE);
+	*width = cinfo.image_width;
+	*height = cinfo.image_height;
+	switch (cinfo.jpeg_color_space) {
+	case JCS_GRAYSCALE:
+		*components = 1;
+		break;
+	case JCS_CMYK:
+	case JCS_YCCK:
+		*components = 0;
+		break;
+	default:
+		*components = 4;
+	}
+	jpeg_destroy_decompress(&cinfo);
+	return 1;
+}
+
+static int gcc_jpeg_decode(const unsigned char *data, unsigned long size, unsigned char *pix, int components, char *msg) {
+	struct jpeg_decompress_struct cinfo;
+	struct gcc_error err;
+	cinfo.err = jpeg_std_error(&err.pub);
+	err.pub.error_exit = gcc_error_exit;
+	err.msg = msg;
+	if (setjmp(err.jmp)) {
+		jpeg_destroy_decompress(&cinfo);
+		return 0;
+	}
+	jpeg_create_decompress(&cinfo);
+	jpeg_mem_src(&cinfo, data, size);
+	jpeg_read_header(&cinfo, TRUE);
+	cinfo.out_color_space = components == 1 ? JCS_GRAYSCALE : JCS_EXT_RGBA;
+	jpeg_start_decompress(&cinfo);
+	size_t stride = (size_t)cinfo.output_width * components;
+	while (cinfo.output_scanline < cinfo.output_height) {
+		JSAMPROW row = pix + cinfo.output_scanline * stride;
+		jpeg_read_scanlines(&cinfo, &row, 1);
+	}
+	jpeg_finish_decompress(&cinfo);
+	jpeg_destroy_decompress(&cinfo);
+	return 1;
+}
+
+static int gcc_jpeg_encode(unsigned char *pix, int width, int height, int stride, int components, int quality, unsigned char **out, unsigned long *outsize, char *msg) {
+	struct jpeg_compress_struct cinfo;
+	struct gcc_error err;
+	cinfo.err = jpeg_std_error(&err.pub);
+	err.pub.error_exit = gcc_error_exit;
+	err.msg = msg;
+	if (setjmp(err.jmp)) {
+		jpeg_destroy_compress(&cinfo);
+		return 0;
+	}
+	jpeg_create_compress(&cinfo);
+	jpeg_mem_dest(&cinfo, out, outsize);
+	cinfo.image_width = width;
+	cinfo.image_height = height;
+	cinfo.input_components = components;
+	cinfo.in_color_space = components == 1 ? JCS_GRAYSCALE : JCS_EXT_RGBA;
+	jpeg_set_defaults(&cinfo);
+	jpeg_set_quality(&cinfo, quality, TRUE);
+	jpeg_start_compress(&cinfo, TRUE);
+	while (cinfo.next_scanline < cinfo.image_height) {
+		JSAMPROW row = pix + (size_t)cinfo.next_scanline * stride;
+		jpeg_write_scanlines(&cinfo, &row, 1);
+	}
+	jpeg_finish_compress(&cinfo);
+	jpeg_destroy_compress(&cinfo);
+	return 1;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"unsafe"
+)
+
+const nativeAvailable = true
+
+// errUnsupported the image is handled by the standard library instead
+var errUnsupported = errors.New("unsupported by libjpeg backend")
+
+func nativeError(msg []byte) error {
+	return errors.New("libjpeg: " + C.GoString((*C.char)(unsafe.Pointer(&msg[0]))))
+}
+
+func nativeDecode(data []byte) (image.Image, error) {
+	msg := make([]byte, C.JMSG_LENGTH_MAX)
+	var width, height, components C.int
+	src := (*C.uchar)(unsafe.Pointer(&data[0]))
+	if C.gcc_jpeg_header(src, C.ulong(len(data)), &width, &height, &components, (*C.char)(unsafe.Pointer(&msg[0]))) == 0 {
+		return nil, nativeError(msg)
+	}
+	if components == 0 || width == 0 || height == 0 {
+		return nil, errUnsupported
+	}
+
+	var img image.Image
+	var pix []byte
+	r := image.Rect(0, 0, int(width), int(height))
+	if components == 1 {
+		gray := image.NewGray(r)
+		img, pix = gray, gray.Pix
+	} else {
+		rgba := image.NewRGBA(r)
+		img, pix = rgba, rgba.Pix
+	}
+	if C.gcc_jpeg_decode(src, C.ulong(len(data)), (*C.uchar)(unsafe.Pointer(&pix[0])), components, (*C.char)(unsafe.Pointer(&msg[0]))) == 0 {
+		return nil, nativeError(msg)
+	}
+	return img, nil
+}
+
+func nativeEncode(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return errUnsupported
+	}
+
+	var pix []byte
+	var stride, components int
+	switch t := img.(type) {
+	case *image.Gray:
+		pix, stride, components = t.Pix[t.PixOffset(b.Min.X, b.Min.Y):], t.Stride, 1
+	case *image.RGBA:
+		pix, stride, components = t.Pix[t.PixOffset(b.Min.X, b.Min.Y):], t.Stride, 4
+	default:
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+		pix, stride, components = rgba.Pix, rgba.Stride, 4
+	}
+
+	msg := make([]byte, C.JMSG_LENGTH_MAX)
+	var out *C.uchar
+	var size C.ulong
+	ok := C.gcc_jpeg_encode(
+		(*C.uchar)(unsafe.Pointer(&pix[0])),
+		C.int(b.Dx()), C.int(b.Dy()), C.int(stride), C.int(components), C.int(quality),
+		&out, &size,
+		(*C.char)(unsafe.Pointer(&msg[0])),
+	)
+	if out != nil {
+		defer C.free(unsafe.Pointer(out))
+	}
+	if ok == 0 {
+		return nativeError(msg)
+	}
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(out), C.int(size)))
+	return err
+}
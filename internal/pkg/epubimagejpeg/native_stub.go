@@ -0,0 +1,21 @@
+//go:build !cgo || !libjpeg
+
+package epubimagejpeg
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+const nativeAvailable = false
+
+var errUnsupported = errors.New("libjpeg backend not available")
+
+func nativeDecode([]byte) (image.Image, error) {
+	return nil, errUnsupported
+}
+
+func nativeEncode(io.Writer, image.Image, int) error {
+	return errUnsupported
+}
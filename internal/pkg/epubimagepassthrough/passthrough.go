@@ -3,6 +3,7 @@ package epubimagepassthrough
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
@@ -11,6 +12,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -20,50 +22,94 @@ import (
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageprocessor"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubprogress"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/sortpath"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
 	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
 
 type ePUBImagePassthrough struct {
 	epuboptions.EPUBOptions
+	ctx context.Context
 }
 
-func (e ePUBImagePassthrough) Load() (images []epubimage.EPUBImage, err error) {
-	fi, err := os.Stat(e.Input)
+func (e ePUBImagePassthrough) Load(ctx context.Context) (images epubimage.Index, err error) {
+	e.ctx = ctx
+	fsys, name := e.InputFileSystem()
+	fi, err := fs.Stat(fsys, name)
 	if err != nil {
-		return
+		return images, utils.WithExitCode(err, utils.ExitInput)
 	}
 
+	var load func(fsys fs.FS, input string, index *epubimage.IndexWriter) error
 	if fi.IsDir() {
-		return e.loadDir()
+		load = e.loadDir
 	} else {
-		switch ext := strings.ToLower(filepath.Ext(e.Input)); ext {
+		switch ext := strings.ToLower(path.Ext(name)); ext {
 		case ".cbz", ".zip":
-			return e.loadCbz()
+			load = e.loadCbz
 		case ".cbr", ".rar":
-			return e.loadCbr()
+			load = e.loadCbr
 		default:
-			return nil, fmt.Errorf("unknown file format (%s): support .cbz, .zip, .cbr, .rar", ext)
+			if r, ok := epubimageprocessor.LookupArchiveReader(fsys, name); ok {
+				load = func(fsys fs.FS, input string, index *epubimage.IndexWriter) error {
+					return e.loadArchive(fsys, input, index, r)
+				}
+				break
+			}
+			err = utils.WithExitCode(fmt.Errorf("%w (%s): support .cbz, .zip, .cbr, .rar", utils.ErrUnsupportedFormat, ext), utils.ExitInput)
+			return
+		}
+	}
+
+	if !e.KeepTemp && !e.InMemory {
+		epubtemp.Track(e.ImgStorage())
+		epubtemp.Track(e.ImgIndex())
+	}
+	index, err := epubimage.NewIndexWriter(e.ImgIndex())
+	if err != nil {
+		return
+	}
+	// the temporary files are already marked as output
+	err = utils.WithExitCode(load(fsys, name, index), utils.ExitInput)
+	images, cerr := index.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err == nil && images.Len() == 0 {
+		err = errNoImagesFound
+	}
+
+	if errors.Is(err, utils.ErrInterrupted) || ctx.Err() != nil {
+		for _, f := range []string{e.ImgStorage(), e.ImgIndex()} {
+			_ = os.Remove(f)
+			epubtemp.Untrack(f)
+		}
+	}
+	if err != nil {
+		if e.InMemory {
+			epubzip.RemoveMemory(e.ImgStorage())
 		}
+		return epubimage.Index{}, err
 	}
+	return images, nil
 }
 
 func (e ePUBImagePassthrough) CoverTitleData(o epubimageprocessor.CoverTitleDataOptions) (epubzip.Image, error) {
 	return epubimageprocessor.New(e.EPUBOptions).CoverTitleData(o)
 }
 
-var errNoImagesFound = errors.New("no images found")
+var errNoImagesFound = utils.ErrNoImagesFound
 
 func New(o epuboptions.EPUBOptions) epubimageprocessor.EPUBImageProcessor {
-	return ePUBImagePassthrough{o}
+	return ePUBImagePassthrough{o, context.Background()}
 }
 
-func (e ePUBImagePassthrough) loadDir() (images []epubimage.EPUBImage, err error) {
+func (e ePUBImagePassthrough) loadDir(fsys fs.FS, input string, index *epubimage.IndexWriter) (err error) {
 	imagesPath := make([]string, 0)
 
-	input := filepath.Clean(e.Input)
-	err = filepath.WalkDir(input, func(path string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(fsys, input, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -87,7 +133,7 @@ func (e ePUBImagePassthrough) loadDir() (images []epubimage.EPUBImage, err error
 	sort.Sort(sortpath.By(imagesPath, e.SortPathMode))
 
 	var imgStorage epubzip.StorageImageWriter
-	imgStorage, err = epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format)
+	imgStorage, err = epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format, e.InMemory)
 	if err != nil {
 		return
 	}
@@ -97,8 +143,10 @@ func (e ePUBImagePassthrough) loadDir() (images []epubimage.EPUBImage, err error
 	bar := epubprogress.New(epubprogress.Options{
 		Quiet:       e.Quiet,
 		Json:        e.Json,
+		Backend:     e.Progress,
 		Max:         len(imagesPath),
 		Description: "Copying",
+		Unit:        "pages",
 		CurrentJob:  1,
 		TotalJob:    2,
 	})
@@ -110,38 +158,40 @@ func (e ePUBImagePassthrough) loadDir() (images []epubimage.EPUBImage, err error
 		img, err = e.copyRawDataToStorage(
 			imgStorage,
 			func() ([]byte, error) {
-				f, err := os.Open(imgPath)
-				if err != nil {
-					return nil, err
-				}
-				defer f.Close()
-				return io.ReadAll(f)
+				return fs.ReadFile(fsys, imgPath)
 			},
 			i,
-			input,
-			imgPath,
+			relPath(input, imgPath),
 		)
 		if err != nil {
 			return
 		}
 
-		images = append(images, img)
+		if err = index.Add(img.Id, img); err != nil {
+			return
+		}
 		_ = bar.Add(1)
 	}
 
-	if len(images) == 0 {
-		err = errNoImagesFound
-	}
-
 	return
 
 }
 
-func (e ePUBImagePassthrough) loadCbz() (images []epubimage.EPUBImage, err error) {
-	images = make([]epubimage.EPUBImage, 0)
+// loadArchive load an archive of a registered reader, walked like a directory
+func (e ePUBImagePassthrough) loadArchive(fsys fs.FS, input string, index *epubimage.IndexWriter, r epuboptions.ArchiveReader) error {
+	afs, err := r.Open(fsys, input)
+	if err != nil {
+		return err
+	}
+	if c, ok := afs.(io.Closer); ok {
+		defer c.Close()
+	}
+	return e.loadDir(afs, ".", index)
+}
 
-	input := filepath.Clean(e.Input)
-	r, err := zip.OpenReader(input)
+func (e ePUBImagePassthrough) loadCbz(fsys fs.FS, input string, index *epubimage.IndexWriter) (err error) {
+
+	r, err := epubzip.OpenFSReader(fsys, input)
 	if err != nil {
 		return
 	}
@@ -172,7 +222,7 @@ func (e ePUBImagePassthrough) loadCbz() (images []epubimage.EPUBImage, err error
 	}
 
 	var imgStorage epubzip.StorageImageWriter
-	imgStorage, err = epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format)
+	imgStorage, err = epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format, e.InMemory)
 	if err != nil {
 		return
 	}
@@ -182,8 +232,10 @@ func (e ePUBImagePassthrough) loadCbz() (images []epubimage.EPUBImage, err error
 	bar := epubprogress.New(epubprogress.Options{
 		Quiet:       e.Quiet,
 		Json:        e.Json,
+		Backend:     e.Progress,
 		Max:         len(imagesZip),
 		Description: "Copying",
+		Unit:        "pages",
 		CurrentJob:  1,
 		TotalJob:    2,
 	})
@@ -207,7 +259,6 @@ func (e ePUBImagePassthrough) loadCbz() (images []epubimage.EPUBImage, err error
 				return io.ReadAll(f)
 			},
 			indexedNames[imgZip.Name],
-			"",
 			imgZip.Name,
 		)
 
@@ -215,22 +266,19 @@ func (e ePUBImagePassthrough) loadCbz() (images []epubimage.EPUBImage, err error
 			return
 		}
 
-		images = append(images, img)
+		if err = index.Add(img.Id, img); err != nil {
+			return
+		}
 		_ = bar.Add(1)
 	}
 
-	if len(images) == 0 {
-		err = errNoImagesFound
-	}
-
 	return
 }
 
-func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error) {
-	images = make([]epubimage.EPUBImage, 0)
+func (e ePUBImagePassthrough) loadCbr(fsys fs.FS, input string, index *epubimage.IndexWriter) (err error) {
 
 	var isSolid bool
-	files, err := rardecode.List(e.Input)
+	files, err := rardecode.List(input, rardecode.FileSystem(fsys))
 	if err != nil {
 		return
 	}
@@ -258,7 +306,7 @@ func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error
 	}
 
 	var imgStorage epubzip.StorageImageWriter
-	imgStorage, err = epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format)
+	imgStorage, err = epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format, e.InMemory)
 	if err != nil {
 		return
 	}
@@ -268,8 +316,10 @@ func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error
 	bar := epubprogress.New(epubprogress.Options{
 		Quiet:       e.Quiet,
 		Json:        e.Json,
+		Backend:     e.Progress,
 		Max:         len(names),
 		Description: "Copying",
+		Unit:        "pages",
 		CurrentJob:  1,
 		TotalJob:    2,
 	})
@@ -277,7 +327,7 @@ func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error
 
 	if isSolid {
 		var r *rardecode.ReadCloser
-		r, err = rardecode.OpenReader(e.Input)
+		r, err = rardecode.OpenReader(input, rardecode.FileSystem(fsys))
 		if err != nil {
 			return
 		}
@@ -304,7 +354,6 @@ func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error
 					return io.ReadAll(r)
 				},
 				indexedNames[f.Name],
-				"",
 				f.Name,
 			)
 
@@ -312,7 +361,9 @@ func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error
 				return
 			}
 
-			images = append(images, img)
+			if err = index.Add(img.Id, img); err != nil {
+				return
+			}
 			_ = bar.Add(1)
 		}
 	} else {
@@ -330,7 +381,6 @@ func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error
 						return io.ReadAll(f)
 					},
 					i,
-					"",
 					file.Name,
 				)
 
@@ -338,19 +388,25 @@ func (e ePUBImagePassthrough) loadCbr() (images []epubimage.EPUBImage, err error
 					return
 				}
 
-				images = append(images, img)
+				if err = index.Add(img.Id, img); err != nil {
+					return
+				}
 				_ = bar.Add(1)
 			}
 		}
 	}
 
-	if len(images) == 0 {
-		err = errNoImagesFound
-	}
-
 	return
 }
 
+// relPath the path of a file of the directory, relative to it.
+func relPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return strings.TrimPrefix(name, dir+"/")
+}
+
 func (e ePUBImagePassthrough) isSupportedImage(path string) bool {
 	switch strings.ToLower(filepath.Ext(path)) {
 	case ".jpg", ".jpeg", ".png":
@@ -365,9 +421,16 @@ func (e ePUBImagePassthrough) copyRawDataToStorage(
 	imgStorage epubzip.StorageImageWriter,
 	getData func() ([]byte, error),
 	id int,
-	dirname string,
 	filename string,
 ) (img epubimage.EPUBImage, err error) {
+	if utils.Interrupted() {
+		err = utils.ErrInterrupted
+		return
+	}
+	if err = e.ctx.Err(); err != nil {
+		return
+	}
+
 	var uncompressedData []byte
 	uncompressedData, err = getData()
 	if err != nil {
@@ -375,11 +438,6 @@ func (e ePUBImagePassthrough) copyRawDataToStorage(
 	}
 
 	p, fn := filepath.Split(filepath.Clean(filename))
-	if p == dirname {
-		p = ""
-	} else {
-		p = p[len(dirname)+1:]
-	}
 
 	var (
 		format       string
@@ -387,7 +445,7 @@ func (e ePUBImagePassthrough) copyRawDataToStorage(
 		decode       func(r io.Reader) (image.Image, error)
 	)
 
-	switch filepath.Ext(fn) {
+	switch strings.ToLower(filepath.Ext(fn)) {
 	case ".png":
 		format = "png"
 		decodeConfig = png.DecodeConfig
@@ -401,6 +459,7 @@ func (e ePUBImagePassthrough) copyRawDataToStorage(
 	var config image.Config
 	config, err = decodeConfig(bytes.NewReader(uncompressedData))
 	if err != nil {
+		err = &utils.DecodeError{Page: filename, Err: err}
 		return
 	}
 
@@ -408,6 +467,7 @@ func (e ePUBImagePassthrough) copyRawDataToStorage(
 	if id == 0 {
 		rawImage, err = decode(bytes.NewReader(uncompressedData))
 		if err != nil {
+			err = &utils.DecodeError{Page: filename, Err: err}
 			return
 		}
 	}
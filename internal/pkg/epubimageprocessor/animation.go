@@ -0,0 +1,175 @@
+package epubimageprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+
+	"golang.org/x/image/font/gofont/gomonobold"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+)
+
+var errNoFFmpeg = errors.New("ffmpeg is required to extract a still from a video")
+
+// brands of the ftyp box of the still images: AVIF, HEIF and HEIC
+var imageBrands = []string{"mif1", "msf1", "avif", "avis", "heic", "heix", "heim", "heis", "hevc", "hevx"}
+
+// brands of the ftyp box of the videos: MP4, M4V, QuickTime and 3GP
+var videoBrands = []string{"isom", "iso2", "iso4", "iso5", "iso6", "mp41", "mp42", "avc1", "dash", "M4V ", "qt  ", "3gp4", "3gp5", "3gp6", "3g2a", "mmp4"}
+
+// detect animated pages: gif, mp4 and webm
+func animationFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return "gif"
+	case isVideo(data):
+		return "mp4"
+	case bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return "webm"
+	}
+	return ""
+}
+
+// isVideo the ftyp box has the brand of a video, and none of an image: the AVIF and the HEIC share the container of the MP4.
+//
+// the box hold its size, "ftyp", the major brand, the minor version then the compatible brands.
+func isVideo(data []byte) bool {
+	if len(data) < 16 || !bytes.Equal(data[4:8], []byte("ftyp")) {
+		return false
+	}
+	size := min(int(binary.BigEndian.Uint32(data)), len(data))
+	brands := []string{string(data[8:12])}
+	for p := 16; p+4 <= size; p += 4 {
+		brands = append(brands, string(data[p:p+4]))
+	}
+	if slices.ContainsFunc(brands, func(b string) bool { return slices.Contains(imageBrands, b) }) {
+		return false
+	}
+	return slices.ContainsFunc(brands, func(b string) bool { return slices.Contains(videoBrands, b) })
+}
+
+// decodeAnimation extract a representative still of the animation, with an optional badge.
+//
+// the gif of a single frame are not animated, they have no badge.
+func (e ePUBImageProcessor) decodeAnimation(format string, data []byte) (img image.Image, err error) {
+	frames := 0
+	if format == "gif" {
+		img, frames, err = gifStill(data)
+	} else {
+		img, err = videoStill(e.TempDir, e.InMemory, data)
+	}
+	if err != nil {
+		return
+	}
+	if e.Image.AnimationBadge && (format != "gif" || frames > 1) {
+		img = animationBadge(img)
+	}
+	return
+}
+
+// gifStill render the frame in the middle of the animation, and return the number of frames.
+//
+// frames only contain the changes from the previous one, so they are composed on a white canvas.
+func gifStill(data []byte) (image.Image, int, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, frame := range g.Image[:len(g.Image)/2+1] {
+		var previous *image.RGBA
+		if g.Disposal != nil && g.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if i == len(g.Image)/2 || g.Disposal == nil {
+			continue
+		}
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.White, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return canvas, len(g.Image), nil
+}
+
+// videoStill use ffmpeg to pick a representative frame of the video.
+//
+// in memory, the video is given through a pipe: an mp4 that must seek (its index at the end) can't be read.
+func videoStill(tempDir string, inMemory bool, data []byte) (image.Image, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, errNoFFmpeg
+	}
+	if inMemory {
+		return ffmpegStill(ffmpeg, "pipe:0", bytes.NewReader(data))
+	}
+
+	// mp4 may need to seek, the video is provided as a file
+	f, err := os.CreateTemp(tempDir, "go-comic-converter-*.video")
+	if err != nil {
+		return nil, err
+	}
+	epubtemp.Track(f.Name())
+	defer func() {
+		_ = os.Remove(f.Name())
+		epubtemp.Untrack(f.Name())
+	}()
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	return ffmpegStill(ffmpeg, f.Name(), nil)
+}
+
+// ffmpegStill the representative frame of the input of ffmpeg, a file or the pipe of stdin.
+func ffmpegStill(ffmpeg string, input string, stdin io.Reader) (image.Image, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-v", "error", "-i", input, "-vf", "thumbnail", "-frames:v", "1", "-f", "image2pipe", "-c:v", "png", "-")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New("ffmpeg: " + string(bytes.TrimSpace(stderr.Bytes())))
+	}
+	return png.Decode(&stdout)
+}
+
+// animationBadge draw an "ANIMATION" label on the top right corner.
+func animationBadge(src image.Image) image.Image {
+	w, h := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+	size := max(w/24, 12)
+	f, _ := truetype.Parse(gomonobold.TTF)
+	face := truetype.NewFace(f, &truetype.Options{Size: size, DPI: 72})
+
+	g := gg.NewContext(int(w), int(h))
+	g.DrawImage(src, -src.Bounds().Min.X, -src.Bounds().Min.Y)
+	g.SetFontFace(face)
+	tw, th := g.MeasureString("ANIMATION")
+	margin := size / 2
+	g.SetColor(color.Black)
+	g.DrawRoundedRectangle(w-tw-3*margin, margin, tw+2*margin, th+2*margin, margin/2)
+	g.Fill()
+	g.SetColor(color.White)
+	g.DrawStringAnchored("ANIMATION", w-tw/2-2*margin, 2*margin+th/2, 0.5, 0.5)
+	return g.Image()
+}
@@ -0,0 +1,196 @@
+package epubimageprocessor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+)
+
+// bump this version when the transformation change, to invalidate old entries.
+const cacheVersion = 1
+
+// cache of transformed pages, keyed by the hash of the source and the image options.
+//
+// Each source is stored as a manifest with the info of every page, and the encoded data of every page.
+type cache struct {
+	dir         string
+	fingerprint string
+	tempDir     string
+}
+
+type cacheEntry struct {
+	Part                int     `json:"part"`
+	Width               int     `json:"width"`
+	Height              int     `json:"height"`
+	IsBlank             bool    `json:"is_blank"`
+	DoublePage          bool    `json:"double_page"`
+	Format              string  `json:"format"`
+	OriginalAspectRatio float64 `json:"original_aspect_ratio"`
+}
+
+// return nil if the cache is disabled.
+//
+// the pages aren't cached with an image hook: only its command is in the key, the script behind may change.
+func (e ePUBImageProcessor) newCache() *cache {
+	if e.CacheDir == "" || e.Dry || e.Image.Hook != "" {
+		return nil
+	}
+	options, err := json.Marshal(e.Image)
+	if err != nil {
+		return nil
+	}
+	return &cache{
+		dir:         e.CacheDir,
+		fingerprint: fmt.Sprintf("%d-%x", cacheVersion, sha256.Sum256(options)),
+		tempDir:     e.TempDir,
+	}
+}
+
+// the cover isn't split, and the page may have specific settings, so they are part of the key
+func (c *cache) key(input task) string {
+	overrides, _ := json.Marshal(input.Overrides)
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s-%s-%t-%s", c.fingerprint, input.Hash, input.Id == 0, overrides)))
+	key := fmt.Sprintf("%x", h)
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// get the pages of the input, ok is false if not found
+func (c *cache) get(input task) (pages []page, ok bool) {
+	if c == nil || input.Hash == "" || input.Error != nil {
+		return nil, false
+	}
+	key := c.key(input)
+	manifest, err := os.ReadFile(key + ".json")
+	if err != nil {
+		return nil, false
+	}
+	var entries []cacheEntry
+	if err = json.Unmarshal(manifest, &entries); err != nil {
+		return nil, false
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(fmt.Sprintf("%s_%d.%s", key, entry.Part, entry.Format))
+		if err != nil {
+			return nil, false
+		}
+		img := epubimage.EPUBImage{
+			Id:                  input.Id,
+			Part:                entry.Part,
+			Width:               entry.Width,
+			Height:              entry.Height,
+			IsBlank:             entry.IsBlank,
+			DoublePage:          entry.DoublePage,
+			Path:                input.Path,
+			Name:                input.Name,
+			Format:              entry.Format,
+			OriginalAspectRatio: entry.OriginalAspectRatio,
+		}
+		// the cover need the raw image for the title page
+		if input.Id == 0 && entry.Part == 0 {
+			if img.Raw, err = decodeImage(data, c.tempDir); err != nil {
+				return nil, false
+			}
+		}
+		pages = append(pages, page{img, data})
+	}
+	return pages, true
+}
+
+// put the pages of the input into the cache.
+//
+// this is a best effort, the conversion continue without cache on failure.
+func (c *cache) put(input task, pages []page) {
+	if c == nil || input.Hash == "" || input.Error != nil {
+		return
+	}
+	key := c.key(input)
+	if err := os.MkdirAll(filepath.Dir(key), 0755); err != nil {
+		return
+	}
+	entries := make([]cacheEntry, 0, len(pages))
+	for _, p := range pages {
+		if err := c.write(fmt.Sprintf("%s_%d.%s", key, p.img.Part, p.img.Format), p.data); err != nil {
+			return
+		}
+		entries = append(entries, cacheEntry{
+			Part:                p.img.Part,
+			Width:               p.img.Width,
+			Height:              p.img.Height,
+			IsBlank:             p.img.IsBlank,
+			DoublePage:          p.img.DoublePage,
+			Format:              p.img.Format,
+			OriginalAspectRatio: p.img.OriginalAspectRatio,
+		})
+	}
+	manifest, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+	// manifest last, the entry is complete
+	_ = c.write(key+".json", manifest)
+}
+
+// write into a temporary file then rename it, to never read a partial file
+func (c *cache) write(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// cacheKey the name of the files of an entry start with the hex sha256 of its key
+var cacheKey = regexp.MustCompile(`^[0-9a-f]{64}[._]`)
+
+// CleanCache remove the entries of the cache directory, return the files removed.
+//
+// only the files of the cache layout are removed, the directory itself and the other files are kept.
+// with dry, the files are only listed.
+func CleanCache(dir string, dry bool) (removed []string, err error) {
+	removed = make([]string, 0)
+	subdirs, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, sub := range subdirs {
+		if !sub.IsDir() || len(sub.Name()) != 2 {
+			continue
+		}
+		subdir := filepath.Join(dir, sub.Name())
+		entries, err := os.ReadDir(subdir)
+		if err != nil {
+			return removed, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), sub.Name()) || !cacheKey.MatchString(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(subdir, entry.Name())
+			if !dry {
+				if err := os.Remove(path); err != nil {
+					return removed, err
+				}
+			}
+			removed = append(removed, path)
+		}
+		if !dry {
+			// only if empty
+			_ = os.Remove(subdir)
+		}
+	}
+	return
+}
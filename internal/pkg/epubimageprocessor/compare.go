@@ -0,0 +1,156 @@
+package epubimageprocessor
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// compareGap between the 2 versions of a composite.
+const compareGap = 16
+
+// ComparePage a page processed with 2 sets of options, written side by side.
+type ComparePage struct {
+	Id     int            `json:"id"`
+	Path   string         `json:"path"`
+	Part   int            `json:"part"`
+	Reason string         `json:"reason"`
+	File   string         `json:"file"`
+	A      CompareVersion `json:"a"`
+	B      CompareVersion `json:"b"`
+}
+
+// CompareVersion a page processed with a set of options.
+type CompareVersion struct {
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Size   int     `json:"size"` // bytes once encoded
+	PSNR   float64 `json:"psnr"` // dB, loss of the encoding, 100 if lossless
+}
+
+// Compare process the representative pages with the 2 sets of options, and write into dir the composites of the
+// encoded pages: a on the left, b on the right.
+//
+// the pages are loaded with the options a.
+func Compare(a, b epuboptions.EPUBOptions, dir string, count int) ([]ComparePage, error) {
+	ea, eb := newPreview(a), newPreview(b)
+	eb.memory, eb.failure = ea.memory, ea.failure
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	mu := sync.Mutex{}
+	pages := make([]ComparePage, 0, count)
+	err := ea.representative(count, func(input task, reason string, name string) {
+		pagesA := ea.transformPages(input)
+		pagesB := eb.transformPages(input)
+		for part := range max(len(pagesA), len(pagesB)) {
+			p := ComparePage{
+				Id:     input.Id,
+				Path:   input.page(),
+				Part:   part,
+				Reason: reason,
+				File:   filepath.Join(dir, fmt.Sprintf("%s_p%d.png", name, part)),
+			}
+			var imgA, imgB image.Image
+			var err error
+			if part < len(pagesA) {
+				if imgA, p.A, err = ea.compareVersion(pagesA[part]); err != nil {
+					ea.failure.set(err)
+				}
+			}
+			if part < len(pagesB) {
+				if imgB, p.B, err = eb.compareVersion(pagesB[part]); err != nil {
+					ea.failure.set(err)
+				}
+			}
+			if err = writePNG(p.File, composite(imgA, imgB)); err != nil {
+				ea.failure.set(err)
+			}
+
+			mu.Lock()
+			pages = append(pages, p)
+			mu.Unlock()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(pages, func(a, b ComparePage) int {
+		return cmp.Or(cmp.Compare(a.Id, b.Id), cmp.Compare(a.Part, b.Part))
+	})
+	return pages, nil
+}
+
+// compareVersion encode the page like the EPUB, and decode it back to show the loss.
+func (e ePUBImageProcessor) compareVersion(p page) (image.Image, CompareVersion, error) {
+	defer releaseImage(p.img.Raw)
+	data, err := epubzip.EncodeImage(e.Image.Format, e.Image.JpegBackend, p.img.Raw, e.Image.Quality, e.Image.WebpLossless, e.Image.AvifSpeed, e.TempDir, e.iccProfile())
+	if err != nil {
+		return nil, CompareVersion{}, err
+	}
+	img, err := decodeImage(data, e.TempDir)
+	if err != nil {
+		return nil, CompareVersion{}, err
+	}
+	return img, CompareVersion{
+		Width:  p.img.Width,
+		Height: p.img.Height,
+		Size:   len(data),
+		PSNR:   psnr(p.img.Raw, img),
+	}, nil
+}
+
+// psnr peak signal-to-noise ratio between the image and its encoded version, on the gray levels.
+func psnr(src, dst image.Image) float64 {
+	bounds := src.Bounds()
+	if bounds.Empty() || bounds.Size() != dst.Bounds().Size() {
+		return 0
+	}
+	var mse float64
+	offset := dst.Bounds().Min.Sub(bounds.Min)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := color.GrayModel.Convert(src.At(x, y)).(color.Gray).Y
+			b := color.GrayModel.Convert(dst.At(x+offset.X, y+offset.Y)).(color.Gray).Y
+			d := float64(a) - float64(b)
+			mse += d * d
+		}
+	}
+	mse /= float64(bounds.Dx() * bounds.Dy())
+	if mse == 0 {
+		return 100
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// composite the 2 images side by side, on a gray background. A missing image leave its side empty.
+func composite(a, b image.Image) image.Image {
+	var wa, wb, h int
+	if a != nil {
+		wa, h = a.Bounds().Dx(), a.Bounds().Dy()
+	}
+	if b != nil {
+		wb, h = b.Bounds().Dx(), max(h, b.Bounds().Dy())
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, wa+compareGap+wb), max(1, h)))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.Gray{Y: 0x80}), image.Point{}, draw.Src)
+	if a != nil {
+		draw.Draw(dst, image.Rect(0, 0, wa, a.Bounds().Dy()), a, a.Bounds().Min, draw.Src)
+	}
+	if b != nil {
+		draw.Draw(dst, image.Rect(wa+compareGap, 0, wa+compareGap+wb, b.Bounds().Dy()), b, b.Bounds().Min, draw.Src)
+	}
+	return dst
+}
@@ -0,0 +1,99 @@
+package epubimageprocessor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epuboverrides"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// estimateSamples number of pages converted to estimate the size and the duration.
+const estimateSamples = 12
+
+// Estimation of the conversion, extrapolated from the sampled pages.
+type Estimation struct {
+	Pages      int   `json:"pages"` // source pages
+	Sampled    int   `json:"sampled"`
+	Size       int64 `json:"size"` // bytes, of the whole EPUB before the split
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// Estimate convert a few pages spread over the input, without writing them, to estimate the size of the EPUB
+// and the duration of the conversion.
+//
+// the other pages are only listed. The size is extrapolated by the number of pages, the duration by the number
+// of pages converted in parallel. The webtoon are estimated on their source pages, they are not rejoined.
+func Estimate(o epuboptions.EPUBOptions) (Estimation, error) {
+	o.Dry, o.Quiet, o.Progress = false, true, nil
+	e := ePUBImageProcessor{o, newMemoryBudget(o.MaxMemory), &failure{}, 0, context.Background(), nil, &sync.Once{}}
+
+	overrides, err := epuboverrides.Load(e.Overrides)
+	if err != nil {
+		return Estimation{}, err
+	}
+	start := time.Now()
+	// the pages are listed first to spread the samples, like a dry run
+	list := e
+	list.Dry, list.DryPlan = true, false
+	imageCount, imageInput, err := list.load()
+	if err != nil {
+		return Estimation{}, err
+	}
+	for range imageInput {
+	}
+	e.sample = max(1, imageCount/estimateSamples)
+	if _, imageInput, err = e.load(); err != nil {
+		return Estimation{}, err
+	}
+
+	mu := sync.Mutex{}
+	var sampled, outputPages int
+	var size int64
+	wg := &sync.WaitGroup{}
+	for range e.WorkersRatio(100) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range imageInput {
+				if e.stopped() || input.Id%e.sample != 0 {
+					e.memory.release(input.Memory)
+					continue
+				}
+				input.Overrides = overrides.Get(input.page())
+				p := e.planPage(input, true)
+				e.memory.release(input.Memory)
+
+				mu.Lock()
+				sampled++
+				outputPages += len(p.Pages)
+				size += p.sampled
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if utils.Interrupted() {
+		return Estimation{}, utils.ErrInterrupted
+	}
+	if err := e.failure.get(); err != nil {
+		return Estimation{}, err
+	}
+	if sampled == 0 {
+		return Estimation{}, errNoImagesFound
+	}
+
+	ratio := float64(imageCount) / float64(sampled)
+	// the samples fewer than the workers did not use all of them
+	parallel := float64(min(e.Workers, sampled)) / float64(max(1, e.Workers))
+	return Estimation{
+		Pages:   imageCount,
+		Sampled: sampled,
+		// descriptor files, title, and a xhtml file by page, like the plan
+		Size:       128*1024 + int64(float64(outputPages)*ratio)*1024 + int64(float64(size)*ratio),
+		DurationMs: int64(float64(time.Since(start).Milliseconds()) * ratio * parallel),
+	}, nil
+}
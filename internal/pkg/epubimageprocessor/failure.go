@@ -0,0 +1,34 @@
+package epubimageprocessor
+
+import (
+	"sync"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// failure keep the first error of the pipeline.
+//
+// once set, the stages stop working and drain their input, then Load return the error.
+type failure struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *failure) set(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *failure) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// stopped by an interruption, the context or an error of the pipeline.
+func (e ePUBImageProcessor) stopped() bool {
+	return utils.Interrupted() || e.ctx.Err() != nil || e.failure.get() != nil
+}
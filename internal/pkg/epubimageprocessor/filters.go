@@ -0,0 +1,69 @@
+package epubimageprocessor
+
+import (
+	"github.com/disintegration/gift"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// customFilters the filters of the library users applied to a page.
+type customFilters struct {
+	filters []epuboptions.Filter
+	ctx     epuboptions.FilterContext
+}
+
+func (e ePUBImageProcessor) customFilters(input task, part int, parts int) *customFilters {
+	b := input.Image.Bounds()
+	return &customFilters{
+		filters: e.Image.Filters,
+		ctx: epuboptions.FilterContext{
+			Id:     input.Id,
+			Part:   part,
+			Parts:  parts,
+			Path:   input.Path,
+			Name:   input.Name,
+			Width:  b.Dx(),
+			Height: b.Dy(),
+		},
+	}
+}
+
+// builtin add the built-in filter, or its replacement by a custom filter with the same name.
+func (c *customFilters) builtin(g *gift.GIFT, name string, f gift.Filter) {
+	for _, cf := range c.filters {
+		if cf.Name != name {
+			continue
+		}
+		if cf.New == nil {
+			return
+		}
+		if f = cf.New(c.ctx); f == nil {
+			return
+		}
+		break
+	}
+	g.Add(f)
+}
+
+// stage add the custom filters of the stage, in their order.
+func (c *customFilters) stage(g *gift.GIFT, stage epuboptions.Stage) {
+	for _, cf := range c.filters {
+		if cf.Stage != stage || cf.New == nil || isBuiltinFilter(cf.Name) {
+			continue
+		}
+		if f := cf.New(c.ctx); f != nil {
+			g.Add(f)
+		}
+	}
+}
+
+func isBuiltinFilter(name string) bool {
+	switch name {
+	case epuboptions.FilterToneMap, epuboptions.FilterAutoLevels, epuboptions.FilterAutoRotate,
+		epuboptions.FilterAutoContrast, epuboptions.FilterContrast, epuboptions.FilterBrightness,
+		epuboptions.FilterDespeckle, epuboptions.FilterResize, epuboptions.FilterBorder, epuboptions.FilterGrayScale,
+		epuboptions.FilterDither:
+		return true
+	}
+	return false
+}
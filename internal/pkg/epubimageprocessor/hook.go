@@ -0,0 +1,43 @@
+package epubimageprocessor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os/exec"
+	"runtime"
+)
+
+// imageHook pipe the decoded image through the user command: the image is written as PNG on its stdin,
+// the transformed image is read from its stdout in any supported format.
+//
+// it runs before the internal filters, the crop, split and resize apply on the result.
+func (e ePUBImageProcessor) imageHook(src image.Image) (image.Image, error) {
+	var stdin bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&stdin, src); err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", e.Image.Hook)
+	} else {
+		cmd = exec.Command("sh", "-c", e.Image.Hook)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &stdin, &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New("image hook: " + err.Error() + ": " + string(bytes.TrimSpace(stderr.Bytes())))
+	}
+
+	data := stdout.Bytes()
+	if err := e.checkSize(data); err != nil {
+		return nil, err
+	}
+	img, err := decodeImage(data, e.TempDir)
+	if err != nil {
+		return nil, errors.New("image hook: " + err.Error())
+	}
+	return img, nil
+}
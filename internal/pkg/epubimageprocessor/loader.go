@@ -3,7 +3,7 @@ package epubimageprocessor
 import (
 	"archive/zip"
 	"bytes"
-	"errors"
+	"crypto/sha256"
 	"fmt"
 	"image"
 	"image/color"
@@ -11,7 +11,8 @@ import (
 	_ "image/png"
 	"io"
 	"io/fs"
-	"os"
+	"log/slog"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -21,31 +22,88 @@ import (
 	_ "golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
 
+	"github.com/disintegration/gift"
 	"github.com/fogleman/gg"
 	"github.com/golang/freetype/truetype"
 	"github.com/nwaples/rardecode/v2"
 	pdfimage "github.com/raff/pdfreader/image"
 	"github.com/raff/pdfreader/pdfread"
 
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageicc"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagejpeg"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epuboverrides"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/pagerange"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/sortpath"
 
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
 
 type task struct {
-	Id    int
-	Image image.Image
-	Path  string
-	Name  string
-	Error error
+	Id     int
+	Image  image.Image
+	Format string
+	Data   []byte // original data, only kept if they may be copied as is
+	Hash   string // hash of the original data, only computed if the cache is enabled
+	Path   string
+	Name   string
+	Error  error
+
+	Overrides *epuboverrides.Page // settings specific to this page
+	Memory    int64               // estimated memory to process the image, released once stored
+	Config    image.Config        // size of the image copied as is, without being decoded
+	Shrink    int                 // factor of the reduction of a very large source, 0 if not reduced
+	Deep      bool                // the source is decoded with 16 bits per channel, before any conversion
+
+	ToneMapLow, ToneMapHigh float32 // range of the tone map of a deep source, computed once for the page and its parts
 }
 
-var errNoImagesFound = errors.New("no images found")
+// isDeep the image has 16 bits per channel.
+func isDeep(img image.Image) bool {
+	switch img.(type) {
+	case *image.Gray16, *image.RGBA64, *image.NRGBA64:
+		return true
+	}
+	return false
+}
+
+// page path of the source image, for the messages.
+func (t task) page() string {
+	return filepath.Join(t.Path, t.Name)
+}
 
-// only accept jpg, png and webp as source file
+var errNoImagesFound = utils.ErrNoImagesFound
+
+// selectPages keep the sorted pages selected by -pages and -chapters.
+//
+// the chapters are the directories of the pages, numbered in their order like the TOC.
+func selectPages[T any](o epuboptions.EPUBOptions, items []T, dir func(T) string) ([]T, error) {
+	pages, err := pagerange.Parse(o.Pages)
+	if err != nil {
+		return nil, err
+	}
+	chapters, err := pagerange.Parse(o.Chapters)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]T, 0, len(items))
+	chapter, current := 0, ""
+	for i, item := range items {
+		if d := dir(item); chapter == 0 || d != current {
+			chapter, current = chapter+1, d
+		}
+		if pages.Contains(i+1) && chapters.Contains(chapter) {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+
+// only accept jpg, png, webp, tiff and animations (gif, mp4, webm) as source file
 func (e ePUBImageProcessor) isSupportedImage(path string) bool {
 	switch strings.ToLower(filepath.Ext(path)) {
-	case ".jpg", ".jpeg", ".png", ".webp", ".tiff":
+	case ".jpg", ".jpeg", ".png", ".webp", ".tiff", ".gif", ".mp4", ".webm":
 		{
 			return !strings.HasPrefix(filepath.Base(path), ".")
 		}
@@ -55,29 +113,156 @@ func (e ePUBImageProcessor) isSupportedImage(path string) bool {
 
 // load images from input
 func (e ePUBImageProcessor) load() (totalImages int, output chan task, err error) {
-	fi, err := os.Stat(e.Input)
+	defer func() {
+		err = utils.WithExitCode(err, utils.ExitInput)
+	}()
+	fsys, name := e.InputFileSystem()
+	fi, err := fs.Stat(fsys, name)
 	if err != nil {
 		return
 	}
 
 	// get all images though a channel of bytes
 	if fi.IsDir() {
-		return e.loadDir()
+		return e.loadDir(fsys, name)
 	} else {
-		switch ext := strings.ToLower(filepath.Ext(e.Input)); ext {
+		switch ext := strings.ToLower(path.Ext(name)); ext {
 		case ".cbz", ".zip":
-			return e.loadCbz()
+			return e.loadCbz(fsys, name)
 		case ".cbr", ".rar":
-			return e.loadCbr()
+			return e.loadCbr(fsys, name)
 		case ".pdf":
-			return e.loadPdf()
+			return e.loadPdf(fsys, name)
 		default:
-			err = fmt.Errorf("unknown file format (%s): support .cbz, .zip, .cbr, .rar, .pdf", ext)
+			if r, ok := LookupArchiveReader(fsys, name); ok {
+				return e.loadArchive(fsys, name, r)
+			}
+			err = fmt.Errorf("%w (%s): support .cbz, .zip, .cbr, .rar, .pdf", utils.ErrUnsupportedFormat, ext)
 			return
 		}
 	}
 }
 
+// LookupArchiveReader the reader registered for the input, by its extension then by its first bytes.
+func LookupArchiveReader(fsys fs.FS, name string) (epuboptions.ArchiveReader, bool) {
+	header := make([]byte, 512)
+	if f, err := fsys.Open(name); err == nil {
+		n, _ := io.ReadFull(f, header)
+		header = header[:n]
+		_ = f.Close()
+	}
+	return epuboptions.LookupArchiveReader(name, header)
+}
+
+// decode an image, keeping the original data if they may be copied as is.
+//
+// the EXIF orientation of JPEG is applied, the colors are converted to sRGB if requested,
+// and the image is piped through the image hook. a still is extracted from animations.
+func (e ePUBImageProcessor) decode(r io.Reader) (t task, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if err = e.checkSize(data); err != nil {
+		return
+	}
+	t.Memory = e.estimateMemory(data)
+	e.memory.acquire(t.Memory)
+	if e.CacheDir != "" {
+		t.Hash = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
+
+	// animations are replaced by a still, the original data are never kept
+	if t.Format = animationFormat(data); t.Format != "" {
+		t.Image, err = e.decodeAnimation(t.Format, data)
+		return
+	}
+
+	// conforming JPEG are copied as is, the image is only decoded if needed later
+	if c, ok := e.isPassthrough(data); ok {
+		t.Config, t.Format, t.Data = c, "jpeg", data
+		return
+	}
+
+	if t.Image, t.Format, err = epubimagejpeg.Decode(e.Image.JpegBackend, data); err != nil {
+		return
+	}
+	profile := e.colorProfile(t.Format, data)
+	// the inks of CMYK are converted through their profile first, the other transformations flatten them into RGB
+	if cmyk, ok := t.Image.(*image.CMYK); ok && profile != nil {
+		dst := image.NewRGBA(cmyk.Bounds())
+		profile.Draw(dst, cmyk, &gift.Options{Parallelization: true})
+		t.Image, data, profile = dst, nil, nil
+	}
+	// very large source are reduced first, the other transformations run on the reduced image
+	if f := e.tileFactor(t.Image.Bounds().Dx(), t.Image.Bounds().Dy()); f > 1 {
+		t.Image, t.Shrink = shrink(t.Image, f), f
+	}
+	// the orientation and the color conversion below draw into 16 bits images, whatever the source
+	t.Deep = isDeep(t.Image)
+
+	g := gift.New()
+	if t.Format == "jpeg" {
+		if f := exifOrientationFilter(exifOrientation(data)); f != nil {
+			g.Add(f)
+		}
+	}
+	if profile != nil {
+		g.Add(profile)
+	}
+	if len(g.Filters) > 0 {
+		dst := e.createImage(t.Image, g.Bounds(t.Image.Bounds()))
+		g.Draw(dst, t.Image)
+		// the original data are no more valid
+		t.Image, data = dst, nil
+	}
+
+	if e.Image.Hook != "" {
+		if t.Image, err = e.imageHook(t.Image); err != nil {
+			return
+		}
+		data = nil
+	}
+
+	if e.Image.CopyUnchanged && t.Shrink == 0 {
+		t.Data = data
+	}
+	return
+}
+
+// colorProfile the filter converting the embedded ICC profile into sRGB, nil if none or not requested.
+func (e ePUBImageProcessor) colorProfile(format string, data []byte) gift.Filter {
+	if !e.Image.ColorProfile {
+		return nil
+	}
+	f, err := epubimageicc.ToSRGB(epubimageicc.Extract(format, data))
+	if err != nil {
+		// once by conversion, the pages of a volume share their profile
+		e.profileWarning.Do(func() {
+			slog.Warn("color profile not converted, the colors may shift", "input", e.Input, "error", err)
+		})
+	}
+	return f
+}
+
+// checkSize reject the images above the limits, before decoding them.
+//
+// a malformed or pathological image may announce a size that would exhaust the memory.
+func (e ePUBImageProcessor) checkSize(data []byte) error {
+	c, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// the decoder report the error
+		return nil
+	}
+	if e.Image.MaxDimension > 0 && max(c.Width, c.Height) > e.Image.MaxDimension {
+		return fmt.Errorf("image too large: %dx%d, the maximum dimension is %d px", c.Width, c.Height, e.Image.MaxDimension)
+	}
+	if e.Image.MaxMegapixels > 0 && int64(c.Width)*int64(c.Height) > int64(e.Image.MaxMegapixels)*1_000_000 {
+		return fmt.Errorf("image too large: %dx%d, the maximum is %d MP", c.Width, c.Height, e.Image.MaxMegapixels)
+	}
+	return nil
+}
+
 func (e ePUBImageProcessor) corruptedImage(path, name string) image.Image {
 	var w, h float64 = 1200, 1920
 	f, _ := truetype.Parse(gomonobold.TTF)
@@ -102,11 +287,10 @@ func (e ePUBImageProcessor) corruptedImage(path, name string) image.Image {
 }
 
 // load a directory of images
-func (e ePUBImageProcessor) loadDir() (totalImages int, output chan task, err error) {
+func (e ePUBImageProcessor) loadDir(fsys fs.FS, input string) (totalImages int, output chan task, err error) {
 	images := make([]string, 0)
 
-	input := filepath.Clean(e.Input)
-	err = filepath.WalkDir(input, func(path string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(fsys, input, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -120,6 +304,11 @@ func (e ePUBImageProcessor) loadDir() (totalImages int, output chan task, err er
 		return
 	}
 
+	sort.Sort(sortpath.By(images, e.SortPathMode))
+	if images, err = selectPages(e.EPUBOptions, images, path.Dir); err != nil {
+		return
+	}
+
 	totalImages = len(images)
 
 	if totalImages == 0 {
@@ -127,8 +316,6 @@ func (e ePUBImageProcessor) loadDir() (totalImages int, output chan task, err er
 		return
 	}
 
-	sort.Sort(sortpath.By(images, e.SortPathMode))
-
 	// Queue all file with id
 	type job struct {
 		Id   int
@@ -150,33 +337,31 @@ func (e ePUBImageProcessor) loadDir() (totalImages int, output chan task, err er
 		go func() {
 			defer wg.Done()
 			for job := range jobs {
-				var img image.Image
+				// stop loading, the remaining jobs are drained
+				if e.stopped() {
+					continue
+				}
+				var t task
 				var err error
-				if !e.Dry {
-					var f *os.File
-					f, err = os.Open(job.Path)
+				if !e.skipDecode(job.Id) {
+					var f fs.File
+					f, err = fsys.Open(job.Path)
 					if err == nil {
-						img, _, err = image.Decode(f)
+						t, err = e.decode(f)
 						_ = f.Close()
 					}
 				}
 
-				p, fn := filepath.Split(job.Path)
-				if p == input {
-					p = ""
-				} else {
-					p = p[len(input)+1:]
+				p, fn := path.Split(job.Path)
+				if input != "." {
+					p = strings.TrimPrefix(p, input+"/")
 				}
+				p = filepath.FromSlash(p)
 				if err != nil {
-					img = e.corruptedImage(p, fn)
-				}
-				output <- task{
-					Id:    job.Id,
-					Image: img,
-					Path:  p,
-					Name:  fn,
-					Error: err,
+					t.Image = e.corruptedImage(p, fn)
 				}
+				t.Id, t.Path, t.Name, t.Error = job.Id, p, fn, err
+				output <- t
 			}
 		}()
 	}
@@ -190,9 +375,41 @@ func (e ePUBImageProcessor) loadDir() (totalImages int, output chan task, err er
 	return
 }
 
+// load an archive of a registered reader, walked like a directory
+func (e ePUBImageProcessor) loadArchive(fsys fs.FS, input string, r epuboptions.ArchiveReader) (totalImages int, output chan task, err error) {
+	afs, err := r.Open(fsys, input)
+	if err != nil {
+		return
+	}
+	c, ok := afs.(io.Closer)
+	if !ok {
+		return e.loadDir(afs, ".")
+	}
+	totalImages, images, err := e.loadDir(afs, ".")
+	if err != nil {
+		_ = c.Close()
+		return
+	}
+
+	// closed once all the images are read
+	output = make(chan task, e.Workers)
+	go func() {
+		defer func() {
+			_ = c.Close()
+		}()
+		for t := range images {
+			output <- t
+		}
+		close(output)
+	}()
+	return
+}
+
 // load a zip file that include images
-func (e ePUBImageProcessor) loadCbz() (totalImages int, output chan task, err error) {
-	r, err := zip.OpenReader(e.Input)
+//
+// the entries are read directly from the archive by the decode workers, nothing is extracted on the disk.
+func (e ePUBImageProcessor) loadCbz(fsys fs.FS, input string) (totalImages int, output chan task, err error) {
+	r, err := epubzip.OpenFSReader(fsys, input)
 	if err != nil {
 		return
 	}
@@ -204,7 +421,17 @@ func (e ePUBImageProcessor) loadCbz() (totalImages int, output chan task, err er
 		}
 	}
 
-	totalImages = len(images)
+	var names []string
+	for _, img := range images {
+		names = append(names, img.Name)
+	}
+	sort.Sort(sortpath.By(names, e.SortPathMode))
+	if names, err = selectPages(e.EPUBOptions, names, path.Dir); err != nil {
+		_ = r.Close()
+		return
+	}
+
+	totalImages = len(names)
 
 	if totalImages == 0 {
 		_ = r.Close()
@@ -212,12 +439,6 @@ func (e ePUBImageProcessor) loadCbz() (totalImages int, output chan task, err er
 		return
 	}
 
-	var names []string
-	for _, img := range images {
-		names = append(names, img.Name)
-	}
-	sort.Sort(sortpath.By(names, e.SortPathMode))
-
 	indexedNames := make(map[string]int)
 	for i, name := range names {
 		indexedNames[name] = i
@@ -231,7 +452,9 @@ func (e ePUBImageProcessor) loadCbz() (totalImages int, output chan task, err er
 	go func() {
 		defer close(jobs)
 		for _, img := range images {
-			jobs <- job{indexedNames[img.Name], img}
+			if i, ok := indexedNames[img.Name]; ok {
+				jobs <- job{i, img}
+			}
 		}
 	}()
 
@@ -242,28 +465,27 @@ func (e ePUBImageProcessor) loadCbz() (totalImages int, output chan task, err er
 		go func() {
 			defer wg.Done()
 			for job := range jobs {
-				var img image.Image
+				// stop loading, the remaining jobs are drained
+				if e.stopped() {
+					continue
+				}
+				var t task
 				var err error
-				if !e.Dry {
+				if !e.skipDecode(job.Id) {
 					var f io.ReadCloser
 					f, err = job.F.Open()
 					if err == nil {
-						img, _, err = image.Decode(f)
+						t, err = e.decode(f)
+						_ = f.Close()
 					}
-					_ = f.Close()
 				}
 
 				p, fn := filepath.Split(filepath.Clean(job.F.Name))
 				if err != nil {
-					img = e.corruptedImage(p, fn)
-				}
-				output <- task{
-					Id:    job.Id,
-					Image: img,
-					Path:  p,
-					Name:  fn,
-					Error: err,
+					t.Image = e.corruptedImage(p, fn)
 				}
+				t.Id, t.Path, t.Name, t.Error = job.Id, p, fn, err
+				output <- t
 			}
 		}()
 	}
@@ -277,9 +499,12 @@ func (e ePUBImageProcessor) loadCbz() (totalImages int, output chan task, err er
 }
 
 // load a rar file that include images
-func (e ePUBImageProcessor) loadCbr() (totalImages int, output chan task, err error) {
+//
+// the entries are read directly from the archive by the decode workers, nothing is extracted on the disk.
+// a solid archive can only be read sequentially, each entry is read in memory then sent to the workers.
+func (e ePUBImageProcessor) loadCbr(fsys fs.FS, input string) (totalImages int, output chan task, err error) {
 	var isSolid bool
-	files, err := rardecode.List(e.Input)
+	files, err := rardecode.List(input, rardecode.FileSystem(fsys))
 	if err != nil {
 		return
 	}
@@ -294,14 +519,17 @@ func (e ePUBImageProcessor) loadCbr() (totalImages int, output chan task, err er
 		}
 	}
 
+	sort.Sort(sortpath.By(names, e.SortPathMode))
+	if names, err = selectPages(e.EPUBOptions, names, path.Dir); err != nil {
+		return
+	}
+
 	totalImages = len(names)
 	if totalImages == 0 {
 		err = errNoImagesFound
 		return
 	}
 
-	sort.Sort(sortpath.By(names, e.SortPathMode))
-
 	indexedNames := make(map[string]int)
 	for i, name := range names {
 		indexedNames[name] = i
@@ -316,27 +544,29 @@ func (e ePUBImageProcessor) loadCbr() (totalImages int, output chan task, err er
 	jobs := make(chan job)
 	go func() {
 		defer close(jobs)
-		if isSolid && !e.Dry {
-			r, rerr := rardecode.OpenReader(e.Input)
+		if isSolid && !e.listOnly() {
+			r, rerr := rardecode.OpenReader(input, rardecode.FileSystem(fsys))
 			if rerr != nil {
-				utils.Fatalf("\nerror processing image %s: %s\n", e.Input, rerr)
+				e.failure.set(fmt.Errorf("error processing image %s: %w", e.Input, rerr))
+				return
 			}
 			defer func(r *rardecode.ReadCloser) {
 				_ = r.Close()
 			}(r)
-			for {
+			for !e.stopped() {
 				f, rerr := r.Next()
 				if rerr != nil {
-					if rerr == io.EOF {
-						break
+					if rerr != io.EOF {
+						e.failure.set(fmt.Errorf("error processing image %s: %w", e.Input, rerr))
 					}
-					utils.Fatalf("\nerror processing image %s: %s\n", f.Name, rerr)
+					break
 				}
 				if i, ok := indexedNames[f.Name]; ok {
 					var b bytes.Buffer
 					_, rerr = io.Copy(&b, r)
 					if rerr != nil {
-						utils.Fatalf("\nerror processing image %s: %s\n", f.Name, rerr)
+						e.failure.set(&utils.DecodeError{Page: f.Name, Err: rerr})
+						break
 					}
 					jobs <- job{i, f.Name, func() (io.ReadCloser, error) {
 						return io.NopCloser(bytes.NewReader(b.Bytes())), nil
@@ -360,28 +590,27 @@ func (e ePUBImageProcessor) loadCbr() (totalImages int, output chan task, err er
 		go func() {
 			defer wg.Done()
 			for job := range jobs {
-				var img image.Image
+				// stop loading, the remaining jobs are drained
+				if e.stopped() {
+					continue
+				}
+				var t task
 				var err error
-				if !e.Dry {
+				if !e.skipDecode(job.Id) {
 					var f io.ReadCloser
 					f, err = job.Open()
 					if err == nil {
-						img, _, err = image.Decode(f)
+						t, err = e.decode(f)
+						_ = f.Close()
 					}
-					_ = f.Close()
 				}
 
 				p, fn := filepath.Split(filepath.Clean(job.Name))
 				if err != nil {
-					img = e.corruptedImage(p, fn)
-				}
-				output <- task{
-					Id:    job.Id,
-					Image: img,
-					Path:  p,
-					Name:  fn,
-					Error: err,
+					t.Image = e.corruptedImage(p, fn)
 				}
+				t.Id, t.Path, t.Name, t.Error = job.Id, p, fn, err
+				output <- t
 			}
 		}()
 	}
@@ -393,33 +622,63 @@ func (e ePUBImageProcessor) loadCbr() (totalImages int, output chan task, err er
 }
 
 // extract image from a pdf
-func (e ePUBImageProcessor) loadPdf() (totalImages int, output chan task, err error) {
-	pdf := pdfread.Load(e.Input)
+//
+// the pdf is read in place on the disk, loaded in memory from another file system.
+func (e ePUBImageProcessor) loadPdf(fsys fs.FS, input string) (totalImages int, output chan task, err error) {
+	var pdf *pdfread.PdfReaderT
+	if e.InputFS == nil {
+		pdf = pdfread.Load(e.Input)
+	} else {
+		var data []byte
+		if data, err = fs.ReadFile(fsys, input); err != nil {
+			return
+		}
+		pdf = pdfread.LoadBytes(data)
+	}
 	if pdf == nil {
 		err = fmt.Errorf("can't read pdf")
 		return
 	}
 
-	totalImages = len(pdf.Pages())
-	pageFmt := "page " + utils.FormatNumberOfDigits(totalImages)
+	pages := make([]int, len(pdf.Pages()))
+	for i := range pages {
+		pages[i] = i + 1
+	}
+	pageFmt := "page " + utils.FormatNumberOfDigits(len(pages))
+	if pages, err = selectPages(e.EPUBOptions, pages, func(int) string {
+		return ""
+	}); err != nil {
+		pdf.Close()
+		return
+	}
+	totalImages = len(pages)
+	if totalImages == 0 {
+		pdf.Close()
+		err = errNoImagesFound
+		return
+	}
 	output = make(chan task)
 	go func() {
 		defer close(output)
 		defer pdf.Close()
-		for i := range totalImages {
+		for i, pageNumber := range pages {
+			if e.stopped() {
+				break
+			}
 			var img image.Image
 			var err error
-			if !e.Dry {
-				img, err = pdfimage.Extract(pdf, i+1)
+			if !e.skipDecode(i) {
+				img, err = pdfimage.Extract(pdf, pageNumber)
 			}
 
-			name := fmt.Sprintf(pageFmt, i+1)
+			name := fmt.Sprintf(pageFmt, pageNumber)
 			if err != nil {
 				img = e.corruptedImage("", name)
 			}
 			output <- task{
 				Id:    i,
 				Image: img,
+				Deep:  err == nil && isDeep(img),
 				Path:  "",
 				Name:  name,
 				Error: err,
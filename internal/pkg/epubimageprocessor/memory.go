@@ -0,0 +1,104 @@
+package epubimageprocessor
+
+import (
+	"bytes"
+	"image"
+	"runtime/debug"
+	"sync"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// bytesPerPixel estimate the memory needed to process a pixel: 16 bits source, intermediate and destination images.
+const bytesPerPixel = 24
+
+// memoryBudget throttle the decoding of new images when the images in progress use too much memory.
+//
+// a nil budget is unlimited.
+type memoryBudget struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	max       int64
+	available int64
+}
+
+// newMemoryBudget of maxMb, or 3/4 of the available memory if 0 (auto).
+func newMemoryBudget(maxMb int) *memoryBudget {
+	if maxMb == 0 {
+		maxMb = utils.AvailableMemoryMb() * 3 / 4
+	}
+	if maxMb <= 0 {
+		return nil
+	}
+	m := &memoryBudget{max: int64(maxMb) << 20, available: int64(maxMb) << 20}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// estimate the memory needed to process the encoded image
+func (e ePUBImageProcessor) estimateMemory(data []byte) int64 {
+	c, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return int64(len(data))
+	}
+	pixels := int64(c.Width) * int64(c.Height)
+	// a very large source is only decoded (~4 bytes per pixel), the processing is done on the reduced image
+	if f := int64(e.tileFactor(c.Width, c.Height)); f > 1 {
+		return int64(len(data)) + pixels*4 + pixels/(f*f)*bytesPerPixel
+	}
+	return int64(len(data)) + pixels*bytesPerPixel
+}
+
+// acquire wait for enough memory.
+//
+// an image bigger than the budget wait for all the others to finish, then is processed alone.
+func (m *memoryBudget) acquire(n int64) {
+	if m == nil {
+		return
+	}
+	n = min(n, m.max)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.available < n {
+		m.cond.Wait()
+	}
+	m.available -= n
+}
+
+func (m *memoryBudget) release(n int64) {
+	if m == nil {
+		return
+	}
+	n = min(n, m.max)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.available += n
+	m.cond.Broadcast()
+}
+
+// the memory limit of the garbage collector is global: it is set by the first conversion,
+// raised by the others running at the same time, and restored once they are all done.
+var memoryLimit struct {
+	sync.Mutex
+	users    int
+	previous int64
+}
+
+// setMemoryLimit of the garbage collector during a conversion, return the function restoring it.
+func setMemoryLimit(limit int64) func() {
+	memoryLimit.Lock()
+	defer memoryLimit.Unlock()
+	if memoryLimit.users == 0 {
+		memoryLimit.previous = debug.SetMemoryLimit(limit)
+	} else if current := debug.SetMemoryLimit(-1); limit > current {
+		debug.SetMemoryLimit(limit)
+	}
+	memoryLimit.users++
+	return func() {
+		memoryLimit.Lock()
+		defer memoryLimit.Unlock()
+		if memoryLimit.users--; memoryLimit.users == 0 {
+			debug.SetMemoryLimit(memoryLimit.previous)
+		}
+	}
+}
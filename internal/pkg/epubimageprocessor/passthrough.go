@@ -0,0 +1,177 @@
+package epubimageprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageicc"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagejpeg"
+)
+
+// standard luminance quantization table (quality 50), in zigzag order like the DQT segment
+var jpegStdLuminance = [64]int{
+	16, 11, 12, 14, 12, 10, 16, 14, 13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37, 29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68, 87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113, 121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// jpegQuality estimate the quality used to encode the JPEG, from its luminance quantization table.
+//
+// return 100 if not found.
+func jpegQuality(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 100
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 100
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan or end of image, no more tables
+			return 100
+		}
+
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 100
+		}
+		// DQT, the luminance table is the first one
+		if marker == 0xDB && size >= 3+64 && data[i+4]&0x0f == 0 {
+			table := data[i+5:]
+			sixteenBits := data[i+4]>>4 == 1
+			// a table of 16 bits values is twice as long
+			if sixteenBits && size < 3+128 {
+				return 100
+			}
+			sum, std := 0, 0
+			for k := range 64 {
+				if sixteenBits {
+					sum += int(binary.BigEndian.Uint16(table[2*k:]))
+				} else {
+					sum += int(table[k])
+				}
+				std += jpegStdLuminance[k]
+			}
+			// inverse of the libjpeg scaling
+			scale := float64(sum) * 100 / float64(std)
+			if scale <= 100 {
+				return int((200-scale)/2 + 0.5)
+			}
+			return int(5000/scale + 0.5)
+		}
+		i += 2 + size
+	}
+	return 100
+}
+
+// jpegBaseline check if the JPEG is a baseline one (SOF0 or SOF1), the progressive and the lossless ones are decoded.
+func jpegBaseline(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return false
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xC0 || marker == 0xC1:
+			return true
+		case marker >= 0xC2 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC: // other start of frame
+			return false
+		case marker == 0xDA || marker == 0xD9: // start of scan or end of image before the frame
+			return false
+		}
+
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return false
+		}
+		i += 2 + size
+	}
+	return false
+}
+
+// isPassthrough check if the JPEG can be copied as is, without being decoded.
+//
+// no transformation should change it: a baseline gray or YCbCr JPEG, grayscale if needed, fit the device,
+// no filters (internal, custom or hook), no rotation, no color conversion, and a quality not above the requested one.
+// the CMYK, YCCK and progressive JPEG are re-encoded, the readers don't all support them.
+func (e ePUBImageProcessor) isPassthrough(data []byte) (c image.Config, ok bool) {
+	i := e.Image
+	if !i.CopyUnchanged || i.Format != "jpeg" || i.Webtoon || i.Hook != "" || len(i.Filters) > 0 ||
+		i.Crop.Enabled || i.NoBlankImage || i.AutoContrast || i.AutoLevels ||
+		i.Contrast != 0 || i.Brightness != 0 || i.Despeckle != 0 || i.Border.Width != 0 || i.Dither {
+		return
+	}
+
+	c, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "jpeg" {
+		return
+	}
+	if (c.ColorModel != color.GrayModel && c.ColorModel != color.YCbCrModel) || !jpegBaseline(data) {
+		return
+	}
+	if i.GrayScale && c.ColorModel != color.GrayModel {
+		return
+	}
+	if c.Width > c.Height && (i.AutoRotate || i.AutoSplitDoublePage) {
+		return
+	}
+	if i.Resize && (c.Width > i.View.Width || c.Height > i.View.Height) {
+		return
+	}
+	if exifOrientation(data) > 1 {
+		return
+	}
+	if i.ColorProfile {
+		if f, _ := epubimageicc.ToSRGB(epubimageicc.Extract(format, data)); f != nil {
+			return
+		}
+	}
+	return c, jpegQuality(data) <= i.Quality
+}
+
+// decodePassthrough decode the image skipped by the loader, when it can't be copied as is.
+//
+// the cover is needed to generate the title page, and the overrides may transform the page.
+func (e ePUBImageProcessor) decodePassthrough(input task) (task, error) {
+	if input.Image != nil || (input.Id > 0 && input.Overrides == nil) {
+		return input, nil
+	}
+	img, _, err := epubimagejpeg.Decode(e.Image.JpegBackend, input.Data)
+	input.Image = img
+	return input, err
+}
+
+// passthroughPage the page with the original data.
+func (e ePUBImageProcessor) passthroughPage(input task) page {
+	w, h := input.Config.Width, input.Config.Height
+	return page{
+		img: epubimage.EPUBImage{
+			Id:                  input.Id,
+			Width:               w,
+			Height:              h,
+			DoublePage:          w > h,
+			Path:                input.Path,
+			Name:                input.Name,
+			Format:              e.Image.Format,
+			OriginalAspectRatio: float64(h) / float64(w),
+			Error:               input.Error,
+		},
+		data: input.Data,
+	}
+}
@@ -0,0 +1,126 @@
+package epubimageprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// dqt a JPEG with only the DQT segment of the luminance table, scaled like libjpeg for the quality.
+func dqt(quality int, sixteenBits bool, truncate int) []byte {
+	scale := 5000 / quality
+	if quality >= 50 {
+		scale = 200 - quality*2
+	}
+	var table []byte
+	for _, v := range jpegStdLuminance {
+		q := max(1, (v*scale+50)/100)
+		if sixteenBits {
+			table = binary.BigEndian.AppendUint16(table, uint16(q))
+		} else {
+			table = append(table, byte(min(255, q)))
+		}
+	}
+	table = table[:len(table)-truncate]
+	pq := byte(0)
+	if sixteenBits {
+		pq = 1 << 4
+	}
+	data := []byte{0xFF, 0xD8, 0xFF, 0xDB}
+	data = binary.BigEndian.AppendUint16(data, uint16(3+len(table)))
+	data = append(data, pq)
+	data = append(data, table...)
+	return append(data, 0xFF, 0xD9)
+}
+
+func TestJpegQuality(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 8, 8)), &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"encoded", encoded.Bytes(), 75},
+		{"8 bits", dqt(85, false, 0), 85},
+		{"8 bits low quality", dqt(20, false, 0), 20},
+		{"16 bits", dqt(85, true, 0), 85},
+		{"16 bits low quality", dqt(5, true, 0), 5},
+		{"8 bits truncated", dqt(85, false, 1), 100},
+		{"16 bits truncated to 8 bits", dqt(85, true, 64), 100},
+		{"16 bits truncated", dqt(85, true, 1), 100},
+		{"not a jpeg", []byte("not a jpeg"), 100},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegQuality(tt.data); got != tt.want {
+				t.Errorf("jpegQuality() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// frame replace the start of frame of an encoded JPEG by the marker with the components, after the optional segment.
+func frame(t *testing.T, marker byte, components int, segment []byte) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 8)), &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+	sof := bytes.Index(data, []byte{0xFF, 0xC0})
+	end := sof + 2 + int(binary.BigEndian.Uint16(data[sof+2:]))
+
+	out := append([]byte{}, data[:sof]...)
+	out = append(out, segment...)
+	out = append(out, 0xFF, marker)
+	out = binary.BigEndian.AppendUint16(out, uint16(8+3*components))
+	out = append(out, 8, 0, 8, 0, 8, byte(components))
+	for c := range components {
+		out = append(out, byte(c+1), 0x11, 0)
+	}
+	return append(out, data[end:]...)
+}
+
+// TestIsPassthrough only the baseline gray and YCbCr JPEG are copied as is.
+func TestIsPassthrough(t *testing.T) {
+	var gray bytes.Buffer
+	if err := jpeg.Encode(&gray, image.NewGray(image.Rect(0, 0, 8, 8)), &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	// adobe segment, transform 0 = RGB or CMYK, 2 = YCCK
+	adobe := func(transform byte) []byte {
+		return []byte{0xFF, 0xEE, 0, 14, 'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, transform}
+	}
+
+	e := ePUBImageProcessor{}
+	e.Image.CopyUnchanged = true
+	e.Image.Format = "jpeg"
+	e.Image.Quality = 85
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"baseline gray", gray.Bytes(), true},
+		{"baseline ycbcr", frame(t, 0xC0, 3, nil), true},
+		{"extended ycbcr", frame(t, 0xC1, 3, nil), true},
+		{"progressive ycbcr", frame(t, 0xC2, 3, nil), false},
+		{"progressive gray", frame(t, 0xC2, 1, nil), false},
+		{"cmyk", frame(t, 0xC0, 4, nil), false},
+		{"adobe cmyk", frame(t, 0xC0, 4, adobe(0)), false},
+		{"ycck", frame(t, 0xC0, 4, adobe(2)), false},
+		{"rgb", frame(t, 0xC0, 3, adobe(0)), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := e.isPassthrough(tt.data); got != tt.want {
+				t.Errorf("isPassthrough() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package epubimageprocessor
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubevent"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epuboverrides"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubprogress"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// planSamples number of pages encoded to estimate the size of the EPUB.
+const planSamples = 20
+
+// planPage what the conversion will do with a source page.
+type planPage struct {
+	Id         int          `json:"id"`
+	Path       string       `json:"path"`
+	Width      int          `json:"width"`
+	Height     int          `json:"height"`
+	Crop       [4]int       `json:"crop"` // pixels removed on the left, top, right and bottom
+	DoublePage bool         `json:"double_page,omitempty"`
+	Rotated    bool         `json:"rotated,omitempty"`
+	Split      int          `json:"split,omitempty"` // number of parts
+	Blank      bool         `json:"blank,omitempty"` // removed
+	Pages      []planOutput `json:"pages"`
+	Error      string       `json:"error,omitempty"`
+
+	dir, name string
+	pixels    int64 // of the pages kept
+	sampled   int64 // size of the encoded pages, -1 if not encoded
+}
+
+// planOutput page of the EPUB, the page itself or a part of a double page.
+type planOutput struct {
+	Part   int `json:"part"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// plan of the conversion.
+type plan struct {
+	Pages         []planPage `json:"pages"`
+	Sampled       int        `json:"sampled"`
+	EstimatedSize int64      `json:"estimated_size"` // bytes
+}
+
+// listOnly the dry run only list the images, unless the plan of the pages is requested.
+func (e ePUBImageProcessor) listOnly() bool {
+	return e.Dry && !e.DryPlan
+}
+
+// skipDecode the page is only listed: dry run, or not sampled by the estimate.
+func (e ePUBImageProcessor) skipDecode(id int) bool {
+	return e.listOnly() || (e.sample > 0 && id%e.sample != 0) || e.resume.has(id)
+}
+
+// plan transform the pages like the conversion, without storing them, and show what is done with each page.
+//
+// the size of the EPUB is estimated by encoding a sample of the pages, and extrapolated to the others by their number of pixels.
+func (e ePUBImageProcessor) plan(imageCount int, imageInput chan task, overrides epuboverrides.Overrides) (epubimage.Index, error) {
+	bar := epubprogress.New(epubprogress.Options{
+		Quiet:       e.Quiet,
+		Json:        e.Json,
+		Backend:     e.Progress,
+		Max:         imageCount,
+		Description: "Planning",
+		Unit:        "pages",
+		CurrentJob:  1,
+		TotalJob:    1,
+	})
+	step := max(1, imageCount/planSamples)
+
+	mu := sync.Mutex{}
+	pages := make([]planPage, 0, imageCount)
+	wg := &sync.WaitGroup{}
+	for range e.WorkersRatio(100) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range imageInput {
+				if e.stopped() {
+					e.memory.release(input.Memory)
+					continue
+				}
+				input.Overrides = overrides.Get(filepath.Join(input.Path, input.Name))
+				var err error
+				if input, err = e.decodePassthrough(input); err != nil {
+					input.Image, input.Error = e.corruptedImage(input.Path, input.Name), err
+				}
+				p := e.planPage(input, input.Id%step == 0)
+				e.memory.release(input.Memory)
+				_ = bar.Add(1)
+
+				mu.Lock()
+				pages = append(pages, p)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	_ = bar.Close()
+
+	if utils.Interrupted() {
+		return epubimage.Index{}, utils.ErrInterrupted
+	}
+	if err := e.failure.get(); err != nil {
+		return epubimage.Index{}, err
+	}
+	if len(pages) == 0 {
+		return epubimage.Index{}, errNoImagesFound
+	}
+
+	slices.SortFunc(pages, func(a, b planPage) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	e.showPlan(newPlan(pages))
+
+	// the TOC of the dry run
+	index, _ := epubimage.NewIndexWriter("")
+	for _, p := range pages {
+		_ = index.Add(p.Id, epubimage.EPUBImage{
+			Id:     p.Id,
+			Path:   p.dir,
+			Name:   p.name,
+			Format: e.Image.Format,
+		})
+	}
+	return index.Close()
+}
+
+// planPage transform the input, and encode the pages of a sample.
+func (e ePUBImageProcessor) planPage(input task, sample bool) planPage {
+	p := planPage{
+		Id:      input.Id,
+		Path:    filepath.Join(input.Path, input.Name),
+		dir:     input.Path,
+		name:    input.Name,
+		sampled: -1,
+	}
+	if input.Error != nil {
+		p.Error = input.Error.Error()
+	}
+
+	if input.Image != nil {
+		bounds := input.Image.Bounds()
+		p.Width, p.Height = bounds.Dx(), bounds.Dy()
+		if e.Image.Crop.Enabled {
+			crop := e.cropMargin(input.Image, bounds)
+			if !crop.Empty() {
+				p.Crop = [4]int{crop.Min.X - bounds.Min.X, crop.Min.Y - bounds.Min.Y, bounds.Max.X - crop.Max.X, bounds.Max.Y - crop.Max.Y}
+			}
+		}
+	} else {
+		p.Width, p.Height = input.Config.Width, input.Config.Height
+	}
+
+	pages := e.transformPages(input)
+	if sample {
+		p.sampled = 0
+	}
+	iccProfile := e.iccProfile()
+	for _, pg := range pages {
+		img := pg.img
+		if img.Part == 0 {
+			p.DoublePage = img.DoublePage
+			p.Rotated = img.DoublePage && e.Image.AutoRotate
+			p.Blank = img.IsBlank && e.Image.NoBlankImage
+		} else {
+			p.Split++
+		}
+		if img.IsBlank && e.Image.NoBlankImage {
+			releaseImage(img.Raw)
+			continue
+		}
+		p.Pages = append(p.Pages, planOutput{img.Part, img.Width, img.Height})
+		p.pixels += int64(img.Width) * int64(img.Height)
+
+		if sample {
+			data := pg.data
+			if data == nil && img.Raw != nil {
+				var err error
+				if data, err = epubzip.EncodeImage(e.Image.Format, e.Image.JpegBackend, img.Raw, e.Image.Quality, e.Image.WebpLossless, e.Image.AvifSpeed, e.TempDir, iccProfile); err != nil {
+					e.failure.set(fmt.Errorf("error with %s: %w", input.Name, err))
+				}
+			}
+			p.sampled += int64(len(data))
+		}
+		releaseImage(img.Raw)
+	}
+	return p
+}
+
+// newPlan estimate the size of the EPUB from the sampled pages.
+func newPlan(pages []planPage) plan {
+	pl := plan{Pages: pages}
+	var sampledSize, sampledPixels, pixels int64
+	count := 0
+	for _, p := range pages {
+		pixels += p.pixels
+		count += len(p.Pages)
+		if p.sampled >= 0 {
+			pl.Sampled++
+			sampledSize += p.sampled
+			sampledPixels += p.pixels
+		}
+	}
+	// descriptor files, title, and a xhtml file by page, like the split of the EPUB
+	pl.EstimatedSize = 128*1024 + int64(count)*1024
+	if sampledPixels > 0 {
+		pl.EstimatedSize += int64(float64(sampledSize) / float64(sampledPixels) * float64(pixels))
+	}
+	return pl
+}
+
+// showPlan print the plan, or write it as a json line.
+func (e ePUBImageProcessor) showPlan(pl plan) {
+	if e.Json {
+		epubevent.Emit(epubevent.Plan, pl)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("Plan:\n")
+	for _, p := range pl.Pages {
+		actions := make([]string, 0)
+		if p.Error != "" {
+			actions = append(actions, "error: "+p.Error)
+		}
+		if p.Crop != [4]int{} {
+			actions = append(actions, fmt.Sprintf("crop %d,%d,%d,%d", p.Crop[0], p.Crop[1], p.Crop[2], p.Crop[3]))
+		}
+		if p.DoublePage {
+			actions = append(actions, "double page")
+		}
+		if p.Rotated {
+			actions = append(actions, "rotated")
+		}
+		if p.Split > 0 {
+			actions = append(actions, fmt.Sprintf("split in %d", p.Split))
+		}
+		if p.Blank {
+			actions = append(actions, "blank, removed")
+		}
+		sizes := make([]string, 0, len(p.Pages))
+		for _, pg := range p.Pages {
+			sizes = append(sizes, fmt.Sprintf("%dx%d", pg.Width, pg.Height))
+		}
+		if len(sizes) > 0 {
+			actions = append(actions, "-> "+strings.Join(sizes, ", "))
+		}
+		_, _ = fmt.Fprintf(&b, "  - %s %dx%d: %s\n", p.Path, p.Width, p.Height, strings.Join(actions, ", "))
+	}
+	_, _ = fmt.Fprintf(&b, "Estimated size: %.1f Mb (%d pages sampled)\n", float64(pl.EstimatedSize)/1024/1024, pl.Sampled)
+	utils.Printf("%s\n", b.String())
+}
@@ -0,0 +1,97 @@
+package epubimageprocessor
+
+import (
+	"image"
+	"math/bits"
+	"sync"
+)
+
+// pixSubClasses number of sizes between 2 powers of 2, a buffer waste at most 25% of its size.
+const pixSubClasses = 4
+
+// buffers of pixels, reused between the images to reduce the allocations and the garbage collector pauses.
+//
+// each pool contains buffers of the same size.
+var pixPools [64 * pixSubClasses]sync.Pool
+
+// pixClass the pool and the size of a buffer of n bytes.
+func pixClass(n int) (class int, size int) {
+	k := bits.Len(uint(n - 1))
+	if k < 3 {
+		return k * pixSubClasses, 1 << k
+	}
+	step := 1 << (k - 3)
+	i := (n - 1 - 1<<(k-1)) / step
+	return k*pixSubClasses + i, 1<<(k-1) + (i+1)*step
+}
+
+// getPix a cleared buffer of n bytes.
+func getPix(n int) []uint8 {
+	if n <= 0 {
+		return nil
+	}
+	class, size := pixClass(n)
+	if p, ok := pixPools[class].Get().(*[]uint8); ok {
+		b := (*p)[:n]
+		clear(b)
+		return b
+	}
+	return make([]uint8, n, size)
+}
+
+// putPix give back the buffer, it should not be used anymore.
+func putPix(b []uint8) {
+	if cap(b) == 0 {
+		return
+	}
+	// not a buffer of the pool
+	class, size := pixClass(cap(b))
+	if size != cap(b) {
+		return
+	}
+	pixPools[class].Put(&b)
+}
+
+// same as image.NewXXX, with a buffer of the pool.
+
+func newGray(r image.Rectangle) *image.Gray {
+	return &image.Gray{Pix: getPix(r.Dx() * r.Dy()), Stride: r.Dx(), Rect: r}
+}
+
+func newGray16(r image.Rectangle) *image.Gray16 {
+	return &image.Gray16{Pix: getPix(r.Dx() * r.Dy() * 2), Stride: r.Dx() * 2, Rect: r}
+}
+
+func newRGBA(r image.Rectangle) *image.RGBA {
+	return &image.RGBA{Pix: getPix(r.Dx() * r.Dy() * 4), Stride: r.Dx() * 4, Rect: r}
+}
+
+func newRGBA64(r image.Rectangle) *image.RGBA64 {
+	return &image.RGBA64{Pix: getPix(r.Dx() * r.Dy() * 8), Stride: r.Dx() * 8, Rect: r}
+}
+
+func newNRGBA(r image.Rectangle) *image.NRGBA {
+	return &image.NRGBA{Pix: getPix(r.Dx() * r.Dy() * 4), Stride: r.Dx() * 4, Rect: r}
+}
+
+func newNRGBA64(r image.Rectangle) *image.NRGBA64 {
+	return &image.NRGBA64{Pix: getPix(r.Dx() * r.Dy() * 8), Stride: r.Dx() * 8, Rect: r}
+}
+
+// releaseImage give back the buffer of an image created by createImage, it should not be used anymore.
+func releaseImage(img image.Image) {
+	switch t := img.(type) {
+	case *image.Gray:
+		putPix(t.Pix)
+	case *image.Gray16:
+		putPix(t.Pix)
+	case *image.RGBA:
+		putPix(t.Pix)
+	case *image.RGBA64:
+		putPix(t.Pix)
+	case *image.NRGBA:
+		putPix(t.Pix)
+	case *image.NRGBA64:
+		putPix(t.Pix)
+	}
+}
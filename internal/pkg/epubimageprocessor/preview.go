@@ -0,0 +1,136 @@
+package epubimageprocessor
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epuboverrides"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// PreviewPage source page of the preview, and the PNG files of its processed pages.
+type PreviewPage struct {
+	Id     int      `json:"id"`
+	Path   string   `json:"path"`
+	Reason string   `json:"reason"` // first, middle, last or double page
+	Files  []string `json:"files"`
+}
+
+// Preview process a few representative pages with the options, and write them as PNG into dir.
+func Preview(o epuboptions.EPUBOptions, dir string, count int) ([]PreviewPage, error) {
+	e := newPreview(o)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	mu := sync.Mutex{}
+	pages := make([]PreviewPage, 0, count)
+	err := e.representative(count, func(input task, reason string, name string) {
+		p := PreviewPage{Id: input.Id, Path: input.page(), Reason: reason}
+		for _, pg := range e.transformPages(input) {
+			file := filepath.Join(dir, fmt.Sprintf("%s_p%d.png", name, pg.img.Part))
+			if err := writePNG(file, pg.img.Raw); err != nil {
+				e.failure.set(err)
+			}
+			releaseImage(pg.img.Raw)
+			p.Files = append(p.Files, file)
+		}
+
+		mu.Lock()
+		pages = append(pages, p)
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(pages, func(a, b PreviewPage) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return pages, nil
+}
+
+// newPreview processor of the pages of a preview, they are always decoded to be shown.
+func newPreview(o epuboptions.EPUBOptions) ePUBImageProcessor {
+	o.Dry, o.Quiet, o.Progress = false, true, nil
+	o.Image.CopyUnchanged = false
+	return ePUBImageProcessor{o, newMemoryBudget(o.MaxMemory), &failure{}, 0, context.Background(), nil, &sync.Once{}}
+}
+
+// representative pages of the input: the first, middle and last pages, then the first double pages found, up to count pages.
+//
+// all the pages are decoded to detect the double pages, fn is called in parallel for the selected ones,
+// with the name of their files: the id padded to sort them.
+func (e ePUBImageProcessor) representative(count int, fn func(input task, reason string, name string)) error {
+	overrides, err := epuboverrides.Load(e.Overrides)
+	if err != nil {
+		return err
+	}
+	imageCount, imageInput, err := e.load()
+	if err != nil {
+		return err
+	}
+	if e.Image.Webtoon {
+		imageCount, imageInput = e.rejoinWebtoon(imageInput)
+	}
+	fmtId := utils.FormatNumberOfDigits(imageCount)
+
+	reasons := map[int]string{0: "first", imageCount / 2: "middle", imageCount - 1: "last"}
+	doubles := max(0, count-len(reasons))
+	mu := sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for range e.WorkersRatio(100) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range imageInput {
+				if e.stopped() {
+					e.memory.release(input.Memory)
+					continue
+				}
+				input.Overrides = overrides.Get(input.page())
+				var err error
+				if input, err = e.decodePassthrough(input); err != nil {
+					input.Image, input.Error = e.corruptedImage(input.Path, input.Name), err
+				}
+
+				mu.Lock()
+				reason, ok := reasons[input.Id]
+				if !ok && doubles > 0 && input.Image != nil && input.Image.Bounds().Dx() > input.Image.Bounds().Dy() {
+					reason, ok = "double page", true
+					doubles--
+				}
+				mu.Unlock()
+				if ok && input.Image != nil {
+					fn(input, reason, fmt.Sprintf(fmtId, input.Id))
+				}
+				e.memory.release(input.Memory)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if utils.Interrupted() {
+		return utils.ErrInterrupted
+	}
+	return e.failure.get()
+}
+
+func writePNG(file string, img image.Image) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(f, img); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
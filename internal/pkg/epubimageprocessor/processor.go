@@ -2,46 +2,97 @@
 package epubimageprocessor
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"log/slog"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/disintegration/gift"
 
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubevent"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageavif"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagefilters"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageicc"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagesimd"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epuboverrides"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubprogress"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
 	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
 
 type EPUBImageProcessor interface {
-	Load() (images []epubimage.EPUBImage, err error)
+	Load(ctx context.Context) (images epubimage.Index, err error)
 	CoverTitleData(o CoverTitleDataOptions) (epubzip.Image, error)
 }
 
+// maxPendingSize of the encoded pages waiting for a previous one to be stored.
+const maxPendingSize = 64 << 20
+
 type ePUBImageProcessor struct {
 	epuboptions.EPUBOptions
+	memory  *memoryBudget
+	failure *failure
+	sample  int // only one page out of sample is decoded by the estimate, 0 = all
+	ctx     context.Context
+	resume  *resume // the pages stored by an interrupted conversion, nil if none
+
+	profileWarning *sync.Once // the unsupported color profiles are reported once
 }
 
 func New(o epuboptions.EPUBOptions) EPUBImageProcessor {
-	return ePUBImageProcessor{o}
+	return ePUBImageProcessor{o, newMemoryBudget(o.MaxMemory), &failure{}, 0, context.Background(), nil, &sync.Once{}}
 }
 
 // Load extract and convert images
-func (e ePUBImageProcessor) Load() (images []epubimage.EPUBImage, err error) {
-	images = make([]epubimage.EPUBImage, 0)
+//
+// the workers stop once the context is done, the temporary files are removed and its error is returned.
+func (e ePUBImageProcessor) Load(ctx context.Context) (images epubimage.Index, err error) {
+	e.ctx = ctx
+	if e.memory != nil && e.MaxMemory > 0 {
+		// the garbage collector need to return the memory of the processed images sooner,
+		// the auto budget only throttle the decoding: the limit is left to the program
+		defer setMemoryLimit(e.memory.max)()
+	}
+	overrides, err := epuboverrides.Load(e.Overrides)
+	if err != nil {
+		return
+	}
+	// before the loader, that skip the pages resumed
+	e.resume = e.loadResume()
+	defer e.resume.close()
 	imageCount, imageInput, err := e.load()
 	if err != nil {
-		return nil, err
+		return
+	}
+
+	if e.Image.Webtoon && !e.listOnly() {
+		imageCount, imageInput = e.rejoinWebtoon(imageInput)
+	}
+
+	// dry run, the pages are only transformed to show the plan
+	if e.Dry && e.DryPlan {
+		return e.plan(imageCount, imageInput, overrides)
 	}
 
 	// dry run, skip conversion
 	if e.Dry {
+		index, _ := epubimage.NewIndexWriter("")
 		for img := range imageInput {
-			images = append(images, epubimage.EPUBImage{
+			_ = index.Add(img.Id, epubimage.EPUBImage{
 				Id:     img.Id,
 				Path:   img.Path,
 				Name:   img.Name,
@@ -49,116 +100,345 @@ func (e ePUBImageProcessor) Load() (images []epubimage.EPUBImage, err error) {
 			})
 		}
 
-		return images, nil
+		return index.Close()
 	}
 
-	imageOutput := make(chan epubimage.EPUBImage)
-
 	// processing
+	start := time.Now()
 	bar := epubprogress.New(epubprogress.Options{
 		Quiet:       e.Quiet,
 		Json:        e.Json,
+		Backend:     e.Progress,
 		Max:         imageCount,
 		Description: "Processing",
+		Unit:        "pages",
 		CurrentJob:  1,
 		TotalJob:    2,
 	})
 	wg := &sync.WaitGroup{}
 
-	imgStorage, err := epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format)
+	if !e.KeepTemp && !e.InMemory {
+		epubtemp.Track(e.ImgStorage())
+	}
+	imgStorage, err := epubzip.NewStorageImageWriter(e.ImgStorage(), e.Image.Format, e.InMemory)
 	if err != nil {
 		_ = bar.Close()
-		return nil, err
+		return
+	}
+	if !e.KeepTemp && !e.InMemory {
+		epubtemp.Track(e.ImgIndex())
+	}
+	index, err := epubimage.NewIndexWriter(e.ImgIndex())
+	if err != nil {
+		_ = imgStorage.Close()
+		_ = bar.Close()
+		return
+	}
+	imgCache := e.newCache()
+	resumed, err := e.resume.copy(imgStorage, index)
+	if err != nil {
+		e.failure.set(err)
+	}
+	_ = bar.Add(len(resumed))
+
+	// the pages go through 3 stages, with bounded queues between them, so none of them stall the others:
+	// filter the images, encode and compress the pages, then write them into the storage (a single writer).
+	type transformed struct {
+		input  task
+		pages  []page
+		cached bool
+	}
+	type encoded struct {
+		input     task
+		pages     []page
+		zipImages []epubzip.Image
 	}
 
-	wr := 50
-	if e.Image.Format == "png" {
-		wr = 100
+	// png, webp and avif encoding is the slowest part
+	encodeWorkers := e.WorkersRatio(50)
+	if e.Image.Format == "png" || e.Image.Format == "webp" || e.Image.Format == "avif" {
+		encodeWorkers = e.WorkersRatio(100)
 	}
-	for range e.WorkersRatio(wr) {
+	transformedPages := make(chan transformed, encodeWorkers)
+	encodedPages := make(chan encoded, encodeWorkers)
+
+	for range e.WorkersRatio(50) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 
 			for input := range imageInput {
-				img := e.transformImage(input, 0, e.Image.Manga)
-
-				// do not keep double page if requested
-				if !(img.DoublePage && input.Id > 0 &&
-					e.EPUBOptions.Image.AutoSplitDoublePage && !e.EPUBOptions.Image.KeepDoublePageIfSplit) {
-					if err = imgStorage.Add(img.EPUBImgPath(), img.Raw, e.Image.Quality); err != nil {
-						_ = bar.Close()
-						utils.Fatalf("error with %s: %s", input.Name, err)
-					}
-					// do not keep raw image except for cover
-					if img.Id > 0 {
-						img.Raw = nil
-					}
-					imageOutput <- img
+				// stop processing, the remaining images are drained
+				if e.stopped() || e.resume.has(input.Id) {
+					e.memory.release(input.Memory)
+					continue
+				}
+				input.Overrides = overrides.Get(filepath.Join(input.Path, input.Name))
+				var err error
+				if input, err = e.decodePassthrough(input); err != nil {
+					input.Image, input.Error = e.corruptedImage(input.Path, input.Name), err
+				}
+				if e.Events.OnPageDecoded != nil {
+					e.Events.OnPageDecoded(decodedEvent(input))
 				}
+				start := time.Now()
+				pages, cached := imgCache.get(input)
+				if !cached {
+					pages = e.transformPages(input)
+				}
+				slog.Debug("page transformed", "input", e.Input, "page", input.page(), "pages", len(pages), "cached", cached, "duration", time.Since(start))
+				transformedPages <- transformed{input, pages, cached}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(transformedPages)
+	}()
+
+	wgEncode := &sync.WaitGroup{}
+	for range encodeWorkers {
+		wgEncode.Add(1)
+		go func() {
+			defer wgEncode.Done()
 
-				// DOUBLE PAGE
-				if !e.Image.AutoSplitDoublePage || // No split required
-					!img.DoublePage || // Not a double page
-					(e.Image.HasCover && img.Id == 0) { // Cover
+			for t := range transformedPages {
+				if e.stopped() {
+					e.memory.release(t.input.Memory)
 					continue
 				}
-
-				for i, b := range []bool{e.Image.Manga, !e.Image.Manga} {
-					img = e.transformImage(input, i+1, b)
-					if err = imgStorage.Add(img.EPUBImgPath(), img.Raw, e.Image.Quality); err != nil {
-						_ = bar.Close()
-						utils.Fatalf("error with %s: %s", input.Name, err)
+				start := time.Now()
+				if err := e.encodePages(t.pages); err != nil {
+					e.memory.release(t.input.Memory)
+					e.failure.set(fmt.Errorf("error with %s: %w", t.input.Name, err))
+					continue
+				}
+				if !t.cached {
+					imgCache.put(t.input, t.pages)
+				}
+				// only the encoded data are kept
+				e.memory.release(t.input.Memory)
+
+				zipImages := make([]epubzip.Image, 0, len(t.pages))
+				for _, p := range t.pages {
+					zipImage, err := epubzip.CompressRaw(p.img.EPUBImgPath(), p.data)
+					if err != nil {
+						e.failure.set(fmt.Errorf("error with %s: %w", t.input.Name, err))
+						break
 					}
-					img.Raw = nil
-					imageOutput <- img
+					zipImages = append(zipImages, zipImage)
+				}
+				if len(zipImages) == len(t.pages) {
+					size := 0
+					for _, zipImage := range zipImages {
+						size += len(zipImage.Data)
+					}
+					slog.Debug("page encoded", "input", e.Input, "page", t.input.page(), "size", size, "duration", time.Since(start))
+					if e.Events.OnPageProcessed != nil {
+						for i, p := range t.pages {
+							e.Events.OnPageProcessed(processedEvent(p, len(zipImages[i].Data)))
+						}
+					}
+					encodedPages <- encoded{t.input, t.pages, zipImages}
 				}
 			}
 		}()
 	}
-
 	go func() {
-		wg.Wait()
-		_ = imgStorage.Close()
-		close(imageOutput)
+		wgEncode.Wait()
+		close(encodedPages)
 	}()
 
-	for img := range imageOutput {
-		if img.Part == 0 {
-			_ = bar.Add(1)
+	// the sources stored, kept to resume an interrupted conversion
+	sources := resumed
+	store := func(p encoded) {
+		if e.failure.get() != nil {
+			return
 		}
-		if e.Image.NoBlankImage && img.IsBlank {
-			continue
+		kept := make([]epubimage.EPUBImage, 0, len(p.pages))
+		for i, zipImage := range p.zipImages {
+			if err := imgStorage.AddCompressed(zipImage); err != nil {
+				e.failure.set(fmt.Errorf("error with %s: %w", p.input.Name, err))
+				return
+			}
+			img := p.pages[i].img
+			if img.Part == 0 {
+				_ = bar.Add(1)
+			}
+			if e.Image.NoBlankImage && img.IsBlank {
+				continue
+			}
+			kept = append(kept, img)
+		}
+		if err := index.Add(p.input.Id, kept...); err != nil {
+			e.failure.set(err)
+		}
+		sources = append(sources, p.input.Id)
+		if e.Json {
+			e.pageEvent(p.input, p.pages)
+		}
+	}
+
+	// the pages are stored in the order of the input, whatever the order the workers finish,
+	// so the storage and the images are reproducible.
+	// the pages waiting for a slow one are bounded: above maxPendingSize, they are stored out of order,
+	// the index keep the images in order anyway.
+	pending := make(map[int]encoded)
+	pendingSize := 0
+	stored := make(map[int]struct{})
+	for _, id := range resumed {
+		stored[id] = struct{}{}
+	}
+	next := 0
+	storePending := func() {
+		for _, id := range slices.Sorted(maps.Keys(pending)) {
+			store(pending[id])
+			stored[id] = struct{}{}
+		}
+		clear(pending)
+		pendingSize = 0
+	}
+	for p := range encodedPages {
+		pending[p.input.Id] = p
+		for _, zipImage := range p.zipImages {
+			pendingSize += len(zipImage.Data)
+		}
+		for {
+			if p, ok := pending[next]; ok {
+				delete(pending, next)
+				for _, zipImage := range p.zipImages {
+					pendingSize -= len(zipImage.Data)
+				}
+				store(p)
+			} else if _, ok := stored[next]; ok {
+				delete(stored, next)
+			} else {
+				break
+			}
+			next++
+		}
+		if pendingSize > maxPendingSize {
+			storePending()
 		}
-		images = append(images, img)
 	}
+	// the pages after a gap, left by an interruption
+	storePending()
+	_ = imgStorage.Close()
 	_ = bar.Close()
+	if images, err = index.Close(); err != nil {
+		e.failure.set(err)
+	}
 
-	if len(images) == 0 {
-		return nil, errNoImagesFound
+	if utils.Interrupted() {
+		if !e.keepResume(sources) {
+			e.removeTemp()
+		}
+		return epubimage.Index{}, utils.ErrInterrupted
+	}
+	if err = ctx.Err(); err != nil {
+		e.removeTemp()
+		return epubimage.Index{}, err
+	}
+	if err = e.failure.get(); err != nil {
+		e.removeTemp()
+		return epubimage.Index{}, err
 	}
 
+	if images.Len() == 0 {
+		return epubimage.Index{}, errNoImagesFound
+	}
+
+	slog.Info("images processed", "input", e.Input, "sources", imageCount, "pages", images.Len(), "duration", time.Since(start))
 	return images, nil
 }
 
+// pageEvent emit the pages stored for a source page.
+func (e ePUBImageProcessor) pageEvent(input task, pages []page) {
+	outputs := make([]map[string]any, 0, len(pages))
+	for _, p := range pages {
+		outputs = append(outputs, map[string]any{
+			"part":   p.img.Part,
+			"width":  p.img.Width,
+			"height": p.img.Height,
+			"blank":  p.img.IsBlank,
+		})
+	}
+	data := map[string]any{
+		"input":  e.Input,
+		"id":     input.Id,
+		"page":   input.page(),
+		"double": len(pages) > 0 && pages[0].img.DoublePage,
+		"pages":  outputs,
+	}
+	if input.Error != nil {
+		data["error"] = input.Error.Error()
+	}
+	epubevent.Emit(epubevent.Page, data)
+}
+
+// decodedEvent the source page read, its size is known without decoding it if copied as is.
+func decodedEvent(input task) epuboptions.PageEvent {
+	w, h := input.Config.Width, input.Config.Height
+	if input.Image != nil {
+		w, h = input.Image.Bounds().Dx(), input.Image.Bounds().Dy()
+	}
+	return epuboptions.PageEvent{
+		Id:     input.Id,
+		Path:   input.Path,
+		Name:   input.Name,
+		Width:  w,
+		Height: h,
+		Error:  input.Error,
+	}
+}
+
+func processedEvent(p page, size int) epuboptions.PageEvent {
+	return epuboptions.PageEvent{
+		Id:     p.img.Id,
+		Part:   p.img.Part,
+		Path:   p.img.Path,
+		Name:   p.img.Name,
+		Width:  p.img.Width,
+		Height: p.img.Height,
+		Size:   size,
+		Blank:  p.img.IsBlank,
+		Error:  p.img.Error,
+	}
+}
+
+// removeTemp remove the storage and the index of a failed conversion.
+func (e ePUBImageProcessor) removeTemp() {
+	if e.InMemory {
+		epubzip.RemoveMemory(e.ImgStorage())
+		return
+	}
+	for _, f := range []string{e.ImgStorage(), e.ImgIndex()} {
+		_ = os.Remove(f)
+		epubtemp.Untrack(f)
+	}
+}
+
+// createImage of the same type as src, or gray.
+//
+// the buffer come from the pool, it can be given back with releaseImage once the image is not used anymore.
 func (e ePUBImageProcessor) createImage(src image.Image, r image.Rectangle) draw.Image {
 	if e.EPUBOptions.Image.GrayScale {
-		return image.NewGray(r)
+		return newGray(r)
 	}
 
 	switch t := src.(type) {
 	case *image.Gray:
-		return image.NewGray(r)
+		return newGray(r)
 	case *image.Gray16:
-		return image.NewGray16(r)
+		return newGray16(r)
 	case *image.RGBA:
-		return image.NewRGBA(r)
+		return newRGBA(r)
 	case *image.RGBA64:
-		return image.NewRGBA64(r)
+		return newRGBA64(r)
 	case *image.NRGBA:
-		return image.NewNRGBA(r)
+		return newNRGBA(r)
 	case *image.NRGBA64:
-		return image.NewNRGBA64(r)
+		return newNRGBA64(r)
 	case *image.Alpha:
 		return image.NewAlpha(r)
 	case *image.Alpha16:
@@ -168,39 +448,185 @@ func (e ePUBImageProcessor) createImage(src image.Image, r image.Rectangle) draw
 	case *image.Paletted:
 		return image.NewPaletted(r, t.Palette)
 	default:
-		return image.NewNRGBA64(r)
+		return newNRGBA64(r)
 	}
 }
 
-// transform image into 1 or 3 images
-// only doublepage with autosplit has 3 versions
-func (e ePUBImageProcessor) transformImage(input task, part int, right bool) epubimage.EPUBImage {
-	g := gift.New()
+// hide the regions of the source image, before any other transformation.
+//
+// the regions are in pixels of the original source, reduced by shrink if the source has been.
+func (e ePUBImageProcessor) redact(src image.Image, regions []epuboverrides.Region, shrink int) image.Image {
+	filterRegions := make([]epubimagefilters.Region, 0, len(regions))
+	for _, r := range regions {
+		rect := r.Rect()
+		if shrink > 1 {
+			rect = image.Rect(rect.Min.X/shrink, rect.Min.Y/shrink, rect.Max.X/shrink, rect.Max.Y/shrink)
+		}
+		filterRegions = append(filterRegions, epubimagefilters.Region{Rect: rect, Blur: r.Mode == "blur"})
+	}
+	g := gift.New(epubimagefilters.Redact(filterRegions))
+	dst := image.NewNRGBA64(g.Bounds(src.Bounds()))
+	g.Draw(dst, src)
+	return dst
+}
+
+// page ready to be stored: the image and its encoded data
+type page struct {
+	img  epubimage.EPUBImage
+	data []byte
+}
+
+// decodeImage the encoded page, the avif through the tempDir of the conversion.
+func decodeImage(data []byte, tempDir string) (image.Image, error) {
+	if epubimageavif.Is(data) {
+		return epubimageavif.Decode(bytes.NewReader(data), tempDir)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// transform the input into the pages to store, they are encoded later.
+//
+// the page itself, and each part if it is a double page to split.
+// the data are already set if the original data can be copied as is.
+func (e ePUBImageProcessor) transformPages(input task) (pages []page) {
+	if input.Image == nil {
+		return []page{e.passthroughPage(input)}
+	}
+
+	if input.Overrides != nil && len(input.Overrides.Redact) > 0 {
+		input.Image = e.redact(input.Image, input.Overrides.Redact, input.Shrink)
+		// the original data are no more valid
+		input.Data = nil
+	}
+	// the range of the tone map is the one of the whole page, the same for its parts
+	if e.Image.ToneMap && input.Deep {
+		input.ToneMapLow, input.ToneMapHigh = epubimagefilters.ToneMapLevels(input.Image, e.Image.ToneMapClip)
+	}
+	img, unchanged := e.transformImage(input, 0, 0, 1)
+
+	// do not keep double page if requested
+	if !(img.DoublePage && input.Id > 0 &&
+		e.EPUBOptions.Image.AutoSplitDoublePage && !e.EPUBOptions.Image.KeepDoublePageIfSplit) {
+		var data []byte
+		if unchanged {
+			// copy the original data, avoid a new lossy compression
+			data = input.Data
+		}
+		pages = append(pages, page{img, data})
+	}
+
+	// DOUBLE PAGE
+	if !e.Image.AutoSplitDoublePage || // No split required
+		!img.DoublePage || // Not a double page
+		(e.Image.HasCover && img.Id == 0) { // Cover
+		return
+	}
+
+	parts := e.splitParts(input)
+	slog.Debug("double page split", "input", e.Input, "page", input.page(), "parts", parts, "rotated", e.Image.AutoRotate, "kept", len(pages) > 0)
+	for i := range parts {
+		// manga is read from right to left
+		index := i
+		if e.Image.Manga {
+			index = parts - 1 - i
+		}
+		img, _ = e.transformImage(input, i+1, index, parts)
+		pages = append(pages, page{img, nil})
+	}
+	return
+}
+
+// encode the pages not already encoded.
+//
+// the raw image is only kept for the cover, to generate the title page.
+func (e ePUBImageProcessor) encodePages(pages []page) (err error) {
+	iccProfile := e.iccProfile()
+	for i, p := range pages {
+		if p.data == nil {
+			if pages[i].data, err = epubzip.EncodeImage(e.Image.Format, e.Image.JpegBackend, p.img.Raw, e.Image.Quality, e.Image.WebpLossless, e.Image.AvifSpeed, e.TempDir, iccProfile); err != nil {
+				return
+			}
+		}
+		if p.img.Id > 0 || p.img.Part > 0 {
+			releaseImage(p.img.Raw)
+			pages[i].img.Raw = nil
+		}
+	}
+	return
+}
+
+// number of parts to cut a double page into.
+//
+// forced by the page overrides or the options, or based on the aspect ratio of a single page (~1:1.42).
+func (e ePUBImageProcessor) splitParts(input task) int {
+	if input.Overrides != nil && input.Overrides.SplitParts >= 2 {
+		return input.Overrides.SplitParts
+	}
+	if e.Image.SplitParts >= 2 {
+		return e.Image.SplitParts
+	}
+	bounds := input.Image.Bounds()
+	parts := int(math.Round(float64(bounds.Dx()) / float64(bounds.Dy()) * 1.42))
+	if parts < 2 {
+		parts = 2
+	}
+	return parts
+}
+
+// transform image into 1 or 1+n images
+// only doublepage with autosplit has n+1 versions, the page itself and each part.
+// index is the position of the part from the left of the page.
+//
+// unchanged is true if the image can be copied as is from the original data.
+func (e ePUBImageProcessor) transformImage(input task, part int, index int, parts int) (img epubimage.EPUBImage, unchanged bool) {
 	src := input.Image
 	srcBounds := src.Bounds()
 
+	// nothing to draw, the original data are copied
+	if e.isUnchanged(input, part) {
+		return e.epubImage(input, part, src, srcBounds.Dx() > srcBounds.Dy()), true
+	}
+
+	g := gift.New()
+	custom := e.customFilters(input, part, parts)
+	custom.stage(g, epuboptions.StageStart)
+
+	// 16 bits source are stretched before being reduced to 8 bits
+	if e.Image.ToneMap && input.Deep {
+		custom.builtin(g, epuboptions.FilterToneMap, epubimagefilters.ToneMap(input.ToneMapLow, input.ToneMapHigh))
+	}
+
+	// colors need to be restored before the grayscale conversion
+	if e.Image.AutoLevels {
+		custom.builtin(g, epuboptions.FilterAutoLevels, epubimagefilters.AutoLevels(e.Image.AutoLevelsClip))
+	}
+
+	// the simd backend work with 8 bits gray intermediate images, the conversion need to be done first.
+	if e.Image.GrayScale && e.Image.Backend == "simd" {
+		custom.builtin(g, epuboptions.FilterGrayScale, e.grayscaleFilter())
+	}
+
 	// In portrait only, we don't need to keep aspect ratio between each split.
 	// We first cut, the crop.
 	if part > 0 && !e.Image.KeepSplitDoublePageAspect {
-		g.Add(epubimagefilters.CropSplitDoublePage(right))
+		g.Add(epubimagefilters.CropSplitDoublePage(index, parts))
 	}
 
 	// Lookup for margin if crop is enable or if we want to remove blank image
 	if e.Image.Crop.Enabled || e.Image.NoBlankImage {
-		f := epubimagefilters.AutoCrop(
-			src,
-			g.Bounds(src.Bounds()),
-			e.Image.Crop.Left,
-			e.Image.Crop.Up,
-			e.Image.Crop.Right,
-			e.Image.Crop.Bottom,
-			e.Image.Crop.Limit,
-			e.Image.Crop.SkipIfLimitReached,
-		)
+		bounds := g.Bounds(src.Bounds())
+		margin := e.cropMargin(src, bounds)
+		f := gift.Crop(margin)
 
 		// detect if blank image
 		size := f.Bounds(srcBounds)
 		isBlank := size.Dx() == 0 && size.Dy() == 0
+		if isBlank && part == 0 {
+			slog.Debug("blank page", "input", e.Input, "page", input.page(), "removed", e.Image.NoBlankImage)
+		} else if e.Image.Crop.Enabled && margin != bounds {
+			slog.Debug("crop", "input", e.Input, "page", input.page(), "part", part, "from", bounds, "to", margin)
+		}
 
 		// crop is enable or if blank image with noblankimage options
 		if e.Image.Crop.Enabled || (e.Image.NoBlankImage && isBlank) {
@@ -211,7 +637,7 @@ func (e ePUBImageProcessor) transformImage(input task, part int, right bool) epu
 	// With landscape support, we need to keep aspect ratio between each split
 	// We first crop, then cut
 	if part > 0 && e.Image.KeepSplitDoublePageAspect {
-		g.Add(epubimagefilters.CropSplitDoublePage(right))
+		g.Add(epubimagefilters.CropSplitDoublePage(index, parts))
 	}
 
 	dstBounds := g.Bounds(src.Bounds())
@@ -220,64 +646,209 @@ func (e ePUBImageProcessor) transformImage(input task, part int, right bool) epu
 	isDoublePage := part == 0 && srcBounds.Dx() > srcBounds.Dy() && dstBounds.Dx() > dstBounds.Dy()
 
 	if e.Image.AutoRotate && isDoublePage {
-		g.Add(gift.Rotate90())
+		slog.Debug("rotate double page", "input", e.Input, "page", input.page())
+		custom.builtin(g, epuboptions.FilterAutoRotate, gift.Rotate90())
 	}
 
 	if e.Image.AutoContrast {
-		g.Add(epubimagefilters.AutoContrast())
+		custom.builtin(g, epuboptions.FilterAutoContrast, epubimagefilters.AutoContrast())
 	}
 
 	if e.Image.Contrast != 0 {
-		g.Add(gift.Contrast(float32(e.Image.Contrast)))
+		custom.builtin(g, epuboptions.FilterContrast, gift.Contrast(float32(e.Image.Contrast)))
 	}
 
 	if e.Image.Brightness != 0 {
-		g.Add(gift.Brightness(float32(e.Image.Brightness)))
+		custom.builtin(g, epuboptions.FilterBrightness, gift.Brightness(float32(e.Image.Brightness)))
 	}
 
+	// specks would be smeared into visible blobs by the resize
+	if e.Image.Despeckle > 0 {
+		custom.builtin(g, epuboptions.FilterDespeckle, epubimagefilters.Despeckle(e.Image.Despeckle))
+	}
+
+	custom.stage(g, epuboptions.StageBeforeResize)
+
 	if e.Image.Resize {
-		g.Add(gift.ResizeToFit(e.Image.View.Width, e.Image.View.Height, gift.LanczosResampling))
+		// keep room for the border
+		custom.builtin(g, epuboptions.FilterResize, e.resizeFilter(e.Image.View.Width-2*e.Image.Border.Width, e.Image.View.Height-2*e.Image.Border.Width))
 	}
 
+	// blank image are kept as is, to be detected
+	if e.Image.Border.Width > 0 && !g.Bounds(src.Bounds()).Empty() {
+		custom.builtin(g, epuboptions.FilterBorder, epubimagefilters.Border(e.Image.Border.Width, e.borderColor()))
+	}
+
+	custom.stage(g, epuboptions.StageAfterResize)
+
 	if e.Image.GrayScale {
-		var f gift.Filter
-		switch e.Image.GrayScaleMode {
-		case 1: // average
-			f = gift.ColorFunc(func(r0, g0, b0, a0 float32) (r float32, g float32, b float32, a float32) {
-				y := (r0 + g0 + b0) / 3
-				return y, y, y, a0
-			})
-		case 2: // luminance
-			f = gift.ColorFunc(func(r0, g0, b0, a0 float32) (r float32, g float32, b float32, a float32) {
-				y := 0.2126*r0 + 0.7152*g0 + 0.0722*b0
-				return y, y, y, a0
-			})
-		default:
-			f = gift.Grayscale()
+		// the simd backend already apply it first
+		if e.Image.Backend != "simd" {
+			custom.builtin(g, epuboptions.FilterGrayScale, e.grayscaleFilter())
+		}
+
+		// the gradients would band once reduced to the levels of the e-ink screen
+		if e.Image.Dither {
+			custom.builtin(g, epuboptions.FilterDither, e.ditherFilter())
 		}
-		g.Add(f)
 	}
 
+	custom.stage(g, epuboptions.StageEnd)
+
 	g.Add(epubimagefilters.Pixel())
 
 	dst := e.createImage(src, g.Bounds(src.Bounds()))
-	g.Draw(dst, src)
+	e.draw(g, dst, src)
 
+	return e.epubImage(input, part, dst, isDoublePage), false
+}
+
+// epubImage the page of the image transformed.
+func (e ePUBImageProcessor) epubImage(input task, part int, raw image.Image, isDoublePage bool) epubimage.EPUBImage {
+	b, src := raw.Bounds(), input.Image.Bounds()
 	return epubimage.EPUBImage{
 		Id:                  input.Id,
 		Part:                part,
-		Raw:                 dst,
-		Width:               dst.Bounds().Dx(),
-		Height:              dst.Bounds().Dy(),
-		IsBlank:             dst.Bounds().Dx() == 1 && dst.Bounds().Dy() == 1,
+		Raw:                 raw,
+		Width:               b.Dx(),
+		Height:              b.Dy(),
+		IsBlank:             b.Dx() == 1 && b.Dy() == 1,
 		DoublePage:          isDoublePage,
 		Path:                input.Path,
 		Name:                input.Name,
 		Format:              e.Image.Format,
-		OriginalAspectRatio: float64(src.Bounds().Dy()) / float64(src.Bounds().Dx()),
+		OriginalAspectRatio: float64(src.Dy()) / float64(src.Dx()),
 		Error:               input.Error,
 	}
+}
+
+// isUnchanged check if the image can be copied as is from the original data, before building the filters.
+//
+// like isPassthrough, from the options and the bounds of the source: no filter would change its pixels or its size.
+func (e ePUBImageProcessor) isUnchanged(input task, part int) bool {
+	i := e.Image
+	if !i.CopyUnchanged || input.Data == nil || input.Format != i.Format || part > 0 || len(i.Filters) > 0 ||
+		(i.ToneMap && input.Deep) || i.Crop.Enabled || i.NoBlankImage || i.AutoLevels || i.AutoContrast ||
+		i.Contrast != 0 || i.Brightness != 0 || i.Despeckle != 0 || i.Border.Width != 0 {
+		return false
+	}
+	b := input.Image.Bounds()
+	if i.AutoRotate && b.Dx() > b.Dy() {
+		return false
+	}
+	if i.Resize && (b.Dx() > i.View.Width || b.Dy() > i.View.Height) {
+		return false
+	}
+	if i.GrayScale {
+		if _, isGray := input.Image.(*image.Gray); !isGray || i.Dither {
+			return false
+		}
+	}
+	return input.Format != "jpeg" || jpegQuality(input.Data) <= i.Quality
+}
+
+// cropMargin area of the image kept once the margins within the bounds are removed, empty if the image is blank.
+func (e ePUBImageProcessor) cropMargin(src image.Image, bounds image.Rectangle) image.Rectangle {
+	return epubimagefilters.Margin(
+		src,
+		bounds,
+		e.Image.Crop.Left,
+		e.Image.Crop.Up,
+		e.Image.Crop.Right,
+		e.Image.Crop.Bottom,
+		e.Image.Crop.Limit,
+		e.Image.Crop.SkipIfLimitReached,
+		e.Image.Crop.SafeArea,
+	)
+}
+
+// borderColor convert the hexadecimal RGB color of the border, each digit is repeated: 7AF = 77AAFF.
+func (e ePUBImageProcessor) borderColor() color.Color {
+	v, _ := strconv.ParseUint(e.Image.Border.Color, 16, 16)
+	return color.RGBA{
+		R: uint8(v>>8&0xf) * 0x11,
+		G: uint8(v>>4&0xf) * 0x11,
+		B: uint8(v&0xf) * 0x11,
+		A: 0xff,
+	}
+}
+
+// resizeFilter fit the image into the size with the lanczos resampling.
+func (e ePUBImageProcessor) resizeFilter(width, height int) gift.Filter {
+	if e.Image.Backend == "simd" {
+		return epubimagesimd.ResizeToFit(width, height)
+	}
+	return gift.ResizeToFit(width, height, gift.LanczosResampling)
+}
+
+func (e ePUBImageProcessor) grayscaleFilter() gift.Filter {
+	var f gift.Filter
+	weights := epubimagesimd.Rec601
+	switch e.Image.GrayScaleMode {
+	case 1: // average
+		f = gift.ColorFunc(func(r0, g0, b0, a0 float32) (r float32, g float32, b float32, a float32) {
+			y := (r0 + g0 + b0) / 3
+			return y, y, y, a0
+		})
+		weights = epubimagesimd.Average
+	case 2: // luminance
+		f = gift.ColorFunc(func(r0, g0, b0, a0 float32) (r float32, g float32, b float32, a float32) {
+			y := 0.2126*r0 + 0.7152*g0 + 0.0722*b0
+			return y, y, y, a0
+		})
+		weights = epubimagesimd.Luminance
+	default:
+		f = gift.Grayscale()
+	}
+	if e.Image.Backend == "simd" {
+		return epubimagesimd.Grayscale(weights, f)
+	}
+	return f
+}
+
+func (e ePUBImageProcessor) ditherFilter() gift.Filter {
+	switch e.Image.DitherMode {
+	case 1: // ordered
+		return epubimagefilters.OrderedDither(e.Image.DitherMatrix)
+	default:
+		return epubimagefilters.Dither()
+	}
+}
+
+// draw apply the filters to the src.
+//
+// gift use 16 bits intermediate images between each filter.
+// The simd backend use 8 bits intermediate images instead (gray if possible), that its resize and grayscale filters process natively.
+func (e ePUBImageProcessor) draw(g *gift.GIFT, dst draw.Image, src image.Image) {
+	if e.Image.Backend != "simd" || len(g.Filters) <= 1 {
+		g.Draw(dst, src)
+		return
+	}
 
+	tmpIn := src
+	// the jpeg are converted once to be resized natively
+	if ycbcr, ok := src.(*image.YCbCr); ok && !e.Image.GrayScale {
+		rgba := newRGBA(ycbcr.Rect)
+		draw.Draw(rgba, rgba.Rect, ycbcr, ycbcr.Rect.Min, draw.Src)
+		tmpIn = rgba
+	}
+	last := len(g.Filters) - 1
+	for i, f := range g.Filters {
+		tmpOut := dst
+		if i < last {
+			if e.Image.GrayScale {
+				tmpOut = newGray(f.Bounds(tmpIn.Bounds()))
+			} else {
+				tmpOut = newRGBA(f.Bounds(tmpIn.Bounds()))
+			}
+		}
+		f.Draw(tmpOut, tmpIn, &g.Options)
+		// intermediate image already consumed
+		if tmpIn != src {
+			releaseImage(tmpIn)
+		}
+		tmpIn = tmpOut
+	}
 }
 
 type CoverTitleDataOptions struct {
@@ -322,12 +893,26 @@ func (e ePUBImageProcessor) CoverTitleData(o CoverTitleDataOptions) (epubzip.Ima
 	} else {
 		dst = e.createImage(o.Src, g.Bounds(o.Src.Bounds()))
 	}
+	defer releaseImage(dst)
 	g.Draw(dst, o.Src)
 
 	return epubzip.CompressImage(
 		"OEBPS/Images/"+o.Name+".jpeg",
 		"jpeg",
+		e.Image.JpegBackend,
 		dst,
 		e.Image.Quality,
+		false,
+		e.Image.AvifSpeed,
+		e.TempDir,
+		e.iccProfile(),
 	)
 }
+
+// profile to embed into output images
+func (e ePUBImageProcessor) iccProfile() []byte {
+	if e.Image.EmbedSRGB {
+		return epubimageicc.SRGB()
+	}
+	return nil
+}
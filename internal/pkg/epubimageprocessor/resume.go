@@ -0,0 +1,232 @@
+package epubimageprocessor
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/i18n"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// resume the pages stored by an interrupted conversion of the same input with the same options.
+//
+// On an interruption, the storage and the index are kept with a journal: the fingerprint of the options and the input,
+// and the ids of the source pages stored. The next run with the same fingerprint copy these pages from the old storage,
+// without decoding them, and process the others.
+type resume struct {
+	storage *zip.ReadCloser
+	path    string
+	images  map[int][]epubimage.EPUBImage
+	ids     map[int]struct{} // the sources stored, with the ones without images (blank page removed)
+	tempDir string
+}
+
+type resumeJournal struct {
+	Fingerprint string `json:"fingerprint"`
+	Sources     []int  `json:"sources"`
+}
+
+// has the source been stored by the interrupted conversion.
+func (r *resume) has(id int) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.ids[id]
+	return ok
+}
+
+// canResume the storage is on the disk and the ids are the ones of the loader.
+func (e ePUBImageProcessor) canResume() bool {
+	return !e.InMemory && !e.Dry && !e.Image.Webtoon && e.sample == 0
+}
+
+// fingerprint of the options, the program version and the files of the input (name, size, time).
+func (e ePUBImageProcessor) fingerprint() (string, error) {
+	h := sha256.New()
+	options, err := json.Marshal(e.EPUBOptions)
+	if err != nil {
+		return "", err
+	}
+	version := ""
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		version = bi.Main.Version
+	}
+	_, _ = fmt.Fprintf(h, "%d %s %s\n", cacheVersion, version, options)
+	fsys, name := e.InputFileSystem()
+	err = fs.WalkDir(fsys, name, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(h, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if e.Overrides != "" {
+		data, err := os.ReadFile(e.Overrides)
+		if err != nil {
+			return "", err
+		}
+		_, _ = h.Write(data)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// loadResume the pages kept by an interrupted conversion, nil if none or if the options or the input changed.
+//
+// the old storage is moved aside, the new one is created in its place.
+func (e ePUBImageProcessor) loadResume() *resume {
+	if !e.canResume() {
+		return nil
+	}
+	data, err := os.ReadFile(e.ImgResume())
+	if err != nil {
+		return nil
+	}
+	// the journal is used once
+	_ = os.Remove(e.ImgResume())
+
+	var journal resumeJournal
+	fingerprint, err := e.fingerprint()
+	if err != nil || json.Unmarshal(data, &journal) != nil || journal.Fingerprint != fingerprint {
+		slog.Info("interrupted conversion not resumed, the options or the input changed", "input", e.Input)
+		return nil
+	}
+	images, err := epubimage.ReadIndex(e.ImgIndex())
+	if err != nil {
+		slog.Info("interrupted conversion not resumed", "input", e.Input, "error", err)
+		return nil
+	}
+	path := strings.TrimSuffix(e.ImgResume(), ".tmp") + ".zip.tmp"
+	if err = os.Rename(e.ImgStorage(), path); err != nil {
+		slog.Info("interrupted conversion not resumed", "input", e.Input, "error", err)
+		return nil
+	}
+	epubtemp.Track(path)
+	storage, err := zip.OpenReader(path)
+	if err != nil {
+		slog.Info("interrupted conversion not resumed", "input", e.Input, "error", err)
+		_ = os.Remove(path)
+		epubtemp.Untrack(path)
+		return nil
+	}
+
+	// only the sources with all their pages in the storage
+	r := &resume{storage, path, images, map[int]struct{}{}, e.TempDir}
+	files := map[string]struct{}{}
+	for _, f := range storage.File {
+		files[f.Name] = struct{}{}
+	}
+	for _, id := range journal.Sources {
+		complete := true
+		for _, img := range images[id] {
+			if _, ok := files[img.EPUBImgPath()]; !ok {
+				complete = false
+			}
+		}
+		if complete {
+			r.ids[id] = struct{}{}
+		}
+	}
+	slog.Info("interrupted conversion resumed", "input", e.Input, "sources", len(r.ids))
+	return r
+}
+
+// copy the pages resumed into the new storage and index, return the sources copied.
+func (r *resume) copy(storage epubzip.StorageImageWriter, index *epubimage.IndexWriter) ([]int, error) {
+	if r == nil {
+		return nil, nil
+	}
+	files := map[string]*zip.File{}
+	for _, f := range r.storage.File {
+		files[f.Name] = f
+	}
+	ids := slices.Sorted(maps.Keys(r.ids))
+	for _, id := range ids {
+		images := r.images[id]
+		for i, img := range images {
+			f := files[img.EPUBImgPath()]
+			if err := storage.Copy(f); err != nil {
+				return nil, err
+			}
+			// the cover need the raw image for the title page
+			if id == 0 && img.Part == 0 {
+				var err error
+				if images[i].Raw, err = decodeFile(f, r.tempDir); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := index.Add(id, images...); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func decodeFile(f *zip.File, tempDir string) (image.Image, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(data, tempDir)
+}
+
+// close and remove the old storage.
+func (r *resume) close() {
+	if r == nil {
+		return
+	}
+	_ = r.storage.Close()
+	_ = os.Remove(r.path)
+	epubtemp.Untrack(r.path)
+}
+
+// keepResume keep the storage and the index of the interrupted conversion with the journal of the sources stored.
+func (e ePUBImageProcessor) keepResume(sources []int) bool {
+	if !e.canResume() || len(sources) == 0 || e.failure.get() != nil {
+		return false
+	}
+	fingerprint, err := e.fingerprint()
+	if err != nil {
+		return false
+	}
+	data, err := json.Marshal(resumeJournal{fingerprint, sources})
+	if err != nil {
+		return false
+	}
+	if err = os.WriteFile(e.ImgResume(), data, 0644); err != nil {
+		return false
+	}
+	for _, f := range []string{e.ImgStorage(), e.ImgIndex()} {
+		epubtemp.Untrack(f)
+	}
+	if !e.Quiet {
+		utils.Println(i18n.Sprintf("Pages kept to resume: %d, run the same conversion again to resume it", len(sources)))
+	}
+	return true
+}
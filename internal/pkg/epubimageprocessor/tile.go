@@ -0,0 +1,85 @@
+package epubimageprocessor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// maxTileFactor keep the sum of a block of 16 bits values into an uint32.
+const maxTileFactor = 256
+
+// tileFactor of the reduction of a very large source (museum scans, ...), 1 if not needed.
+//
+// the shortest side is kept above 1.5x the longest side of the device, whatever the crop, rotation or split,
+// the resize to the device is then done as usual.
+func (e ePUBImageProcessor) tileFactor(w, h int) int {
+	view := max(e.Image.View.Width, e.Image.View.Height) * 3 / 2
+	if !e.Image.Resize || e.Image.TileThreshold <= 0 || view <= 0 || w*h <= e.Image.TileThreshold*1_000_000 {
+		return 1
+	}
+	return min(max(1, min(w, h)/view), maxTileFactor)
+}
+
+// shrink the source by factor, each block of factor x factor pixels is averaged.
+//
+// the source is converted one strip of factor rows at a time, the only full size buffer is the source itself.
+func shrink(src image.Image, factor int) image.Image {
+	b := src.Bounds()
+	r := image.Rect(0, 0, b.Dx()/factor, b.Dy()/factor)
+	n := uint32(factor * factor)
+
+	var dst draw.Image
+	deep := false
+	switch src.(type) {
+	case *image.Gray:
+		dst = image.NewGray(r)
+	case *image.Gray16:
+		dst, deep = image.NewGray16(r), true
+	case *image.RGBA64, *image.NRGBA64:
+		dst, deep = image.NewRGBA64(r), true
+	default:
+		dst = image.NewRGBA(r)
+	}
+
+	// 16 bits source keep their precision
+	if deep {
+		strip := image.NewRGBA64(image.Rect(0, 0, r.Dx()*factor, factor))
+		for y := range r.Dy() {
+			draw.Draw(strip, strip.Bounds(), src, image.Pt(b.Min.X, b.Min.Y+y*factor), draw.Src)
+			for x := range r.Dx() {
+				var c [4]uint32
+				for sy := range factor {
+					i := strip.PixOffset(x*factor, sy)
+					for range factor {
+						for k := range 4 {
+							c[k] += uint32(strip.Pix[i+2*k])<<8 | uint32(strip.Pix[i+2*k+1])
+						}
+						i += 8
+					}
+				}
+				dst.Set(x, y, color.RGBA64{R: uint16(c[0] / n), G: uint16(c[1] / n), B: uint16(c[2] / n), A: uint16(c[3] / n)})
+			}
+		}
+		return dst
+	}
+
+	strip := image.NewRGBA(image.Rect(0, 0, r.Dx()*factor, factor))
+	for y := range r.Dy() {
+		draw.Draw(strip, strip.Bounds(), src, image.Pt(b.Min.X, b.Min.Y+y*factor), draw.Src)
+		for x := range r.Dx() {
+			var c [4]uint32
+			for sy := range factor {
+				i := strip.PixOffset(x*factor, sy)
+				for range factor {
+					for k := range 4 {
+						c[k] += uint32(strip.Pix[i+k])
+					}
+					i += 4
+				}
+			}
+			dst.Set(x, y, color.RGBA{R: uint8(c[0] / n), G: uint8(c[1] / n), B: uint8(c[2] / n), A: uint8(c[3] / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,291 @@
+package epubimageprocessor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+)
+
+// rejoinWebtoon concatenate the consecutive slices of a webtoon, then cut them at the device height.
+//
+// slices are joined when they have the same width, are in the same directory and the seam is continuous.
+// all the pages are cut before the first one is sent, to know their number: the slices are cut as they come,
+// only the lines not yet in a page are kept, and the pages beyond half the memory budget are written into
+// the temporary directory (kept encoded in memory for a conversion in memory) until they are sent.
+func (e ePUBImageProcessor) rejoinWebtoon(input chan task) (totalImages int, output chan task) {
+	c := &webtoonCutter{e: e}
+	if e.memory != nil {
+		c.limit = e.memory.max / 2
+	}
+
+	// the slices are cut in their order, the ones decoded in advance wait for the previous
+	pending := map[int]task{}
+	next := 0
+	for t := range input {
+		e.memory.release(t.Memory)
+		t.Memory = 0
+		pending[t.Id] = t
+		for s, ok := pending[next]; ok; s, ok = pending[next] {
+			delete(pending, next)
+			c.add(s)
+			next++
+		}
+	}
+	// the loading stopped, some slices are missing
+	for _, id := range slices.Sorted(maps.Keys(pending)) {
+		c.add(pending[id])
+	}
+	c.flush()
+
+	output = make(chan task, e.Workers)
+	go func() {
+		defer close(output)
+		for id, p := range c.pages {
+			page := e.readWebtoonPage(p)
+			page.Id = id
+			b := page.Image.Bounds()
+			page.Memory = int64(b.Dx()) * int64(b.Dy()) * bytesPerPixel
+			e.memory.acquire(page.Memory)
+			output <- page
+		}
+	}()
+	return len(c.pages), output
+}
+
+// webtoonPage a page cut from the slices, its image is nil once written into file or data.
+type webtoonPage struct {
+	task
+	file string
+	data []byte
+}
+
+// webtoonCutter cut the slices of a group into pages as they come.
+type webtoonCutter struct {
+	e      ePUBImageProcessor
+	strip  []task // the slices of the group with lines not yet in a page
+	offset int    // line of the group where the strip start
+	top    int    // line of the group where the next page start
+	hashes string // hashes of the slices of the group, up to the last one
+	pages  []webtoonPage
+	kept   int64 // memory of the pages kept in memory
+	limit  int64 // 0 if unlimited
+}
+
+func (c *webtoonCutter) add(t task) {
+	// the cover is kept as is
+	if c.e.Image.HasCover && t.Id == 0 {
+		c.flush()
+		c.keep(t)
+		return
+	}
+	if len(c.strip) > 0 && !isSeamContinuous(c.strip[len(c.strip)-1], t) {
+		c.flush()
+	}
+	c.strip = append(c.strip, t)
+	c.hashes += t.Hash
+	c.cut(false)
+}
+
+// flush the end of the group.
+func (c *webtoonCutter) flush() {
+	// a single slice that already fit is kept as is
+	if len(c.strip) == 1 && c.top == 0 && c.strip[0].Image.Bounds().Dy() <= c.pageHeight() {
+		c.keep(c.strip[0])
+	} else if len(c.strip) > 0 {
+		c.cut(true)
+	}
+	c.strip, c.offset, c.top, c.hashes = nil, 0, 0, ""
+}
+
+// the height of the pages of the group, for the width of its slices.
+func (c *webtoonCutter) pageHeight() int {
+	return c.strip[0].Image.Bounds().Dx() * c.e.Image.View.Height / c.e.Image.View.Width
+}
+
+// cut the strip into pages, up to its end for the last slice of the group, else while more lines follow the page.
+func (c *webtoonCutter) cut(last bool) {
+	pageHeight := c.pageHeight()
+	s := webtoonStrip(c.strip)
+	h := c.offset + s.Bounds().Dy()
+	for c.top < h && (last || c.top+pageHeight < h) {
+		bottom := min(c.top+pageHeight, h)
+		if bottom < h {
+			bottom = c.offset + gutterAbove(s, bottom-c.offset, pageHeight/4)
+		}
+		c.page(c.top, bottom, last && bottom == h)
+		c.top = bottom
+	}
+
+	// the slices fully in the pages are no more needed
+	for len(c.strip) > 0 && c.offset+c.strip[0].Image.Bounds().Dy() <= c.top {
+		c.offset += c.strip[0].Image.Bounds().Dy()
+		c.strip = c.strip[1:]
+	}
+}
+
+// page copy the lines of the group from top to bottom into a new page.
+func (c *webtoonCutter) page(top, bottom int, last bool) {
+	w := c.strip[0].Image.Bounds().Dx()
+	img := image.NewNRGBA(image.Rect(0, 0, w, bottom-top))
+	var first *task
+	y := c.offset
+	for i, s := range c.strip {
+		b := s.Image.Bounds()
+		if y < bottom && y+b.Dy() > top {
+			if first == nil {
+				first = &c.strip[i]
+			}
+			from := max(top, y)
+			draw.Draw(img, image.Rect(0, from-top, w, min(bottom, y+b.Dy())-top), s.Image, image.Pt(b.Min.X, b.Min.Y+from-y), draw.Src)
+		}
+		y += b.Dy()
+	}
+
+	page := task{
+		Image:  img,
+		Format: first.Format,
+		Path:   first.Path,
+		Name:   first.Name,
+	}
+	if c.e.CacheDir != "" {
+		page.Hash = fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d-%t", c.hashes, top, last))))
+	}
+	c.keep(page)
+}
+
+// keep the page in memory up to the limit, else write it.
+func (c *webtoonCutter) keep(t task) {
+	b := t.Image.Bounds()
+	size := int64(b.Dx()) * int64(b.Dy()) * 4
+	if c.limit == 0 || c.kept+size <= c.limit {
+		c.kept += size
+		c.pages = append(c.pages, webtoonPage{task: t})
+		return
+	}
+	c.pages = append(c.pages, c.e.writeWebtoonPage(t))
+}
+
+// writeWebtoonPage encode the image of the page into a temporary file, or in memory for a conversion in memory.
+//
+// the page is kept as is if it can't be written.
+func (e ePUBImageProcessor) writeWebtoonPage(t task) webtoonPage {
+	var data bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&data, t.Image); err != nil {
+		return webtoonPage{task: t}
+	}
+	if e.InMemory {
+		t.Image = nil
+		return webtoonPage{task: t, data: data.Bytes()}
+	}
+
+	f, err := os.CreateTemp(e.TempDir, "go-comic-converter-webtoon-*.png")
+	if err != nil {
+		return webtoonPage{task: t}
+	}
+	epubtemp.Track(f.Name())
+	_, err = f.Write(data.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		epubtemp.Untrack(f.Name())
+		return webtoonPage{task: t}
+	}
+	t.Image = nil
+	return webtoonPage{task: t, file: f.Name()}
+}
+
+// readWebtoonPage the page with its image, the temporary file is removed.
+func (e ePUBImageProcessor) readWebtoonPage(p webtoonPage) task {
+	t := p.task
+	if t.Image != nil {
+		return t
+	}
+	data := p.data
+	if p.file != "" {
+		var err error
+		data, err = os.ReadFile(p.file)
+		_ = os.Remove(p.file)
+		epubtemp.Untrack(p.file)
+		if err != nil {
+			t.Image, t.Error = e.corruptedImage(t.Path, t.Name), err
+			return t
+		}
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Image, t.Error = e.corruptedImage(t.Path, t.Name), err
+		return t
+	}
+	t.Image = img
+	return t
+}
+
+// webtoonStrip the slices one below the other, read as a single image.
+type webtoonStrip []task
+
+func (s webtoonStrip) ColorModel() color.Model {
+	return color.NRGBAModel
+}
+
+func (s webtoonStrip) Bounds() image.Rectangle {
+	h := 0
+	for _, t := range s {
+		h += t.Image.Bounds().Dy()
+	}
+	return image.Rect(0, 0, s[0].Image.Bounds().Dx(), h)
+}
+
+func (s webtoonStrip) At(x, y int) color.Color {
+	for _, t := range s {
+		b := t.Image.Bounds()
+		if y < b.Dy() {
+			return t.Image.At(b.Min.X+x, b.Min.Y+y)
+		}
+		y -= b.Dy()
+	}
+	return color.Transparent
+}
+
+// the bottom of a slice should continue on the top of the next one
+func isSeamContinuous(prev, next task) bool {
+	pb, nb := prev.Image.Bounds(), next.Image.Bounds()
+	if prev.Error != nil || next.Error != nil || prev.Path != next.Path || pb.Dx() != nb.Dx() {
+		return false
+	}
+
+	var diff int
+	for x := 0; x < pb.Dx(); x++ {
+		p := color.GrayModel.Convert(prev.Image.At(pb.Min.X+x, pb.Max.Y-1)).(color.Gray).Y
+		n := color.GrayModel.Convert(next.Image.At(nb.Min.X+x, nb.Min.Y)).(color.Gray).Y
+		diff += max(int(p), int(n)) - min(int(p), int(n))
+	}
+	// average difference below ~10%
+	return diff/pb.Dx() <= 0x1a
+}
+
+// gutterAbove lookup for a uniform line (between panels) up to maxDistance above y, to avoid cutting a panel.
+func gutterAbove(img image.Image, y, maxDistance int) int {
+	b := img.Bounds()
+	for cy := y; cy > y-maxDistance && cy > b.Min.Y; cy-- {
+		low, high := uint8(0xff), uint8(0)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := color.GrayModel.Convert(img.At(x, cy)).(color.Gray).Y
+			low, high = min(low, g), max(high, g)
+		}
+		if high-low <= 8 {
+			return cy
+		}
+	}
+	return y
+}
@@ -0,0 +1,95 @@
+package epubimageprocessor
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// webtoonSlices a strip of 100x1000 cut in slices of 200 lines, with a gutter every 130 lines.
+func webtoonSlices() []task {
+	strip := image.NewGray(image.Rect(0, 0, 100, 1000))
+	for y := range 1000 {
+		for x := range 100 {
+			if y%130 < 120 {
+				strip.SetGray(x, y, color.Gray{Y: uint8(y/4 + x%16)})
+			} else {
+				strip.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	slices := make([]task, 0, 5)
+	for i := range 5 {
+		slices = append(slices, task{Id: i, Image: strip.SubImage(image.Rect(0, i*200, 100, i*200+200)), Format: "png", Name: "slice.png"})
+	}
+	return slices
+}
+
+// TestRejoinWebtoon the pages written into the temporary directory beyond the memory budget are the ones kept in memory.
+func TestRejoinWebtoon(t *testing.T) {
+	rejoin := func(memory *memoryBudget, tempDir string) []image.Image {
+		o := epuboptions.EPUBOptions{Workers: 2, TempDir: tempDir}
+		o.Image.View.Width, o.Image.View.Height = 100, 150
+		e := ePUBImageProcessor{o, memory, &failure{}, 0, context.Background(), nil, &sync.Once{}}
+
+		input := make(chan task, 5)
+		// the slices come out of order from the workers
+		slices := webtoonSlices()
+		for _, i := range []int{1, 0, 3, 4, 2} {
+			input <- slices[i]
+		}
+		close(input)
+		count, output := e.rejoinWebtoon(input)
+		pages := make([]image.Image, 0, count)
+		for page := range output {
+			if page.Id != len(pages) || page.Error != nil {
+				t.Fatalf("page %d: id %d, error %v", len(pages), page.Id, page.Error)
+			}
+			memory.release(page.Memory)
+			pages = append(pages, page.Image)
+		}
+		if len(pages) != count {
+			t.Fatalf("%d pages, %d announced", len(pages), count)
+		}
+		return pages
+	}
+
+	kept := rejoin(nil, "")
+	tempDir := t.TempDir()
+	budget := &memoryBudget{max: 2, available: 2}
+	budget.cond = sync.NewCond(&budget.mu)
+	written := rejoin(budget, tempDir)
+
+	h := 0
+	for i, page := range kept {
+		b := page.Bounds()
+		if b.Dy() > 150 {
+			t.Errorf("page %d: %d lines", i, b.Dy())
+		}
+		h += b.Dy()
+		if written[i].Bounds().Size() != b.Size() {
+			t.Fatalf("page %d: size %v, want %v", i, written[i].Bounds().Size(), b.Size())
+		}
+		for y := range b.Dy() {
+			for x := range b.Dx() {
+				if color.GrayModel.Convert(written[i].At(x, y)) != color.GrayModel.Convert(page.At(b.Min.X+x, b.Min.Y+y)) {
+					t.Fatalf("page %d: pixel %d,%d differ", i, x, y)
+				}
+			}
+		}
+	}
+	if h != 1000 || len(written) != len(kept) {
+		t.Errorf("%d lines, %d and %d pages", h, len(kept), len(written))
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+		t.Errorf("%d temporary files left", len(files))
+	}
+	if budget.available != budget.max {
+		t.Errorf("%d of the memory budget not released", budget.max-budget.available)
+	}
+}
@@ -0,0 +1,123 @@
+//go:build cgo && simd
+
+package epubimagesimd
+
+/*
+#cgo CFLAGS: -O3
+#include <stdint.h>
+#include <string.h>
+
+typedef float v4sf __attribute__((vector_size(16)));
+
+static inline uint8_t gcc_clamp(float v) {
+	if (v <= 0) return 0;
+	if (v >= 255) return 255;
+	return (uint8_t)(v + 0.5f);
+}
+
+// resize each row: 4 channels in a vector, or 4 taps of the gray in a vector
+static void gcc_resize_h(const uint8_t *src, int src_stride, uint8_t *dst, int dst_stride, int rows, int channels, int width,
+	const int32_t *starts, const float *weights, int taps) {
+	for (int y = 0; y < rows; y++) {
+		const uint8_t *s = src + (size_t)y * src_stride;
+		uint8_t *d = dst + (size_t)y * dst_stride;
+		const float *w = weights;
+		if (channels == 4) {
+			for (int x = 0; x < width; x++, w += taps) {
+				const uint8_t *p = s + (size_t)starts[x] * 4;
+				v4sf acc = {0, 0, 0, 0};
+				for (int k = 0; k < taps; k++, p += 4) {
+					v4sf px = {p[0], p[1], p[2], p[3]};
+					v4sf wk = {w[k], w[k], w[k], w[k]};
+					acc += px * wk;
+				}
+				for (int c = 0; c < 4; c++) {
+					d[x * 4 + c] = gcc_clamp(acc[c]);
+				}
+			}
+		} else {
+			for (int x = 0; x < width; x++, w += taps) {
+				const uint8_t *p = s + starts[x];
+				v4sf acc = {0, 0, 0, 0};
+				int k = 0;
+				for (; k + 4 <= taps; k += 4) {
+					v4sf px = {p[k], p[k + 1], p[k + 2], p[k + 3]};
+					v4sf wk;
+					memcpy(&wk, w + k, sizeof(wk));
+					acc += px * wk;
+				}
+				float sum = acc[0] + acc[1] + acc[2] + acc[3];
+				for (; k < taps; k++) {
+					sum += p[k] * w[k];
+				}
+				d[x] = gcc_clamp(sum);
+			}
+		}
+	}
+}
+
+// resize the columns, the bytes of the rows are accumulated together whatever the channels
+static void gcc_resize_v(const uint8_t *src, int src_stride, uint8_t *dst, int dst_stride, int row_bytes, int y0, int rows,
+	const int32_t *starts, const float *weights, int taps, float *acc) {
+	for (int y = y0; y < y0 + rows; y++) {
+		const float *w = weights + (size_t)y * taps;
+		uint8_t *d = dst + (size_t)(y - y0) * dst_stride;
+		memset(acc, 0, sizeof(float) * row_bytes);
+		for (int k = 0; k < taps; k++) {
+			float wk = w[k];
+			if (wk == 0) continue;
+			const uint8_t *s = src + (size_t)(starts[y] + k) * src_stride;
+			for (int i = 0; i < row_bytes; i++) {
+				acc[i] += wk * s[i];
+			}
+		}
+		for (int i = 0; i < row_bytes; i++) {
+			d[i] = gcc_clamp(acc[i]);
+		}
+	}
+}
+
+static void gcc_gray(const uint8_t *src, int src_stride, uint8_t *dst, int dst_stride, int width, int rows, uint32_t r, uint32_t g, uint32_t b) {
+	for (int y = 0; y < rows; y++) {
+		const uint8_t *s = src + (size_t)y * src_stride;
+		uint8_t *d = dst + (size_t)y * dst_stride;
+		for (int x = 0; x < width; x++) {
+			d[x] = (r * s[x * 4] + g * s[x * 4 + 1] + b * s[x * 4 + 2] + 32768) >> 16;
+		}
+	}
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+const nativeAvailable = true
+
+func bytePtr(b []byte) *C.uint8_t {
+	return (*C.uint8_t)(unsafe.Pointer(unsafe.SliceData(b)))
+}
+
+func nativeResizeH(src []byte, srcStride int, dst []byte, dstStride int, rows int, channels int, width int, w weights) {
+	C.gcc_resize_h(
+		bytePtr(src), C.int(srcStride), bytePtr(dst), C.int(dstStride), C.int(rows), C.int(channels), C.int(width),
+		(*C.int32_t)(unsafe.Pointer(unsafe.SliceData(w.starts))), (*C.float)(unsafe.Pointer(unsafe.SliceData(w.values))), C.int(w.taps),
+	)
+}
+
+func nativeResizeV(src []byte, srcStride int, dst []byte, dstStride int, rowBytes int, y0 int, rows int, w weights) {
+	acc := make([]float32, rowBytes)
+	C.gcc_resize_v(
+		bytePtr(src), C.int(srcStride), bytePtr(dst), C.int(dstStride), C.int(rowBytes), C.int(y0), C.int(rows),
+		(*C.int32_t)(unsafe.Pointer(unsafe.SliceData(w.starts))), (*C.float)(unsafe.Pointer(unsafe.SliceData(w.values))), C.int(w.taps),
+		(*C.float)(unsafe.Pointer(unsafe.SliceData(acc))),
+	)
+}
+
+func nativeGray(src []byte, srcStride int, dst []byte, dstStride int, width int, rows int, weights [3]int) {
+	C.gcc_gray(
+		bytePtr(src), C.int(srcStride), bytePtr(dst), C.int(dstStride), C.int(width), C.int(rows),
+		C.uint32_t(weights[0]), C.uint32_t(weights[1]), C.uint32_t(weights[2]),
+	)
+}
@@ -0,0 +1,11 @@
+//go:build !cgo || !simd
+
+package epubimagesimd
+
+const nativeAvailable = false
+
+func nativeResizeH([]byte, int, []byte, int, int, int, int, weights) {}
+
+func nativeResizeV([]byte, int, []byte, int, int, int, int, weights) {}
+
+func nativeGray([]byte, int, []byte, int, int, int, [3]int) {}
@@ -0,0 +1,227 @@
+/*
+Package epubimagesimd Resize and convert to grayscale the 8 bits images with SIMD instructions.
+
+The native code is written in C with the vector extensions of gcc and clang (SSE on amd64, NEON on arm64),
+it is only available if the program is built with cgo and the simd tag:
+
+	go build -tags simd
+
+The other images, and every image of a build without it, are drawn by the gift filters.
+*/
+package epubimagesimd
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/disintegration/gift"
+)
+
+// Weights of red, green and blue of the grayscale modes, in 1/65536.
+var (
+	Rec601    = [3]int{19595, 38470, 7471} // gift.Grayscale
+	Average   = [3]int{21845, 21846, 21845}
+	Luminance = [3]int{13933, 46871, 4732}
+)
+
+// Available check if the native code is compiled in.
+func Available() bool {
+	return nativeAvailable
+}
+
+// ResizeToFit like gift.ResizeToFit with the lanczos resampling.
+//
+// *image.Gray into *image.Gray and *image.RGBA into *image.RGBA are resized by the native code.
+func ResizeToFit(width, height int) gift.Filter {
+	return resizeToFit{gift.ResizeToFit(width, height, gift.LanczosResampling)}
+}
+
+type resizeToFit struct {
+	gift.Filter
+}
+
+func (f resizeToFit) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	b := f.Bounds(src.Bounds())
+	if nativeAvailable && !b.Empty() && resize(dst, src, b.Dx(), b.Dy(), parallel(options)) {
+		return
+	}
+	f.Filter.Draw(dst, src, options)
+}
+
+// Grayscale convert with the weights of red, green and blue, the filter is the same conversion by gift.
+//
+// *image.RGBA and *image.YCbCr (Rec601 only) into *image.Gray are converted by the native code.
+func Grayscale(weights [3]int, filter gift.Filter) gift.Filter {
+	return grayscale{filter, weights}
+}
+
+type grayscale struct {
+	gift.Filter
+	weights [3]int
+}
+
+func (f grayscale) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	if nativeAvailable && gray(dst, src, f.weights, parallel(options)) {
+		return
+	}
+	f.Filter.Draw(dst, src, options)
+}
+
+func gray(dst draw.Image, src image.Image, weights [3]int, parallel bool) bool {
+	d, ok := dst.(*image.Gray)
+	if !ok || !d.Rect.Size().Eq(src.Bounds().Size()) {
+		return false
+	}
+	w, h := d.Rect.Dx(), d.Rect.Dy()
+	switch s := src.(type) {
+	case *image.RGBA:
+		rows(h, parallel, func(y0, y1 int) {
+			nativeGray(s.Pix[s.PixOffset(s.Rect.Min.X, s.Rect.Min.Y+y0):], s.Stride, d.Pix[d.PixOffset(d.Rect.Min.X, d.Rect.Min.Y+y0):], d.Stride, w, y1-y0, weights)
+		})
+		return true
+	case *image.YCbCr:
+		// the luma of the jpeg is the Rec601 gray
+		if weights != Rec601 {
+			return false
+		}
+		for y := 0; y < h; y++ {
+			copy(d.Pix[d.PixOffset(d.Rect.Min.X, d.Rect.Min.Y+y):][:w], s.Y[s.YOffset(s.Rect.Min.X, s.Rect.Min.Y+y):])
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// pixels of the image from its origin, with the stride and the number of channels. Only *image.Gray and *image.RGBA.
+func pixels(img image.Image) ([]byte, int, int) {
+	switch t := img.(type) {
+	case *image.Gray:
+		return t.Pix[t.PixOffset(t.Rect.Min.X, t.Rect.Min.Y):], t.Stride, 1
+	case *image.RGBA:
+		return t.Pix[t.PixOffset(t.Rect.Min.X, t.Rect.Min.Y):], t.Stride, 4
+	default:
+		return nil, 0, 0
+	}
+}
+
+// resize the src into w x h at the origin of dst, horizontally then vertically.
+func resize(dst draw.Image, src image.Image, w, h int, parallel bool) bool {
+	srcPix, srcStride, channels := pixels(src)
+	dstPix, dstStride, dstChannels := pixels(dst)
+	if channels == 0 || channels != dstChannels || dst.Bounds().Dx() < w || dst.Bounds().Dy() < h {
+		return false
+	}
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+
+	if srcW != w {
+		hw := prepareWeights(w, srcW, channels == 1)
+		tmp, tmpStride := dstPix, dstStride
+		if srcH != h {
+			tmpStride = w * channels
+			tmp = make([]byte, tmpStride*srcH)
+		}
+		rows(srcH, parallel, func(y0, y1 int) {
+			nativeResizeH(srcPix[y0*srcStride:], srcStride, tmp[y0*tmpStride:], tmpStride, y1-y0, channels, w, hw)
+		})
+		srcPix, srcStride = tmp, tmpStride
+	}
+
+	if srcH != h {
+		vw := prepareWeights(h, srcH, false)
+		rows(h, parallel, func(y0, y1 int) {
+			nativeResizeV(srcPix, srcStride, dstPix[y0*dstStride:], dstStride, w*channels, y0, y1-y0, vw)
+		})
+	} else if srcW == w {
+		for y := 0; y < h; y++ {
+			copy(dstPix[y*dstStride:][:w*channels], srcPix[y*srcStride:])
+		}
+	}
+	return true
+}
+
+// weights of the source pixels of each destination pixel, all with the same number of taps.
+type weights struct {
+	starts []int32
+	values []float32
+	taps   int
+}
+
+func lanczos(x float32) float32 {
+	if x > -3 && x < 3 {
+		return sinc(x) * sinc(x/3)
+	}
+	return 0
+}
+
+func sinc(x float32) float32 {
+	if x == 0 {
+		return 1
+	}
+	return float32(math.Sin(math.Pi*float64(x)) / (math.Pi * float64(x)))
+}
+
+// prepareWeights like gift, padded to a multiple of 4 taps for the vectors if pad.
+func prepareWeights(dstSize, srcSize int, pad bool) weights {
+	delta := float32(srcSize) / float32(dstSize)
+	scale := max(delta, 1)
+	radius := float32(math.Ceil(float64(scale * 3)))
+
+	lefts := make([]int, dstSize)
+	values := make([][]float32, dstSize)
+	taps := 0
+	for i := range dstSize {
+		center := (float32(i)+0.5)*delta - 0.5
+		left := max(int(math.Ceil(float64(center-radius))), 0)
+		right := min(int(math.Floor(float64(center+radius))), srcSize-1)
+		var sum float32
+		v := make([]float32, right-left+1)
+		for j := left; j <= right; j++ {
+			v[j-left] = lanczos((float32(j) - center) / scale)
+			sum += v[j-left]
+		}
+		for j := range v {
+			v[j] /= sum
+		}
+		lefts[i], values[i] = left, v
+		taps = max(taps, len(v))
+	}
+	if pad && (taps+3)/4*4 <= srcSize {
+		taps = (taps + 3) / 4 * 4
+	}
+
+	// the windows near the end start earlier to stay within the source
+	w := weights{starts: make([]int32, dstSize), values: make([]float32, dstSize*taps), taps: taps}
+	for i, v := range values {
+		start := min(lefts[i], srcSize-taps)
+		w.starts[i] = int32(start)
+		copy(w.values[i*taps+lefts[i]-start:], v)
+	}
+	return w
+}
+
+func parallel(options *gift.Options) bool {
+	return options == nil || options.Parallelization
+}
+
+// rows split the n rows between the cpus.
+func rows(n int, parallel bool, fn func(y0, y1 int)) {
+	procs := runtime.GOMAXPROCS(0)
+	if !parallel || procs == 1 || n < 2*procs {
+		fn(0, n)
+		return
+	}
+	step := (n + procs - 1) / procs
+	var wg sync.WaitGroup
+	for y := 0; y < n; y += step {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			fn(y0, y1)
+		}(y, min(y+step, n))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,187 @@
+package epubimagesimd
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"github.com/disintegration/gift"
+)
+
+// scan a page with flat areas, lines and noise.
+func scan(w, h int, rgba bool) draw.Image {
+	r := rand.New(rand.NewSource(int64(w*h + 1)))
+	var img draw.Image = image.NewGray(image.Rect(0, 0, w, h))
+	if rgba {
+		img = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	pix, _, _ := pixels(img)
+	for i := range pix {
+		switch x := i % (w * 4); {
+		case x%97 < 3:
+			pix[i] = 0
+		case (i/(w*4))%50 < 25:
+			pix[i] = 0xff
+		default:
+			pix[i] = uint8(r.Intn(256))
+		}
+	}
+	if rgba {
+		// opaque
+		for i := 3; i < len(pix); i += 4 {
+			pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+func maxDiff(t *testing.T, a, b image.Image) int {
+	t.Helper()
+	if a.Bounds() != b.Bounds() {
+		t.Fatalf("bounds %v, want %v", a.Bounds(), b.Bounds())
+	}
+	pa, _, _ := pixels(a)
+	pb, _, _ := pixels(b)
+	d := 0
+	for i := range pa {
+		d = max(d, int(pa[i])-int(pb[i]), int(pb[i])-int(pa[i]))
+	}
+	return d
+}
+
+// TestPrepareWeights each window stay within the source and its weights sum to 1.
+func TestPrepareWeights(t *testing.T) {
+	for _, tc := range []struct{ dst, src int }{{1, 1}, {1, 7}, {3, 2}, {100, 333}, {1264, 2480}, {1680, 1681}, {9, 3}} {
+		for _, pad := range []bool{false, true} {
+			w := prepareWeights(tc.dst, tc.src, pad)
+			if pad && w.taps%4 != 0 && w.taps+4 <= tc.src {
+				t.Errorf("%v pad: %d taps", tc, w.taps)
+			}
+			for i, start := range w.starts {
+				if start < 0 || int(start)+w.taps > tc.src {
+					t.Fatalf("%v: window %d at %d of %d taps", tc, i, start, w.taps)
+				}
+				var sum float32
+				for _, v := range w.values[i*w.taps : (i+1)*w.taps] {
+					sum += v
+				}
+				if sum < 0.999 || sum > 1.001 {
+					t.Fatalf("%v: window %d sum %f", tc, i, sum)
+				}
+			}
+		}
+	}
+}
+
+// TestResizeToFit the native resize give the pixels of gift, within the rounding.
+func TestResizeToFit(t *testing.T) {
+	if !Available() {
+		t.Skip("build with cgo and -tags simd")
+	}
+	for _, tc := range []struct {
+		name     string
+		w, h     int
+		fitW     int
+		fitH     int
+		rgba     bool
+		wantSize image.Point
+	}{
+		{"gray down", 300, 421, 100, 100, false, image.Pt(71, 100)},
+		{"rgba down", 421, 300, 100, 100, true, image.Pt(100, 71)},
+		{"gray width only", 200, 50, 100, 50, false, image.Pt(100, 25)},
+		{"gray height only", 50, 200, 50, 100, false, image.Pt(25, 100)},
+		{"rgba up", 30, 20, 300, 200, true, image.Pt(30, 20)},
+		{"gray tiny", 5, 3, 1, 1, false, image.Pt(1, 1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := scan(tc.w, tc.h, tc.rgba)
+			want := gift.New(gift.ResizeToFit(tc.fitW, tc.fitH, gift.LanczosResampling))
+			got := gift.New(ResizeToFit(tc.fitW, tc.fitH))
+			if size := got.Bounds(src.Bounds()).Size(); size != tc.wantSize {
+				t.Fatalf("size %v, want %v", size, tc.wantSize)
+			}
+			var dstWant, dstGot draw.Image = image.NewGray(want.Bounds(src.Bounds())), image.NewGray(got.Bounds(src.Bounds()))
+			if tc.rgba {
+				dstWant, dstGot = image.NewRGBA(want.Bounds(src.Bounds())), image.NewRGBA(got.Bounds(src.Bounds()))
+			}
+			want.Draw(dstWant, src)
+			got.Draw(dstGot, src)
+			if d := maxDiff(t, dstGot, dstWant); d > 1 {
+				t.Errorf("max difference %d", d)
+			}
+		})
+	}
+}
+
+// TestGrayscale the native conversion give the pixels of gift, within the rounding.
+func TestGrayscale(t *testing.T) {
+	if !Available() {
+		t.Skip("build with cgo and -tags simd")
+	}
+	src := scan(123, 45, true)
+	ycbcr := image.NewYCbCr(src.Bounds(), image.YCbCrSubsampleRatio444)
+	for y := 0; y < 45; y++ {
+		for x := 0; x < 123; x++ {
+			c := src.At(x, y).(color.RGBA)
+			i := ycbcr.YOffset(x, y)
+			ycbcr.Y[i], ycbcr.Cb[i], ycbcr.Cr[i] = color.RGBToYCbCr(c.R, c.G, c.B)
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		src     image.Image
+		weights [3]int
+		filter  gift.Filter
+	}{
+		{"rgba rec601", src, Rec601, gift.Grayscale()},
+		{"rgba average", src, Average, gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+			y := (r + g + b) / 3
+			return y, y, y, a
+		})},
+		{"ycbcr rec601", ycbcr, Rec601, gift.Grayscale()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want, got := image.NewGray(src.Bounds()), image.NewGray(src.Bounds())
+			gift.New(tc.filter).Draw(want, tc.src)
+			gift.New(Grayscale(tc.weights, tc.filter)).Draw(got, tc.src)
+			if d := maxDiff(t, got, want); d > 1 {
+				t.Errorf("max difference %d", d)
+			}
+		})
+	}
+}
+
+// BenchmarkResizeToFit an A4 scan at 300 dpi into the view of a Kobo Libra, with gift and with the native code.
+func BenchmarkResizeToFit(b *testing.B) {
+	for _, rgba := range []bool{false, true} {
+		src := scan(2480, 3508, rgba)
+		name := "gray"
+		if rgba {
+			name = "rgba"
+		}
+		for _, backend := range []struct {
+			name   string
+			filter gift.Filter
+		}{
+			{"gift", gift.ResizeToFit(1264, 1680, gift.LanczosResampling)},
+			{"simd", ResizeToFit(1264, 1680)},
+		} {
+			b.Run(name+"/"+backend.name, func(b *testing.B) {
+				if backend.name == "simd" && !Available() {
+					b.Skip("build with cgo and -tags simd")
+				}
+				g := gift.New(backend.filter)
+				var dst draw.Image = image.NewGray(g.Bounds(src.Bounds()))
+				if rgba {
+					dst = image.NewRGBA(g.Bounds(src.Bounds()))
+				}
+				b.ResetTimer()
+				for range b.N {
+					g.Draw(dst, src)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package epubimagewebp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+	"slices"
+)
+
+// the lossless format (VP8L), written with the subtract green and the predictor transforms,
+// the runs of the same pixel as backward references, and a prefix code by channel.
+const (
+	predictorBits = 4 // blocks of 16x16 pixels sharing a predictor
+	maxLength     = 4096
+	minRun        = 3
+	// alphabets
+	numLiterals    = 256
+	numLengthCodes = 24
+	numDistCodes   = 40
+	// distance code of the pixel on the left, in the plane codes of the spec
+	leftDistanceCode = 2
+)
+
+// predictors tried for each block: left, top, average of left and top
+var predictors = []int{1, 2, 7}
+
+// codeLengthOrder the order of the lengths of the code length code.
+var codeLengthOrder = []int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// bitWriter write the bits from the least significant, like the decoder read them.
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+func (b *bitWriter) write(v uint32, n uint) {
+	b.acc |= uint64(v) << b.n
+	b.n += n
+	for b.n >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.n -= 8
+	}
+}
+
+func (b *bitWriter) bytes() []byte {
+	if b.n > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.n = 0, 0
+	}
+	return b.buf
+}
+
+// encodeLossless write the image as a lossless webp.
+func encodeLossless(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return fmt.Errorf("webp: %dx%d out of the 16384x16384 limit", width, height)
+	}
+	argb, hasAlpha := toARGB(img)
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	// the transforms are undone by the decoder in the reverse order
+	subtractGreen(argb)
+	bw.write(1, 1)
+	bw.write(2, 2)
+
+	modes := predict(argb, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(predictorBits-2, 3)
+	writeImage(bw, modes, false)
+
+	bw.write(0, 1)
+	writeImage(bw, argb, true)
+
+	data := bw.bytes()
+	pad := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+len(data)+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if pad == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// toARGB the non premultiplied pixels, and if one is not opaque.
+func toARGB(img image.Image) ([]uint32, bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	argb := make([]uint32, 0, width*height)
+	hasAlpha := false
+	switch src := img.(type) {
+	case *image.Gray:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for _, v := range src.Pix[src.PixOffset(bounds.Min.X, y):][:width] {
+				c := uint32(v)
+				argb = append(argb, 0xff000000|c<<16|c<<8|c)
+			}
+		}
+	default:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				if c.A != 0xff {
+					hasAlpha = true
+				}
+				argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+			}
+		}
+	}
+	return argb, hasAlpha
+}
+
+// subtractGreen remove the green from the red and the blue, the same for the gray pixels.
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// subPixels the difference of each channel, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	ag := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	rb := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+// average2 the average of each channel.
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+// prediction of the pixel at x, y by the mode, the borders are predicted like the decoder do.
+func prediction(argb []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+	switch mode {
+	case 1:
+		return argb[i-1]
+	case 2:
+		return argb[i-width]
+	default:
+		return average2(argb[i-1], argb[i-width])
+	}
+}
+
+// cost of a residual, the sum of the distances to 0 of its channels.
+func cost(r uint32) int {
+	c := 0
+	for s := 0; s < 32; s += 8 {
+		v := int(int8(r >> s))
+		c += max(v, -v)
+	}
+	return c
+}
+
+// predict choose the predictor of each block, then replace the pixels by their residuals.
+//
+// return the image of the predictors, in the green channel.
+func predict(argb []uint32, width, height int) []uint32 {
+	size := 1 << predictorBits
+	modesWidth := (width + size - 1) / size
+	modesHeight := (height + size - 1) / size
+	modes := make([]uint32, modesWidth*modesHeight)
+	for by := range modesHeight {
+		for bx := range modesWidth {
+			best, bestCost := predictors[0], -1
+			for _, mode := range predictors {
+				c := 0
+				for y := by * size; y < min(height, (by+1)*size); y++ {
+					for x := bx * size; x < min(width, (bx+1)*size); x++ {
+						c += cost(subPixels(argb[y*width+x], prediction(argb, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || c < bestCost {
+					best, bestCost = mode, c
+				}
+			}
+			modes[by*modesWidth+bx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+
+	// the predictions use the original pixels, the residuals are written from the end
+	for y := height - 1; y >= 0; y-- {
+		for x := width - 1; x >= 0; x-- {
+			mode := int(modes[(y>>predictorBits)*modesWidth+x>>predictorBits]>>8) & 0xff
+			argb[y*width+x] = subPixels(argb[y*width+x], prediction(argb, width, x, y, mode))
+		}
+	}
+	return modes
+}
+
+// token a pixel, or a copy of the previous pixel.
+type token struct {
+	pixel  uint32
+	length int // 0 for a pixel
+}
+
+// prefixEncode the prefix code and the extra bits of a length or a distance.
+func prefixEncode(v int) (code int, extraBits uint, extra uint32) {
+	if v <= 4 {
+		return v - 1, 0, 0
+	}
+	d := v - 1
+	hb := bits.Len(uint(d)) - 1
+	second := (d >> (hb - 1)) & 1
+	extraBits = uint(hb - 1)
+	return 2*hb + second, extraBits, uint32(d & (1<<extraBits - 1))
+}
+
+// writeImage write the pixels with their prefix codes, without color cache.
+//
+// the meta prefix codes are only for the main image, there is a single group of codes.
+func writeImage(bw *bitWriter, pixels []uint32, main bool) {
+	bw.write(0, 1)
+	if main {
+		bw.write(0, 1)
+	}
+
+	tokens := make([]token, 0, len(pixels)/4)
+	for i := 0; i < len(pixels); {
+		tokens = append(tokens, token{pixel: pixels[i]})
+		j := i + 1
+		for j < len(pixels) && pixels[j] == pixels[i] {
+			j++
+		}
+		run := j - i - 1
+		if run < minRun {
+			i++
+			continue
+		}
+		for run > 0 {
+			l := min(run, maxLength)
+			if l < minRun {
+				// the end of a long run
+				for range l {
+					tokens = append(tokens, token{pixel: pixels[i]})
+				}
+			} else {
+				tokens = append(tokens, token{length: l})
+			}
+			run -= l
+		}
+		i = j
+	}
+
+	green := make([]uint32, numLiterals+numLengthCodes)
+	red := make([]uint32, numLiterals)
+	blue := make([]uint32, numLiterals)
+	alpha := make([]uint32, numLiterals)
+	dist := make([]uint32, numDistCodes)
+	distCode, _, _ := prefixEncode(leftDistanceCode)
+	for _, t := range tokens {
+		if t.length > 0 {
+			code, _, _ := prefixEncode(t.length)
+			green[numLiterals+code]++
+			dist[distCode]++
+			continue
+		}
+		green[(t.pixel>>8)&0xff]++
+		red[(t.pixel>>16)&0xff]++
+		blue[t.pixel&0xff]++
+		alpha[t.pixel>>24]++
+	}
+
+	var codes [5]prefixCode
+	for i, h := range [][]uint32{green, red, blue, alpha, dist} {
+		codes[i] = newPrefixCode(h, 15)
+		codes[i].writeLengths(bw)
+	}
+	for _, t := range tokens {
+		if t.length > 0 {
+			code, extraBits, extra := prefixEncode(t.length)
+			codes[0].write(bw, numLiterals+code)
+			bw.write(extra, extraBits)
+			code, extraBits, extra = prefixEncode(leftDistanceCode)
+			codes[4].write(bw, code)
+			bw.write(extra, extraBits)
+			continue
+		}
+		codes[0].write(bw, int((t.pixel>>8)&0xff))
+		codes[1].write(bw, int((t.pixel>>16)&0xff))
+		codes[2].write(bw, int(t.pixel&0xff))
+		codes[3].write(bw, int(t.pixel>>24))
+	}
+}
+
+// prefixCode a canonical Huffman code, a single symbol is coded with 0 bit.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32 // reversed, to be written from the least significant bit
+	single  bool
+}
+
+func newPrefixCode(hist []uint32, limit int) prefixCode {
+	lengths := codeLengths(hist, limit)
+	p := prefixCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	if used == 0 {
+		// the decoder require a symbol
+		p.lengths[0] = 1
+		used = 1
+	}
+	p.single = used == 1
+	if p.single {
+		return p
+	}
+
+	var count [16]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l > 0 {
+			p.codes[s] = bits.Reverse32(next[l]) >> (32 - uint(l))
+			next[l]++
+		}
+	}
+	return p
+}
+
+func (p prefixCode) write(bw *bitWriter, symbol int) {
+	if !p.single {
+		bw.write(p.codes[symbol], uint(p.lengths[symbol]))
+	}
+}
+
+// writeLengths write the code as a normal code: the lengths coded by the code length code, without the repetitions.
+func (p prefixCode) writeLengths(bw *bitWriter) {
+	bw.write(0, 1)
+	hist := make([]uint32, len(codeLengthOrder))
+	for _, l := range p.lengths {
+		hist[l]++
+	}
+	cl := newPrefixCode(hist, 7)
+	n := len(codeLengthOrder)
+	for n > 4 && cl.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		bw.write(uint32(cl.lengths[s]), 3)
+	}
+	// all the symbols of the alphabet
+	bw.write(0, 1)
+	for _, l := range p.lengths {
+		cl.write(bw, int(l))
+	}
+}
+
+// codeLengths of the Huffman code of the histogram, limited in length by flattening the histogram.
+func codeLengths(hist []uint32, limit int) []uint8 {
+	type node struct {
+		weight      uint32
+		symbol      int // -1 for an internal node
+		left, right int
+	}
+	lengths := make([]uint8, len(hist))
+	for countMin := uint32(1); ; countMin *= 2 {
+		nodes := make([]node, 0, 2*len(hist))
+		for s, h := range hist {
+			if h > 0 {
+				nodes = append(nodes, node{weight: max(h, countMin), symbol: s})
+			}
+		}
+		if len(nodes) < 2 {
+			for _, n := range nodes {
+				lengths[n.symbol] = 1
+			}
+			return lengths
+		}
+		slices.SortStableFunc(nodes, func(a, b node) int {
+			if a.weight != b.weight {
+				if a.weight < b.weight {
+					return -1
+				}
+				return 1
+			}
+			return a.symbol - b.symbol
+		})
+
+		// two queues: the sorted leaves, then the internal nodes created in increasing weight
+		leaves := len(nodes)
+		li, ii := 0, leaves
+		pop := func() int {
+			if li < leaves && (ii >= len(nodes) || nodes[li].weight <= nodes[ii].weight) {
+				li++
+				return li - 1
+			}
+			ii++
+			return ii - 1
+		}
+		for range leaves - 1 {
+			a, b := pop(), pop()
+			nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+		}
+
+		depth := make([]int, len(nodes))
+		maxDepth := 0
+		for i := len(nodes) - 1; i >= leaves; i-- {
+			depth[nodes[i].left] = depth[i] + 1
+			depth[nodes[i].right] = depth[i] + 1
+		}
+		for i := range leaves {
+			maxDepth = max(maxDepth, depth[i])
+		}
+		if maxDepth > limit {
+			continue
+		}
+		for i := range leaves {
+			lengths[nodes[i].symbol] = uint8(depth[i])
+		}
+		return lengths
+	}
+}
@@ -0,0 +1,88 @@
+package epubimagewebp
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// pattern the value of a channel: flat areas for the runs, gradients for the predictors and noise.
+func pattern(r *rand.Rand, x, y, channel int) uint8 {
+	switch {
+	case y%7 < 2:
+		return uint8(channel * 60)
+	case x < 5:
+		return uint8(x*40 + y*3 + channel)
+	default:
+		return uint8(r.Intn(256))
+	}
+}
+
+func grayImage(w, h int) image.Image {
+	r := rand.New(rand.NewSource(int64(w*h + 1)))
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{Y: pattern(r, x, y, 0)})
+		}
+	}
+	return img
+}
+
+func nrgbaImage(w, h int, alpha bool) image.Image {
+	r := rand.New(rand.NewSource(int64(w*h + 2)))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: pattern(r, x, y, 0), G: pattern(r, x, y, 1), B: pattern(r, x, y, 2), A: 0xff}
+			if alpha {
+				c.A = pattern(r, x, y, 3)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// TestEncodeLossless the lossless webp decoded by x/image/webp give back the same pixels.
+func TestEncodeLossless(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {1, 9}, {7, 1}, {3, 5}, {17, 31}, {33, 17}, {101, 67}, {257, 3}}
+	for _, s := range sizes {
+		w, h := s[0], s[1]
+		for _, tc := range []struct {
+			name string
+			img  image.Image
+		}{
+			{"gray", grayImage(w, h)},
+			{"nrgba", nrgbaImage(w, h, false)},
+			{"nrgba alpha", nrgbaImage(w, h, true)},
+		} {
+			t.Run(fmt.Sprintf("%s %dx%d", tc.name, w, h), func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := encodeLossless(&buf, tc.img); err != nil {
+					t.Fatal(err)
+				}
+				got, err := webp.Decode(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Bounds() != tc.img.Bounds() {
+					t.Fatalf("bounds %v, want %v", got.Bounds(), tc.img.Bounds())
+				}
+				for y := 0; y < h; y++ {
+					for x := 0; x < w; x++ {
+						want := color.NRGBAModel.Convert(tc.img.At(x, y)).(color.NRGBA)
+						if c := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA); c != want {
+							t.Fatalf("pixel %d,%d: %v, want %v", x, y, c, want)
+						}
+					}
+				}
+			})
+		}
+	}
+}
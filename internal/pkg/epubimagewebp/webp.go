@@ -0,0 +1,50 @@
+/*
+Package epubimagewebp encode the images into webp.
+
+The lossless webp are encoded by the built-in encoder. The lossy webp are encoded by cwebp, the command of libwebp,
+it must be in the PATH.
+*/
+package epubimagewebp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Available check that the encoder of the mode is available.
+func Available(lossless bool) error {
+	if lossless {
+		return nil
+	}
+	if _, err := exec.LookPath("cwebp"); err != nil {
+		return errors.New("cwebp not found, install libwebp (the webp package) or use -webp-lossless")
+	}
+	return nil
+}
+
+// Encode the image into webp, lossy with the quality (0-100) or lossless.
+func Encode(w io.Writer, img image.Image, quality int, lossless bool) error {
+	if lossless {
+		return encodeLossless(w, img)
+	}
+
+	// the image is given uncompressed to cwebp, it is read from the standard input
+	var in bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&in, img); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("cwebp", "-quiet", "-q", strconv.Itoa(quality), "-o", "-", "--", "-")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &in, w, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cwebp: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
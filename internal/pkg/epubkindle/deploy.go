@@ -0,0 +1,211 @@
+package epubkindle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/disintegration/gift"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubhook"
+)
+
+// Dir the directory of the books on the Kindle.
+const Dir = "documents"
+
+// ThumbnailDir the directory of the covers shown on the home screen, named after the ASIN and the type of the book.
+const ThumbnailDir = "system/thumbnails"
+
+// the size of the thumbnails, the Kindle scale them to its layout
+const thumbnailWidth, thumbnailHeight = 330, 470
+
+// characters allowed in the name of a thumbnail
+var asinValid = regexp.MustCompile(`^[\w-]+$`)
+
+// Check that the mount is a Kindle plugged by USB, with its documents and system directories.
+func Check(mount string) error {
+	for _, d := range []string{Dir, "system"} {
+		if fi, err := os.Stat(filepath.Join(mount, d)); err != nil || !fi.IsDir() {
+			return fmt.Errorf("%s is not a mounted Kindle, %s is missing", mount, d)
+		}
+	}
+	return nil
+}
+
+// Deploy the AZW3 or the MOBI onto the Kindle, into documents, with the thumbnail of its cover.
+//
+// the thumbnail is named after the ASIN and the type (EBOK, PDOC) of the EXTH header of the book,
+// a book without them, like the MOBI of kindlegen, is copied without thumbnail: the Kindle generate it.
+func Deploy(mount string, o epubhook.Output) error {
+	if err := Check(mount); err != nil {
+		return err
+	}
+	if err := copyFile(o.Path, filepath.Join(mount, Dir, filepath.Base(o.Path))); err != nil {
+		return fmt.Errorf("kindle copy of %s: %w", o.Path, err)
+	}
+
+	b, err := readBook(o.Path)
+	if err != nil {
+		return fmt.Errorf("kindle thumbnail of %s: %w", o.Path, err)
+	}
+	if b.ASIN == "" || b.CdeType == "" || b.Cover == nil {
+		return nil
+	}
+	if err = thumbnail(filepath.Join(mount, filepath.FromSlash(ThumbnailDir), ThumbnailName(b.ASIN, b.CdeType)), b.Cover); err != nil {
+		return fmt.Errorf("kindle thumbnail of %s: %w", o.Path, err)
+	}
+	return nil
+}
+
+// ThumbnailName the name of the thumbnail of a book: thumbnail_<ASIN>_<type>_portrait.jpg.
+func ThumbnailName(asin, cdeType string) string {
+	return "thumbnail_" + asin + "_" + cdeType + "_portrait.jpg"
+}
+
+// thumbnail of the cover, resized for the home screen.
+func thumbnail(path string, cover []byte) error {
+	img, _, err := image.Decode(bytes.NewReader(cover))
+	if err != nil {
+		return err
+	}
+	g := gift.New(gift.ResizeToFit(thumbnailWidth, thumbnailHeight, gift.LanczosResampling))
+	dst := image.NewRGBA(g.Bounds(img.Bounds()))
+	g.Draw(dst, img)
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90}); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// copyFile through a temporary file, the Kindle may be unplugged during the copy.
+func copyFile(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	w, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err == nil {
+		err = w.Sync()
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// book the details of an AZW3 or a MOBI used by the home screen of the Kindle.
+type book struct {
+	ASIN    string // EXTH 113, or 504
+	CdeType string // EXTH 501
+	Cover   []byte // the image record given by EXTH 201
+}
+
+// EXTH records
+const (
+	exthASIN        = 113
+	exthCoverOffset = 201
+	exthCdeType     = 501
+	exthCdeASIN     = 504
+)
+
+var errNotMobi = errors.New("not a MOBI or AZW3 file")
+
+// readBook the EXTH header and the cover of the Palm database of an AZW3 or a MOBI.
+//
+// the database start with a header of 78 bytes and the offset of each record, the record 0 hold the MOBI header,
+// followed by the EXTH header. The images are records, from the first image index of the MOBI header.
+func readBook(path string) (b book, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if len(data) < 78 || string(data[60:68]) != "BOOKMOBI" {
+		return b, errNotMobi
+	}
+	count := int(binary.BigEndian.Uint16(data[76:]))
+	if len(data) < 78+count*8 {
+		return b, errNotMobi
+	}
+	record := func(i int) []byte {
+		if i < 0 || i >= count {
+			return nil
+		}
+		start, end := int(binary.BigEndian.Uint32(data[78+i*8:])), len(data)
+		if i+1 < count {
+			end = int(binary.BigEndian.Uint32(data[78+(i+1)*8:]))
+		}
+		if start > end || end > len(data) {
+			return nil
+		}
+		return data[start:end]
+	}
+
+	// the PalmDOC header (16 bytes) then the MOBI header
+	r0 := record(0)
+	if len(r0) < 0x84 || string(r0[16:20]) != "MOBI" {
+		return b, errNotMobi
+	}
+	headerLen := int(binary.BigEndian.Uint32(r0[20:]))
+	firstImage := int(binary.BigEndian.Uint32(r0[0x6c:]))
+	if binary.BigEndian.Uint32(r0[0x80:])&0x40 == 0 {
+		return b, nil
+	}
+	exth := r0[min(len(r0), 16+headerLen):]
+	if len(exth) < 12 || string(exth[:4]) != "EXTH" {
+		return b, nil
+	}
+	n := int(binary.BigEndian.Uint32(exth[8:]))
+	coverOffset := -1
+	for p := 12; n > 0 && p+8 <= len(exth); n-- {
+		typ, size := binary.BigEndian.Uint32(exth[p:]), int(binary.BigEndian.Uint32(exth[p+4:]))
+		if size < 8 || p+size > len(exth) {
+			break
+		}
+		v := exth[p+8 : p+size]
+		switch typ {
+		case exthASIN:
+			if asinValid.Match(v) {
+				b.ASIN = string(v)
+			}
+		case exthCdeASIN:
+			if b.ASIN == "" && asinValid.Match(v) {
+				b.ASIN = string(v)
+			}
+		case exthCdeType:
+			if asinValid.Match(v) {
+				b.CdeType = string(v)
+			}
+		case exthCoverOffset:
+			if len(v) == 4 && binary.BigEndian.Uint32(v) != 0xffffffff {
+				coverOffset = int(binary.BigEndian.Uint32(v))
+			}
+		}
+		p += size
+	}
+	if coverOffset >= 0 {
+		b.Cover = record(firstImage + coverOffset)
+	}
+	return b, nil
+}
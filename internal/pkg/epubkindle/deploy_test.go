@@ -0,0 +1,95 @@
+package epubkindle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exth a record of the EXTH header.
+type exth struct {
+	typ   uint32
+	value []byte
+}
+
+func exthUint32(typ, v uint32) exth {
+	return exth{typ, binary.BigEndian.AppendUint32(nil, v)}
+}
+
+// buildMobi a Palm database of a book: the record 0 with the MOBI and EXTH headers, then the images from the record 1.
+func buildMobi(hasExth bool, records []exth, images ...[]byte) []byte {
+	const headerLen = 0xe8
+	r0 := make([]byte, 16+headerLen)
+	copy(r0[16:], "MOBI")
+	binary.BigEndian.PutUint32(r0[20:], headerLen)
+	binary.BigEndian.PutUint32(r0[0x6c:], 1)
+	if hasExth {
+		binary.BigEndian.PutUint32(r0[0x80:], 0x40)
+	}
+	e := make([]byte, 12)
+	copy(e, "EXTH")
+	binary.BigEndian.PutUint32(e[8:], uint32(len(records)))
+	for _, r := range records {
+		e = binary.BigEndian.AppendUint32(e, r.typ)
+		e = binary.BigEndian.AppendUint32(e, uint32(8+len(r.value)))
+		e = append(e, r.value...)
+	}
+	binary.BigEndian.PutUint32(e[4:], uint32(len(e)))
+	r0 = append(r0, e...)
+
+	all := append([][]byte{r0}, images...)
+	data := make([]byte, 78+8*len(all))
+	copy(data[60:], "BOOKMOBI")
+	binary.BigEndian.PutUint16(data[76:], uint16(len(all)))
+	for i, r := range all {
+		binary.BigEndian.PutUint32(data[78+8*i:], uint32(len(data)))
+		data = append(data, r...)
+	}
+	return data
+}
+
+// TestReadBook the ASIN, the type and the cover are read from the EXTH header, the truncated files are rejected or read partially.
+func TestReadBook(t *testing.T) {
+	cover, other := []byte("cover image"), []byte("other image")
+	full := []exth{{exthASIN, []byte("B000TEST01")}, {exthCdeType, []byte("EBOK")}, exthUint32(exthCoverOffset, 1)}
+	mobi, noImages := buildMobi(true, full, other, cover), buildMobi(true, full)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want book
+		err  error
+	}{
+		{"full", mobi, book{ASIN: "B000TEST01", CdeType: "EBOK", Cover: cover}, nil},
+		{"cde asin", buildMobi(true, []exth{{exthCdeASIN, []byte("B000CDE")}, {exthCdeType, []byte("PDOC")}}), book{ASIN: "B000CDE", CdeType: "PDOC"}, nil},
+		{"asin before cde asin", buildMobi(true, []exth{{exthCdeASIN, []byte("B000CDE")}, {exthASIN, []byte("B000TEST01")}}), book{ASIN: "B000TEST01"}, nil},
+		{"invalid asin", buildMobi(true, []exth{{exthASIN, []byte("../B000")}, {exthCdeType, []byte("EB OK")}}), book{}, nil},
+		{"no cover", buildMobi(true, []exth{exthUint32(exthCoverOffset, 0xffffffff)}, cover), book{}, nil},
+		{"cover out of records", buildMobi(true, []exth{exthUint32(exthCoverOffset, 5)}, cover), book{}, nil},
+		{"without exth", buildMobi(false, full, other, cover), book{}, nil},
+		{"not a book", append(bytes.Repeat([]byte{0}, 60), "TEXtREAd"+string(make([]byte, 10))...), book{}, errNotMobi},
+		{"truncated header", mobi[:70], book{}, errNotMobi},
+		{"truncated records", mobi[:80], book{}, errNotMobi},
+		{"truncated record 0", mobi[:78+8*3+0x80], book{}, errNotMobi},
+		{"truncated images", mobi[:len(mobi)-len(cover)-len(other)-4], book{}, errNotMobi},
+		// the EXTH records are read until the truncation
+		{"truncated exth", noImages[:len(noImages)-4], book{ASIN: "B000TEST01", CdeType: "EBOK"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "book.azw3")
+			if err := os.WriteFile(path, tc.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readBook(path)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("error %v, want %v", err, tc.err)
+			}
+			if got.ASIN != tc.want.ASIN || got.CdeType != tc.want.CdeType || !bytes.Equal(got.Cover, tc.want.Cover) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Package epubkindle convert the EPUB written into an AZW3 or a MOBI for the Kindle.
+//
+// the conversion is made by ebook-convert, the command of calibre, or by kindlegen for the MOBI if calibre is missing.
+// The EPUB is replaced by the converted file, next to it: "Saga v01.azw3".
+// The converted file may then be copied onto a Kindle plugged by USB, with the thumbnail of its cover.
+package epubkindle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubhook"
+)
+
+// Formats of the Kindle.
+const (
+	AZW3 = "azw3"
+	MOBI = "mobi"
+)
+
+// ebookConvert the path of ebook-convert, in the PATH or in the default install of calibre.
+func ebookConvert() (string, error) {
+	if path, err := exec.LookPath("ebook-convert"); err == nil {
+		return path, nil
+	}
+	var path string
+	switch runtime.GOOS {
+	case "darwin":
+		path = "/Applications/calibre.app/Contents/MacOS/ebook-convert"
+	case "windows":
+		path = `C:\Program Files\Calibre2\ebook-convert.exe`
+	}
+	if _, err := os.Stat(path); path == "" || err != nil {
+		return "", errors.New("ebook-convert not found")
+	}
+	return path, nil
+}
+
+// Command the path of the converter of the format: ebook-convert, or kindlegen for the MOBI.
+func Command(format string) (string, error) {
+	path, err := ebookConvert()
+	if err == nil {
+		return path, nil
+	}
+	if format == MOBI {
+		if path, err := exec.LookPath("kindlegen"); err == nil {
+			return path, nil
+		}
+		return "", errors.New("ebook-convert or kindlegen not found, install calibre or add it to the PATH")
+	}
+	return "", errors.New("ebook-convert not found, install calibre or add it to the PATH")
+}
+
+// Convert the EPUB into the format, then remove it. The EPUB is kept if the conversion fails.
+func Convert(format string, o epubhook.Output) (epubhook.Output, error) {
+	command, err := Command(format)
+	if err != nil {
+		return o, err
+	}
+	output := strings.TrimSuffix(o.Path, filepath.Ext(o.Path)) + "." + format
+
+	var cmd *exec.Cmd
+	if strings.HasPrefix(filepath.Base(command), "kindlegen") {
+		// kindlegen write into the directory of the EPUB, and exit with 1 on the warnings
+		cmd = exec.Command(command, o.Path, "-c1", "-dont_append_source", "-o", filepath.Base(output))
+	} else {
+		cmd = exec.Command(command, o.Path, output, "--no-inline-toc")
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && strings.HasPrefix(filepath.Base(command), "kindlegen") {
+		err = nil
+	}
+	fi, serr := os.Stat(output)
+	if err == nil {
+		err = serr
+	}
+	if err != nil {
+		_ = os.Remove(output)
+		return o, fmt.Errorf("%s of %s: %w\n%s", filepath.Base(command), o.Path, err, lastLines(out.String(), 10))
+	}
+
+	if err = os.Remove(o.Path); err != nil {
+		return o, err
+	}
+	o.Path, o.Size = output, fi.Size()
+	return o, nil
+}
+
+// lastLines the end of the messages of the command, with the error.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.Join(lines[max(0, len(lines)-n):], "\n")
+}
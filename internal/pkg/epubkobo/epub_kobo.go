@@ -0,0 +1,215 @@
+// Package epubkobo copy the EPUB written onto a mounted Kobo.
+//
+// the Kobo import the new books when it is ejected. The cover thumbnails are written beforehand into .kobo-images,
+// the comics are then listed with their cover at once. The collections are stored in .kobo/KoboReader.sqlite,
+// changed with the sqlite3 command.
+package epubkobo
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/disintegration/gift"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubhook"
+)
+
+// Dir the directory of the comics on the Kobo.
+const Dir = "Comics"
+
+// onboard the path of the storage on the Kobo.
+const onboard = "/mnt/onboard/"
+
+// characters not allowed in a file name on the FAT storage of the Kobo
+var invalid = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+
+// Thumbnail a cover image generated by the Kobo, as jpeg.
+type Thumbnail struct {
+	Suffix        string
+	Width, Height int // 0 = the size of the screen
+}
+
+// Thumbnails of the library: the full screen, the list and the grid. The Kobo scale the last ones to its layout.
+var Thumbnails = []Thumbnail{
+	{" - N3_FULL.parsed", 0, 0},
+	{" - N3_LIBRARY_FULL.parsed", 355, 530},
+	{" - N3_LIBRARY_GRID.parsed", 149, 233},
+}
+
+// Options of the deployment.
+type Options struct {
+	Mount         string // root of the mounted Kobo, with the .kobo directory
+	Collections   bool   // add the EPUB into the collection of its series
+	Width, Height int    // screen of the Kobo
+}
+
+// Check that the mount is a Kobo, and that sqlite3 is available for the collections.
+func Check(mount string, collections bool) error {
+	if fi, err := os.Stat(filepath.Join(mount, ".kobo")); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s is not a mounted Kobo, .kobo is missing", mount)
+	}
+	if !collections {
+		return nil
+	}
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return errors.New("sqlite3 not found, it is required to update the collections of the Kobo")
+	}
+	if _, err := os.Stat(filepath.Join(mount, ".kobo", "KoboReader.sqlite")); err != nil {
+		return fmt.Errorf("the database of the Kobo is missing: %w", err)
+	}
+	return nil
+}
+
+// Deploy the EPUB onto the Kobo, into Comics/<collection>, with its thumbnails.
+//
+// the collection is the series, empty for a book alone.
+func Deploy(o Options, out epubhook.Output, collection string) error {
+	if err := Check(o.Mount, o.Collections); err != nil {
+		return err
+	}
+	name := path.Join(Dir, filepath.Base(out.Path))
+	if collection != "" {
+		name = path.Join(Dir, strings.TrimSpace(invalid.ReplaceAllString(collection, "_")), filepath.Base(out.Path))
+	}
+	if err := copyFile(out.Path, filepath.Join(o.Mount, filepath.FromSlash(name))); err != nil {
+		return fmt.Errorf("kobo copy of %s: %w", out.Path, err)
+	}
+
+	contentId := "file://" + onboard + name
+	if err := thumbnails(o, out.Path, contentId); err != nil {
+		return fmt.Errorf("kobo thumbnails of %s: %w", out.Path, err)
+	}
+	if o.Collections && collection != "" {
+		if err := addToShelf(o.Mount, collection, contentId); err != nil {
+			return fmt.Errorf("kobo collection of %s: %w", out.Path, err)
+		}
+	}
+	return nil
+}
+
+// copyFile through a temporary file, the Kobo may be unplugged during the copy.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	w, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err == nil {
+		err = w.Sync()
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// ImageId of a book, the name of its thumbnails.
+func ImageId(contentId string) string {
+	return strings.NewReplacer("/", "_", " ", "_", ":", "_", ".", "_").Replace(contentId)
+}
+
+// ImageDir of the thumbnails of a book, spread by the hash of Qt of its image id: .kobo-images/<0-255>/<0-255>.
+func ImageDir(imageId string) string {
+	var h uint32
+	for _, c := range []byte(imageId) {
+		h = (h << 4) + uint32(c)
+		h ^= (h & 0xf0000000) >> 23
+		h &= 0x0fffffff
+	}
+	return path.Join(".kobo-images", fmt.Sprint((h&0xff00)>>8), fmt.Sprint(h&0xff))
+}
+
+// thumbnails of the cover of the EPUB, in place of the ones generated by the Kobo.
+func thumbnails(o Options, epub, contentId string) error {
+	cover, err := readCover(epub)
+	if err != nil {
+		return err
+	}
+	imageId := ImageId(contentId)
+	dir := filepath.Join(o.Mount, filepath.FromSlash(ImageDir(imageId)))
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, t := range Thumbnails {
+		w, h := t.Width, t.Height
+		if w == 0 {
+			w, h = o.Width, o.Height
+		}
+		g := gift.New(gift.ResizeToFit(w, h, gift.LanczosResampling))
+		dst := image.NewRGBA(g.Bounds(cover.Bounds()))
+		g.Draw(dst, cover)
+		var b bytes.Buffer
+		if err = jpeg.Encode(&b, dst, &jpeg.Options{Quality: 90}); err != nil {
+			return err
+		}
+		if err = os.WriteFile(filepath.Join(dir, imageId+t.Suffix), b.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCover decode the cover of the EPUB.
+func readCover(epub string) (image.Image, error) {
+	z, err := zip.OpenReader(epub)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	f, err := z.Open("OEBPS/Images/cover.jpeg")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// addToShelf the book, the shelf is created if needed.
+func addToShelf(mount, shelf, contentId string) error {
+	now := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	q := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	sql := fmt.Sprintf(`BEGIN;
+INSERT INTO Shelf (CreationDate, Id, InternalName, LastModified, Name, _IsDeleted, _IsVisible, _IsSynced)
+	SELECT %[1]s, %[2]s, %[2]s, %[1]s, %[2]s, 'false', 'true', 'false'
+	WHERE NOT EXISTS (SELECT 1 FROM Shelf WHERE InternalName = %[2]s);
+UPDATE Shelf SET _IsDeleted = 'false', _IsVisible = 'true', LastModified = %[1]s WHERE InternalName = %[2]s;
+DELETE FROM ShelfContent WHERE ShelfName = %[2]s AND ContentId = %[3]s;
+INSERT INTO ShelfContent (ShelfName, ContentId, DateModified, _IsDeleted, _IsSynced) VALUES (%[2]s, %[3]s, %[1]s, 'false', 'false');
+COMMIT;
+`, q(now), q(shelf), q(contentId))
+	cmd := exec.Command("sqlite3", "-bail", filepath.Join(mount, ".kobo", "KoboReader.sqlite"))
+	cmd.Stdin = strings.NewReader(sql)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
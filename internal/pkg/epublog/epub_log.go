@@ -0,0 +1,92 @@
+// Package epublog structured log of the conversion, with the decisions taken on each page and the timings.
+//
+// the log use the default slog logger: the code log with slog.Debug, slog.Info and slog.Warn.
+//   - warn: the problems that do not stop the conversion (a download retried, ...)
+//   - info: the steps of the conversion and their timings
+//   - debug: the decisions on each page (crop, split, rotation, blank) and their timings
+package epublog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+)
+
+type Options struct {
+	Verbose     bool   // info
+	VeryVerbose bool   // debug
+	Quiet       bool   // errors only
+	Json        bool   // json lines instead of text
+	File        string // json lines with all the details, in addition to stderr
+}
+
+// Setup the default logger, the returned function close the log file.
+func Setup(o Options) (func() error, error) {
+	level := slog.LevelWarn
+	switch {
+	case o.VeryVerbose:
+		level = slog.LevelDebug
+	case o.Verbose:
+		level = slog.LevelInfo
+	case o.Quiet:
+		level = slog.LevelError
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, handlerOptions)
+	if o.Json {
+		handler = slog.NewJSONHandler(os.Stderr, handlerOptions)
+	}
+
+	closeFile := func() error { return nil }
+	if o.File != "" {
+		f, err := os.Create(o.File)
+		if err != nil {
+			return nil, err
+		}
+		handler = multiHandler{handler, slog.NewJSONHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug})}
+		closeFile = f.Close
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return closeFile, nil
+}
+
+// multiHandler send the records to each handler enabled for their level.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
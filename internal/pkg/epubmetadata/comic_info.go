@@ -0,0 +1,177 @@
+package epubmetadata
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// comicInfoOrder the elements of the ComicInfo.xml schema, in their order.
+var comicInfoOrder = []string{
+	"Title", "Series", "Number", "Count", "Volume", "AlternateSeries", "AlternateNumber", "AlternateCount",
+	"Summary", "Notes", "Year", "Month", "Day", "Writer", "Penciller", "Inker", "Colorist", "Letterer",
+	"CoverArtist", "Editor", "Translator", "Publisher", "Imprint", "Genre", "Tags", "Web", "PageCount",
+	"LanguageISO", "Format", "BlackAndWhite", "Manga", "Characters", "Teams", "Locations", "ScanInformation",
+	"StoryArc", "StoryArcNumber", "SeriesGroup", "AgeRating", "Pages", "CommunityRating",
+	"MainCharacterOrTeam", "Review", "GTIN",
+}
+
+// WriteComicInfo write the metadata into the ComicInfo.xml of the input, a directory or a cbz/zip archive.
+//
+// the empty fields are left as is, like the other elements of the file (pages, summary, ...).
+// the input is rewritten only if a field changed, the other archives (cbr, pdf) are left as is.
+func WriteComicInfo(input string, m epuboptions.Metadata) (changed bool, err error) {
+	fi, err := os.Stat(input)
+	if err != nil {
+		return false, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(input)); {
+	case fi.IsDir(), ext == ".cbz", ext == ".zip":
+	default:
+		return false, nil
+	}
+
+	doc := etree.NewDocument()
+	data, err := readComicInfo(input)
+	switch {
+	case err == nil:
+		if err = doc.ReadFromBytes(data); err != nil {
+			return false, err
+		}
+	case errors.Is(err, os.ErrNotExist):
+		doc.CreateProcInst("xml", `version="1.0" encoding="utf-8"`)
+	default:
+		return false, err
+	}
+	root := doc.Root()
+	if root == nil {
+		root = doc.CreateElement("ComicInfo")
+		root.CreateAttr("xmlns:xsi", "http://www.w3.org/2001/XMLSchema-instance")
+		root.CreateAttr("xmlns:xsd", "http://www.w3.org/2001/XMLSchema")
+	}
+
+	for _, f := range []struct{ tag, value string }{
+		{"Title", m.Title},
+		{"Series", m.Series},
+		{"Number", m.Number},
+		{"Volume", m.Volume},
+		{"Writer", m.Author},
+		{"Publisher", m.Publisher},
+		{"LanguageISO", m.Language},
+	} {
+		if f.value != "" && setComicInfo(root, f.tag, f.value) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	doc.Indent(2)
+	if data, err = doc.WriteToBytes(); err != nil {
+		return false, err
+	}
+	if fi.IsDir() {
+		return true, os.WriteFile(filepath.Join(input, "ComicInfo.xml"), data, 0644)
+	}
+	return true, replaceComicInfo(input, fi.Mode(), data)
+}
+
+// setComicInfo set the text of the element, added at its place in the schema if missing.
+func setComicInfo(root *etree.Element, tag, value string) bool {
+	if e := root.SelectElement(tag); e != nil {
+		if e.Text() == value {
+			return false
+		}
+		e.SetText(value)
+		return true
+	}
+	e := etree.NewElement(tag)
+	e.SetText(value)
+	pos := slices.Index(comicInfoOrder, tag)
+	for _, c := range root.ChildElements() {
+		if i := slices.Index(comicInfoOrder, c.Tag); i > pos {
+			root.InsertChildAt(c.Index(), e)
+			return true
+		}
+	}
+	root.AddChild(e)
+	return true
+}
+
+// replaceComicInfo rewrite the archive with the ComicInfo.xml, the other files are copied without being compressed again.
+func replaceComicInfo(input string, mode os.FileMode, data []byte) error {
+	r, err := zip.OpenReader(input)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(input), "."+filepath.Base(input)+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		_ = r.Close()
+		return err
+	}
+	w := zip.NewWriter(f)
+	err = func() error {
+		// the ComicInfo.xml keep its place, or is added at the end
+		written := false
+		for _, zf := range r.File {
+			switch {
+			case !strings.EqualFold(zf.Name, "ComicInfo.xml"):
+				if err := w.Copy(zf); err != nil {
+					return err
+				}
+			case !written:
+				if err := writeEntry(w, zf.Name, data); err != nil {
+					return err
+				}
+				written = true
+			}
+		}
+		if !written {
+			if err := writeEntry(w, "ComicInfo.xml", data); err != nil {
+				return err
+			}
+		}
+		if err := w.SetComment(r.Comment); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		// on the disk before the rename, a crash never leave a truncated archive
+		return f.Sync()
+	}()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	// the archive is closed before being replaced, for windows
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, input)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// writeEntry add the file compressed into the archive.
+func writeEntry(w *zip.Writer, name string, data []byte) error {
+	fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
@@ -0,0 +1,159 @@
+// Package epubmetadata lookup the metadata of the inputs, from the registered providers then the built-in ones.
+package epubmetadata
+
+import (
+	"archive/zip"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nwaples/rardecode/v2"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+var (
+	// "Series v01", "Series Vol. 1", "Series - Volume 1"
+	nameVolume = regexp.MustCompile(`(?i)^(.+?)[\s._-]+(?:v|vol\.?|volume)[\s._]*(\d+)\b`)
+	// "Series 012", "Series #12"
+	nameNumber = regexp.MustCompile(`^(.+?)[\s._-]+#?(\d+)$`)
+)
+
+// built-in providers, the most explicit first
+var (
+	Sidecar   epuboptions.MetadataProvider = epuboptions.MetadataProviderFunc(sidecar)
+	ComicInfo epuboptions.MetadataProvider = epuboptions.MetadataProviderFunc(comicInfo)
+	FileName  epuboptions.MetadataProvider = epuboptions.MetadataProviderFunc(fileName)
+)
+
+// Lookup the metadata of the input from the registered providers then the built-in ones,
+// each completing the fields left empty by the previous.
+//
+// the metadata is optional, the errors of the providers are returned with the metadata found by the others.
+func Lookup(input string) (m epuboptions.Metadata, err error) {
+	return lookup(input, append(epuboptions.MetadataProviders(), Sidecar, ComicInfo, FileName))
+}
+
+// LookupExplicit the metadata given for the input by the registered providers and the sidecar only,
+// without the ComicInfo.xml it already has nor the guesses from its name.
+func LookupExplicit(input string) (m epuboptions.Metadata, err error) {
+	return lookup(input, append(epuboptions.MetadataProviders(), Sidecar))
+}
+
+func lookup(input string, providers []epuboptions.MetadataProvider) (m epuboptions.Metadata, err error) {
+	var errs []error
+	for _, p := range providers {
+		r, err := p.Lookup(input)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		m = merge(m, r)
+	}
+	return m, errors.Join(errs...)
+}
+
+// merge complete the empty fields of m.
+func merge(m, o epuboptions.Metadata) epuboptions.Metadata {
+	m.Title = cmp.Or(m.Title, o.Title)
+	m.Series = cmp.Or(m.Series, o.Series)
+	m.Volume = cmp.Or(m.Volume, o.Volume)
+	m.Number = cmp.Or(m.Number, o.Number)
+	m.Language = cmp.Or(m.Language, o.Language)
+	m.Author = cmp.Or(m.Author, o.Author)
+	m.Publisher = cmp.Or(m.Publisher, o.Publisher)
+	return m
+}
+
+// SidecarPath the json file next to the input with the same name: "Series v01.json" for "Series v01.cbz".
+func SidecarPath(input string) string {
+	input = filepath.Clean(input)
+	return strings.TrimSuffix(input, filepath.Ext(input)) + ".json"
+}
+
+// sidecar read the json file next to the input, with the json fields of the metadata.
+func sidecar(input string) (m epuboptions.Metadata, err error) {
+	data, err := os.ReadFile(SidecarPath(input))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &m)
+	}
+	if err != nil {
+		err = fmt.Errorf("sidecar %s: %w", SidecarPath(input), err)
+	}
+	return
+}
+
+// fileName parse the name of the input: "Series v01", "Series 012".
+func fileName(input string) (m epuboptions.Metadata, _ error) {
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	if r := nameVolume.FindStringSubmatch(name); r != nil {
+		m.Series, m.Volume = strings.TrimSpace(r[1]), r[2]
+	} else if r = nameNumber.FindStringSubmatch(name); r != nil {
+		m.Series, m.Number = strings.TrimSpace(r[1]), r[2]
+	}
+	return
+}
+
+// comicInfo read the ComicInfo.xml at the root of the input, a broken file only leave the fields empty.
+func comicInfo(input string) (m epuboptions.Metadata, _ error) {
+	if data, err := readComicInfo(input); err == nil {
+		_ = xml.Unmarshal(data, &m)
+	}
+	return
+}
+
+// readComicInfo the content of the ComicInfo.xml file at the root of the input.
+func readComicInfo(input string) ([]byte, error) {
+	fi, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return os.ReadFile(filepath.Join(input, "ComicInfo.xml"))
+	}
+
+	switch strings.ToLower(filepath.Ext(input)) {
+	case ".cbz", ".zip":
+		r, err := zip.OpenReader(input)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if strings.EqualFold(f.Name, "ComicInfo.xml") {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			}
+		}
+	case ".cbr", ".rar":
+		r, err := rardecode.OpenReader(input)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for {
+			f, err := r.Next()
+			if err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(f.Name, "ComicInfo.xml") {
+				return io.ReadAll(r)
+			}
+		}
+	}
+	return nil, os.ErrNotExist
+}
@@ -0,0 +1,224 @@
+// Package epubmetrics expose the metrics of the conversions of the serve and daemon modes, in the text format of Prometheus.
+//
+// the metrics are prefixed by go_comic_converter_:
+//
+//	jobs_total{result}              counter   the jobs by result: converted, skipped (up to date), failed
+//	errors_total{reason}            counter   the errors: conversion, invalid (job or upload refused)
+//	jobs_running                    gauge     the conversions in progress
+//	queue_depth                     gauge     the jobs waiting
+//	conversion_duration_seconds     histogram the duration of the conversions
+//	pages_total                     counter   the pages written
+//	pages_per_second                gauge     the speed of the last conversion
+//	input_bytes_total               counter   the size of the archives converted
+//	output_bytes_total              counter   the size of the EPUB written
+//
+// the speed over a period is rate(pages_total) / rate(conversion_duration_seconds_sum).
+package epubmetrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+const prefix = "go_comic_converter_"
+
+// Results of the jobs.
+const (
+	Converted = "converted"
+	Skipped   = "skipped"
+	Failed    = "failed"
+)
+
+// Reasons of the errors.
+const (
+	Conversion = "conversion"
+	Invalid    = "invalid"
+)
+
+// durationBuckets the upper bounds of the histogram, in seconds.
+var durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// Metrics of the conversions, safe for the concurrent conversions. A nil Metrics does nothing.
+type Metrics struct {
+	mu             sync.Mutex
+	jobs           map[string]uint64
+	errors         map[string]uint64
+	running        int
+	queue          func() int
+	buckets        []uint64 // by bound of durationBuckets, not cumulative
+	durationSum    float64
+	durationCount  uint64
+	pages          uint64
+	pagesPerSecond float64
+	inputBytes     uint64
+	outputBytes    uint64
+}
+
+// New metrics, the queue return the number of jobs waiting.
+func New(queue func() int) *Metrics {
+	return &Metrics{
+		jobs:    map[string]uint64{Converted: 0, Skipped: 0, Failed: 0},
+		errors:  map[string]uint64{Conversion: 0, Invalid: 0},
+		queue:   queue,
+		buckets: make([]uint64, len(durationBuckets)),
+	}
+}
+
+// Start a conversion, the returned function end it with its error.
+//
+// an interrupted conversion is not counted, it is converted again on the next start.
+func (m *Metrics) Start() func(err error) {
+	if m == nil {
+		return func(error) {}
+	}
+	m.mu.Lock()
+	m.running++
+	m.mu.Unlock()
+	return func(err error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.running--
+		switch {
+		case errors.Is(err, utils.ErrInterrupted):
+		case err != nil:
+			m.jobs[Failed]++
+			m.errors[Conversion]++
+		default:
+			m.jobs[Converted]++
+		}
+	}
+}
+
+// Skip a job up to date.
+func (m *Metrics) Skip() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[Skipped]++
+}
+
+// Invalid a job refused before its conversion.
+func (m *Metrics) Invalid() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[Failed]++
+	m.errors[Invalid]++
+}
+
+// Stats of a conversion, to set as EPUBOptions.OnStats.
+func (m *Metrics) Stats(s epuboptions.Stats) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seconds := float64(s.DurationMs) / 1000
+	if i, _ := slices.BinarySearch(durationBuckets, seconds); i < len(durationBuckets) {
+		m.buckets[i]++
+	}
+	m.durationSum += seconds
+	m.durationCount++
+	m.pages += uint64(s.Pages)
+	if seconds > 0 {
+		m.pagesPerSecond = float64(s.Pages) / seconds
+	}
+	m.inputBytes += uint64(s.InputSize)
+	m.outputBytes += uint64(s.OutputSize)
+}
+
+// OnStats chain the stats of the metrics with the previous function, if any.
+func (m *Metrics) OnStats(previous epuboptions.StatsFunc) epuboptions.StatsFunc {
+	if m == nil {
+		return previous
+	}
+	return func(s epuboptions.Stats) {
+		if previous != nil {
+			previous(s)
+		}
+		m.Stats(s)
+	}
+}
+
+// ServeHTTP write the metrics in the text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *Metrics) write(w io.Writer) {
+	queue := 0
+	if m.queue != nil {
+		queue = m.queue()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric := func(name, kind, help string) {
+		_, _ = fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", prefix, name, help, prefix, name, kind)
+	}
+	value := func(name string, labels string, v float64) {
+		_, _ = fmt.Fprintf(w, "%s%s%s %s\n", prefix, name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+
+	metric("jobs_total", "counter", "Jobs by result.")
+	for _, r := range []string{Converted, Skipped, Failed} {
+		value("jobs_total", `{result="`+r+`"}`, float64(m.jobs[r]))
+	}
+	metric("errors_total", "counter", "Errors by reason.")
+	for _, r := range []string{Conversion, Invalid} {
+		value("errors_total", `{reason="`+r+`"}`, float64(m.errors[r]))
+	}
+	metric("jobs_running", "gauge", "Conversions in progress.")
+	value("jobs_running", "", float64(m.running))
+	metric("queue_depth", "gauge", "Jobs waiting.")
+	value("queue_depth", "", float64(queue))
+
+	metric("conversion_duration_seconds", "histogram", "Duration of the conversions.")
+	var cumulative uint64
+	for i, b := range durationBuckets {
+		cumulative += m.buckets[i]
+		value("conversion_duration_seconds_bucket", `{le="`+strconv.FormatFloat(b, 'g', -1, 64)+`"}`, float64(cumulative))
+	}
+	value("conversion_duration_seconds_bucket", `{le="+Inf"}`, float64(m.durationCount))
+	value("conversion_duration_seconds_sum", "", m.durationSum)
+	value("conversion_duration_seconds_count", "", float64(m.durationCount))
+
+	metric("pages_total", "counter", "Pages written.")
+	value("pages_total", "", float64(m.pages))
+	metric("pages_per_second", "gauge", "Speed of the last conversion.")
+	value("pages_per_second", "", m.pagesPerSecond)
+	metric("input_bytes_total", "counter", "Size of the archives converted.")
+	value("input_bytes_total", "", float64(m.inputBytes))
+	metric("output_bytes_total", "counter", "Size of the EPUB written.")
+	value("output_bytes_total", "", float64(m.outputBytes))
+}
+
+// Serve the metrics on http://addr/metrics in the background, until the server is shut down.
+func (m *Metrics) Serve(addr string) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, utils.WithExitCode(err, utils.ExitUsage)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	return srv, nil
+}
@@ -0,0 +1,165 @@
+package epubmode
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubbatch"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubmetrics"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubschedule"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// daemonSchedule a schedule of the daemon mode, with its next run.
+type daemonSchedule struct {
+	converter.Schedule
+	cron epubschedule.Cron
+	next time.Time
+}
+
+// runSchedules run the schedules due, one after the other, between the jobs of the spool.
+//
+// a run never overlap another run or the jobs: the runs missed while busy are not caught up, the next run is planned after its end.
+func runSchedules(cmd *converter.Converter, schedules []*daemonSchedule, metrics *epubmetrics.Metrics) {
+	verbose := !cmd.Options.Quiet && !cmd.Options.Json
+	for _, s := range schedules {
+		if utils.Interrupted() || time.Now().Before(s.next) {
+			continue
+		}
+		if verbose {
+			utils.Printf("Schedule %s: convert %s\n", s.Name, s.Input)
+		}
+		if err := runSchedule(cmd, s.Schedule, metrics); err != nil {
+			reportError(cmd, s.Input, "schedule "+s.Name, err)
+		}
+		s.next = s.cron.Next(time.Now())
+		if verbose {
+			utils.Printf("Schedule %s: next run at %s\n", s.Name, s.next.Format(time.DateTime))
+		}
+	}
+}
+
+// runSchedule convert the new or changed archives of the input of the schedule, like the batch mode, with its options.
+func runSchedule(cmd *converter.Converter, s converter.Schedule, metrics *epubmetrics.Metrics) error {
+	sc, err := cmd.ScheduleConverter(s)
+	if err != nil {
+		return err
+	}
+	sc.Options.OnStats = cmd.Options.OnStats
+	inputs, err := epubbatch.Inputs(sc.Options.Input, sc.Options.SortPathMode)
+	if err != nil {
+		return err
+	}
+	_, err = Convert(sc, epubbatch.Jobs(inputs), metrics)
+	return err
+}
+
+// daemonRetryDelay before the first retry of a failed job, doubled on each attempt.
+const daemonRetryDelay = time.Minute
+
+// Daemon convert the jobs of the spool as they come, until Ctrl-C.
+//
+// the jobs interrupted are pending again, and converted on the next start.
+// the error is returned if the spool or the metrics fail, a job that fail is retried or marked failed.
+func Daemon(cmd *converter.Converter) error {
+	spool, err := epubbatch.OpenSpool(cmd.Options.Daemon)
+	if err != nil {
+		return utils.WithExitCode(err, utils.ExitInput)
+	}
+	var metrics *epubmetrics.Metrics
+	if cmd.Options.Metrics != "" {
+		metrics = epubmetrics.New(func() int {
+			n, _ := spool.Pending()
+			return n
+		})
+		cmd.Options.OnStats = metrics.OnStats(cmd.Options.OnStats)
+		srv, err := metrics.Serve(cmd.Options.Metrics)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+	}
+	verbose := !cmd.Options.Quiet && !cmd.Options.Json
+	schedules := make([]*daemonSchedule, 0, len(cmd.Schedules()))
+	for _, s := range cmd.Schedules() {
+		// validated with the options
+		cron, _ := epubschedule.Parse(s.Cron)
+		schedules = append(schedules, &daemonSchedule{s, cron, cron.Next(time.Now())})
+	}
+	if verbose {
+		utils.Printf("Waiting for the jobs in %s, Ctrl-C to stop\n", filepath.Join(cmd.Options.Daemon, epubbatch.SpoolPending))
+		if cmd.Options.Metrics != "" {
+			utils.Printf("Metrics on http://%s/metrics\n", cmd.Options.Metrics)
+		}
+		for _, s := range schedules {
+			utils.Printf("Schedule %s (%s): next run at %s\n", s.Name, s.Cron, s.next.Format(time.DateTime))
+		}
+	}
+	for !utils.Interrupted() {
+		runSchedules(cmd, schedules, metrics)
+		n, err := daemonRound(cmd, spool, metrics)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			time.Sleep(time.Second)
+		}
+	}
+	return nil
+}
+
+// daemonRound convert the next jobs of the spool, and move them to their new state.
+//
+// when the state of the output directory can't be read, the jobs fail with its error, and are retried like any failure.
+//
+// return the number of jobs taken from the spool.
+func daemonRound(cmd *converter.Converter, spool epubbatch.Spool, metrics *epubmetrics.Metrics) (int, error) {
+	jobs, err := spool.Next(max(1, cmd.Options.BatchWorkers))
+	if err != nil || len(jobs) == 0 {
+		return 0, err
+	}
+
+	inputs := make([]epubbatch.Job, 0, len(jobs))
+	invalid := map[string]error{}
+	for _, j := range jobs {
+		if j.Profile != "" && cmd.Options.LookupProfile(j.Profile) == nil {
+			invalid[j.Input] = fmt.Errorf("daemon: profile %q of %s doesn't exists", j.Profile, j.Input)
+			metrics.Invalid()
+			continue
+		}
+		inputs = append(inputs, j.Job)
+	}
+	errs := map[string]error{}
+	if len(inputs) > 0 {
+		if errs, err = Convert(cmd, inputs, metrics); err != nil {
+			reportError(cmd, cmd.Options.Output, cmd.Options.Output, err)
+			errs = make(map[string]error, len(inputs))
+			for _, in := range inputs {
+				errs[in.Input] = err
+			}
+		}
+	}
+	maps.Copy(errs, invalid)
+
+	for _, j := range jobs {
+		switch cause, failed := errs[j.Input]; {
+		case invalid[j.Input] != nil:
+			// no retry would fix it
+			err = spool.Retry(j, cause, 0, 0)
+		case utils.Interrupted() && !failed:
+			// done or not started, skipped as up to date on the next start if done
+			err = spool.Requeue(j)
+		case failed:
+			err = spool.Retry(j, cause, cmd.Options.DaemonRetries, daemonRetryDelay)
+		default:
+			err = spool.Done(j)
+		}
+		if err != nil {
+			return len(jobs), err
+		}
+	}
+	return len(jobs), nil
+}
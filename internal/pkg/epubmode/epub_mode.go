@@ -0,0 +1,280 @@
+/*
+Package epubmode run the modes of the command line converting many archives: batch, library, watch, queue and daemon,
+with the schedules of the daemon.
+
+The archives are converted like the batch mode, skipping the ones already up to date with the state file of the output directory.
+The errors are returned, a mode running until Ctrl-C (watch, daemon) report the errors of a round and keep running.
+*/
+package epubmode
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubbatch"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubevent"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubmetadata"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubmetrics"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubprogress"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/i18n"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epub"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// Batch convert each archive of the input directory or the manifest, skipping the ones already up to date.
+//
+// return the number of archives that failed.
+func Batch(cmd *converter.Converter) (int, error) {
+	var jobs []epubbatch.Job
+	if epubbatch.IsManifest(cmd.Options.Input) {
+		var err error
+		if jobs, err = epubbatch.LoadManifest(cmd.Options.Input); err != nil {
+			return 0, utils.WithExitCode(err, utils.ExitInput)
+		}
+	} else {
+		inputs, err := epubbatch.Inputs(cmd.Options.Input, cmd.Options.SortPathMode)
+		if err != nil {
+			return 0, err
+		}
+		jobs = epubbatch.Jobs(inputs)
+	}
+	errs, err := Convert(cmd, jobs, nil)
+	return len(errs), err
+}
+
+// Convert the archives, skipping the ones already up to date.
+//
+// with many batch workers, the archives are converted in parallel and share the workers, with a single progress bar.
+// an archive that fail does not stop the batch: the errors are reported at the end, and returned by input.
+// a failed archive is not marked as converted, it is retried on the next run.
+// the settings of the manifest replace the defaults of each archive.
+// the jobs are counted in the metrics, if any.
+//
+// the error is returned if the state of the output directory can't be read, nothing is converted.
+func Convert(cmd *converter.Converter, inputs []epubbatch.Job, metrics *epubmetrics.Metrics) (map[string]error, error) {
+	state, err := epubbatch.LoadState(filepath.Join(cmd.Options.Output, epubbatch.StateFileName))
+	if err != nil {
+		return nil, err
+	}
+	parallel := cmd.Options.BatchWorkers > 1
+	verbose := !cmd.Options.Quiet && !cmd.Options.Json
+
+	type job struct {
+		options epuboptions.EPUBOptions
+		entry   epubbatch.Entry
+	}
+	type failure struct {
+		input string
+		err   error
+	}
+	mu := sync.Mutex{}
+	failures := make([]failure, 0)
+	fail := func(input string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, failure{input, err})
+	}
+
+	// the outputs of the previous runs, to number the new ones with the same name
+	used := map[string]string{}
+	for input, entry := range state.Entries {
+		used[strings.ToLower(entry.Output)] = input
+	}
+
+	skipped := 0
+	jobs := make([]job, 0, len(inputs))
+	for _, in := range inputs {
+		input := in.Input
+		o := cmd.Options.EPUBOptions
+		o.Input = input
+		o.Title = cmp.Or(in.Title, strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)))
+		o.Series = cmp.Or(in.Series, o.Series)
+		o.Author = cmp.Or(in.Author, o.Author)
+		outputDir := cmd.Options.Output
+		if cmd.Options.BatchMirror {
+			outputDir = epubbatch.Mirror(cmd.Options.Input, input, outputDir)
+		}
+		o.Output = filepath.Join(outputDir, o.Title+".epub")
+		if in.Output != "" {
+			o.Output = in.Output
+			if !filepath.IsAbs(o.Output) {
+				o.Output = filepath.Join(cmd.Options.Output, o.Output)
+			}
+		}
+		if cmd.Options.BatchName != "" || cmd.Options.BatchComicInfo {
+			// the metadata is optional
+			m, _ := epubmetadata.Lookup(input)
+			m.Title = cmp.Or(in.Title, m.Title)
+			if in.Output == "" && cmd.Options.BatchName != "" {
+				o.Output = filepath.Join(outputDir, epubbatch.Name(cmd.Options.BatchName, input, m)+".epub")
+			}
+			// the archive is in sync with the EPUB, before its state is checked,
+			// with the explicit fields only (sidecar, manifest, flags), never the guesses from the name
+			if cmd.Options.BatchComicInfo && !cmd.Options.Dry {
+				x, _ := epubmetadata.LookupExplicit(input)
+				x.Title = cmp.Or(in.Title, x.Title)
+				x.Series = cmp.Or(o.Series, x.Series)
+				x.Author = cmp.Or(in.Author, x.Author)
+				if changed, err := epubmetadata.WriteComicInfo(input, x); err != nil {
+					fail(input, fmt.Errorf("ComicInfo.xml: %w", err))
+					continue
+				} else if changed && verbose {
+					utils.Printf("Update the ComicInfo.xml of %s\n", input)
+				}
+			}
+		}
+		o.Output = epubbatch.Unique(o.Output, input, used)
+		if profile := cmd.Options.LookupProfile(in.Profile); profile != nil {
+			o.Image.View.Width = profile.Width
+			o.Image.View.Height = profile.Height
+		}
+		if parallel {
+			o.Quiet, o.Progress = true, nil
+			o.Workers = max(1, o.Workers/cmd.Options.BatchWorkers)
+			// the available memory is shared too
+			if o.MaxMemory == 0 {
+				o.MaxMemory = max(256, utils.AvailableMemoryMb()*3/4/cmd.Options.BatchWorkers)
+			}
+		}
+
+		output := o.Output
+		if o.Mihon {
+			output = o.MihonChapter()
+		}
+		// a manifest or -batch-name may still name the CBZ after its archive, before converting it
+		if o.HasCBZ() {
+			cbz, _ := filepath.Abs(o.CBZOutput())
+			if abs, _ := filepath.Abs(input); cbz == abs {
+				fail(input, fmt.Errorf("the CBZ %s would replace the input, choose another output", o.CBZOutput()))
+				continue
+			}
+		}
+		entry, upToDate, err := state.Check(input, output, epubbatch.Fingerprint(o))
+		if err != nil {
+			fail(input, err)
+			continue
+		}
+		if upToDate {
+			if verbose {
+				utils.Printf(i18n.T("Skip %s: up to date\n"), input)
+			}
+			skipped++
+			metrics.Skip()
+			continue
+		}
+		jobs = append(jobs, job{o, entry})
+	}
+
+	bar := epubprogress.New(epubprogress.Options{
+		Quiet:       !parallel || cmd.Options.Quiet,
+		Json:        cmd.Options.Json,
+		Max:         len(jobs),
+		Description: "Converting",
+		Unit:        "archives",
+		CurrentJob:  1,
+		TotalJob:    1,
+	})
+	queue := make(chan job)
+	go func() {
+		defer close(queue)
+		for _, j := range jobs {
+			queue <- j
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	converted := atomic.Int32{}
+	for range max(1, cmd.Options.BatchWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				// drain the remaining archives
+				if utils.Interrupted() {
+					continue
+				}
+				if verbose && !parallel {
+					utils.Printf("Convert %s\n", j.options.Input)
+				}
+				// the output of the manifest or the mirror may be in a subdirectory
+				done := metrics.Start()
+				err := os.MkdirAll(filepath.Dir(j.options.Output), 0755)
+				if err == nil {
+					err = epub.New(j.options).Write()
+				}
+				done(err)
+				if errors.Is(err, utils.ErrInterrupted) {
+					continue
+				}
+				_ = bar.Add(1)
+				if err != nil {
+					if verbose && !parallel {
+						utils.Printf("Error with %s: %v\n", j.options.Input, err)
+					}
+					fail(j.options.Input, err)
+					continue
+				}
+				converted.Add(1)
+				if j.options.Dry {
+					continue
+				}
+
+				mu.Lock()
+				state.Update(j.options.Input, j.entry)
+				err = state.Save()
+				mu.Unlock()
+				if err != nil {
+					fail(j.options.Input, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	_ = bar.Close()
+
+	if utils.Interrupted() {
+		utils.Printf("Batch interrupted: %d of %d archives converted\n", converted.Load(), len(jobs))
+	}
+
+	if cmd.Options.Json {
+		errs := make(map[string]string, len(failures))
+		for _, f := range failures {
+			errs[f.input] = f.err.Error()
+		}
+		epubevent.Emit(epubevent.Batch, map[string]any{
+			"converted": converted.Load(),
+			"skipped":   skipped,
+			"failed":    len(failures),
+			"errors":    errs,
+		})
+	} else if len(failures) > 0 || !cmd.Options.Quiet {
+		utils.Printf(i18n.T("Batch: %d converted, %d skipped, %d failed\n"), converted.Load(), skipped, len(failures))
+		for _, f := range failures {
+			utils.Printf("  %s: %v\n", f.input, f.err)
+		}
+	}
+	errs := make(map[string]error, len(failures))
+	for _, f := range failures {
+		errs[f.input] = f.err
+	}
+	return errs, nil
+}
+
+// reportError of an input in the modes running until the end or Ctrl-C, the mode continue.
+//
+// the label name the input in the message: the input itself, the line of the queue or the schedule.
+func reportError(cmd *converter.Converter, input string, label string, err error) {
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Error, map[string]any{"input": input, "error": err.Error(), "interrupted": false})
+	} else {
+		utils.Printf("Error with %s: %v\n", label, err)
+	}
+}
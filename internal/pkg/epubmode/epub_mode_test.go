@@ -0,0 +1,136 @@
+package epubmode
+
+import (
+	"archive/zip"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubbatch"
+)
+
+// newBatch a converter of the batch mode, the input directory with an archive of a few pages.
+func newBatch(t *testing.T) *converter.Converter {
+	t.Helper()
+	input, output := t.TempDir(), t.TempDir()
+	f, err := os.Create(filepath.Join(input, "book.cbz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zip.NewWriter(f)
+	img := image.NewGray(image.Rect(0, 0, 300, 400))
+	for y := range 400 {
+		for x := range 300 {
+			img.SetGray(x, y, color.Gray{Y: uint8(x ^ y)})
+		}
+	}
+	for _, name := range []string{"001.png", "002.png", "003.png"} {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = png.Encode(w, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := converter.New()
+	cmd.Options.Input, cmd.Options.Output = input, output
+	cmd.Options.Batch, cmd.Options.BatchWorkers = true, 1
+	cmd.Options.Quiet, cmd.Options.Workers = true, 1
+	profile := cmd.Options.GetProfile()
+	cmd.Options.Image.View.Width, cmd.Options.Image.View.Height = profile.Width, profile.Height
+	return cmd
+}
+
+// corruptState replace the state file of the output directory.
+func corruptState(t *testing.T, cmd *converter.Converter) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(cmd.Options.Output, epubbatch.StateFileName), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBatch the archives are converted once, then skipped while up to date.
+func TestBatch(t *testing.T) {
+	cmd := newBatch(t)
+	for run := range 2 {
+		failed, err := Batch(cmd)
+		if failed != 0 || err != nil {
+			t.Fatalf("run %d: %d failed, error %v", run, failed, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cmd.Options.Output, "book.epub")); err != nil {
+		t.Error(err)
+	}
+	state, err := epubbatch.LoadState(filepath.Join(cmd.Options.Output, epubbatch.StateFileName))
+	if err != nil || !state.Has(filepath.Join(cmd.Options.Input, "book.cbz")) {
+		t.Errorf("state %v, error %v", state.Entries, err)
+	}
+}
+
+// TestCorruptState the state that can't be read is returned by the modes, nothing is converted.
+func TestCorruptState(t *testing.T) {
+	t.Run("batch", func(t *testing.T) {
+		cmd := newBatch(t)
+		corruptState(t, cmd)
+		if _, err := Batch(cmd); err == nil {
+			t.Error("no error")
+		}
+		if _, err := os.Stat(filepath.Join(cmd.Options.Output, "book.epub")); !os.IsNotExist(err) {
+			t.Errorf("EPUB written: %v", err)
+		}
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		cmd := newBatch(t)
+		corruptState(t, cmd)
+		// the options of the schedule are parsed again from the command line, without the config of the user
+		t.Setenv("HOME", t.TempDir())
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+		args := os.Args
+		t.Cleanup(func() {
+			os.Args = args
+		})
+		os.Args = []string{"go-comic-converter", "-daemon", t.TempDir(), "-output", cmd.Options.Output, "-quiet"}
+		if err := runSchedule(cmd, converter.Schedule{Name: "nightly", Input: cmd.Options.Input}, nil); err == nil || !strings.Contains(err.Error(), epubbatch.StateFileName) {
+			t.Errorf("error %v", err)
+		}
+	})
+
+	t.Run("daemon", func(t *testing.T) {
+		cmd := newBatch(t)
+		corruptState(t, cmd)
+		cmd.Options.Daemon, cmd.Options.DaemonRetries = t.TempDir(), 1
+		spool, err := epubbatch.OpenSpool(cmd.Options.Daemon)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job := []byte(`{"input": "` + filepath.ToSlash(filepath.Join(cmd.Options.Input, "book.cbz")) + `"}`)
+		if err = os.WriteFile(filepath.Join(cmd.Options.Daemon, epubbatch.SpoolPending, "1.json"), job, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// the job is retried later, like a failed conversion
+		if n, err := daemonRound(cmd, spool, nil); n != 1 || err != nil {
+			t.Fatalf("%d jobs, error %v", n, err)
+		}
+		if n, err := daemonRound(cmd, spool, nil); n != 0 || err != nil {
+			t.Fatalf("%d jobs before the retry, error %v", n, err)
+		}
+		if n, err := spool.Pending(); n != 1 || err != nil {
+			t.Errorf("%d pending, error %v", n, err)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package epubmode
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubbatch"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubevent"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/i18n"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// Library keep the output directory in sync with the library of the input directory.
+//
+// the new or changed archives are converted like the batch mode, with the named profile of their series (the first directory
+// under the input), the EPUB of the archives deleted are removed, then the archives converted and not converted are counted
+// from the state file of the output directory.
+//
+// return the number of archives that failed.
+func Library(cmd *converter.Converter) (int, error) {
+	inputs, err := epubbatch.Inputs(cmd.Options.Input, cmd.Options.SortPathMode)
+	if err != nil {
+		return 0, err
+	}
+	verbose := !cmd.Options.Quiet && !cmd.Options.Json
+
+	// the series sharing a named profile are converted together
+	byProfile := map[string][]string{}
+	for _, input := range inputs {
+		series := ""
+		if rel, err := filepath.Rel(cmd.Options.Input, input); err == nil {
+			if dir, _, ok := strings.Cut(filepath.ToSlash(rel), "/"); ok {
+				series = dir
+			}
+		}
+		name := cmd.SeriesProfileName(series)
+		byProfile[name] = append(byProfile[name], input)
+	}
+	failed := 0
+	for _, name := range slices.Sorted(maps.Keys(byProfile)) {
+		c := cmd
+		if name != "" {
+			if c, err = cmd.ProfileNameConverter(name); err != nil {
+				return failed, utils.WithExitCode(err, utils.ExitUsage)
+			}
+			c.Options.OnStats = cmd.Options.OnStats
+			if verbose {
+				utils.Printf("Profile %s: %d archives\n", name, len(byProfile[name]))
+			}
+		}
+		errs, err := Convert(c, epubbatch.Jobs(byProfile[name]), nil)
+		if err != nil {
+			return failed, err
+		}
+		failed += len(errs)
+		if utils.Interrupted() {
+			return failed, nil
+		}
+	}
+
+	// without a terminal, the EPUB of the archives deleted are only listed, unless -yes
+	kept := !cmd.Options.Yes && !utils.Interactive()
+	removed, err := CleanOutputs(cmd, cmd.Options.Dry || kept)
+	if err != nil {
+		return failed, err
+	}
+	state, err := epubbatch.LoadState(filepath.Join(cmd.Options.Output, epubbatch.StateFileName))
+	if err != nil {
+		return failed, err
+	}
+	notConverted := make([]string, 0)
+	for _, input := range inputs {
+		if !state.Has(input) {
+			notConverted = append(notConverted, input)
+		}
+	}
+
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Library, map[string]any{
+			"archives":      len(inputs),
+			"converted":     len(inputs) - len(notConverted),
+			"not_converted": notConverted,
+			"removed":       removed,
+		})
+	} else if !cmd.Options.Quiet || len(notConverted) > 0 {
+		action := i18n.T("removed")
+		if cmd.Options.Dry {
+			action = i18n.T("to remove")
+		} else if kept {
+			action = i18n.T("kept, -yes to remove")
+		}
+		utils.Printf("Library: %d archives, %d converted, %d not converted, %d EPUB %s\n",
+			len(inputs), len(inputs)-len(notConverted), len(notConverted), len(removed), action)
+		for _, input := range notConverted {
+			utils.Printf("  not converted: %s\n", input)
+		}
+		for _, output := range removed {
+			utils.Printf("  %s: %s\n", action, output)
+		}
+	}
+	return failed, nil
+}
+
+// CleanOutputs remove the EPUB of the archives converted in batch mode that no longer exist, and their entry of the state.
+func CleanOutputs(cmd *converter.Converter, dry bool) ([]string, error) {
+	if fi, err := os.Stat(cmd.Options.Output); err != nil || !fi.IsDir() {
+		return nil, utils.WithExitCode(errors.New("clean outputs require the -output directory of the batch mode"), utils.ExitUsage)
+	}
+	// a missing source (unmounted drive, network share) is not a source emptied
+	if cmd.Options.Input != "" {
+		if _, err := os.Stat(cmd.Options.Input); err != nil {
+			return nil, utils.WithExitCode(fmt.Errorf("the input %s is missing, the EPUB of the archives deleted are kept: %w", cmd.Options.Input, err), utils.ExitInput)
+		}
+	}
+	state, err := epubbatch.LoadState(filepath.Join(cmd.Options.Output, epubbatch.StateFileName))
+	if err != nil {
+		return nil, err
+	}
+	orphans := state.Orphans()
+	outputs := make([]string, 0)
+	for _, input := range orphans {
+		outputs = append(outputs, epubbatch.Outputs(state.Entries[input].Output)...)
+	}
+	if dry || len(orphans) == 0 {
+		return outputs, nil
+	}
+	// nobody to confirm: a cron run must not remove the EPUB of a source gone by mistake
+	if len(outputs) > 0 && !cmd.Options.Yes && !utils.Interactive() {
+		return outputs, utils.WithExitCode(fmt.Errorf("%d EPUB of the archives deleted are kept, removing them without a terminal require -yes", len(outputs)), utils.ExitUsage)
+	}
+	if len(outputs) > 0 && !utils.Confirm(cmd.Options.Yes, "Remove %d EPUB of the archives deleted?", len(outputs)) {
+		return outputs, utils.ErrCancelled
+	}
+	for _, output := range outputs {
+		if err := os.Remove(output); err != nil {
+			return nil, err
+		}
+	}
+	for _, input := range orphans {
+		state.Remove(input)
+	}
+	return outputs, state.Save()
+}
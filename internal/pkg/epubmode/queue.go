@@ -0,0 +1,111 @@
+package epubmode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubbatch"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// Queue convert the jobs read from the queue file or the standard input as they come, until the end of the file or Ctrl-C.
+//
+// the jobs already read are converted together, in parallel with the batch workers, like the batch mode.
+// a bad line does not stop the queue, it is reported with the failures.
+//
+// return the number of jobs that failed.
+func Queue(cmd *converter.Converter) (int, error) {
+	var r io.Reader = os.Stdin
+	dir, _ := os.Getwd()
+	if cmd.Options.Queue != "-" {
+		f, err := os.Open(cmd.Options.Queue)
+		if err != nil {
+			return 0, utils.WithExitCode(err, utils.ExitInput)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		r, dir = f, filepath.Dir(cmd.Options.Queue)
+	}
+	return queue(cmd, r, dir)
+}
+
+// queue convert the jobs of the reader, the inputs are relative to dir.
+func queue(cmd *converter.Converter, r io.Reader, dir string) (int, error) {
+	// the error of the queue is known once the lines are closed
+	lines := make(chan string)
+	var readErr error
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 64*1024), 1024*1024)
+		for s.Scan() {
+			if line := strings.TrimSpace(s.Text()); line != "" {
+				lines <- line
+			}
+		}
+		readErr = s.Err()
+	}()
+
+	failed := 0
+	for !utils.Interrupted() {
+		var line string
+		var ok bool
+		select {
+		case line, ok = <-lines:
+		case <-time.After(time.Second):
+			continue
+		}
+		if !ok {
+			break
+		}
+
+		// the other jobs already read
+		chunk := []string{line}
+	read:
+		for len(chunk) < cmd.Options.BatchWorkers {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					break read
+				}
+				chunk = append(chunk, line)
+			default:
+				break read
+			}
+		}
+
+		jobs := make([]epubbatch.Job, 0, len(chunk))
+		for _, line := range chunk {
+			job, err := epubbatch.DecodeJob([]byte(line), dir)
+			if err == nil && job.Profile != "" && cmd.Options.LookupProfile(job.Profile) == nil {
+				err = fmt.Errorf("queue: profile %q of %s doesn't exists", job.Profile, job.Input)
+			}
+			if err != nil {
+				failed++
+				reportError(cmd, job.Input, line, err)
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+		if len(jobs) > 0 {
+			errs, err := Convert(cmd, jobs, nil)
+			if err != nil {
+				// the state is the same for the next jobs
+				return failed + len(jobs), err
+			}
+			failed += len(errs)
+		}
+	}
+	// a line too long or a read error stop the queue, after the jobs already read
+	if !utils.Interrupted() && readErr != nil {
+		return failed, utils.WithExitCode(fmt.Errorf("queue %s: %w", cmd.Options.Queue, readErr), utils.ExitInput)
+	}
+	return failed, nil
+}
@@ -0,0 +1,55 @@
+package epubmode
+
+import (
+	"os"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubbatch"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// Watch the input directory, and convert the new or changed archives once they stop changing, until Ctrl-C.
+//
+// an archive is ready when its size and modification time did not change during the debounce delay (still downloading).
+// the state file of the batch mode mark the archives processed, they are not converted again after a restart.
+// an archive not converted because the state can't be read is tried again once it changes.
+func Watch(cmd *converter.Converter) {
+	type watched struct {
+		size    int64
+		modTime time.Time
+		since   time.Time
+		done    bool
+	}
+	debounce := time.Duration(cmd.Options.WatchDebounce) * time.Second
+	files := map[string]*watched{}
+	if !cmd.Options.Quiet && !cmd.Options.Json {
+		utils.Printf("Watching %s, Ctrl-C to stop\n", cmd.Options.Input)
+	}
+	for !utils.Interrupted() {
+		inputs, _ := epubbatch.Inputs(cmd.Options.Input, cmd.Options.SortPathMode)
+		ready := make([]string, 0)
+		now := time.Now()
+		for _, input := range inputs {
+			fi, err := os.Stat(input)
+			if err != nil {
+				continue
+			}
+			w, ok := files[input]
+			if !ok || w.size != fi.Size() || !w.modTime.Equal(fi.ModTime()) {
+				files[input] = &watched{size: fi.Size(), modTime: fi.ModTime(), since: now}
+				continue
+			}
+			if !w.done && now.Sub(w.since) >= debounce {
+				w.done = true
+				ready = append(ready, input)
+			}
+		}
+		if len(ready) > 0 {
+			if _, err := Convert(cmd, epubbatch.Jobs(ready), nil); err != nil {
+				reportError(cmd, cmd.Options.Input, cmd.Options.Input, err)
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Package epuboverrides Settings to apply on specific pages, loaded from a yaml file.
+
+Pages are matched by their path inside the source, and support glob pattern:
+
+	pages:
+	  "chapter 1/003.jpg":
+	    redact:
+	      - {x: 0, y: 1800, width: 1200, height: 120, mode: blank}
+	  "bonus/ads-*.jpg":
+	    redact:
+	      - {x: 100, y: 100, width: 400, height: 300, mode: blur}
+	  "chapter 2/fold-out.jpg":
+	    split_parts: 4
+
+Coordinates are in pixels of the source image.
+*/
+package epuboverrides
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Region struct {
+	X      int    `yaml:"x" json:"x"`
+	Y      int    `yaml:"y" json:"y"`
+	Width  int    `yaml:"width" json:"width"`
+	Height int    `yaml:"height" json:"height"`
+	Mode   string `yaml:"mode" json:"mode"` // blank or blur
+}
+
+// Rect region as a rectangle
+func (r Region) Rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+type Page struct {
+	Redact     []Region `yaml:"redact" json:"redact"`
+	SplitParts int      `yaml:"split_parts" json:"split_parts"`
+}
+
+type Overrides struct {
+	Pages map[string]Page `yaml:"pages" json:"pages"`
+
+	// patterns sorted, to always match in the same order
+	patterns []string
+}
+
+// Load the overrides file, an empty filename return no overrides.
+func Load(filename string) (o Overrides, err error) {
+	if filename == "" {
+		return
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	if err = yaml.NewDecoder(f).Decode(&o); err != nil {
+		return o, fmt.Errorf("overrides %s: %w", filename, err)
+	}
+
+	for pattern, page := range o.Pages {
+		if _, err = filepath.Match(pattern, ""); err != nil {
+			return o, fmt.Errorf("overrides %s: bad pattern %q: %w", filename, pattern, err)
+		}
+		for _, r := range page.Redact {
+			if r.Mode != "blank" && r.Mode != "blur" {
+				return o, fmt.Errorf("overrides %s: redact mode of %q should be blank or blur", filename, pattern)
+			}
+			if r.Width <= 0 || r.Height <= 0 {
+				return o, fmt.Errorf("overrides %s: redact size of %q should be > 0", filename, pattern)
+			}
+		}
+		if page.SplitParts < 0 || page.SplitParts == 1 {
+			return o, fmt.Errorf("overrides %s: split parts of %q should be 0 or >= 2", filename, pattern)
+		}
+		o.patterns = append(o.patterns, pattern)
+	}
+	sort.Strings(o.patterns)
+	return
+}
+
+// Get the overrides of a page, return nil if none.
+//
+// An exact match is preferred to a pattern.
+func (o Overrides) Get(path string) *Page {
+	path = filepath.Clean(path)
+	if p, ok := o.Pages[path]; ok {
+		return &p
+	}
+	for _, pattern := range o.patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			p := o.Pages[pattern]
+			return &p
+		}
+	}
+	return nil
+}
@@ -1,66 +1,124 @@
 // Package epubprogress create a progress bar with custom settings.
+//
+// the progress is shown with a backend: terminal bar, json lines, silent, or a custom one set in the options.
 package epubprogress
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
 
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/i18n"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
 
 type Options struct {
 	Quiet       bool
 	Json        bool
+	Backend     epuboptions.ProgressBackend // replace the default backends if set
 	Max         int
 	Description string
+	Unit        string // unit of the throughput, default "it"
 	CurrentJob  int
 	TotalJob    int
 }
 
-type EPUBProgress interface {
-	Add(num int) error
-	Close() error
-}
+type EPUBProgress = epuboptions.Progress
 
 func New(o Options) EPUBProgress {
-	if o.Quiet {
-		return progressbar.DefaultSilent(int64(o.Max))
+	if o.Unit == "" {
+		o.Unit = "it"
+	}
+	step := epuboptions.ProgressStep{
+		Max:         o.Max,
+		Description: o.Description,
+		Unit:        o.Unit,
+		CurrentJob:  o.CurrentJob,
+		TotalJob:    o.TotalJob,
+	}
+
+	switch {
+	case o.Backend != nil:
+		return o.Backend(step)
+	case o.Quiet:
+		return Silent(step)
+	case o.Json:
+		return Json(step)
+	default:
+		return Terminal(step)
 	}
+}
+
+// Silent backend, show nothing.
+func Silent(step epuboptions.ProgressStep) epuboptions.Progress {
+	return progressbar.DefaultSilent(int64(step.Max))
+}
 
-	if o.Json {
-		return &jsonprogress{
-			o: o,
-			e: json.NewEncoder(os.Stdout),
-		}
+// Json backend, a json line on stdout for each progress.
+func Json(step epuboptions.ProgressStep) epuboptions.Progress {
+	return &jsonprogress{
+		o:       step,
+		startAt: time.Now(),
 	}
+}
 
-	fmtJob := utils.FormatNumberOfDigits(o.TotalJob)
-	return progressbar.NewOptions(o.Max,
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionThrottle(65*time.Millisecond),
-		progressbar.OptionOnCompletion(func() {
-			utils.Println()
-		}),
-		progressbar.OptionSetDescription(fmt.Sprintf(
-			"["+fmtJob+"/"+fmtJob+"] %-15s",
-			o.CurrentJob,
-			o.TotalJob,
-			o.Description,
-		)),
-		progressbar.OptionSetWidth(60),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
+// Terminal backend, a progress bar on stderr.
+func Terminal(step epuboptions.ProgressStep) epuboptions.Progress {
+	fmtJob := utils.FormatNumberOfDigits(step.TotalJob)
+	description := fmt.Sprintf(
+		"["+fmtJob+"/"+fmtJob+"] %-15s",
+		step.CurrentJob,
+		step.TotalJob,
+		i18n.T(step.Description),
 	)
+	return &termprogress{
+		description: description,
+		ProgressBar: progressbar.NewOptions(step.Max,
+			progressbar.OptionSetWriter(os.Stderr),
+			progressbar.OptionThrottle(65*time.Millisecond),
+			progressbar.OptionOnCompletion(func() {
+				utils.Println()
+			}),
+			progressbar.OptionSetDescription(description),
+			progressbar.OptionSetWidth(60),
+			progressbar.OptionShowCount(),
+			progressbar.OptionShowIts(),
+			progressbar.OptionSetItsString(step.Unit),
+			progressbar.OptionSetRenderBlankState(true),
+			progressbar.OptionEnableColorCodes(true),
+			progressbar.OptionSetTheme(progressbar.Theme{
+				Saucer:        "[green]=[reset]",
+				SaucerHead:    "[green]>[reset]",
+				SaucerPadding: " ",
+				BarStart:      "[",
+				BarEnd:        "]",
+			}),
+		),
+	}
+}
+
+// termprogress show the memory usage in the description of the bar, with the throughput and the remaining time.
+type termprogress struct {
+	*progressbar.ProgressBar
+	description string
+	memoryAt    time.Time
+}
+
+func (p *termprogress) Add(num int) error {
+	// reading the memory stats stop the world, only refresh it from time to time
+	if time.Since(p.memoryAt) > 500*time.Millisecond {
+		p.memoryAt = time.Now()
+		p.Describe(fmt.Sprintf("%s %5d Mb", p.description, memoryUsageMb()))
+	}
+	return p.ProgressBar.Add(num)
+}
+
+func memoryUsageMb() uint64 {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return mem.Sys / 1024 / 1024
 }
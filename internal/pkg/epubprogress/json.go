@@ -1,31 +1,48 @@
 package epubprogress
 
 import (
-	"encoding/json"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubevent"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
 
 type jsonprogress struct {
-	o       Options
-	e       *json.Encoder
+	o       epuboptions.ProgressStep
 	current int
+	startAt time.Time
 }
 
 func (p *jsonprogress) Add(num int) error {
 	p.current += num
-	return p.e.Encode(map[string]any{
-		"type": "epubprogress",
-		"data": map[string]any{
-			"epubprogress": map[string]any{
-				"current": p.current,
-				"total":   p.o.Max,
-			},
-			"steps": map[string]any{
-				"current": p.o.CurrentJob,
-				"total":   p.o.TotalJob,
-			},
-			"description": p.o.Description,
+
+	elapsed := time.Since(p.startAt)
+	var rate float64
+	var eta time.Duration
+	if p.current > 0 && elapsed > 0 {
+		rate = float64(p.current) / elapsed.Seconds()
+		eta = time.Duration(float64(elapsed) / float64(p.current) * float64(p.o.Max-p.current))
+	}
+
+	epubevent.Emit(epubevent.Progress, map[string]any{
+		"epubprogress": map[string]any{
+			"current": p.current,
+			"total":   p.o.Max,
 		},
+		"steps": map[string]any{
+			"current": p.o.CurrentJob,
+			"total":   p.o.TotalJob,
+		},
+		"description": p.o.Description,
+		"throughput": map[string]any{
+			"rate": rate,
+			"unit": p.o.Unit + "/s",
+		},
+		"elapsed_ms":      elapsed.Milliseconds(),
+		"eta_ms":          eta.Milliseconds(),
+		"memory_usage_mb": memoryUsageMb(),
 	})
+	return nil
 }
 
 func (p *jsonprogress) Close() error {
@@ -0,0 +1,170 @@
+// Package epubschedule parse the cron expressions of the schedules of the daemon mode.
+//
+// the expressions have 5 fields: minute (0-59), hour (0-23), day of month (1-31), month (1-12), day of week (0-6, 0 or 7 = sunday),
+// with the lists "1,15", the ranges "1-5", the steps "*/15" or "0-30/10", and the shortcuts @yearly, @monthly, @weekly, @daily and @hourly.
+// Like cron, when the day of month and the day of week are both restricted, a day matching either of them is run.
+// On the changes of the summer time, the times of a restricted hour skipped are run at the change, and the times repeated are run once.
+package epubschedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var shortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron a parsed expression, each field is a set of bits.
+type Cron struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar, hourStar    bool
+}
+
+// Parse the expression.
+func Parse(expr string) (Cron, error) {
+	c := Cron{expr: expr}
+	fields := strings.Fields(expr)
+	if len(fields) == 1 {
+		if s, ok := shortcuts[strings.ToLower(fields[0])]; ok {
+			fields = strings.Fields(s)
+		}
+	}
+	if len(fields) != 5 {
+		return c, fmt.Errorf("cron %q should have 5 fields: minute hour day month weekday", expr)
+	}
+	var err error
+	for _, f := range []struct {
+		bits     *uint64
+		min, max int
+		name     string
+	}{
+		{&c.minute, 0, 59, "minute"},
+		{&c.hour, 0, 23, "hour"},
+		{&c.dom, 1, 31, "day"},
+		{&c.month, 1, 12, "month"},
+		{&c.dow, 0, 7, "weekday"},
+	} {
+		if *f.bits, err = parseField(fields[0], f.min, f.max); err != nil {
+			return c, fmt.Errorf("cron %q: %s: %w", expr, f.name, err)
+		}
+		fields = fields[1:]
+	}
+	// 7 is sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = c.dom == bitRange(1, 31, 1)
+	c.hourStar = c.hour == bitRange(0, 23, 1)
+	c.dowStar = c.dow&0x7f == 0x7f
+	return c, nil
+}
+
+// parseField a comma separated list of *, n, n-m, with an optional /step.
+func parseField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		r, step, hasStep := strings.Cut(part, "/")
+		s := 1
+		if hasStep {
+			var err error
+			if s, err = strconv.Atoi(step); err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step %q", step)
+			}
+		}
+		start, end := lo, hi
+		if r != "*" {
+			a, b, isRange := strings.Cut(r, "-")
+			var err error
+			if start, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", a)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", b)
+				}
+			} else if hasStep {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("%q out of the range %d-%d", part, lo, hi)
+		}
+		bits |= bitRange(start, end, s)
+	}
+	return bits, nil
+}
+
+func bitRange(start, end, step int) (bits uint64) {
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return
+}
+
+func (c Cron) String() string {
+	return c.expr
+}
+
+// matchDay the day of month or of week, or both if one is not restricted.
+func (c Cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// skipped an hour of the expression was skipped by the change to the summer time, just before t.
+func (c Cron) skipped(t time.Time) bool {
+	if c.hourStar {
+		return false
+	}
+	before := t.Add(-time.Hour)
+	return before.Day() == t.Day() && t.Hour()-before.Hour() > 1 && c.hour&bitRange(before.Hour()+1, t.Hour()-1, 1) != 0
+}
+
+// forward the next time, after t: time.Date put a time skipped by the change to the summer time an hour before.
+func forward(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return next.Add(time.Hour)
+}
+
+// Next the first time after t matching the expression, in the location of t. Zero if none within 5 years (February 30).
+func (c Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+		case !c.matchDay(t):
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+		case t.Minute() == 0 && c.skipped(t):
+			return t
+		case c.hour&(1<<t.Hour()) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		case !c.hourStar && t.Add(-time.Hour).Hour() == t.Hour():
+			// the hour repeated by the change to the winter time, already run
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,139 @@
+package epubschedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// TestParse the invalid expressions are rejected.
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"*/15 0-6,22 1,15 */3 1-5", true},
+		{"0 0 * * 7", true},
+		{"@Daily", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"@every", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"30-10 * * * *", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"a * * * *", false},
+		{"1-b * * * *", false},
+		{"1,,2 * * * *", false},
+	} {
+		if _, err := Parse(tc.expr); (err == nil) != tc.ok {
+			t.Errorf("Parse(%q): %v, want ok %v", tc.expr, err, tc.ok)
+		}
+	}
+}
+
+// TestNext the next run of the expressions, in UTC.
+func TestNext(t *testing.T) {
+	// a thursday
+	from := time.Date(2026, 1, 1, 10, 7, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		name, expr string
+		from, want time.Time
+	}{
+		{"every minute", "* * * * *", from, time.Date(2026, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"after an exact minute", "* * * * *", time.Date(2026, 1, 1, 10, 8, 0, 0, time.UTC), time.Date(2026, 1, 1, 10, 9, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", from, time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"step of a range", "0-30/10 * * * *", time.Date(2026, 1, 1, 10, 31, 0, 0, time.UTC), time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"step from a value", "5/20 * * * *", time.Date(2026, 1, 1, 10, 26, 0, 0, time.UTC), time.Date(2026, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"list", "10,40 9,18 * * *", from, time.Date(2026, 1, 1, 18, 10, 0, 0, time.UTC)},
+		{"range", "0 8-9 * * *", from, time.Date(2026, 1, 2, 8, 0, 0, 0, time.UTC)},
+		{"next month", "0 0 1 * *", from, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"next year", "30 6 15 1 *", time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 15, 6, 30, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"february 30", "0 0 30 2 *", from, time.Time{}},
+		{"day of week", "0 0 * * 5", from, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"7 is sunday", "0 0 * * 7", from, time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"day of month", "0 0 13 * *", from, time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week", "0 0 13 * 5", from, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week, the day of month first", "0 0 13 * 5", time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"day of month and week star", "0 0 13 * *", time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 13, 0, 0, 0, 0, time.UTC)},
+		{"day of week and month", "0 0 * 3 1", from, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", "@yearly", from, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@annually", "@annually", from, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", "@monthly", from, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", "@weekly", from, time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"@daily", "@daily", from, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@midnight", "@midnight", from, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", "@hourly", from, time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Next(tc.from); !got.Equal(tc.want) {
+				t.Errorf("Next(%v) of %q: %v, want %v", tc.from, tc.expr, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestNextDST the runs on the changes of the summer time: the times skipped run at the change, the times repeated run once.
+func TestNextDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-03-08 02:00 EST -> 03:00 EDT, 2026-11-01 02:00 EDT -> 01:00 EST
+	spring := time.Date(2026, 3, 8, 0, 0, 0, 0, ny)
+	fall := time.Date(2026, 11, 1, 0, 0, 0, 0, ny)
+	for _, tc := range []struct {
+		name, expr string
+		from       time.Time
+		want       []time.Time
+	}{
+		{"skipped time", "30 2 * * *", spring, []time.Time{
+			time.Date(2026, 3, 8, 3, 0, 0, 0, ny),
+			time.Date(2026, 3, 9, 2, 30, 0, 0, ny),
+		}},
+		{"skipped time from the hour before", "30 2 * * *", time.Date(2026, 3, 8, 1, 45, 0, 0, ny), []time.Time{
+			time.Date(2026, 3, 8, 3, 0, 0, 0, ny),
+		}},
+		{"time after the skipped hour", "30 3 * * *", spring, []time.Time{
+			time.Date(2026, 3, 8, 3, 30, 0, 0, ny),
+		}},
+		{"every hour on the skipped hour", "30 * * * *", time.Date(2026, 3, 8, 1, 0, 0, 0, ny), []time.Time{
+			time.Date(2026, 3, 8, 1, 30, 0, 0, ny),
+			time.Date(2026, 3, 8, 3, 30, 0, 0, ny),
+		}},
+		{"repeated time", "30 1 * * *", fall, []time.Time{
+			time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC),
+			time.Date(2026, 11, 2, 1, 30, 0, 0, ny),
+		}},
+		{"every hour on the repeated hour", "30 * * * *", time.Date(2026, 11, 1, 0, 45, 0, 0, ny), []time.Time{
+			time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC),
+			time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC),
+			time.Date(2026, 11, 1, 2, 30, 0, 0, ny),
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tc.from
+			for _, want := range tc.want {
+				prev := got
+				if got = c.Next(prev); !got.Equal(want) {
+					t.Fatalf("Next(%v) of %q: %v, want %v", prev, tc.expr, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Package epubserver serve the converter over http on the local network.
+//
+// with the web UI, a page to drop the archives, pick a profile, watch the progress and download the EPUB,
+// a friendlier front door for the users without a terminal. With the OPDS catalog, the e-readers browse a directory
+// of archives and download them converted on demand. The conversions run with the same pipeline as the command line.
+//
+// the api of the jobs, used by the page, can be served alone to integrate the converter in a home server or a web frontend.
+//
+// there is no authentication but the optional token of the api, the server should only listen on localhost or a trusted network.
+package epubserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubmetrics"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// Profile a device offered in the UI.
+type Profile struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+type Options struct {
+	Addr      string                  // host:port to listen on
+	UI        bool                    // serve the web page and its api
+	API       bool                    // serve the api of the jobs only
+	Token     string                  // bearer token required by the api, if set
+	OPDS      string                  // directory of the archives served as an OPDS catalog
+	OPDSCache string                  // EPUB of the catalog, in the temporary directory if empty
+	EPUB      epuboptions.EPUBOptions // defaults of the conversions
+	Profile   string                  // default profile of the UI
+	Profiles  []Profile
+	Workers   int    // conversions in parallel
+	Keep      int    // finished jobs kept with their EPUB, the oldest are removed beyond, 0 = all
+	TempDir   string // uploads and EPUB, removed when the server stop
+	Metrics   string // host:port of the prometheus metrics, disabled if empty
+	Quiet     bool
+}
+
+type Server struct {
+	o       Options
+	dir     string
+	jobs    *jobs
+	metrics *epubmetrics.Metrics
+}
+
+func New(o Options) (*Server, error) {
+	dir, err := os.MkdirTemp(o.TempDir, "go-comic-converter-serve-*")
+	if err != nil {
+		return nil, err
+	}
+	// -clean must not remove the jobs of a running server
+	epubtemp.Track(dir)
+	s := &Server{o: o, dir: dir, jobs: newJobs(max(1, o.Workers), o.Keep)}
+	if o.Metrics != "" {
+		s.metrics = epubmetrics.New(s.jobs.queued)
+		s.jobs.metrics = s.metrics
+		s.o.EPUB.OnStats = s.metrics.OnStats(o.EPUB.OnStats)
+	}
+	return s, nil
+}
+
+// Handler the routes of the enabled features.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.o.UI {
+		s.ui(mux)
+	}
+	if s.o.UI || s.o.API {
+		s.api(mux)
+	}
+	if s.o.OPDS != "" {
+		s.opds(mux)
+	}
+	return s.guard(s.authorize(mux))
+}
+
+// authorize the requests of the api with the token, if set: "Authorization: Bearer <token>".
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.o.Token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.o.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "invalid or missing token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// guard reject the requests of the other sites, through the browser of the user.
+//
+// the Host must be an ip, localhost, the host of the address or the name of the machine, never a domain
+// resolved to the server by a DNS rebinding. The Origin of the requests changing the jobs, if any, must be the server.
+func (s *Server) guard(next http.Handler) http.Handler {
+	hosts := []string{"localhost"}
+	if host, _, err := net.SplitHostPort(s.o.Addr); err == nil && host != "" {
+		hosts = append(hosts, strings.ToLower(host))
+	}
+	if name, err := os.Hostname(); err == nil {
+		name = strings.ToLower(name)
+		hosts = append(hosts, name, name+".local")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if net.ParseIP(host) == nil && !slices.Contains(hosts, host) {
+			writeError(w, http.StatusForbidden, "host not allowed: "+r.Host)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+					writeError(w, http.StatusForbidden, "origin not allowed: "+origin)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run serve until Ctrl-C, then wait for the requests in progress and remove the temporary files.
+func (s *Server) Run() error {
+	defer s.cleanup()
+	l, err := net.Listen("tcp", s.o.Addr)
+	if err != nil {
+		return utils.WithExitCode(err, utils.ExitUsage)
+	}
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	if s.metrics != nil {
+		metrics, err := s.metrics.Serve(s.o.Metrics)
+		if err != nil {
+			_ = l.Close()
+			return err
+		}
+		defer metrics.Close()
+	}
+	if !s.o.Quiet {
+		utils.Printf("Serving on http://%s, Ctrl-C to stop\n", l.Addr())
+		if s.o.OPDS != "" {
+			utils.Printf("OPDS catalog on http://%s/opds\n", l.Addr())
+		}
+		if s.o.Metrics != "" {
+			utils.Printf("Metrics on http://%s/metrics\n", s.o.Metrics)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(l)
+	}()
+	for !utils.Interrupted() {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	// the conversions in progress stop on the interruption
+	s.jobs.wait()
+	return nil
+}
+
+// cleanup remove the uploads and the EPUB not downloaded.
+func (s *Server) cleanup() {
+	s.jobs.each(func(j *Job) {
+		s.jobs.remove(j.Id)
+	})
+	_ = os.RemoveAll(s.dir)
+	epubtemp.Untrack(s.dir)
+}
+
+// lookupProfile the profile offered in the UI by its code.
+func (s *Server) lookupProfile(code string) (Profile, bool) {
+	for _, p := range s.o.Profiles {
+		if p.Code == code {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
@@ -0,0 +1,206 @@
+package epubserver
+
+import (
+	"cmp"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubmetrics"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epub"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+type State string
+
+const (
+	Queued  State = "queued"
+	Running State = "running"
+	Done    State = "done"
+	Failed  State = "failed"
+)
+
+// Job a conversion submitted to the server.
+type Job struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"` // file name of the upload
+	Title   string `json:"title"`
+	Profile string `json:"profile"`
+	Manga   bool   `json:"manga"`
+	State   State  `json:"state"`
+	Step    string `json:"step"`    // description of the current step
+	Current int    `json:"current"` // progress of the step
+	Max     int    `json:"max"`
+	Error   string `json:"error,omitempty"`
+	Size    int64  `json:"size,omitempty"` // size of the EPUB once done
+
+	input, output string
+}
+
+// jobs in memory, converted in the order of submission with a limited number in parallel.
+type jobs struct {
+	mu     sync.Mutex
+	next   int
+	byId   map[string]*Job
+	slots  chan struct{}
+	active sync.WaitGroup
+	keep   int // finished jobs kept, 0 = all
+
+	metrics *epubmetrics.Metrics // nil if disabled
+}
+
+func newJobs(workers int, keep int) *jobs {
+	return &jobs{byId: map[string]*Job{}, slots: make(chan struct{}, workers), keep: keep}
+}
+
+// add the job and return its copy with its id.
+func (js *jobs) add(j *Job) Job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.next++
+	j.Id, j.State = strconv.Itoa(js.next), Queued
+	js.byId[j.Id] = j
+	return *j
+}
+
+// get a copy of the job, safe to read while it runs.
+func (js *jobs) get(id string) (Job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.byId[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// list a copy of the jobs in the order of submission.
+func (js *jobs) list() []Job {
+	res := make([]Job, 0)
+	js.each(func(j *Job) {
+		res = append(res, *j)
+	})
+	return res
+}
+
+func (js *jobs) each(fn func(j *Job)) {
+	js.mu.Lock()
+	all := make([]*Job, 0, len(js.byId))
+	for _, j := range js.byId {
+		all = append(all, j)
+	}
+	js.mu.Unlock()
+	slices.SortFunc(all, func(a, b *Job) int {
+		ia, _ := strconv.Atoi(a.Id)
+		ib, _ := strconv.Atoi(b.Id)
+		return cmp.Compare(ia, ib)
+	})
+	for _, j := range all {
+		fn(j)
+	}
+}
+
+// queued the number of jobs waiting for a slot.
+func (js *jobs) queued() int {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	n := 0
+	for _, j := range js.byId {
+		if j.State == Queued {
+			n++
+		}
+	}
+	return n
+}
+
+// update the job under the lock.
+func (js *jobs) update(j *Job, fn func(j *Job)) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	fn(j)
+}
+
+// remove the job and its files, a running job is kept until done.
+func (js *jobs) remove(id string) bool {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.byId[id]
+	if !ok || j.State == Running {
+		return false
+	}
+	delete(js.byId, id)
+	for _, f := range []string{j.input, j.output} {
+		if f != "" {
+			_ = os.Remove(f)
+			epubtemp.Untrack(f)
+		}
+	}
+	return true
+}
+
+// prune remove the oldest finished jobs and their files beyond the limit.
+func (js *jobs) prune() {
+	if js.keep <= 0 {
+		return
+	}
+	var finished []string
+	for _, j := range js.list() {
+		if j.State == Done || j.State == Failed {
+			finished = append(finished, j.Id)
+		}
+	}
+	for _, id := range finished[:max(0, len(finished)-js.keep)] {
+		js.remove(id)
+	}
+}
+
+// wait for the running conversions.
+func (js *jobs) wait() {
+	js.active.Wait()
+}
+
+// run the conversion of the job once a slot is available.
+func (js *jobs) run(j *Job, o epuboptions.EPUBOptions) {
+	js.active.Add(1)
+	go func() {
+		defer js.active.Done()
+		js.slots <- struct{}{}
+		defer func() { <-js.slots }()
+		// removed while queued
+		if _, ok := js.get(j.Id); !ok || utils.Interrupted() {
+			return
+		}
+
+		js.update(j, func(j *Job) { j.State = Running })
+		o.Progress = epuboptions.ProgressFunc(func(step epuboptions.ProgressStep, current int) {
+			js.update(j, func(j *Job) {
+				j.Step, j.Current, j.Max = step.Description, current, step.Max
+			})
+		})
+		epubtemp.Track(o.Output)
+		done := js.metrics.Start()
+		err := epub.New(o).Write()
+		done(err)
+
+		// the upload is no more needed
+		_ = os.Remove(o.Input)
+		epubtemp.Untrack(o.Input)
+		js.update(j, func(j *Job) {
+			j.input = ""
+			if err != nil {
+				j.State, j.Error = Failed, err.Error()
+				_ = os.Remove(j.output)
+				epubtemp.Untrack(j.output)
+				return
+			}
+			j.State = Done
+			if fi, err := os.Stat(o.Output); err == nil {
+				j.Size = fi.Size()
+			}
+		})
+		js.prune()
+	}()
+}
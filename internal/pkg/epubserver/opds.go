@@ -0,0 +1,255 @@
+package epubserver
+
+import (
+	"encoding/xml"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubbatch"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/sortpath"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epub"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+const (
+	opdsNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+)
+
+// opdsFeed an OPDS 1.2 catalog, an atom feed.
+type opdsFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []opdsLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+type opdsEntry struct {
+	Id      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []opdsLink `xml:"link"`
+}
+
+type opdsLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// opds serve the archives of the directory as an OPDS catalog, converted on demand:
+//
+//	GET /opds                    the root of the directory
+//	GET /opds/{path}             a subdirectory
+//	GET /opds/book/{path}        the EPUB of an archive, converted with the profile on the first download
+//
+// the EPUB are cached with the state of the batch mode, converted again once the archive or the options change.
+func (s *Server) opds(mux *http.ServeMux) {
+	c := &opdsCache{locks: map[string]*sync.Mutex{}}
+	mux.HandleFunc("GET /opds", func(w http.ResponseWriter, r *http.Request) {
+		s.opdsFeed(w, ".")
+	})
+	mux.HandleFunc("GET /opds/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		p := r.PathValue("path")
+		if book, ok := strings.CutPrefix(p, "book/"); ok {
+			s.opdsBook(w, r, c, book)
+			return
+		}
+		s.opdsFeed(w, strings.TrimSuffix(p, "/"))
+	})
+}
+
+// opdsPath the file of the catalog on the disk, the path should stay in the directory.
+func (s *Server) opdsPath(p string) (string, bool) {
+	if !fs.ValidPath(p) {
+		return "", false
+	}
+	return filepath.Join(s.o.OPDS, filepath.FromSlash(p)), true
+}
+
+// opdsFeed the subdirectories and the archives of the directory.
+func (s *Server) opdsFeed(w http.ResponseWriter, dir string) {
+	file, ok := s.opdsPath(dir)
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	entries, err := os.ReadDir(file)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	title := "Comics"
+	if dir != "." {
+		title = path.Base(dir)
+	}
+	feed := opdsFeed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		Id:      "urn:go-comic-converter:" + dir,
+		Title:   title,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links: []opdsLink{
+			{Rel: "self", Href: opdsHref("", dir), Type: opdsAcquisition},
+			{Rel: "start", Href: "/opds", Type: opdsNavigation},
+		},
+		Entries: make([]opdsEntry, 0, len(entries)),
+	}
+
+	names := make([]string, 0, len(entries))
+	byName := map[string]fs.DirEntry{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || (!e.IsDir() && !slices.Contains(uploadExtensions, strings.ToLower(filepath.Ext(e.Name())))) {
+			continue
+		}
+		names = append(names, e.Name())
+		byName[e.Name()] = e
+	}
+	sort.Sort(sortpath.By(names, s.o.EPUB.SortPathMode))
+	for _, name := range names {
+		e := byName[name]
+		p := path.Join(dir, name)
+		entry := opdsEntry{Id: "urn:go-comic-converter:" + p, Title: name, Updated: feed.Updated}
+		if fi, err := e.Info(); err == nil {
+			entry.Updated = fi.ModTime().UTC().Format(time.RFC3339)
+		}
+		if e.IsDir() {
+			entry.Links = []opdsLink{{Rel: "subsection", Href: opdsHref("", p), Type: opdsNavigation}}
+		} else {
+			entry.Title = strings.TrimSuffix(name, filepath.Ext(name))
+			entry.Links = []opdsLink{{Rel: "http://opds-spec.org/acquisition", Href: opdsHref("book/", p), Type: "application/epub+zip"}}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", opdsAcquisition+";charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(feed)
+}
+
+// opdsHref the url of a path of the catalog.
+func opdsHref(prefix, p string) string {
+	if p == "." {
+		return "/opds"
+	}
+	return (&url.URL{Path: "/opds/" + prefix + p}).EscapedPath()
+}
+
+// opdsCache the conversions of the catalog, one at a time by archive.
+type opdsCache struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+	state *epubbatch.State
+}
+
+func (c *opdsCache) lock(input string) func() {
+	c.mu.Lock()
+	l, ok := c.locks[input]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[input] = l
+	}
+	c.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// opdsBook convert the archive if the EPUB is missing or outdated, then send it.
+func (s *Server) opdsBook(w http.ResponseWriter, r *http.Request, c *opdsCache, p string) {
+	input, ok := s.opdsPath(p)
+	if fi, err := os.Stat(input); !ok || err != nil || fi.IsDir() || !slices.Contains(uploadExtensions, strings.ToLower(filepath.Ext(input))) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	profile, ok := s.lookupProfile(s.o.Profile)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "unknown profile "+s.o.Profile)
+		return
+	}
+
+	title := strings.TrimSuffix(path.Base(p), path.Ext(p))
+	o := s.o.EPUB
+	o.Input, o.Title = input, title
+	o.Output = filepath.Join(s.opdsCacheDir(), filepath.FromSlash(strings.TrimSuffix(p, path.Ext(p)))+".epub")
+	o.Image.View.Width, o.Image.View.Height = profile.Width, profile.Height
+	// a single EPUB to download
+	o.LimitMb, o.OutputFormat = 0, epuboptions.OutputEPUB
+	o.Quiet, o.Json, o.Dry = true, false, false
+	if s.o.Workers > 1 {
+		o.Workers = max(1, o.Workers/s.o.Workers)
+	}
+
+	unlock := c.lock(input)
+	defer unlock()
+	if err := s.opdsConvert(c, o); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": title + ".epub"}))
+	http.ServeFile(w, r, o.Output)
+}
+
+// opdsCacheDir the EPUB of the catalog, kept in the output directory or until the server stop.
+func (s *Server) opdsCacheDir() string {
+	if s.o.OPDSCache != "" {
+		return s.o.OPDSCache
+	}
+	return filepath.Join(s.dir, "opds")
+}
+
+// opdsConvert the archive, unless the EPUB is up to date.
+func (s *Server) opdsConvert(c *opdsCache, o epuboptions.EPUBOptions) error {
+	c.mu.Lock()
+	if c.state == nil {
+		state, err := epubbatch.LoadState(filepath.Join(s.opdsCacheDir(), epubbatch.StateFileName))
+		if err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		c.state = &state
+	}
+	entry, upToDate, err := c.state.Check(o.Input, o.Output, epubbatch.Fingerprint(o))
+	c.mu.Unlock()
+	if err != nil || upToDate {
+		if upToDate {
+			s.metrics.Skip()
+		}
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(o.Output), 0755); err != nil {
+		return err
+	}
+	// the conversions share the workers with the uploads
+	s.jobs.slots <- struct{}{}
+	done := s.metrics.Start()
+	epubtemp.Track(o.Output)
+	err = epub.New(o).Write()
+	epubtemp.Untrack(o.Output)
+	done(err)
+	<-s.jobs.slots
+	if err != nil {
+		_ = os.Remove(o.Output)
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Update(o.Input, entry)
+	return c.state.Save()
+}
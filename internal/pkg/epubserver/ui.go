@@ -0,0 +1,230 @@
+package epubserver
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+//go:embed "ui.html"
+var uiPage []byte
+
+// uploadMemory the part of an upload kept in memory, the rest is written in a temporary file.
+const uploadMemory = 32 << 20
+
+// maxUploadSize of the body of a submit, the largest archives are a few hundred of MB.
+const maxUploadSize = 4 << 30
+
+// extensions of the archives accepted by the UI
+var uploadExtensions = []string{".cbz", ".zip", ".cbr", ".rar", ".pdf"}
+
+// ui register the page, using the api.
+func (s *Server) ui(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(uiPage)
+	})
+}
+
+// api register the routes of the jobs:
+//
+//	GET    /api/profiles          the devices and the default one
+//	GET    /api/jobs              the jobs
+//	POST   /api/jobs              submit an archive (multipart: file, profile, manga, title, options)
+//	GET    /api/jobs/{id}         a job
+//	GET    /api/jobs/{id}/epub    download the EPUB
+//	DELETE /api/jobs/{id}         remove the job and its files
+func (s *Server) api(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/profiles", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, map[string]any{"default": s.o.Profile, "profiles": s.o.Profiles})
+	})
+	mux.HandleFunc("GET /api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, s.jobs.list())
+	})
+	mux.HandleFunc("POST /api/jobs", s.submit)
+	mux.HandleFunc("GET /api/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		j, ok := s.jobs.get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		}
+		writeJson(w, http.StatusOK, j)
+	})
+	mux.HandleFunc("GET /api/jobs/{id}/epub", s.download)
+	mux.HandleFunc("DELETE /api/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !s.jobs.remove(r.PathValue("id")) {
+			writeError(w, http.StatusConflict, "job not found or running")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// submit save the upload and queue its conversion with the defaults of the server.
+//
+// the options are the json options of the EPUB over the defaults, like -show-json. The server keep its files and commands:
+// the input, the output, the hooks, the overrides and the directories can't be changed.
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer func() {
+		_ = r.MultipartForm.RemoveAll()
+	}()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file: "+err.Error())
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !slices.Contains(uploadExtensions, ext) {
+		s.metrics.Invalid()
+		writeError(w, http.StatusBadRequest, "file should be a cbz, zip, cbr, rar or pdf")
+		return
+	}
+	profile, ok := s.lookupProfile(cmp.Or(r.FormValue("profile"), s.o.Profile))
+	if !ok {
+		s.metrics.Invalid()
+		writeError(w, http.StatusBadRequest, "unknown profile "+r.FormValue("profile"))
+		return
+	}
+	o, err := s.options(r.FormValue("options"))
+	if err != nil {
+		s.metrics.Invalid()
+		writeError(w, http.StatusBadRequest, "options: "+err.Error())
+		return
+	}
+
+	j := &Job{
+		Name:    filepath.Base(header.Filename),
+		Title:   cmp.Or(strings.TrimSpace(r.FormValue("title")), o.Title),
+		Profile: profile.Code,
+		Manga:   o.Image.Manga,
+	}
+	if m := r.FormValue("manga"); m != "" {
+		j.Manga = m == "true"
+	}
+	if j.Title == "" {
+		j.Title = strings.TrimSuffix(j.Name, filepath.Ext(j.Name))
+	}
+
+	o.Input, o.Output, o.Title = j.Name, j.Title+".epub", j.Title
+	o.Image.Manga = j.Manga
+	o.Image.View.Width, o.Image.View.Height = profile.Width, profile.Height
+	// a single EPUB to download
+	o.LimitMb, o.OutputFormat = 0, epuboptions.OutputEPUB
+	o.Quiet, o.Json, o.Dry, o.DryVerbose, o.DryPlan = true, false, false, false, false
+	if err = o.Check(); err != nil {
+		s.metrics.Invalid()
+		var ve *epuboptions.ValidationError
+		if errors.As(err, &ve) {
+			writeJson(w, http.StatusBadRequest, map[string]any{"error": err.Error(), "fields": ve.Errors})
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	job := s.jobs.add(j)
+
+	// the loader choose the reader by the extension
+	input := filepath.Join(s.dir, job.Id+ext)
+	epubtemp.Track(input)
+	if err := saveUpload(input, file); err != nil {
+		_ = os.Remove(input)
+		epubtemp.Untrack(input)
+		s.jobs.update(j, func(j *Job) { j.State, j.Error = Failed, err.Error() })
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	o.Input, o.Output = input, filepath.Join(s.dir, job.Id+".epub")
+	if s.o.Workers > 1 {
+		o.Workers = max(1, o.Workers/s.o.Workers)
+	}
+	s.jobs.update(j, func(j *Job) { j.input, j.output = o.Input, o.Output })
+	s.jobs.run(j, o)
+
+	job, _ = s.jobs.get(job.Id)
+	writeJson(w, http.StatusAccepted, job)
+}
+
+// download the EPUB of a job done, named after its title.
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if j.State != Done {
+		writeError(w, http.StatusConflict, "job is "+string(j.State))
+		return
+	}
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": j.Title + ".epub"}))
+	http.ServeFile(w, r, j.output)
+}
+
+// options of a job, the json over the defaults of the server.
+func (s *Server) options(raw string) (epuboptions.EPUBOptions, error) {
+	o := s.o.EPUB
+	if raw == "" {
+		return o, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &o); err != nil {
+		return o, err
+	}
+	d := s.o.EPUB
+	o.Input, o.Output, o.Overrides = d.Input, d.Output, d.Overrides
+	o.PostHook, o.Image.Hook, o.Calibre = d.PostHook, d.Image.Hook, d.Calibre
+	o.Kobo, o.KoboCollections, o.KindleMount, o.Mihon, o.Upload, o.UploadRetries = d.Kobo, d.KoboCollections, d.KindleMount, false, d.Upload, d.UploadRetries
+	o.CacheDir, o.TempDir, o.KeepTemp, o.Validate = d.CacheDir, d.TempDir, d.KeepTemp, d.Validate
+	o.Workers, o.MaxMemory = d.Workers, d.MaxMemory
+	// the limits protect the server from the large uploads, the backends depend on its build
+	o.Image.MaxMegapixels, o.Image.MaxDimension, o.Image.TileThreshold = d.Image.MaxMegapixels, d.Image.MaxDimension, d.Image.TileThreshold
+	o.Image.Backend, o.Image.JpegBackend = d.Image.Backend, d.Image.JpegBackend
+	return o, nil
+}
+
+func saveUpload(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJson(w, status, map[string]string{"error": msg})
+}
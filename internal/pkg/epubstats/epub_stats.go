@@ -0,0 +1,132 @@
+// Package epubstats collect the stats of the conversions of a run, for the summary at the end.
+package epubstats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// Total the aggregate of the conversions.
+type Total struct {
+	Books          int     `json:"books"`
+	InputSize      int64   `json:"input_size"`
+	OutputSize     int64   `json:"output_size"`
+	Ratio          float64 `json:"ratio"` // output / input
+	Sources        int     `json:"sources"`
+	Pages          int     `json:"pages"`
+	Split          int     `json:"split"`
+	Dropped        int     `json:"dropped"`
+	DurationMs     int64   `json:"duration_ms"`     // sum of the conversions, above the wall time with parallel conversions
+	AverageQuality float64 `json:"average_quality"` // of the lossy formats, 0 if none
+}
+
+// Summary of the run.
+type Summary struct {
+	Books []epuboptions.Stats `json:"books"`
+	Total Total               `json:"total"`
+}
+
+// Collector of the stats of the conversions, safe for the concurrent conversions of the batch mode.
+type Collector struct {
+	mu    sync.Mutex
+	books []epuboptions.Stats
+}
+
+func New() *Collector {
+	return &Collector{books: make([]epuboptions.Stats, 0)}
+}
+
+// Add the stats of a conversion, to set as EPUBOptions.OnStats.
+func (c *Collector) Add(s epuboptions.Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.books = append(c.books, s)
+}
+
+// Summary of the conversions added so far.
+func (c *Collector) Summary() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Summary{Books: append(make([]epuboptions.Stats, 0, len(c.books)), c.books...)}
+	qualities, lossy := 0, 0
+	for _, b := range c.books {
+		s.Total.Books++
+		s.Total.InputSize += b.InputSize
+		s.Total.OutputSize += b.OutputSize
+		s.Total.Sources += b.Sources
+		s.Total.Pages += b.Pages
+		s.Total.Split += b.Split
+		s.Total.Dropped += b.Dropped
+		s.Total.DurationMs += b.DurationMs
+		if b.Format == "jpeg" {
+			qualities += b.Quality
+			lossy++
+		}
+	}
+	if s.Total.InputSize > 0 {
+		s.Total.Ratio = float64(s.Total.OutputSize) / float64(s.Total.InputSize)
+	}
+	if lossy > 0 {
+		s.Total.AverageQuality = float64(qualities) / float64(lossy)
+	}
+	return s
+}
+
+// WriteFile export the summary as json.
+func (s Summary) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+func (s Summary) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(w, "BOOK\tINPUT\tOUTPUT\tRATIO\tSOURCES\tPAGES\tSPLIT\tDROPPED\tQUALITY\tTIME\t")
+	for _, book := range s.Books {
+		quality := "-"
+		if book.Format == "jpeg" {
+			quality = utils.IntToString(book.Quality)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t\n",
+			filepath.Base(book.Input), mb(book.InputSize), mb(book.OutputSize), ratio(book.Ratio),
+			book.Sources, book.Pages, book.Split, book.Dropped, quality, seconds(book.DurationMs),
+		)
+	}
+	t := s.Total
+	quality := "-"
+	if t.AverageQuality > 0 {
+		quality = fmt.Sprintf("%.0f", t.AverageQuality)
+	}
+	_, _ = fmt.Fprintf(w, "TOTAL (%d)\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t\n",
+		t.Books, mb(t.InputSize), mb(t.OutputSize), ratio(t.Ratio),
+		t.Sources, t.Pages, t.Split, t.Dropped, quality, seconds(t.DurationMs),
+	)
+	_ = w.Flush()
+	return b.String()
+}
+
+func mb(size int64) string {
+	return fmt.Sprintf("%.1f Mb", float64(size)/1024/1024)
+}
+
+func ratio(r float64) string {
+	if r == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", r*100)
+}
+
+func seconds(ms int64) string {
+	return fmt.Sprintf("%.1fs", float64(ms)/1000)
+}
@@ -0,0 +1,143 @@
+// Package epubtemp track the temporary files of the running conversion.
+//
+// each run keep a manifest of its temporary files in the user cache dir, named after its pid.
+// if the program die (crash, kill, power loss), the next run find the manifest of the dead process and remove its files.
+package epubtemp
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	mu    sync.Mutex
+	files = map[string]struct{}{}
+)
+
+// dir of the manifests.
+func dir() (string, error) {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "go-comic-converter", "temp"), nil
+}
+
+// save the manifest of the current run, removed once all the files are untracked.
+//
+// the manifest is best effort, a failure should not stop the conversion.
+func save() {
+	d, err := dir()
+	if err != nil {
+		return
+	}
+	manifest := filepath.Join(d, strconv.Itoa(os.Getpid())+".json")
+	if len(files) == 0 {
+		_ = os.Remove(manifest)
+		return
+	}
+	data, err := json.Marshal(slices.Sorted(maps.Keys(files)))
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(d, 0755); err != nil {
+		return
+	}
+	// written then renamed, a crash never leave a truncated manifest
+	if err = os.WriteFile(manifest+".tmp", data, 0644); err != nil {
+		return
+	}
+	_ = os.Rename(manifest+".tmp", manifest)
+}
+
+// Track a temporary file of the current run, to remove it on the next run if this one die.
+func Track(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	files[path] = struct{}{}
+	save()
+}
+
+// Untrack a temporary file once removed or kept on purpose.
+func Untrack(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := files[path]; !ok {
+		return
+	}
+	delete(files, path)
+	save()
+}
+
+// Cleanup remove the temporary files left by the previous runs that died, return the removed files.
+//
+// the manifests of the running processes are left untouched.
+func Cleanup() (removed []string) {
+	d, err := dir()
+	if err != nil {
+		return
+	}
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		pid, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		if err != nil || !strings.HasSuffix(name, ".json") || pid == os.Getpid() || alive(pid) {
+			continue
+		}
+		manifest := filepath.Join(d, name)
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			continue
+		}
+		var paths []string
+		_ = json.Unmarshal(data, &paths)
+		failed := false
+		for _, path := range paths {
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				continue
+			}
+			// the directory of the server is removed with its files
+			if err := os.RemoveAll(path); err == nil {
+				removed = append(removed, path)
+			} else {
+				failed = true
+			}
+		}
+		// retried on the next run
+		if !failed {
+			_ = os.Remove(manifest)
+		}
+	}
+	return
+}
+
+// alive check if the process is still running.
+//
+// on windows, finding the process already open it.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
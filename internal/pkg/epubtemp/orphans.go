@@ -0,0 +1,76 @@
+package epubtemp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// patterns of the temporary files of a conversion: the storage and the index of the processed images,
+// next to the output or in the temp dir, the videos and the uploads of the server mode.
+var patterns = []string{
+	"*.epub.tmp",
+	"*.epub.idx.tmp",
+	"*.epub.*.tmp",
+	"go-comic-converter-*.video",
+	"go-comic-converter-serve-*",
+}
+
+// inUse the temporary files tracked by the running processes, including this one.
+func inUse() map[string]bool {
+	used := map[string]bool{}
+	mu.Lock()
+	for path := range files {
+		used[path] = true
+	}
+	mu.Unlock()
+
+	d, err := dir()
+	if err != nil {
+		return used
+	}
+	entries, _ := os.ReadDir(d)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") || !alive(pid) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(d, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var paths []string
+		_ = json.Unmarshal(data, &paths)
+		for _, path := range paths {
+			used[path] = true
+		}
+	}
+	return used
+}
+
+// Orphans the temporary files found in the directories that no running conversion use.
+//
+// they are left by a run killed before its manifest was written, or by a version without manifest.
+// the storage of a running conversion started without manifest can't be told apart, the conversions should be stopped.
+func Orphans(dirs ...string) []string {
+	used := inUse()
+	orphans := make([]string, 0)
+	for _, d := range dirs {
+		for _, pattern := range patterns {
+			matches, _ := filepath.Glob(filepath.Join(d, pattern))
+			for _, path := range matches {
+				if abs, err := filepath.Abs(path); err == nil {
+					path = abs
+				}
+				if !used[path] && !slices.Contains(orphans, path) {
+					orphans = append(orphans, path)
+				}
+			}
+		}
+	}
+	slices.Sort(orphans)
+	return orphans
+}
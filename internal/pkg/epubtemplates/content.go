@@ -13,13 +13,17 @@ type Content struct {
 	HasTitlePage bool
 	UID          string
 	Author       string
+	Series       string
 	Publisher    string
 	UpdatedAt    string
 	ImageOptions epuboptions.Image
 	Cover        epubimage.EPUBImage
-	Images       []epubimage.EPUBImage
+	Images       epubimage.Index
 	Current      int
 	Total        int
+
+	// Positions receive the spread of each image, used by the style of the pages.
+	Positions []string
 }
 
 type tagAttrs map[string]string
@@ -129,17 +133,23 @@ func (o Content) getMeta() []tag {
 
 	metas = append(metas, tag{"meta", tagAttrs{"name": "cover", "content": "img_cover"}, ""})
 
+	series := o.Series
+	if series == "" && o.Total > 1 {
+		series = o.Title
+	}
+	if series != "" {
+		metas = append(metas, tag{"meta", tagAttrs{"name": "calibre:series", "content": series}, ""})
+	}
 	if o.Total > 1 {
-		metas = append(
-			metas,
-			tag{"meta", tagAttrs{"name": "calibre:series", "content": o.Title}, ""},
-			tag{"meta", tagAttrs{"name": "calibre:series_index", "content": utils.IntToString(o.Current)}, ""},
-		)
+		metas = append(metas, tag{"meta", tagAttrs{"name": "calibre:series_index", "content": utils.IntToString(o.Current)}, ""})
 	}
 
 	return metas
 }
 
+// getManifest items of the content.
+//
+// the images are not given a fallback: a format out of the core media types (avif) is only displayed by the readers supporting it.
 func (o Content) getManifest() []tag {
 	var imageTags, pageTags, spaceTags []tag
 	addTag := func(img epubimage.EPUBImage, withSpace bool) {
@@ -154,6 +164,11 @@ func (o Content) getManifest() []tag {
 				tag{"item", tagAttrs{"id": img.SpaceKey(), "href": img.SpacePath(), "media-type": "application/xhtml+xml"}, ""},
 			)
 		}
+		if !o.ImageOptions.View.PortraitOnly && img.HasEndSpace() {
+			spaceTags = append(spaceTags,
+				tag{"item", tagAttrs{"id": img.EndSpaceKey(), "href": img.EndSpacePath(), "media-type": "application/xhtml+xml"}, ""},
+			)
+		}
 	}
 
 	items := []tag{
@@ -174,14 +189,14 @@ func (o Content) getManifest() []tag {
 		}
 	}
 
-	lastImage := o.Images[len(o.Images)-1]
-	for _, img := range o.Images {
+	last := o.Images.Len() - 1
+	for i, img := range o.Images.All() {
 		addTag(
 			img,
 			!o.ImageOptions.View.PortraitOnly &&
 				(img.DoublePage ||
 					(!o.ImageOptions.KeepDoublePageIfSplit && img.Part == 1) ||
-					(img.Part == 0 && img == lastImage)))
+					(img.Part == 0 && i == last)))
 	}
 
 	items = append(items, imageTags...)
@@ -227,7 +242,8 @@ func (o Content) getSpineAuto() []tag {
 			)
 		}
 	}
-	for i, img := range o.Images {
+	var lastImage epubimage.EPUBImage
+	for i, img := range o.Images.All() {
 		if (img.DoublePage || img.Part == 1) && o.ImageOptions.Manga == isOnTheRight {
 			spine = append(spine, tag{
 				"itemref",
@@ -242,13 +258,24 @@ func (o Content) getSpineAuto() []tag {
 			tagAttrs{"idref": img.PageKey(), "properties": img.Position},
 			"",
 		})
-		// save position, img is a value type
-		o.Images[i] = img
+		// save position for the pages
+		if i < len(o.Positions) {
+			o.Positions[i] = img.Position
+		}
+		// an odd number of parts end on the first page of a spread, the next page start a new one
+		if img.HasEndSpace() && o.ImageOptions.Manga == isOnTheRight {
+			spine = append(spine, tag{
+				"itemref",
+				tagAttrs{"idref": img.EndSpaceKey(), "properties": getSpreadBlank()},
+				"",
+			})
+		}
+		lastImage = img
 	}
 	if o.ImageOptions.Manga == isOnTheRight {
 		spine = append(spine, tag{
 			"itemref",
-			tagAttrs{"idref": o.Images[len(o.Images)-1].SpaceKey(), "properties": getSpread(false)},
+			tagAttrs{"idref": lastImage.SpaceKey(), "properties": getSpread(false)},
 			"",
 		})
 	}
@@ -263,7 +290,7 @@ func (o Content) getSpinePortrait() []tag {
 			tag{"itemref", tagAttrs{"idref": "page_title"}, ""},
 		)
 	}
-	for _, img := range o.Images {
+	for _, img := range o.Images.All() {
 		spine = append(spine, tag{
 			"itemref",
 			tagAttrs{"idref": img.PageKey()},
@@ -277,6 +304,6 @@ func (o Content) getSpinePortrait() []tag {
 func (o Content) getGuide() []tag {
 	return []tag{
 		{"reference", tagAttrs{"type": "cover", "title": "cover", "href": "Text/cover.xhtml"}, ""},
-		{"reference", tagAttrs{"type": "text", "title": "content", "href": o.Images[0].PagePath()}, ""},
+		{"reference", tagAttrs{"type": "text", "title": "content", "href": o.Images.First().PagePath()}, ""},
 	}
 }
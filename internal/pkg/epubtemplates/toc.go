@@ -12,7 +12,7 @@ import (
 // Toc create toc
 //
 //goland:noinspection HttpUrlsUsage
-func Toc(title string, hasTitle bool, stripFirstDirectoryFromToc bool, images []epubimage.EPUBImage) string {
+func Toc(title string, hasTitle bool, stripFirstDirectoryFromToc bool, images epubimage.Index) string {
 	doc := etree.NewDocument()
 	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
 	doc.CreateDirective("DOCTYPE html")
@@ -30,7 +30,7 @@ func Toc(title string, hasTitle bool, stripFirstDirectoryFromToc bool, images []
 
 	ol := etree.NewElement("ol")
 	paths := map[string]*etree.Element{".": ol}
-	for _, img := range images {
+	for _, img := range images.All() {
 		currentPath := "."
 		for _, path := range strings.Split(img.Path, string(filepath.Separator)) {
 			parentPath := currentPath
@@ -61,7 +61,7 @@ func Toc(title string, hasTitle bool, stripFirstDirectoryFromToc bool, images []
 	if hasTitle {
 		beginningLink.CreateAttr("href", "Text/title.xhtml")
 	} else {
-		beginningLink.CreateAttr("href", images[0].PagePath())
+		beginningLink.CreateAttr("href", images.First().PagePath())
 	}
 	beginningLink.CreateText(title)
 	ol.InsertChildAt(0, beginning)
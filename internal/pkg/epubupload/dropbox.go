@@ -0,0 +1,168 @@
+package epubupload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// dropboxChunk the size of the requests, below the limit of 150 Mb of an upload.
+const dropboxChunk = 128 << 20
+
+// dropbox upload by session, in chunks, the file is overwritten.
+type dropbox struct{}
+
+func (dropbox) check(*url.URL) error {
+	if os.Getenv("DROPBOX_TOKEN") != "" {
+		return nil
+	}
+	for _, n := range []string{"DROPBOX_REFRESH_TOKEN", "DROPBOX_APP_KEY", "DROPBOX_APP_SECRET"} {
+		if _, err := env(n); err != nil {
+			return errors.New("DROPBOX_TOKEN, or DROPBOX_REFRESH_TOKEN, DROPBOX_APP_KEY and DROPBOX_APP_SECRET, are not set")
+		}
+	}
+	return nil
+}
+
+// token the access token, the refresh token is exchanged for a new one as they expire after a few hours.
+func (dropbox) token(ctx context.Context) (string, error) {
+	if t := os.Getenv("DROPBOX_TOKEN"); t != "" {
+		return t, nil
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {os.Getenv("DROPBOX_REFRESH_TOKEN")},
+		"client_id":     {os.Getenv("DROPBOX_APP_KEY")},
+		"client_secret": {os.Getenv("DROPBOX_APP_SECRET")},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.dropboxapi.com/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var t struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&t)
+	return t.AccessToken, err
+}
+
+func (d dropbox) upload(ctx context.Context, u *url.URL, file string, name string, retries int) (string, error) {
+	f, size, err := openFile(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var token string
+	if err = retry(ctx, retries, func() (err error) {
+		token, err = d.token(ctx)
+		return
+	}); err != nil {
+		return "", err
+	}
+	call := func(endpoint string, arg any, body io.Reader, length int64, result any) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://content.dropboxapi.com/2/files/"+endpoint, body)
+		if err != nil {
+			return err
+		}
+		a, _ := json.Marshal(arg)
+		req.ContentLength = length
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/octet-stream")
+		// the header is ascii only, the other characters are escaped by json
+		req.Header.Set("Dropbox-API-Arg", asciiJson(string(a)))
+		resp, err := do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if result == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+
+	var session struct {
+		SessionId string `json:"session_id"`
+	}
+	if err = retry(ctx, retries, func() error {
+		return call("upload_session/start", map[string]any{}, http.NoBody, 0, &session)
+	}); err != nil {
+		return "", err
+	}
+
+	// a chunk is sent again after a failure, unless dropbox received it before
+	var offset int64
+	for offset < size {
+		n := min(dropboxChunk, size-offset)
+		cursor := map[string]any{"session_id": session.SessionId, "offset": offset}
+		if err = retry(ctx, retries, func() error {
+			err := call("upload_session/append_v2", map[string]any{"cursor": cursor}, io.NewSectionReader(f, offset, n), n, nil)
+			if received, ok := dropboxOffset(err); ok && received == offset+n {
+				return nil
+			}
+			return err
+		}); err != nil {
+			return "", err
+		}
+		offset += n
+	}
+
+	// dropbox://Books/ is read like dropbox:///Books/
+	remote := folder(&url.URL{Path: u.Host + u.Path}) + name
+	if err = retry(ctx, retries, func() error {
+		return call("upload_session/finish", map[string]any{
+			"cursor": map[string]any{"session_id": session.SessionId, "offset": offset},
+			"commit": map[string]any{"path": remote, "mode": "overwrite", "mute": true},
+		}, http.NoBody, 0, nil)
+	}); err != nil {
+		return "", err
+	}
+	return "dropbox://" + remote, nil
+}
+
+// dropboxOffset the offset received by the session, given by the error of an append at another offset.
+func dropboxOffset(err error) (int64, bool) {
+	var serr statusError
+	if !errors.As(err, &serr) || serr.code != http.StatusConflict {
+		return 0, false
+	}
+	var body struct {
+		Error struct {
+			Tag           string `json:".tag"`
+			CorrectOffset int64  `json:"correct_offset"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(serr.body, &body) != nil || body.Error.Tag != "incorrect_offset" {
+		return 0, false
+	}
+	return body.Error.CorrectOffset, true
+}
+
+// asciiJson escape the characters above ascii of the json.
+func asciiJson(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		for _, c := range utf16.Encode([]rune{r}) {
+			_, _ = fmt.Fprintf(&b, `\u%04x`, c)
+		}
+	}
+	return b.String()
+}
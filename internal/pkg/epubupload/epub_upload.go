@@ -0,0 +1,180 @@
+// Package epubupload upload the EPUB written to a cloud storage, for the headless servers.
+//
+// the destination is an url of the folder, the credentials are read from the environment:
+//
+//	s3://bucket/prefix/       AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION, AWS_ENDPOINT_URL (S3 compatible)
+//	dropbox://path/           DROPBOX_TOKEN, or DROPBOX_REFRESH_TOKEN, DROPBOX_APP_KEY and DROPBOX_APP_SECRET
+//	gdrive://folder_id/       GOOGLE_APPLICATION_CREDENTIALS (a service account), or GOOGLE_DRIVE_TOKEN
+//
+// a file with the same name in the folder is replaced. A failed request is retried like the downloads, with an increasing delay,
+// the chunk or the rest of the session for Dropbox and Google Drive.
+package epubupload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var client = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 5 * time.Minute,
+	},
+}
+
+// backend of a scheme.
+type backend interface {
+	// check the destination and the credentials, before the conversion
+	check(u *url.URL) error
+	// upload the file under the name into the folder of the destination, return the url of the file
+	upload(ctx context.Context, u *url.URL, file string, name string, retries int) (string, error)
+}
+
+var backends = map[string]backend{
+	"s3":      s3{},
+	"dropbox": dropbox{},
+	"gdrive":  gdrive{},
+}
+
+func parse(dest string) (*url.URL, backend, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, ok := backends[u.Scheme]
+	if !ok {
+		return nil, nil, fmt.Errorf("upload destination should be s3://bucket/prefix/, dropbox://path/ or gdrive://folder_id/, got %q", dest)
+	}
+	return u, b, nil
+}
+
+// Check the destination and its credentials.
+func Check(dest string) error {
+	u, b, err := parse(dest)
+	if err != nil {
+		return err
+	}
+	return b.check(u)
+}
+
+// Upload the file into the destination folder, with its name, each request is retried up to retries times.
+func Upload(ctx context.Context, dest string, file string, retries int) (string, error) {
+	u, b, err := parse(dest)
+	if err != nil {
+		return "", err
+	}
+	start := time.Now()
+	remote, err := b.upload(ctx, u, file, filepath.Base(file), retries)
+	if err != nil {
+		return "", fmt.Errorf("upload of %s: %w", file, err)
+	}
+	slog.Info("uploaded", "file", file, "url", remote, "duration", time.Since(start))
+	return remote, nil
+}
+
+// env the first variable set, or an error naming them.
+func env(names ...string) (string, error) {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not set", strings.Join(names, " or "))
+}
+
+// folder the path of the destination as a folder: /a/b/
+func folder(u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+// do send the request, an error with the body of the response unless 2xx.
+func do(req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, newStatusError(req, resp)
+	}
+	return resp, nil
+}
+
+// statusError a response of the storage other than 2xx, with the start of its body.
+type statusError struct {
+	method string
+	url    string
+	status string
+	code   int
+	body   []byte
+}
+
+func newStatusError(req *http.Request, resp *http.Response) statusError {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	_ = resp.Body.Close()
+	return statusError{req.Method, req.URL.Redacted(), resp.Status, resp.StatusCode, b}
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.method, e.url, e.status, strings.TrimSpace(string(e.body)))
+}
+
+// permanent the request is refused (forbidden, not found, ...), a retry will not fix it.
+func (e statusError) permanent() bool {
+	return e.code/100 == 4 && e.code != http.StatusRequestTimeout && e.code != http.StatusTooManyRequests
+}
+
+// retryDelay before the first retry, doubled after each failure up to maxRetryDelay, like the downloads.
+var retryDelay = time.Second
+
+const maxRetryDelay = 30 * time.Second
+
+// retry the request until it succeed, it is refused, or after the retries.
+func retry(ctx context.Context, retries int, fn func() error) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		var serr statusError
+		if err == nil || (errors.As(err, &serr) && serr.permanent()) || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		slog.Warn("upload failed, retrying", "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// openFile the body of an upload, with its size.
+func openFile(file string) (*os.File, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	if fi.IsDir() {
+		_ = f.Close()
+		return nil, 0, errors.New("only the files can be uploaded")
+	}
+	return f, fi.Size(), nil
+}
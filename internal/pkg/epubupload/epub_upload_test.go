@@ -0,0 +1,124 @@
+package epubupload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestUploadRetry the failed requests are sent again whole, until the retries, the refused ones are not.
+func TestUploadRetry(t *testing.T) {
+	retryDelay = time.Millisecond
+	t.Cleanup(func() {
+		retryDelay = time.Second
+	})
+	file := filepath.Join(t.TempDir(), "book.epub")
+	if err := os.WriteFile(file, []byte("epub content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		retries  int
+		requests int
+		ok       bool
+	}{
+		{"success", []int{200}, 2, 1, true},
+		{"retried", []int{503, 429, 200}, 2, 3, true},
+		{"too many failures", []int{503, 503, 503, 200}, 2, 3, false},
+		{"refused", []int{403, 200}, 2, 1, false},
+		{"no retry", []int{503, 200}, 0, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if b, _ := io.ReadAll(r.Body); string(b) != "epub content" {
+					t.Errorf("request %d: body %q", requests, b)
+				}
+				w.WriteHeader(tc.statuses[min(requests, len(tc.statuses)-1)])
+				requests++
+			}))
+			defer srv.Close()
+			t.Setenv("AWS_ACCESS_KEY_ID", "id")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+			t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+			_, err := Upload(context.Background(), "s3://bucket/comics/", file, tc.retries)
+			if (err == nil) != tc.ok || requests != tc.requests {
+				t.Errorf("%d requests, error %v", requests, err)
+			}
+		})
+	}
+}
+
+// TestGdriveReceived the resumable session give the bytes received, or the file once complete.
+func TestGdriveReceived(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		rng      string
+		received int64
+		complete bool
+		err      bool
+	}{
+		{"partial", http.StatusPermanentRedirect, "bytes=0-99", 100, false, false},
+		{"nothing", http.StatusPermanentRedirect, "", 0, false, false},
+		{"complete", http.StatusOK, "", 1000, true, false},
+		{"bad range", http.StatusPermanentRedirect, "bytes=0-x", 0, false, true},
+		{"expired", http.StatusNotFound, "", 0, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Range") != "bytes */1000" {
+					t.Errorf("content range %q", r.Header.Get("Content-Range"))
+				}
+				if tc.rng != "" {
+					w.Header().Set("Range", tc.rng)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			received, resp, err := gdriveReceived(context.Background(), srv.URL, 1000)
+			if resp != nil {
+				_ = resp.Body.Close()
+			}
+			if received != tc.received || (resp != nil) != tc.complete || (err != nil) != tc.err {
+				t.Errorf("received %d, response %v, error %v", received, resp != nil, err)
+			}
+		})
+	}
+}
+
+// TestDropboxOffset the offset of the session is read from the error of an append at another offset only.
+func TestDropboxOffset(t *testing.T) {
+	conflict := func(body string) error {
+		return statusError{http.MethodPost, "https://content.dropboxapi.com", "409 Conflict", http.StatusConflict, []byte(body)}
+	}
+	for _, tc := range []struct {
+		name   string
+		err    error
+		offset int64
+		ok     bool
+	}{
+		{"incorrect offset", conflict(`{"error_summary": "incorrect_offset/..", "error": {".tag": "incorrect_offset", "correct_offset": 134217728}}`), 134217728, true},
+		{"other conflict", conflict(`{"error_summary": "closed/..", "error": {".tag": "closed"}}`), 0, false},
+		{"not json", conflict("conflict"), 0, false},
+		{"other status", statusError{code: http.StatusServiceUnavailable}, 0, false},
+		{"network", &url.Error{Op: "Post", URL: "https://content.dropboxapi.com", Err: errors.New("connection reset")}, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if offset, ok := dropboxOffset(tc.err); offset != tc.offset || ok != tc.ok {
+				t.Errorf("offset %d %v, want %d %v", offset, ok, tc.offset, tc.ok)
+			}
+		})
+	}
+}
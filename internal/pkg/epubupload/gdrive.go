@@ -0,0 +1,249 @@
+package epubupload
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gdrive upload by a resumable session into the folder, on a drive or a shared drive.
+type gdrive struct{}
+
+// serviceAccount the fields of the json key of a service account.
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+}
+
+func (gdrive) check(u *url.URL) error {
+	if u.Host == "" {
+		return errors.New("google drive folder missing: gdrive://folder_id/")
+	}
+	_, err := env("GOOGLE_DRIVE_TOKEN", "GOOGLE_APPLICATION_CREDENTIALS")
+	return err
+}
+
+// token the access token, signed with the key of the service account if any.
+func (gdrive) token(ctx context.Context) (string, error) {
+	if t := os.Getenv("GOOGLE_DRIVE_TOKEN"); t != "" {
+		return t, nil
+	}
+	b, err := os.ReadFile(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	if err != nil {
+		return "", err
+	}
+	var sa serviceAccount
+	if err = json.Unmarshal(b, &sa); err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return "", errors.New("invalid private key of the service account")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("the private key of the service account should be rsa")
+	}
+
+	now := time.Now().Unix()
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   sa.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/drive",
+		"aud":   sa.TokenUri,
+		"iat":   now,
+		"exp":   now + 3600,
+	})
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, rsaKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + enc.EncodeToString(signature)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sa.TokenUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var t struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&t)
+	return t.AccessToken, err
+}
+
+func (g gdrive) upload(ctx context.Context, u *url.URL, file string, name string, retries int) (string, error) {
+	f, size, err := openFile(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var token string
+	if err = retry(ctx, retries, func() (err error) {
+		token, err = g.token(ctx)
+		return
+	}); err != nil {
+		return "", err
+	}
+	request := func(method, endpoint string, body []byte) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		}
+		return do(req)
+	}
+	const api = "https://www.googleapis.com/drive/v3/files"
+	const uploadApi = "https://www.googleapis.com/upload/drive/v3/files"
+
+	// the file of the same name is updated, to keep its id and its sharing
+	escape := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+	q := url.Values{
+		"q":                         {fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false", escape(name), escape(u.Host))},
+		"fields":                    {"files(id)"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	var list struct {
+		Files []struct {
+			Id string `json:"id"`
+		} `json:"files"`
+	}
+	if err = retry(ctx, retries, func() error {
+		resp, err := request(http.MethodGet, api+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return json.NewDecoder(resp.Body).Decode(&list)
+	}); err != nil {
+		return "", err
+	}
+
+	var session string
+	if err = retry(ctx, retries, func() error {
+		var resp *http.Response
+		var err error
+		if len(list.Files) > 0 {
+			resp, err = request(http.MethodPatch, uploadApi+"/"+list.Files[0].Id+"?uploadType=resumable&supportsAllDrives=true", []byte("{}"))
+		} else {
+			metadata, _ := json.Marshal(map[string]any{"name": name, "parents": []string{u.Host}})
+			resp, err = request(http.MethodPost, uploadApi+"?uploadType=resumable&supportsAllDrives=true", metadata)
+		}
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		session = resp.Header.Get("Location")
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	if session == "" {
+		return "", errors.New("google drive did not return the upload session")
+	}
+
+	// after a failure, the session resume from the bytes received
+	var uploaded struct {
+		Id string `json:"id"`
+	}
+	attempted := false
+	if err = retry(ctx, retries, func() error {
+		var start int64
+		if attempted {
+			received, resp, err := gdriveReceived(ctx, session, size)
+			if err != nil {
+				return err
+			}
+			if resp != nil {
+				defer resp.Body.Close()
+				return json.NewDecoder(resp.Body).Decode(&uploaded)
+			}
+			start = received
+		}
+		attempted = true
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, io.NewSectionReader(f, start, size-start))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = size - start
+		req.Header.Set("Content-Type", "application/epub+zip")
+		if start > 0 {
+			req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+		}
+		resp, err := do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return json.NewDecoder(resp.Body).Decode(&uploaded)
+	}); err != nil {
+		return "", err
+	}
+	return "https://drive.google.com/file/d/" + uploaded.Id + "/view", nil
+}
+
+// gdriveReceived the number of bytes received by the resumable session, or the response of the file if it is complete.
+func gdriveReceived(ctx context.Context, session string, size int64) (int64, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, http.NoBody)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case resp.StatusCode/100 == 2:
+		return size, resp, nil
+	case resp.StatusCode != http.StatusPermanentRedirect:
+		return 0, nil, newStatusError(req, resp)
+	}
+	// 308 Resume Incomplete, with the range received: bytes=0-N, none if nothing
+	_ = resp.Body.Close()
+	r := resp.Header.Get("Range")
+	if r == "" {
+		return 0, nil, nil
+	}
+	_, last, ok := strings.Cut(r, "-")
+	n, err := strconv.ParseInt(last, 10, 64)
+	if !ok || err != nil {
+		return 0, nil, fmt.Errorf("google drive: unexpected range %q", r)
+	}
+	return n + 1, nil, nil
+}
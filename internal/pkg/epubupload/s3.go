@@ -0,0 +1,152 @@
+package epubupload
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// s3 put the object with a signature v4, on AWS or an S3 compatible storage (MinIO, R2, ...).
+type s3 struct{}
+
+func (s3) check(u *url.URL) error {
+	if u.Host == "" {
+		return errors.New("s3 bucket missing: s3://bucket/prefix/")
+	}
+	if _, err := env("AWS_ACCESS_KEY_ID"); err != nil {
+		return err
+	}
+	if _, err := env("AWS_SECRET_ACCESS_KEY"); err != nil {
+		return err
+	}
+	if _, err := env("AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ENDPOINT_URL"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s3) upload(ctx context.Context, u *url.URL, file string, name string, retries int) (string, error) {
+	f, size, err := openFile(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// the endpoint of AWS use the bucket as host, the compatible storages use it as path
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	key := strings.TrimPrefix(folder(u), "/") + name
+	var endpoint string
+	if e := os.Getenv("AWS_ENDPOINT_URL"); e != "" {
+		endpoint = strings.TrimSuffix(e, "/") + "/" + u.Host + "/" + key
+		if region == "" {
+			region = "us-east-1"
+		}
+	} else {
+		endpoint = "https://" + u.Host + ".s3." + region + ".amazonaws.com/" + key
+	}
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	// the escaping of the signature: every byte except the unreserved ones and the slashes
+	target.RawPath = uriEncode(target.Path)
+
+	// the whole object is sent again, signed again
+	err = retry(ctx, retries, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/epub+zip")
+		sign(req, region, time.Now().UTC())
+		resp, err := do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+	return "s3://" + u.Host + "/" + key, nil
+}
+
+// sign the request for s3 with the credentials of the environment, the payload is not hashed (https).
+func sign(req *http.Request, region string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	signed := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("X-Amz-Security-Token") != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	signV4(req, region, "s3", signed, "UNSIGNED-PAYLOAD", now)
+}
+
+// signV4 set the authorization of the request with the credentials of the environment,
+// for the headers signed, lowercase and sorted, and the hash of the payload.
+func signV4(req *http.Request, region, service string, signed []string, payload string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	var headers strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		strings.Join(signed, ";"),
+		payload,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := []byte("AWS4" + os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSha256(key, s)
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+os.Getenv("AWS_ACCESS_KEY_ID")+"/"+scope+
+		", SignedHeaders="+strings.Join(signed, ";")+
+		", Signature="+hex.EncodeToString(hmacSha256(key, toSign)))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode the path like the signature v4.
+func uriEncode(p string) string {
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,307 @@
+// Package epubvalidate structural checks of a generated EPUB, reported like EPUBCheck.
+//
+// it does not replace EPUBCheck, it catches the mistakes of the templates that only show on the devices:
+// the mimetype, the container, the metadata, the consistency of the manifest and the spine, and the broken links.
+package epubvalidate
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	Error   = "ERROR"
+	Warning = "WARNING"
+)
+
+// coreImageTypes the images displayed by all the EPUB 3 readers.
+var coreImageTypes = []string{"image/gif", "image/jpeg", "image/png", "image/svg+xml", "image/webp"}
+
+// Message a problem found in the EPUB.
+type Message struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"` // code of the same check in EPUBCheck
+	Path     string `json:"path"` // file of the EPUB, empty for the EPUB itself
+	Text     string `json:"message"`
+}
+
+// String format the message like EPUBCheck: ERROR(RSC-007): book.epub/OEBPS/toc.xhtml: ...
+func (m Message) String() string {
+	return fmt.Sprintf("%s(%s): %s: %s", m.Severity, m.Code, m.Path, m.Text)
+}
+
+type opfPackage struct {
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Metadata         struct {
+		Titles      []string        `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Languages   []string        `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Identifiers []opfIdentifier `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+		Metas       []opfMeta       `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		Id         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IdRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type opfIdentifier struct {
+	Id    string `xml:"id,attr"`
+	Value string `xml:",chardata"`
+}
+
+type opfMeta struct {
+	Property string `xml:"property,attr"`
+}
+
+type validator struct {
+	name     string
+	files    map[string]*zip.File
+	messages []Message
+}
+
+func (v *validator) add(severity, code, file, format string, args ...any) {
+	v.messages = append(v.messages, Message{severity, code, path.Join(v.name, file), fmt.Sprintf(format, args...)})
+}
+
+// Validate check the EPUB, the error is only returned if the file can't be read.
+func Validate(filename string) ([]Message, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	v := &validator{name: path.Base(strings.ReplaceAll(filename, "\\", "/")), files: map[string]*zip.File{}}
+	for _, f := range r.File {
+		v.files[f.Name] = f
+	}
+
+	v.checkMimetype(r.File)
+	rootFile := v.checkContainer()
+	if rootFile == "" {
+		return v.messages, nil
+	}
+	if opf, ok := v.checkPackage(rootFile); ok {
+		v.checkLinks(rootFile, opf)
+	}
+	return v.messages, nil
+}
+
+// checkMimetype the first file, stored without compression.
+func (v *validator) checkMimetype(files []*zip.File) {
+	if len(files) == 0 || files[0].Name != "mimetype" {
+		v.add(Error, "PKG-006", "", "Mimetype file entry is missing or is not the first file in the archive.")
+		return
+	}
+	data, err := read(files[0])
+	if err != nil || string(data) != "application/epub+zip" || files[0].Method != zip.Store || len(files[0].Extra) > 0 {
+		v.add(Error, "PKG-007", "mimetype", "Mimetype file should only contain the string \"application/epub+zip\" and should not be compressed.")
+	}
+}
+
+// checkContainer return the path of the package document.
+func (v *validator) checkContainer() string {
+	f, ok := v.files["META-INF/container.xml"]
+	if !ok {
+		v.add(Error, "RSC-002", "", "Required META-INF/container.xml resource could not be found.")
+		return ""
+	}
+	var container struct {
+		RootFiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := decode(f, &container); err != nil {
+		v.add(Error, "RSC-005", f.Name, "Error while parsing file: %v", err)
+		return ""
+	}
+	if len(container.RootFiles) == 0 || container.RootFiles[0].FullPath == "" {
+		v.add(Error, "OPF-016", f.Name, "The rootfile element is missing the required full-path attribute.")
+		return ""
+	}
+	rootFile := container.RootFiles[0].FullPath
+	if _, ok = v.files[rootFile]; !ok {
+		v.add(Error, "OPF-002", f.Name, "The OPF file %q was not found in the EPUB container.", rootFile)
+		return ""
+	}
+	return rootFile
+}
+
+// checkPackage the metadata, the manifest and the spine.
+func (v *validator) checkPackage(rootFile string) (opf opfPackage, ok bool) {
+	if err := decode(v.files[rootFile], &opf); err != nil {
+		v.add(Error, "RSC-005", rootFile, "Error while parsing file: %v", err)
+		return
+	}
+
+	// metadata
+	m := opf.Metadata
+	if len(m.Titles) == 0 || strings.TrimSpace(m.Titles[0]) == "" {
+		v.add(Error, "RSC-005", rootFile, "Error while parsing file: element \"metadata\" missing required element \"dc:title\".")
+	}
+	if len(m.Languages) == 0 || strings.TrimSpace(m.Languages[0]) == "" {
+		v.add(Error, "RSC-005", rootFile, "Error while parsing file: element \"metadata\" missing required element \"dc:language\".")
+	}
+	if !slices.ContainsFunc(m.Identifiers, func(i opfIdentifier) bool {
+		return i.Id == opf.UniqueIdentifier && strings.TrimSpace(i.Value) != ""
+	}) {
+		v.add(Error, "OPF-030", rootFile, "The unique-identifier %q was not found.", opf.UniqueIdentifier)
+	}
+	if !slices.ContainsFunc(m.Metas, func(meta opfMeta) bool {
+		return meta.Property == "dcterms:modified"
+	}) {
+		v.add(Error, "RSC-005", rootFile, "Error while parsing file: package dcterms:modified meta element must occur exactly once.")
+	}
+
+	// manifest
+	base := path.Dir(rootFile)
+	ids := map[string]struct{}{}
+	hrefs := map[string]struct{}{rootFile: {}}
+	navs := 0
+	for _, item := range opf.Manifest {
+		if _, dup := ids[item.Id]; dup {
+			v.add(Error, "RSC-005", rootFile, "Error while parsing file: Duplicate id %q.", item.Id)
+		}
+		ids[item.Id] = struct{}{}
+		href := path.Join(base, item.Href)
+		if _, dup := hrefs[href]; dup {
+			v.add(Error, "OPF-074", rootFile, "Package resource %q is declared in several manifest item.", item.Href)
+		}
+		hrefs[href] = struct{}{}
+		if _, exists := v.files[href]; !exists {
+			v.add(Error, "RSC-001", rootFile, "File %q could not be found.", href)
+		}
+		if item.MediaType == "" {
+			v.add(Error, "RSC-005", rootFile, "Error while parsing file: element \"item\" missing required attribute \"media-type\".")
+		}
+		// the images without fallback, like the avif, are only displayed by the readers supporting them
+		if strings.HasPrefix(item.MediaType, "image/") && !slices.Contains(coreImageTypes, item.MediaType) {
+			v.add(Warning, "RSC-032", rootFile, "Fallback must be provided for foreign resources, but found none for resource %q of type %q.", item.Href, item.MediaType)
+		}
+		if slices.Contains(strings.Fields(item.Properties), "nav") {
+			navs++
+		}
+	}
+	if navs != 1 {
+		v.add(Error, "RSC-005", rootFile, "Error while parsing file: Exactly one manifest item must declare the \"nav\" property (number of \"nav\" items: %d).", navs)
+	}
+	for _, name := range slices.Sorted(maps.Keys(v.files)) {
+		if _, declared := hrefs[name]; !declared && name != "mimetype" && !strings.HasPrefix(name, "META-INF/") && !strings.HasSuffix(name, "/") {
+			v.add(Warning, "OPF-003", name, "Item %q exists in the EPUB, but is not declared in the OPF manifest.", name)
+		}
+	}
+
+	// spine
+	if len(opf.Spine.ItemRefs) == 0 {
+		v.add(Error, "RSC-005", rootFile, "Error while parsing file: element \"spine\" incomplete; missing required element \"itemref\".")
+	}
+	if opf.Spine.Toc != "" {
+		if _, exists := ids[opf.Spine.Toc]; !exists {
+			v.add(Error, "OPF-049", rootFile, "Item id %q was not found in the manifest.", opf.Spine.Toc)
+		}
+	}
+	for _, ref := range opf.Spine.ItemRefs {
+		if _, exists := ids[ref.IdRef]; !exists {
+			v.add(Error, "OPF-049", rootFile, "Item id %q was not found in the manifest.", ref.IdRef)
+		}
+	}
+	return opf, true
+}
+
+// checkLinks the links and the images of the xhtml, the navigation and the ncx files.
+func (v *validator) checkLinks(rootFile string, opf opfPackage) {
+	base := path.Dir(rootFile)
+	for _, item := range opf.Manifest {
+		switch item.MediaType {
+		case "application/xhtml+xml", "application/x-dtbncx+xml":
+		default:
+			continue
+		}
+		name := path.Join(base, item.Href)
+		f, ok := v.files[name]
+		if !ok {
+			continue
+		}
+		links, err := links(f)
+		if err != nil {
+			v.add(Error, "RSC-005", name, "Error while parsing file: %v", err)
+			continue
+		}
+		for _, link := range links {
+			target := path.Join(path.Dir(name), link)
+			if _, exists := v.files[target]; !exists {
+				v.add(Error, "RSC-007", name, "Referenced resource %q could not be found in the EPUB.", target)
+			}
+		}
+	}
+}
+
+// links the local resources referenced by the file, without their fragment.
+func links(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	result := make([]string, 0)
+	d := xml.NewDecoder(rc)
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		el, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range el.Attr {
+			if attr.Name.Local != "href" && attr.Name.Local != "src" {
+				continue
+			}
+			link, _, _ := strings.Cut(attr.Value, "#")
+			// external or in the same file
+			if link == "" || strings.Contains(link, ":") {
+				continue
+			}
+			result = append(result, link)
+		}
+	}
+}
+
+func read(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func decode(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
@@ -7,23 +7,32 @@ package epubzip
 
 import (
 	"archive/zip"
+	"context"
+	"io"
 	"os"
 	"time"
 )
 
 type EPUBZip struct {
-	w  *os.File
+	w  *countWriter
 	wz *zip.Writer
 }
 
 // New create a new EPUB
-func New(path string) (EPUBZip, error) {
+func New(ctx context.Context, path string) (EPUBZip, error) {
 	w, err := os.Create(path)
 	if err != nil {
 		return EPUBZip{}, err
 	}
-	wz := zip.NewWriter(w)
-	return EPUBZip{w, wz}, nil
+	return NewWriter(ctx, w), nil
+}
+
+// NewWriter create a new EPUB streamed into w, closed with the EPUB if it is an io.Closer.
+//
+// the writes fail once the context is done.
+func NewWriter(ctx context.Context, w io.Writer) EPUBZip {
+	cw := &countWriter{ctx: ctx, w: w}
+	return EPUBZip{cw, zip.NewWriter(cw)}
 }
 
 // Close compress pipe and file.
@@ -31,7 +40,30 @@ func (e EPUBZip) Close() error {
 	if err := e.wz.Close(); err != nil {
 		return err
 	}
-	return e.w.Close()
+	if c, ok := e.w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Size of the EPUB written so far.
+func (e EPUBZip) Size() int64 {
+	return e.w.n
+}
+
+type countWriter struct {
+	ctx context.Context
+	w   io.Writer
+	n   int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // WriteMagic Write mimetype, in a very specific way.
@@ -66,6 +98,22 @@ func (e EPUBZip) Copy(fz *zip.File) error {
 	return e.wz.Copy(fz)
 }
 
+// CopyAs copy the file under another name, without compressing it again.
+func (e EPUBZip) CopyAs(fz *zip.File, name string) error {
+	r, err := fz.OpenRaw()
+	if err != nil {
+		return err
+	}
+	fh := fz.FileHeader
+	fh.Name = name
+	w, err := e.wz.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
 // WriteRaw Write image. They are already compressed, so we write them down directly.
 func (e EPUBZip) WriteRaw(raw Image) error {
 	m, err := e.wz.CreateRaw(raw.Header)
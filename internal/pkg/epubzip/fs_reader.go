@@ -0,0 +1,50 @@
+package epubzip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+)
+
+// FSReader a zip archive opened from a file system.
+type FSReader struct {
+	*zip.Reader
+	f fs.File
+}
+
+// OpenFSReader open the zip archive of the file system.
+//
+// the archive is read in place if the file support random access (disk, embed, ...), loaded in memory otherwise.
+func OpenFSReader(fsys fs.FS, name string) (*FSReader, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	ra, ok := f.(io.ReaderAt)
+	size := fi.Size()
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+	r, err := zip.NewReader(ra, size)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &FSReader{r, f}, nil
+}
+
+func (r *FSReader) Close() error {
+	return r.f.Close()
+}
@@ -7,9 +7,14 @@ import (
 	"fmt"
 	"hash/crc32"
 	"image"
-	"image/jpeg"
 	"image/png"
 	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageavif"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageicc"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagejpeg"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagewebp"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
 )
 
 type Image struct {
@@ -17,54 +22,52 @@ type Image struct {
 	Data   []byte
 }
 
-// CompressImage create gzip encoded jpeg
-func CompressImage(filename string, format string, img image.Image, quality int) (Image, error) {
+// EncodeImage encode the image into the format (jpeg, png, webp, avif or registered), jpeg with the jpegBackend (go or libjpeg)
+//
+// the webp is lossless if set, the avif is encoded with the speed (0-10) through the tempDir, a registered webp or avif encoder replace the built-in one.
+// the iccProfile is embedded into jpeg if provided.
+func EncodeImage(format string, jpegBackend string, img image.Image, quality int, lossless bool, speed int, tempDir string, iccProfile []byte) ([]byte, error) {
 	var (
-		data, cdata bytes.Buffer
-		err         error
+		data bytes.Buffer
+		err  error
 	)
 
 	switch format {
 	case "png":
 		err = png.Encode(&data, img)
 	case "jpeg":
-		err = jpeg.Encode(&data, img, &jpeg.Options{Quality: quality})
+		err = epubimagejpeg.Encode(jpegBackend, &data, img, quality)
 	default:
-		err = fmt.Errorf("unknown format %q", format)
+		if e, ok := epuboptions.LookupEncoder(format); ok {
+			err = e.Encode(&data, img, quality)
+		} else if format == "webp" {
+			err = epubimagewebp.Encode(&data, img, quality, lossless)
+		} else if format == "avif" {
+			err = epubimageavif.Encode(&data, img, quality, speed, tempDir)
+		} else {
+			err = fmt.Errorf("unknown format %q", format)
+		}
 	}
 	if err != nil {
-		return Image{}, err
+		return nil, err
 	}
 
-	wcdata, err := flate.NewWriter(&cdata, flate.BestCompression)
-	if err != nil {
-		return Image{}, err
+	if format == "jpeg" && iccProfile != nil {
+		return epubimageicc.EmbedJpeg(data.Bytes(), iccProfile), nil
 	}
 
-	_, err = wcdata.Write(data.Bytes())
-	if err != nil {
-		return Image{}, err
-	}
+	return data.Bytes(), nil
+}
 
-	err = wcdata.Close()
+// CompressImage create gzip encoded jpeg
+//
+// the iccProfile is embedded into jpeg if provided.
+func CompressImage(filename string, format string, jpegBackend string, img image.Image, quality int, lossless bool, speed int, tempDir string, iccProfile []byte) (Image, error) {
+	data, err := EncodeImage(format, jpegBackend, img, quality, lossless, speed, tempDir, iccProfile)
 	if err != nil {
 		return Image{}, err
 	}
-
-	t := time.Now()
-	//goland:noinspection GoDeprecation
-	return Image{
-		&zip.FileHeader{
-			Name:               filename,
-			CompressedSize64:   uint64(cdata.Len()),
-			UncompressedSize64: uint64(data.Len()),
-			CRC32:              crc32.Checksum(data.Bytes(), crc32.IEEETable),
-			Method:             zip.Deflate,
-			ModifiedTime:       uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11),
-			ModifiedDate:       uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9),
-		},
-		cdata.Bytes(),
-	}, nil
+	return CompressRaw(filename, data)
 }
 
 func CompressRaw(filename string, uncompressedData []byte) (Image, error) {
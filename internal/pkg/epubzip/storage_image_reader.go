@@ -2,6 +2,8 @@ package epubzip
 
 import (
 	"archive/zip"
+	"bytes"
+	"fmt"
 	"os"
 )
 
@@ -13,24 +15,45 @@ type StorageImageReader struct {
 	files map[string]*zip.File
 }
 
-func NewStorageImageReader(filename string) (StorageImageReader, error) {
+// NewStorageImageReader open the storage, the one kept in memory if inMemory, never the disk then.
+func NewStorageImageReader(filename string, inMemory bool) (StorageImageReader, error) {
+	if inMemory {
+		memoryStoragesMu.Lock()
+		buf, ok := memoryStorages[filename]
+		memoryStoragesMu.Unlock()
+		if !ok {
+			return StorageImageReader{}, fmt.Errorf("storage %s not found in memory", filename)
+		}
+		fz, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			return StorageImageReader{}, err
+		}
+		return newStorageImageReader(filename, nil, fz), nil
+	}
+
 	fh, err := os.Open(filename)
 	if err != nil {
 		return StorageImageReader{}, err
 	}
 	s, err := fh.Stat()
 	if err != nil {
+		_ = fh.Close()
 		return StorageImageReader{}, err
 	}
 	fz, err := zip.NewReader(fh, s.Size())
 	if err != nil {
+		_ = fh.Close()
 		return StorageImageReader{}, err
 	}
+	return newStorageImageReader(filename, fh, fz), nil
+}
+
+func newStorageImageReader(filename string, fh *os.File, fz *zip.Reader) StorageImageReader {
 	files := map[string]*zip.File{}
 	for _, z := range fz.File {
 		files[z.Name] = z
 	}
-	return StorageImageReader{filename, fh, fz, files}, nil
+	return StorageImageReader{filename, fh, fz, files}
 }
 
 func (e StorageImageReader) Get(filename string) *zip.File {
@@ -45,9 +68,25 @@ func (e StorageImageReader) Size(filename string) uint64 {
 }
 
 func (e StorageImageReader) Close() error {
+	if e.fh == nil {
+		return nil
+	}
 	return e.fh.Close()
 }
 
 func (e StorageImageReader) Remove() error {
+	if e.fh == nil {
+		memoryStoragesMu.Lock()
+		defer memoryStoragesMu.Unlock()
+		delete(memoryStorages, e.filename)
+		return nil
+	}
 	return os.Remove(e.filename)
 }
+
+// RemoveMemory release the storage kept in memory under the filename, of a failed conversion.
+func RemoveMemory(filename string) {
+	memoryStoragesMu.Lock()
+	defer memoryStoragesMu.Unlock()
+	delete(memoryStorages, filename)
+}
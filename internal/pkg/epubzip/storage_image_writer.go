@@ -2,11 +2,22 @@ package epubzip
 
 import (
 	"archive/zip"
+	"bytes"
 	"image"
 	"os"
 	"sync"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageavif"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagejpeg"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
 )
 
+// StorageImageWriter temporary storage of the processed images.
+//
+// the entries are written to the disk as they are added, through the small buffer of the zip writer.
+//
+// in memory, the storage is kept under its filename until removed, without touching the disk:
+// the filename is then a key unique by conversion (see EPUBOptions.ImgStorage).
 type StorageImageWriter struct {
 	fh     *os.File
 	fz     *zip.Writer
@@ -14,16 +25,31 @@ type StorageImageWriter struct {
 	mut    *sync.Mutex
 }
 
-func NewStorageImageWriter(filename string, format string) (StorageImageWriter, error) {
+var (
+	memoryStoragesMu sync.Mutex
+	memoryStorages   = map[string]*bytes.Buffer{}
+)
+
+func NewStorageImageWriter(filename string, format string, inMemory bool) (StorageImageWriter, error) {
+	if inMemory {
+		buf := &bytes.Buffer{}
+		memoryStoragesMu.Lock()
+		memoryStorages[filename] = buf
+		memoryStoragesMu.Unlock()
+		return StorageImageWriter{nil, zip.NewWriter(buf), format, &sync.Mutex{}}, nil
+	}
 	fh, err := os.Create(filename)
 	if err != nil {
-		return StorageImageWriter{}, err
+		return StorageImageWriter{}, utils.WithExitCode(err, utils.ExitOutput)
 	}
 	fz := zip.NewWriter(fh)
 	return StorageImageWriter{fh, fz, format, &sync.Mutex{}}, nil
 }
 
 func (e StorageImageWriter) Close() error {
+	if e.fh == nil {
+		return e.fz.Close()
+	}
 	if err := e.fz.Close(); err != nil {
 		_ = e.fh.Close()
 		return err
@@ -32,32 +58,23 @@ func (e StorageImageWriter) Close() error {
 }
 
 func (e StorageImageWriter) Add(filename string, img image.Image, quality int) error {
-	zipImage, err := CompressImage(filename, e.format, img, quality)
+	zipImage, err := CompressImage(filename, e.format, epubimagejpeg.Go, img, quality, false, epubimageavif.DefaultSpeed, "", nil)
 	if err != nil {
 		return err
 	}
-
-	e.mut.Lock()
-	defer e.mut.Unlock()
-	fh, err := e.fz.CreateRaw(zipImage.Header)
-	if err != nil {
-		return err
-	}
-	_, err = fh.Write(zipImage.Data)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return e.AddCompressed(zipImage)
 }
 
 func (e StorageImageWriter) AddRaw(filename string, uncompressedData []byte) error {
 	zipImage, err := CompressRaw(filename, uncompressedData)
-
 	if err != nil {
 		return err
 	}
+	return e.AddCompressed(zipImage)
+}
 
+// AddCompressed add an image already compressed, the compression can be done concurrently outside the writer.
+func (e StorageImageWriter) AddCompressed(zipImage Image) error {
 	e.mut.Lock()
 	defer e.mut.Unlock()
 	fh, err := e.fz.CreateRaw(zipImage.Header)
@@ -65,9 +82,12 @@ func (e StorageImageWriter) AddRaw(filename string, uncompressedData []byte) err
 		return err
 	}
 	_, err = fh.Write(zipImage.Data)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
-	return nil
+// Copy an entry of another storage as is, without decompressing it.
+func (e StorageImageWriter) Copy(f *zip.File) error {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	return e.fz.Copy(f)
 }
@@ -0,0 +1,79 @@
+/*
+Package i18n translate the messages of the command line: the help, the progress and the errors.
+
+The messages are their english text, translated if the catalog of the language has them,
+the missing ones stay in english. The language is set with -lang, or detected from the locale
+(LC_ALL, LC_MESSAGES, LANG).
+*/
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Languages supported, english first
+var Languages = []string{"en", "fr", "ja"}
+
+var catalogs = map[string]map[string]string{
+	"fr": fr,
+	"ja": ja,
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(Detect())
+}
+
+// Detect the language from the locale, english if not supported.
+func Detect() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(env)
+		if locale == "" {
+			continue
+		}
+		// fr_FR.UTF-8, ja_JP, C
+		parts := strings.FieldsFunc(locale, func(r rune) bool {
+			return r == '_' || r == '.' || r == '-' || r == '@'
+		})
+		if len(parts) > 0 && slices.Contains(Languages, strings.ToLower(parts[0])) {
+			return strings.ToLower(parts[0])
+		}
+		return "en"
+	}
+	return "en"
+}
+
+// SetLang select the language of the messages, empty to detect it from the locale.
+func SetLang(lang string) error {
+	if lang == "" {
+		lang = Detect()
+	}
+	if !slices.Contains(Languages, lang) {
+		return fmt.Errorf("lang should be %s", strings.Join(Languages, ", "))
+	}
+	current.Store(lang)
+	return nil
+}
+
+// Lang selected.
+func Lang() string {
+	return current.Load().(string)
+}
+
+// T translate the message.
+func T(msg string) string {
+	if t, ok := catalogs[Lang()][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// Sprintf translate the format, then format the message.
+func Sprintf(format string, a ...any) string {
+	return fmt.Sprintf(T(format), a...)
+}
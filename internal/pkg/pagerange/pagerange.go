@@ -0,0 +1,98 @@
+/*
+Package pagerange select the pages of the input to convert.
+
+The selection is a list of pages and ranges separated by a comma, the pages are numbered from 1 once sorted:
+  - 45: the page 45
+  - 1-20: the pages 1 to 20
+  - 100-: the page 100 and the next ones
+  - -5: the pages 1 to 5
+
+Example:
+
+	r, _ := pagerange.Parse("1-20,45,100-")
+	images = pagerange.Filter(r, images)
+*/
+package pagerange
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range of pages, To is 0 for the last page.
+type Range struct {
+	From, To int
+}
+
+// Ranges selected, empty to select all the pages.
+type Ranges []Range
+
+// Parse the selection, empty to select all the pages.
+func Parse(s string) (Ranges, error) {
+	r := make(Ranges, 0)
+	if strings.TrimSpace(s) == "" {
+		return r, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		var err error
+		var p Range
+		if p.From, err = page(from, isRange); err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+		if !isRange {
+			p.To = p.From
+		} else if p.To, err = page(to, true); err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+		p.From = max(1, p.From)
+		if p.To != 0 && p.To < p.From {
+			return nil, fmt.Errorf("%q: the end is before the start", part)
+		}
+		r = append(r, p)
+	}
+	return r, nil
+}
+
+// page number, 0 if empty and optional.
+func page(s string, optional bool) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" && optional {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, errors.New("a page should be a number >= 1")
+	}
+	return n, nil
+}
+
+// Contains the page, numbered from 1.
+func (r Ranges) Contains(page int) bool {
+	if len(r) == 0 {
+		return true
+	}
+	for _, p := range r {
+		if page >= p.From && (p.To == 0 || page <= p.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter the sorted items, only the selected pages are kept in the same order.
+func Filter[T any](r Ranges, items []T) []T {
+	if len(r) == 0 {
+		return items
+	}
+	res := make([]T, 0, len(items))
+	for i, item := range items {
+		if r.Contains(i + 1) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/i18n"
+)
+
+// ErrCancelled Returned when a confirmation is refused.
+var ErrCancelled = errors.New("cancelled")
+
+// Interactive the standard input is a terminal, a user may answer a question.
+func Interactive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Confirm ask the question on the terminal before a destructive action, the default answer is no.
+//
+// the action is confirmed without asking with -yes, or without a terminal (scripts, GUI): they run like before the prompts.
+func Confirm(yes bool, format string, a ...any) bool {
+	if yes || !Interactive() {
+		return true
+	}
+	Printf(i18n.T(format)+" "+i18n.T("[y/N]")+" ", a...)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes", i18n.T("y"), i18n.T("yes"):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "errors"
+
+// ErrUnsupportedFormat Returned when the input is not a directory or a supported archive.
+var ErrUnsupportedFormat = errors.New("unknown file format")
+
+// DecodeError an image of the input that can't be read, when it can't be replaced by an error page.
+type DecodeError struct {
+	Page string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return "error processing image " + e.Page + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
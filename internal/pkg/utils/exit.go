@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"os"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/i18n"
+)
+
+// Exit codes, to let the scripts react to the failure.
+const (
+	ExitOk          = 0
+	ExitError       = 1   // unexpected error
+	ExitPartial     = 2   // some archives of the batch failed, the others are converted
+	ExitUsage       = 3   // bad arguments
+	ExitInput       = 4   // the input can't be read
+	ExitNoImages    = 5   // the input has no images
+	ExitOutput      = 6   // the output can't be written
+	ExitInterrupted = 130 // Ctrl-C
+)
+
+// ErrNoImagesFound Returned when the input has no supported images.
+var ErrNoImagesFound = errors.New("no images found")
+
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// WithExitCode mark the error with the exit code of the program, the message is unchanged.
+//
+// an error already marked keep its code: the closest to the failure is the most precise.
+func WithExitCode(err error, code int) error {
+	var e exitError
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	return exitError{err, code}
+}
+
+// ExitCode of the error: the code it is marked with, or the one of the known errors.
+func ExitCode(err error) int {
+	var e exitError
+	switch {
+	case err == nil:
+		return ExitOk
+	case errors.Is(err, ErrInterrupted):
+		return ExitInterrupted
+	case errors.Is(err, ErrNoImagesFound):
+		return ExitNoImages
+	case errors.As(err, &e):
+		return e.code
+	}
+	return ExitError
+}
+
+// Exit print the error and exit with its code.
+func Exit(err error) {
+	Printf(i18n.T("Error: %v\n"), i18n.T(err.Error()))
+	os.Exit(ExitCode(err))
+}
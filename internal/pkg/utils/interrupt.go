@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// ErrInterrupted Returned when the conversion stop after an interruption (Ctrl-C).
+var ErrInterrupted = errors.New("interrupted")
+
+var interrupted atomic.Bool
+
+// HandleInterrupt On Ctrl-C, let the workers finish their current image and stop, to clean up the temporary files.
+//
+// a second Ctrl-C exit immediately.
+func HandleInterrupt() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		interrupted.Store(true)
+		Println("\nInterrupted, cleaning up... (Ctrl-C again to force)")
+		<-c
+		os.Exit(ExitInterrupted)
+	}()
+}
+
+// Interrupted Check if the conversion should stop.
+func Interrupted() bool {
+	return interrupted.Load()
+}
@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package utils
+
+import "errors"
+
+// SetNice is not supported on this system.
+func SetNice(int) error {
+	return errors.New("nice is not supported on this system")
+}
@@ -0,0 +1,29 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package utils
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// SetNice lower the priority of the process, from 0 (normal) to 19 (lowest).
+//
+// on linux the priority is per thread, it is set on all the threads of the process, the new ones inherit it.
+func SetNice(nice int) error {
+	if tasks, err := os.ReadDir("/proc/self/task"); err == nil {
+		for _, task := range tasks {
+			tid, err := strconv.Atoi(task.Name())
+			if err != nil {
+				continue
+			}
+			// the thread may have exited
+			if err = syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil && err != syscall.ESRCH {
+				return err
+			}
+		}
+		return nil
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice)
+}
@@ -4,26 +4,17 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 func Printf(format string, a ...interface{}) {
 	_, _ = fmt.Fprintf(os.Stderr, format, a...)
 }
 
-func Fatalf(format string, args ...interface{}) {
-	Printf(format, args...)
-	os.Exit(1)
-}
-
 func Println(a ...interface{}) {
 	_, _ = fmt.Fprintln(os.Stderr, a...)
 }
 
-func Fatalln(a ...interface{}) {
-	Println(a...)
-	os.Exit(1)
-}
-
 func IntToString(i int) string {
 	return strconv.FormatInt(int64(i), 10)
 }
@@ -54,3 +45,18 @@ func NumberOfDigits(i int) int {
 func FormatNumberOfDigits(i int) string {
 	return "%0" + IntToString(NumberOfDigits(i)) + "d"
 }
+
+// AvailableMemoryMb Memory available for new processes, 0 if unknown (only linux is supported).
+func AvailableMemoryMb() int {
+	b, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, _ := strconv.Atoi(fields[1])
+			return kb / 1024
+		}
+	}
+	return 0
+}
@@ -8,13 +8,28 @@ EPUB is now support by Amazon through [SendToKindle](https://www.amazon.com/gp/s
 package main
 
 import (
-	"encoding/json"
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/tcnksm/go-latest"
+	"gopkg.in/yaml.v3"
 
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubevent"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageprocessor"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epublog"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubmode"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubserver"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubstats"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/i18n"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
 	"github.com/ppkhoa/go-comic-converter/v3/pkg/epub"
 )
@@ -30,12 +45,22 @@ func main() {
 	switch {
 	case cmd.Options.Version:
 		version()
+	case cmd.Options.Doctor:
+		doctor(cmd)
+	case cmd.Options.Profiles:
+		profiles(cmd)
 	case cmd.Options.Save:
 		save(cmd)
 	case cmd.Options.Show:
 		show(cmd)
+	case cmd.Options.ShowEffective:
+		showEffective(cmd)
 	case cmd.Options.Reset:
 		reset(cmd)
+	case cmd.Options.ImportKCC != "":
+		importKCC(cmd)
+	case cmd.Options.Clean:
+		clean(cmd)
 	default:
 		generate(cmd)
 	}
@@ -45,7 +70,7 @@ func main() {
 func version() {
 	bi, ok := debug.ReadBuildInfo()
 	if !ok {
-		utils.Fatalln("failed to fetch current version")
+		utils.Exit(errors.New("failed to fetch current version"))
 	}
 
 	githubTag := &latest.GithubTag{
@@ -54,10 +79,10 @@ func version() {
 	}
 	v, err := githubTag.Fetch()
 	if err != nil {
-		utils.Fatalln("failed to fetch the latest version")
+		utils.Exit(fmt.Errorf("failed to fetch the latest version: %w", err))
 	}
 	if len(v.Versions) < 1 {
-		utils.Fatalln("no versions found")
+		utils.Exit(errors.New("no versions found"))
 	}
 	latestVersion := v.Versions[0]
 
@@ -80,6 +105,9 @@ $ go install github.com/celogeek/go-comic-converter/v%d@%s
 }
 
 func save(cmd *converter.Converter) {
+	if _, err := os.Stat(cmd.Options.FileName()); err == nil && !utils.Confirm(cmd.Options.Yes, "Overwrite the default settings of %s?", cmd.Options.FileName()) {
+		utils.Exit(utils.ErrCancelled)
+	}
 	if err := cmd.Options.SaveConfig(); err != nil {
 		cmd.Fatal(err)
 	}
@@ -91,11 +119,78 @@ func save(cmd *converter.Converter) {
 	)
 }
 
+func doctor(cmd *converter.Converter) {
+	items := cmd.Doctor()
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Doctor, items)
+		return
+	}
+	utils.Printf("%s", converter.DoctorString(items))
+}
+
+// profiles list the devices and the named profiles, as tables or a json line.
+func profiles(cmd *converter.Converter) {
+	info, err := cmd.ProfilesInfo()
+	if err != nil {
+		utils.Exit(err)
+	}
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Profiles, info)
+		return
+	}
+	utils.Printf("%s", converter.ProfilesInfoString(info))
+}
+
 func show(cmd *converter.Converter) {
 	utils.Println(cmd.Options.Header(), cmd.Options.ShowConfig())
 }
 
+// importKCC save the options of KCC as a named profile.
+func importKCC(cmd *converter.Converter) {
+	name := cmp.Or(cmd.Options.ProfileName, "kcc")
+	r, err := converter.ImportKCC(cmd.Options.ImportKCC)
+	if err != nil {
+		utils.Exit(utils.WithExitCode(err, utils.ExitUsage))
+	}
+	config, err := converter.LoadUserConfig()
+	if err != nil {
+		utils.Exit(err)
+	}
+	if _, ok := config.Profiles[name]; ok && !utils.Confirm(cmd.Options.Yes, "Overwrite the profile %s?", name) {
+		utils.Exit(utils.ErrCancelled)
+	}
+	if err = converter.SaveProfileName(name, r.Profile, r.Device); err != nil {
+		utils.Exit(err)
+	}
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	_ = enc.Encode(map[string]any{name: r.Profile})
+	utils.Printf("Profile saved into %s:\n\n%s\n", converter.ConfigFileName(), b.String())
+	if r.Device != nil {
+		utils.Printf("Device added: %s\n\n", r.Device)
+	}
+	if len(r.Ignored) > 0 {
+		utils.Printf("Options of KCC without equivalent: %s\n\n", strings.Join(r.Ignored, ", "))
+	}
+	utils.Printf("Use it with: go-comic-converter -profile-name %s -input ...\n", name)
+}
+
+// showEffective print the merged options on stdout, to debug which setting applied.
+func showEffective(cmd *converter.Converter) {
+	b, err := cmd.EffectiveConfig()
+	if err != nil {
+		utils.Exit(err)
+	}
+	fmt.Println(string(b))
+}
+
 func reset(cmd *converter.Converter) {
+	// the named profiles and the custom devices are removed too
+	if !utils.Confirm(cmd.Options.Yes, "Reset the default settings of %s?", cmd.Options.FileName()) {
+		utils.Exit(utils.ErrCancelled)
+	}
 	if err := cmd.Options.ResetConfig(); err != nil {
 		cmd.Fatal(err)
 	}
@@ -107,10 +202,135 @@ func reset(cmd *converter.Converter) {
 	)
 }
 
+// clean remove the temporary files left by the runs that died, the cached pages,
+// and with -clean-outputs the EPUB of the batch mode whose archive no longer exists.
+//
+// with -dry, the files are only listed.
+func clean(cmd *converter.Converter) {
+	dry := cmd.Options.Dry
+	report := map[string]any{"dry": dry}
+	removed := i18n.T("removed")
+	if dry {
+		removed = i18n.T("to remove")
+	}
+
+	// the manifests of the runs that died list their files, the others are found by their name
+	temp := make([]string, 0)
+	if !dry {
+		temp = append(temp, epubtemp.Cleanup()...)
+	}
+	dirs := []string{cmp.Or(cmd.Options.TempDir, os.TempDir())}
+	for _, p := range []string{cmd.Options.Input, cmd.Options.Output} {
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			dirs = append(dirs, p)
+		} else if p != "" {
+			dirs = append(dirs, filepath.Dir(p))
+		}
+	}
+	for _, path := range epubtemp.Orphans(dirs...) {
+		if dry || os.RemoveAll(path) == nil {
+			temp = append(temp, path)
+		}
+	}
+	report["temp"] = temp
+	if !cmd.Options.Json {
+		utils.Printf(i18n.T("Temporary files: %d %s\n"), len(temp), removed)
+		for _, path := range temp {
+			utils.Printf("  %s\n", path)
+		}
+	}
+
+	if cmd.Options.CacheDir != "" {
+		var size int64
+		files, err := epubimageprocessor.CleanCache(cmd.Options.CacheDir, true)
+		if err == nil {
+			size = filesSize(files)
+			if !dry {
+				files, err = epubimageprocessor.CleanCache(cmd.Options.CacheDir, false)
+			}
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			utils.Exit(err)
+		}
+		report["cache"] = map[string]any{"dir": cmd.Options.CacheDir, "files": len(files), "size": size}
+		if !cmd.Options.Json {
+			utils.Printf(i18n.T("Cache %s: %d files %s (%.1f Mb)\n"), cmd.Options.CacheDir, len(files), removed, float64(size)/1024/1024)
+		}
+	}
+
+	if cmd.Options.CleanOutputs {
+		outputs, err := epubmode.CleanOutputs(cmd, dry)
+		if err != nil {
+			utils.Exit(err)
+		}
+		report["outputs"] = outputs
+		if !cmd.Options.Json {
+			utils.Printf(i18n.T("EPUB of the archives deleted: %d %s\n"), len(outputs), removed)
+			for _, path := range outputs {
+				utils.Printf("  %s\n", path)
+			}
+		}
+	}
+
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Clean, report)
+	}
+}
+
+// filesSize the total size of the files.
+func filesSize(files []string) (size int64) {
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			size += fi.Size()
+		}
+	}
+	return
+}
+
 func generate(cmd *converter.Converter) {
+	closeLog, err := epublog.Setup(epublog.Options{
+		Verbose:     cmd.Options.Verbose,
+		VeryVerbose: cmd.Options.VeryVerbose,
+		Quiet:       cmd.Options.Quiet,
+		Json:        cmd.Options.Json,
+		File:        cmd.Options.LogFile,
+	})
+	if err != nil {
+		utils.Exit(err)
+	}
+	defer func() {
+		_ = closeLog()
+	}()
+
+	// the previous runs that died left their temporary files
+	for _, f := range epubtemp.Cleanup() {
+		slog.Info("removed temporary file of a previous run", "file", f)
+	}
+
+	downloaded, err := cmd.Download()
+	if err != nil {
+		utils.Exit(err)
+	}
+	if downloaded != "" {
+		epubtemp.Track(downloaded)
+		defer func() {
+			_ = os.Remove(downloaded)
+			epubtemp.Untrack(downloaded)
+		}()
+	}
+
 	if err := cmd.Validate(); err != nil {
 		cmd.Fatal(err)
 	}
+	// the batch mode replace the outdated EPUB by design
+	if !cmd.Options.Batch && !cmd.Options.Dry && !cmd.Options.Json && cmd.Options.Preview == "" && cmd.Options.Serve == "" {
+		if outputs := cmd.Options.ExistingOutputs(); len(outputs) > 0 && !utils.Confirm(cmd.Options.Yes, "Overwrite %s?", strings.Join(outputs, ", ")) {
+			utils.Exit(utils.ErrCancelled)
+		}
+	}
+	if err := cmd.LimitCpu(); err != nil {
+		utils.Exit(utils.WithExitCode(err, utils.ExitUsage))
+	}
 
 	if profile := cmd.Options.GetProfile(); profile != nil {
 		cmd.Options.Image.View.Width = profile.Width
@@ -118,17 +338,210 @@ func generate(cmd *converter.Converter) {
 	}
 
 	if cmd.Options.Json {
-		_ = json.NewEncoder(os.Stdout).Encode(map[string]any{
-			"type": "options", "data": cmd.Options,
-		})
+		epubevent.Emit(epubevent.Options, cmd.Options)
 	} else {
 		utils.Println(cmd.Options)
 	}
 
-	if err := epub.New(cmd.Options.EPUBOptions).Write(); err != nil {
-		utils.Fatalf("Error: %v\n", err)
+	stopProfiling, err := cmd.StartProfiling()
+	if err != nil {
+		utils.Exit(err)
+	}
+	defer func() {
+		if err := stopProfiling(); err != nil {
+			utils.Exit(err)
+		}
+	}()
+
+	var stats *epubstats.Collector
+	if (cmd.Options.Summary || cmd.Options.SummaryFile != "") && !cmd.Options.Dry {
+		stats = epubstats.New()
+		cmd.Options.OnStats = stats.Add
+	}
+
+	utils.HandleInterrupt()
+	if cmd.Options.Estimate && cmd.Options.Compare == "" && cmd.Options.Preview == "" {
+		estimate(cmd)
+		if utils.Interrupted() {
+			_ = stopProfiling()
+			os.Exit(utils.ExitInterrupted)
+		}
+	}
+	failed := 0
+	if cmd.Options.Compare != "" {
+		compare(cmd)
+	} else if cmd.Options.Preview != "" {
+		preview(cmd)
+	} else if cmd.Options.Serve != "" {
+		serve(cmd)
+	} else if cmd.Options.Daemon != "" {
+		err = epubmode.Daemon(cmd)
+	} else if cmd.Options.Queue != "" {
+		failed, err = epubmode.Queue(cmd)
+	} else if cmd.Options.Library {
+		failed, err = epubmode.Library(cmd)
+	} else if cmd.Options.Watch {
+		epubmode.Watch(cmd)
+	} else if cmd.Options.Batch {
+		failed, err = epubmode.Batch(cmd)
+	} else if err = epub.New(cmd.Options.EPUBOptions).Write(); errors.Is(err, utils.ErrInterrupted) {
+		utils.Println(i18n.T("Conversion interrupted"))
+		err = nil
+	}
+	if err != nil {
+		utils.Exit(err)
+	}
+	// the books converted before an interruption are in the summary
+	if stats != nil {
+		summary(cmd, stats.Summary())
+	}
+	if utils.Interrupted() {
+		_ = stopProfiling()
+		os.Exit(utils.ExitInterrupted)
 	}
 	if !cmd.Options.Dry {
 		cmd.Stats()
 	}
+	// partial failure of the batch, the other archives are converted
+	if failed > 0 {
+		_ = stopProfiling()
+		os.Exit(utils.ExitPartial)
+	}
+}
+
+// summary show the stats of the conversions, and export them into the summary file.
+func summary(cmd *converter.Converter, s epubstats.Summary) {
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Summary, s)
+	} else if cmd.Options.Summary {
+		utils.Printf("%s\n%s\n", i18n.T("Summary:"), s)
+	}
+	if cmd.Options.SummaryFile != "" {
+		if err := s.WriteFile(cmd.Options.SummaryFile); err != nil {
+			utils.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+// preview write a few processed pages as PNG, to check the settings before a conversion.
+func preview(cmd *converter.Converter) {
+	pages, err := epubimageprocessor.Preview(cmd.Options.EPUBOptions, cmd.Options.Preview, cmd.Options.PreviewPages)
+	if errors.Is(err, utils.ErrInterrupted) {
+		utils.Println("Preview interrupted")
+		return
+	} else if err != nil {
+		utils.Exit(err)
+	}
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Preview, pages)
+		return
+	}
+	utils.Println("Preview:")
+	for _, p := range pages {
+		utils.Printf("  - %s (%s): %s\n", p.Path, p.Reason, strings.Join(p.Files, ", "))
+	}
+}
+
+// estimate show the projected size and duration of the conversion, and the limits exceeded.
+func estimate(cmd *converter.Converter) {
+	est, err := epubimageprocessor.Estimate(cmd.Options.EPUBOptions)
+	if errors.Is(err, utils.ErrInterrupted) {
+		utils.Println("Estimate interrupted")
+		return
+	} else if err != nil {
+		utils.Exit(err)
+	}
+	parts, warnings := cmd.Options.EstimateLimits(est.Size)
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Estimate, map[string]any{
+			"pages":       est.Pages,
+			"sampled":     est.Sampled,
+			"size":        est.Size,
+			"duration_ms": est.DurationMs,
+			"parts":       parts,
+			"warnings":    warnings,
+		})
+		return
+	}
+	size := fmt.Sprintf("%.1f Mb", float64(est.Size)/1024/1024)
+	if parts > 1 {
+		size += fmt.Sprintf(" in %d parts", parts)
+	}
+	utils.Printf(
+		"Estimate: %s, %s for %d pages (%d sampled)\n",
+		size, (time.Duration(est.DurationMs) * time.Millisecond).Round(time.Second), est.Pages, est.Sampled,
+	)
+	for _, w := range warnings {
+		utils.Printf("Warning: %s\n", w)
+	}
+}
+
+// compare write the pages of the preview processed with the current and the compared options side by side.
+func compare(cmd *converter.Converter) {
+	other, err := cmd.CompareOptions()
+	if err != nil {
+		utils.Exit(utils.WithExitCode(err, utils.ExitUsage))
+	}
+	pages, err := epubimageprocessor.Compare(cmd.Options.EPUBOptions, other.EPUBOptions, cmd.Options.Preview, cmd.Options.PreviewPages)
+	if errors.Is(err, utils.ErrInterrupted) {
+		utils.Println("Compare interrupted")
+		return
+	} else if err != nil {
+		utils.Exit(err)
+	}
+	if cmd.Options.Json {
+		epubevent.Emit(epubevent.Compare, pages)
+		return
+	}
+
+	var sizeA, sizeB int
+	utils.Printf("Compare: current options on the left, with %q on the right\n", cmd.Options.Compare)
+	for _, p := range pages {
+		utils.Printf(
+			"  - %s p%d (%s): %dx%d %d Kb %.1f dB | %dx%d %d Kb %.1f dB -> %s\n",
+			p.Path, p.Part, p.Reason,
+			p.A.Width, p.A.Height, p.A.Size/1024, p.A.PSNR,
+			p.B.Width, p.B.Height, p.B.Size/1024, p.B.PSNR,
+			p.File,
+		)
+		sizeA += p.A.Size
+		sizeB += p.B.Size
+	}
+	if sizeA > 0 {
+		utils.Printf("Total: %d Kb | %d Kb (%+.0f%%)\n", sizeA/1024, sizeB/1024, float64(sizeB-sizeA)/float64(sizeA)*100)
+	}
+}
+
+// serve the web UI, the api and the OPDS catalog until Ctrl-C, the conversions use the options of the command line as defaults.
+func serve(cmd *converter.Converter) {
+	info, err := cmd.ProfilesInfo()
+	if err != nil {
+		utils.Exit(err)
+	}
+	profiles := make([]epubserver.Profile, 0, len(info.Devices))
+	for _, d := range info.Devices {
+		profiles = append(profiles, epubserver.Profile{Code: d.Code, Description: d.Description, Width: d.Width, Height: d.Height})
+	}
+	s, err := epubserver.New(epubserver.Options{
+		Addr:      cmd.Options.Serve,
+		UI:        cmd.Options.UI,
+		API:       cmd.Options.API,
+		Token:     cmd.Options.APIToken,
+		OPDS:      cmd.Options.OPDS,
+		OPDSCache: cmd.Options.Output,
+		EPUB:      cmd.Options.EPUBOptions,
+		Profile:   cmd.Options.Profile,
+		Profiles:  profiles,
+		Workers:   cmd.Options.BatchWorkers,
+		Keep:      cmd.Options.ServeKeep,
+		TempDir:   cmd.Options.TempDir,
+		Metrics:   cmd.Options.Metrics,
+		Quiet:     cmd.Options.Quiet || cmd.Options.Json,
+	})
+	if err != nil {
+		utils.Exit(err)
+	}
+	if err := s.Run(); err != nil {
+		utils.Exit(err)
+	}
 }
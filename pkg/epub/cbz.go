@@ -0,0 +1,113 @@
+package epub
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubhook"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// cbzComicInfo the ComicInfo.xml of the CBZ, for the readers and the libraries of comics.
+type cbzComicInfo struct {
+	XMLName   xml.Name `xml:"ComicInfo"`
+	Title     string   `xml:"Title"`
+	Series    string   `xml:"Series,omitempty"`
+	Writer    string   `xml:"Writer,omitempty"`
+	Publisher string   `xml:"Publisher,omitempty"`
+	PageCount int      `xml:"PageCount"`
+	Manga     string   `xml:"Manga,omitempty"`
+}
+
+// allPages the cover, if any, then the pages of all the parts.
+func (e epub) allPages(epubParts []epubPart) ([]epubimage.EPUBImage, error) {
+	pages := make([]epubimage.EPUBImage, 0)
+	if e.Image.HasCover {
+		pages = append(pages, epubParts[0].Cover)
+	}
+	for _, part := range epubParts {
+		for _, img := range part.Images.All() {
+			pages = append(pages, img)
+		}
+		if err := part.Images.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// writeCBZ write the processed pages into a CBZ next to the output, with sequential names: 001.jpeg, 002.jpeg...
+//
+// the parts of the EPUB are gathered into a single archive, without the blank pages of the EPUB.
+// the archive is written aside then renamed, a conversion again replace it.
+func (e epub) writeCBZ(ctx context.Context, epubParts []epubPart, imgStorage epubzip.StorageImageReader) (epubhook.Output, error) {
+	start := time.Now()
+	output := e.CBZOutput()
+	if input, err := filepath.Abs(e.Input); e.InputFS == nil && err == nil {
+		if abs, _ := filepath.Abs(output); abs == input {
+			return epubhook.Output{}, fmt.Errorf("the CBZ %s would replace the input, choose another output", output)
+		}
+	}
+	pages, err := e.allPages(epubParts)
+	if err != nil {
+		return epubhook.Output{}, err
+	}
+
+	tmp := filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+".tmp")
+	wz, err := epubzip.New(ctx, tmp)
+	if err != nil {
+		return epubhook.Output{}, err
+	}
+	err = func() error {
+		info := cbzComicInfo{Title: e.Title, Series: e.Series, Writer: e.Author, Publisher: e.Publisher, PageCount: len(pages)}
+		if e.Image.Manga {
+			info.Manga = "YesAndRightToLeft"
+		}
+		b, _ := xml.MarshalIndent(info, "", "  ")
+		if err := wz.WriteContent("ComicInfo.xml", append([]byte(xml.Header), b...)); err != nil {
+			return err
+		}
+		fmtLen := max(3, len(utils.IntToString(len(pages))))
+		for i, img := range pages {
+			if utils.Interrupted() {
+				return utils.ErrInterrupted
+			}
+			f := imgStorage.Get(img.EPUBImgPath())
+			if f == nil {
+				return fmt.Errorf("image %d missing from the storage", img.Id)
+			}
+			if err := wz.CopyAs(f, fmt.Sprintf("%0*d.%s", fmtLen, i+1, img.Format)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if cerr := wz.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, output)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return epubhook.Output{}, err
+	}
+
+	slog.Info("cbz written", "input", e.Input, "output", output, "images", len(pages), "duration", time.Since(start))
+	return epubhook.Output{
+		Input: e.Input,
+		Path:  output,
+		Title: e.Title,
+		Pages: len(pages),
+		Size:  wz.Size(),
+		Part:  1,
+		Parts: 1,
+	}, nil
+}
@@ -3,23 +3,36 @@ package epub
 
 import (
 	"archive/zip"
+	"context"
+	"errors"
 	"fmt"
+	"iter"
+	"log/slog"
 	"math"
+	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/gofrs/uuid"
 
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubcalibre"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubevent"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubhook"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimagepassthrough"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimageprocessor"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubkindle"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubkobo"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubprogress"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemp"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtemplates"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubtree"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubupload"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubvalidate"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
 	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
 	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
@@ -27,6 +40,8 @@ import (
 
 type EPUB interface {
 	Write() error
+	// WriteContext stop the conversion once the context is done, the temporary files and the partial EPUB are removed.
+	WriteContext(ctx context.Context) error
 }
 
 type epub struct {
@@ -35,18 +50,22 @@ type epub struct {
 	Publisher string
 	UpdatedAt string
 
+	// settings of the conversion, embedded into each part
+	settings string
+
 	templateProcessor *template.Template
 	imageProcessor    epubimageprocessor.EPUBImageProcessor
 }
 
 type epubPart struct {
 	Cover  epubimage.EPUBImage
-	Images []epubimage.EPUBImage
+	Images epubimage.Index
 }
 
 // New initialize EPUB
 func New(options epuboptions.EPUBOptions) EPUB {
 	uid := uuid.Must(uuid.NewV4())
+	options.StorageId = uid.String()
 	tmpl := template.New("parser")
 	tmpl.Funcs(template.FuncMap{
 		"mod":  func(i, j int) bool { return i%j == 0 },
@@ -80,17 +99,31 @@ func (e epub) render(templateString string, data map[string]any) string {
 	return regexp.MustCompile("\n+").ReplaceAllString(result.String(), "\n")
 }
 
+// writeFile write the content generated for the data, adjusted by the template of the options with the same name if any.
+func (e epub) writeFile(wz epubzip.EPUBZip, file string, name string, data map[string]any, content string) error {
+	if t, ok := e.Templates[name]; ok && name != "" {
+		var err error
+		if content, err = t(data, content); err != nil {
+			return fmt.Errorf("template %s: %w", name, err)
+		}
+	}
+	return wz.WriteContent(file, []byte(content))
+}
+
+// writeTemplate render the built-in template and write it.
+func (e epub) writeTemplate(wz epubzip.EPUBZip, file string, name string, templateString string, data map[string]any) error {
+	return e.writeFile(wz, file, name, data, e.render(templateString, data))
+}
+
 // write image to the zip
 func (e epub) writeImage(wz epubzip.EPUBZip, img epubimage.EPUBImage, zipImg *zip.File) error {
-	err := wz.WriteContent(
-		img.EPUBPagePath(),
-		[]byte(e.render(epubtemplates.Text, map[string]any{
-			"Title":      "Image " + utils.IntToString(img.Id) + " Part " + utils.IntToString(img.Part),
-			"ViewPort":   e.Image.View.Port(),
-			"ImagePath":  img.ImgPath(),
-			"ImageStyle": img.ImgStyle(e.Image.View.Width, e.Image.View.Height, ""),
-		})),
-	)
+	err := e.writeTemplate(wz, img.EPUBPagePath(), epuboptions.TemplatePage, epubtemplates.Text, map[string]any{
+		"Title":      "Image " + utils.IntToString(img.Id) + " Part " + utils.IntToString(img.Part),
+		"ViewPort":   e.Image.View.Port(),
+		"ImagePath":  img.ImgPath(),
+		"ImageStyle": img.ImgStyle(e.Image.View.Width, e.Image.View.Height, ""),
+		"KEPUB":      e.KEPUB(),
+	})
 	if err == nil {
 		err = wz.Copy(zipImg)
 	}
@@ -99,14 +132,12 @@ func (e epub) writeImage(wz epubzip.EPUBZip, img epubimage.EPUBImage, zipImg *zi
 }
 
 // write blank page
-func (e epub) writeBlank(wz epubzip.EPUBZip, img epubimage.EPUBImage) error {
-	return wz.WriteContent(
-		img.EPUBSpacePath(),
-		[]byte(e.render(epubtemplates.Blank, map[string]any{
-			"Title":    "Blank Page " + utils.IntToString(img.Id),
-			"ViewPort": e.Image.View.Port(),
-		})),
-	)
+func (e epub) writeBlank(wz epubzip.EPUBZip, img epubimage.EPUBImage, path string) error {
+	return e.writeTemplate(wz, path, epuboptions.TemplateBlank, epubtemplates.Blank, map[string]any{
+		"Title":    "Blank Page " + utils.IntToString(img.Id),
+		"ViewPort": e.Image.View.Port(),
+		"KEPUB":    e.KEPUB(),
+	})
 }
 
 // write title image
@@ -118,15 +149,13 @@ func (e epub) writeCoverImage(wz epubzip.EPUBZip, img epubimage.EPUBImage, part,
 		title = title + " " + text
 	}
 
-	if err := wz.WriteContent(
-		"OEBPS/Text/cover.xhtml",
-		[]byte(e.render(epubtemplates.Text, map[string]any{
-			"Title":      title,
-			"ViewPort":   e.Image.View.Port(),
-			"ImagePath":  "Images/cover.jpeg",
-			"ImageStyle": img.ImgStyle(e.Image.View.Width, e.Image.View.Height, ""),
-		})),
-	); err != nil {
+	if err := e.writeTemplate(wz, "OEBPS/Text/cover.xhtml", epuboptions.TemplatePage, epubtemplates.Text, map[string]any{
+		"Title":      title,
+		"ViewPort":   e.Image.View.Port(),
+		"ImagePath":  "Images/cover.jpeg",
+		"ImageStyle": img.ImgStyle(e.Image.View.Width, e.Image.View.Height, ""),
+		"KEPUB":      e.KEPUB(),
+	}); err != nil {
 		return err
 	}
 
@@ -164,26 +193,22 @@ func (e epub) writeTitleImage(wz epubzip.EPUBZip, img epubimage.EPUBImage, title
 	}
 
 	if !e.Image.View.PortraitOnly {
-		if err := wz.WriteContent(
-			"OEBPS/Text/space_title.xhtml",
-			[]byte(e.render(epubtemplates.Blank, map[string]any{
-				"Title":    "Blank Page Title",
-				"ViewPort": e.Image.View.Port(),
-			})),
-		); err != nil {
+		if err := e.writeTemplate(wz, "OEBPS/Text/space_title.xhtml", epuboptions.TemplateBlank, epubtemplates.Blank, map[string]any{
+			"Title":    "Blank Page Title",
+			"ViewPort": e.Image.View.Port(),
+			"KEPUB":    e.KEPUB(),
+		}); err != nil {
 			return err
 		}
 	}
 
-	if err := wz.WriteContent(
-		"OEBPS/Text/title.xhtml",
-		[]byte(e.render(epubtemplates.Text, map[string]any{
-			"Title":      title,
-			"ViewPort":   e.Image.View.Port(),
-			"ImagePath":  "Images/title.jpeg",
-			"ImageStyle": img.ImgStyle(e.Image.View.Width, e.Image.View.Height, titleAlign),
-		})),
-	); err != nil {
+	if err := e.writeTemplate(wz, "OEBPS/Text/title.xhtml", epuboptions.TemplatePage, epubtemplates.Text, map[string]any{
+		"Title":      title,
+		"ViewPort":   e.Image.View.Port(),
+		"ImagePath":  "Images/title.jpeg",
+		"ImageStyle": img.ImgStyle(e.Image.View.Width, e.Image.View.Height, titleAlign),
+		"KEPUB":      e.KEPUB(),
+	}); err != nil {
 		return err
 	}
 
@@ -209,25 +234,19 @@ func (e epub) writeTitleImage(wz epubzip.EPUBZip, img epubimage.EPUBImage, title
 }
 
 // extract image and split it into part
-func (e epub) getParts() (parts []epubPart, imgStorage epubzip.StorageImageReader, err error) {
-	images, err := e.imageProcessor.Load()
-
+//
+// the parts are ranges of the index, sorted by id and part, their images are read back when each part is written.
+func (e epub) getParts(ctx context.Context) (parts []epubPart, index epubimage.Index, imgStorage epubzip.StorageImageReader, err error) {
+	index, err = e.imageProcessor.Load(ctx)
 	if err != nil {
 		return
 	}
 
-	// sort result by id and part
-	sort.Slice(images, func(i, j int) bool {
-		if images[i].Id == images[j].Id {
-			return images[i].Part < images[j].Part
-		}
-		return images[i].Id < images[j].Id
-	})
-
 	parts = make([]epubPart, 0)
-	cover := images[0]
+	images := index
+	cover := images.First()
 	if e.Image.HasCover || (cover.DoublePage && !e.Image.KeepDoublePageIfSplit) {
-		images = images[1:]
+		images = images.Slice(1, images.Len())
 	}
 
 	if e.Dry {
@@ -238,7 +257,7 @@ func (e epub) getParts() (parts []epubPart, imgStorage epubzip.StorageImageReade
 		return
 	}
 
-	imgStorage, err = epubzip.NewStorageImageReader(e.ImgStorage())
+	imgStorage, err = epubzip.NewStorageImageReader(e.ImgStorage(), e.InMemory)
 	if err != nil {
 		return
 	}
@@ -250,27 +269,28 @@ func (e epub) getParts() (parts []epubPart, imgStorage epubzip.StorageImageReade
 	baseSize := uint64(128*1024) + imgStorage.Size(cover.EPUBImgPath())*2
 
 	currentSize := baseSize
-	currentImages := make([]epubimage.EPUBImage, 0)
-	part := 1
+	start := 0
 
-	for _, img := range images {
+	for i, img := range images.All() {
 		imgSize := imgStorage.Size(img.EPUBImgPath()) + xhtmlSize
-		if maxSize > 0 && len(currentImages) > 0 && currentSize+imgSize > maxSize {
+		if maxSize > 0 && i > start && currentSize+imgSize > maxSize {
 			parts = append(parts, epubPart{
 				Cover:  cover,
-				Images: currentImages,
+				Images: images.Slice(start, i),
 			})
-			part += 1
 			currentSize = baseSize
-			currentImages = make([]epubimage.EPUBImage, 0)
+			start = i
 		}
 		currentSize += imgSize
-		currentImages = append(currentImages, img)
 	}
-	if len(currentImages) > 0 {
+	if err = images.Err(); err != nil {
+		_ = imgStorage.Close()
+		return
+	}
+	if start < images.Len() {
 		parts = append(parts, epubPart{
 			Cover:  cover,
-			Images: currentImages,
+			Images: images.Slice(start, images.Len()),
 		})
 	}
 
@@ -280,7 +300,7 @@ func (e epub) getParts() (parts []epubPart, imgStorage epubzip.StorageImageReade
 // create a tree from the directories.
 //
 // this is used to simulate the toc.
-func (e epub) getTree(images []epubimage.EPUBImage, skipFiles bool) string {
+func (e epub) getTree(images iter.Seq2[int, epubimage.EPUBImage], skipFiles bool) string {
 	t := epubtree.New()
 	for _, img := range images {
 		if skipFiles {
@@ -310,7 +330,7 @@ func (e epub) computeAspectRatio(epubParts []epubPart) float64 {
 
 	for _, p := range epubParts {
 		aspectRatio[trunc(p.Cover.OriginalAspectRatio)]++
-		for _, i := range p.Images {
+		for _, i := range p.Images.All() {
 			aspectRatio[trunc(i.OriginalAspectRatio)]++
 		}
 	}
@@ -344,16 +364,20 @@ func (e epub) computeViewPort(epubParts []epubPart) (int, int) {
 	}
 }
 
-func (e epub) writePart(path string, currentPart, totalParts int, part epubPart, imgStorage epubzip.StorageImageReader) error {
-	hasTitlePage := e.TitlePage == 1 || (e.TitlePage == 2 && totalParts > 1)
-
-	wz, err := epubzip.New(path)
+// createPart the EPUB of a part, a file or the writer of the options.
+func (e epub) createPart(ctx context.Context, path string, currentPart, totalParts int) (epubzip.EPUBZip, error) {
+	if e.OutputWriter == nil {
+		return epubzip.New(ctx, path)
+	}
+	w, err := e.OutputWriter(path, currentPart, totalParts)
 	if err != nil {
-		return err
+		return epubzip.EPUBZip{}, err
 	}
-	defer func(wz epubzip.EPUBZip) {
-		_ = wz.Close()
-	}(wz)
+	return epubzip.NewWriter(ctx, w), nil
+}
+
+func (e epub) writePart(wz epubzip.EPUBZip, currentPart, totalParts int, part epubPart, imgStorage epubzip.StorageImageReader) (err error) {
+	hasTitlePage := e.TitlePage == 1 || (e.TitlePage == 2 && totalParts > 1)
 
 	title := e.Title
 	if totalParts > 1 {
@@ -361,17 +385,35 @@ func (e epub) writePart(path string, currentPart, totalParts int, part epubPart,
 	}
 
 	type zipContent struct {
-		Name    string
-		Content string
+		Name     string
+		Content  string
+		Template string // name of the template of the options that may adjust it
+		Data     map[string]any
+	}
+	positions := make([]string, part.Images.Len())
+	meta := map[string]any{
+		"Title":     title,
+		"UID":       e.UID,
+		"Author":    e.Author,
+		"Series":    e.Series,
+		"Publisher": e.Publisher,
+		"UpdatedAt": e.UpdatedAt,
+		"Part":      currentPart,
+		"Parts":     totalParts,
+	}
+	style := map[string]any{
+		"View": e.Image.View,
 	}
 	content := []zipContent{
-		{"META-INF/container.xml", epubtemplates.Container},
-		{"META-INF/com.apple.ibooks.display-options.xml", epubtemplates.AppleBooks},
+		{"META-INF/container.xml", epubtemplates.Container, "", nil},
+		{"META-INF/com.apple.ibooks.display-options.xml", epubtemplates.AppleBooks, "", nil},
+		{SettingsFile, e.settings, "", nil},
 		{"OEBPS/content.opf", epubtemplates.Content{
 			Title:        title,
 			HasTitlePage: hasTitlePage,
 			UID:          e.UID,
 			Author:       e.Author,
+			Series:       e.Series,
 			Publisher:    e.Publisher,
 			UpdatedAt:    e.UpdatedAt,
 			ImageOptions: e.Image,
@@ -379,18 +421,17 @@ func (e epub) writePart(path string, currentPart, totalParts int, part epubPart,
 			Images:       part.Images,
 			Current:      currentPart,
 			Total:        totalParts,
-		}.String()},
-		{"OEBPS/toc.xhtml", epubtemplates.Toc(title, hasTitlePage, e.StripFirstDirectoryFromToc, part.Images)},
-		{"OEBPS/Text/style.css", e.render(epubtemplates.Style, map[string]any{
-			"View": e.Image.View,
-		})},
+			Positions:    positions,
+		}.String(), epuboptions.TemplateContent, meta},
+		{"OEBPS/toc.xhtml", epubtemplates.Toc(title, hasTitlePage, e.StripFirstDirectoryFromToc, part.Images), epuboptions.TemplateToc, meta},
+		{"OEBPS/Text/style.css", e.render(epubtemplates.Style, style), epuboptions.TemplateStyle, style},
 	}
 
 	if err = wz.WriteMagic(); err != nil {
 		return err
 	}
 	for _, c := range content {
-		if err := wz.WriteContent(c.Name, []byte(c.Content)); err != nil {
+		if err := e.writeFile(wz, c.Name, c.Template, c.Data, c.Content); err != nil {
 			return err
 		}
 	}
@@ -405,8 +446,12 @@ func (e epub) writePart(path string, currentPart, totalParts int, part epubPart,
 		}
 	}
 
-	lastImage := part.Images[len(part.Images)-1]
-	for _, img := range part.Images {
+	last := part.Images.Len() - 1
+	for i, img := range part.Images.All() {
+		if utils.Interrupted() {
+			return utils.ErrInterrupted
+		}
+		img.Position = positions[i]
 		if err := e.writeImage(wz, img, imgStorage.Get(img.EPUBImgPath())); err != nil {
 			return err
 		}
@@ -415,52 +460,229 @@ func (e epub) writePart(path string, currentPart, totalParts int, part epubPart,
 		if !e.Image.View.PortraitOnly &&
 			(img.DoublePage ||
 				(!e.Image.KeepDoublePageIfSplit && img.Part == 1) ||
-				(img.Part == 0 && img == lastImage)) {
-			if err := e.writeBlank(wz, img); err != nil {
+				(img.Part == 0 && i == last)) {
+			if err := e.writeBlank(wz, img, img.EPUBSpacePath()); err != nil {
+				return err
+			}
+		}
+		if !e.Image.View.PortraitOnly && img.HasEndSpace() {
+			if err := e.writeBlank(wz, img, img.EPUBEndSpacePath()); err != nil {
 				return err
 			}
 		}
 	}
-	return nil
+	return part.Images.Err()
 }
 
 // create the zip
+//
+// in json mode, the start and the end of the conversion are emitted as events, with the EPUB files written.
 func (e epub) Write() error {
-	epubParts, imgStorage, err := e.getParts()
+	return e.WriteContext(context.Background())
+}
+
+// WriteContext create the zip, until the context is done.
+func (e epub) WriteContext(ctx context.Context) error {
+	if !e.Json {
+		_, err := e.write(ctx)
+		return err
+	}
+
+	start := time.Now()
+	epubevent.Emit(epubevent.Start, map[string]any{
+		"input":  e.Input,
+		"output": e.Output,
+	})
+	outputs, err := e.write(ctx)
 	if err != nil {
+		epubevent.Emit(epubevent.Error, map[string]any{
+			"input":       e.Input,
+			"error":       err.Error(),
+			"interrupted": errors.Is(err, utils.ErrInterrupted),
+		})
 		return err
 	}
+	epubevent.Emit(epubevent.Finished, map[string]any{
+		"input":      e.Input,
+		"outputs":    outputs,
+		"elapsed_ms": time.Since(start).Milliseconds(),
+	})
+	return nil
+}
+
+// write the parts of the EPUB, return their path.
+func (e epub) write(ctx context.Context) (outputs []string, err error) {
+	start := time.Now()
+	if e.Mihon {
+		if err = e.checkMihonChapter(); err != nil {
+			return
+		}
+	}
+	epubParts, index, imgStorage, err := e.getParts(ctx)
+	if err != nil {
+		if e.InMemory {
+			epubzip.RemoveMemory(e.ImgStorage())
+		}
+		return
+	}
 
 	if e.Dry {
 		p := epubParts[0]
-		utils.Printf("TOC:\n  - %s\n%s\n", e.Title, e.getTree(p.Images, true))
+		utils.Printf("TOC:\n  - %s\n%s\n", e.Title, e.getTree(p.Images.All(), true))
 		if e.DryVerbose {
 			if e.Image.HasCover {
-				utils.Printf("Cover:\n%s\n", e.getTree([]epubimage.EPUBImage{p.Cover}, false))
+				utils.Printf("Cover:\n%s\n", e.getTree(slices.All([]epubimage.EPUBImage{p.Cover}), false))
 			}
-			utils.Printf("Files:\n%s\n", e.getTree(p.Images, false))
+			utils.Printf("Files:\n%s\n", e.getTree(p.Images.All(), false))
 		}
-		return nil
+		return
 	}
 	defer func() {
 		_ = imgStorage.Close()
+		if e.KeepTemp {
+			utils.Printf("Temporary files kept: %s, %s\n", e.ImgStorage(), e.ImgIndex())
+			return
+		}
 		_ = imgStorage.Remove()
+		_ = index.Remove()
+		epubtemp.Untrack(e.ImgStorage())
+		epubtemp.Untrack(e.ImgIndex())
 	}()
 
+	if e.Mihon {
+		chapter, err := e.writeMihon(epubParts, imgStorage)
+		if err != nil {
+			return nil, utils.WithExitCode(err, utils.ExitOutput)
+		}
+		return []string{chapter}, nil
+	}
+
 	totalParts := len(epubParts)
+	e.settings = e.settingsContent()
+	e.Image.View.Width, e.Image.View.Height = e.computeViewPort(epubParts)
+	written := make([]epubhook.Output, 0, totalParts)
+	if e.HasEPUB() {
+		if outputs, written, err = e.writeParts(ctx, epubParts, imgStorage); err != nil {
+			return nil, err
+		}
+	}
+
+	// display corrupted images
+	hasError := false
+	for pId, part := range epubParts {
+		if pId == 0 && e.Image.HasCover && part.Cover.Error != nil {
+			hasError = true
+			e.imageError(part.Cover)
+		}
+		for _, img := range part.Images.All() {
+			if img.Part == 0 && img.Error != nil {
+				hasError = true
+				e.imageError(img)
+			}
+		}
+	}
+	if hasError && !e.Json {
+		utils.Println()
+	}
+
+	if e.Validate && e.OutputWriter == nil {
+		if err = e.validate(outputs); err != nil {
+			return
+		}
+	}
+	// the EPUB validated is replaced by the AZW3 or the MOBI of the Kindle
+	if e.Kindle() && e.OutputWriter == nil {
+		for i, o := range written {
+			if written[i], err = epubkindle.Convert(e.OutputFormat, o); err != nil {
+				return nil, utils.WithExitCode(err, utils.ExitOutput)
+			}
+			outputs[i] = written[i].Path
+			e.volumeFinished(written[i])
+		}
+	}
+	// the CBZ gather the parts, it is uploaded and given to the post hook with them
+	files := written
+	if e.HasCBZ() && e.OutputWriter == nil {
+		var cbz epubhook.Output
+		if cbz, err = e.writeCBZ(ctx, epubParts, imgStorage); err != nil {
+			return nil, utils.WithExitCode(err, utils.ExitOutput)
+		}
+		outputs = append(outputs, cbz.Path)
+		files = append(slices.Clip(files), cbz)
+	}
+	if e.Upload != "" && e.OutputWriter == nil {
+		for _, o := range files {
+			if _, err = epubupload.Upload(ctx, e.Upload, o.Path, e.UploadRetries); err != nil {
+				return
+			}
+		}
+	}
+	if e.PostHook != "" && e.OutputWriter == nil {
+		for _, o := range files {
+			if err = epubhook.Run(e.PostHook, o); err != nil {
+				return
+			}
+		}
+	}
+	if e.Calibre != "" && e.OutputWriter == nil {
+		for _, o := range written {
+			if err = epubcalibre.Add(e.Calibre, o); err != nil {
+				return
+			}
+		}
+	}
+	if e.Kobo != "" && e.OutputWriter == nil {
+		// the parts are gathered in a collection like in the metadata of the EPUB
+		collection := e.Series
+		if collection == "" && totalParts > 1 {
+			collection = e.Title
+		}
+		ko := epubkobo.Options{Mount: e.Kobo, Collections: e.KoboCollections, Width: e.Image.View.Width, Height: e.Image.View.Height}
+		for _, o := range written {
+			if err = epubkobo.Deploy(ko, o, collection); err != nil {
+				return
+			}
+		}
+	}
+	if e.KindleMount != "" && e.Kindle() && e.OutputWriter == nil {
+		for _, o := range written {
+			if err = epubkindle.Deploy(e.KindleMount, o); err != nil {
+				return
+			}
+		}
+	}
+	if e.OnStats != nil {
+		e.OnStats(e.stats(index, files, time.Since(start)))
+	}
+	return
+}
+
+// writeParts write the parts of the EPUB, return their path and their details for the post steps.
+func (e epub) writeParts(ctx context.Context, epubParts []epubPart, imgStorage epubzip.StorageImageReader) (outputs []string, written []epubhook.Output, err error) {
+	totalParts := len(epubParts)
+	written = make([]epubhook.Output, 0, totalParts)
+	if totalParts > 1 && e.Json {
+		epubevent.Emit(epubevent.Split, map[string]any{
+			"input":    e.Input,
+			"parts":    totalParts,
+			"limit_mb": e.LimitMb,
+		})
+	}
 
 	bar := epubprogress.New(epubprogress.Options{
 		Max:         totalParts,
 		Description: "Writing Part",
+		Unit:        "parts",
 		CurrentJob:  2,
 		TotalJob:    2,
 		Quiet:       e.Quiet,
 		Json:        e.Json,
+		Backend:     e.Progress,
 	})
 
-	e.Image.View.Width, e.Image.View.Height = e.computeViewPort(epubParts)
+	output := e.EPUBOutput()
 	for i, part := range epubParts {
-		ext := filepath.Ext(e.Output)
+		ext := e.EPUBExt()
 		suffix := ""
 		if totalParts > 1 {
 			fmtLen := utils.FormatNumberOfDigits(totalParts)
@@ -468,42 +690,131 @@ func (e epub) Write() error {
 			suffix = fmt.Sprintf(fmtPart, i+1, totalParts)
 		}
 
-		path := e.Output[0:len(e.Output)-len(ext)] + suffix + ext
-
-		if err := e.writePart(
-			path,
-			i+1,
-			totalParts,
-			part,
-			imgStorage,
-		); err != nil {
-			return err
+		path := output[0:len(output)-len(ext)] + suffix + ext
+
+		start := time.Now()
+		wz, err := e.createPart(ctx, path, i+1, totalParts)
+		if err == nil {
+			err = e.writePart(
+				wz,
+				i+1,
+				totalParts,
+				part,
+				imgStorage,
+			)
+			if cerr := wz.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			// do not leave a partial epub
+			if e.OutputWriter == nil {
+				_ = os.Remove(path)
+			}
+			_ = bar.Close()
+			if errors.Is(err, utils.ErrInterrupted) && !e.Quiet {
+				utils.Printf("\nCompleted %d of %d parts\n", i, totalParts)
+			}
+			return nil, nil, utils.WithExitCode(err, utils.ExitOutput)
+		}
+		slog.Info("part written", "input", e.Input, "output", path, "images", part.Images.Len(), "duration", time.Since(start))
+		outputs = append(outputs, path)
+		size := wz.Size()
+		written = append(written, epubhook.Output{
+			Input: e.Input,
+			Path:  path,
+			Title: e.Title,
+			Pages: part.Images.Len(),
+			Size:  size,
+			Part:  i + 1,
+			Parts: totalParts,
+		})
+		// the EPUB for the Kindle is reported once converted
+		if !e.Kindle() || e.OutputWriter != nil {
+			e.volumeFinished(written[len(written)-1])
+		}
+		if e.Json {
+			epubevent.Emit(epubevent.Part, map[string]any{
+				"input":  e.Input,
+				"part":   i + 1,
+				"total":  totalParts,
+				"output": path,
+				"size":   size,
+			})
 		}
 
 		_ = bar.Add(1)
 	}
 	_ = bar.Close()
-	if !e.Json {
+	if !e.Json && e.Progress == nil {
 		utils.Println()
 	}
+	return outputs, written, nil
+}
 
-	// display corrupted images
-	hasError := false
-	for pId, part := range epubParts {
-		if pId == 0 && e.Image.HasCover && part.Cover.Error != nil {
-			hasError = true
-			utils.Printf("Error on image %s: %v\n", filepath.Join(part.Cover.Path, part.Cover.Name), part.Cover.Error)
+// volumeFinished call the OnVolumeFinished event with the final file of the part.
+func (e epub) volumeFinished(o epubhook.Output) {
+	if e.Events.OnVolumeFinished == nil {
+		return
+	}
+	e.Events.OnVolumeFinished(epuboptions.VolumeEvent{
+		Input:  o.Input,
+		Output: o.Path,
+		Title:  o.Title,
+		Part:   o.Part,
+		Parts:  o.Parts,
+		Pages:  o.Pages,
+		Size:   o.Size,
+	})
+}
+
+// validate the structure of the EPUB files, they are kept to be inspected.
+func (e epub) validate(outputs []string) error {
+	errorCount := 0
+	for _, output := range outputs {
+		messages, err := epubvalidate.Validate(output)
+		if err != nil {
+			return err
 		}
-		for _, img := range part.Images {
-			if img.Part == 0 && img.Error != nil {
-				hasError = true
-				utils.Printf("Error on image %s: %v\n", filepath.Join(img.Path, img.Name), img.Error)
+		for _, m := range messages {
+			if m.Severity == epubvalidate.Error {
+				errorCount++
+			}
+			if e.Events.OnWarning != nil {
+				e.Events.OnWarning(epuboptions.WarningEvent{Input: e.Input, Output: output, Page: m.Path, Message: m.Text})
+			}
+			if e.Json {
+				epubevent.Emit(epubevent.Warning, map[string]any{
+					"input":      e.Input,
+					"output":     output,
+					"page":       m.Path,
+					"message":    m.Text,
+					"validation": m,
+				})
+			} else {
+				utils.Println(m)
 			}
 		}
 	}
-	if hasError {
-		utils.Println()
+	if errorCount > 0 {
+		return fmt.Errorf("validation failed with %d errors", errorCount)
 	}
-
 	return nil
 }
+
+// imageError show a corrupted image, replaced by an error page, or emit it as a warning event.
+func (e epub) imageError(img epubimage.EPUBImage) {
+	page := filepath.Join(img.Path, img.Name)
+	if e.Events.OnWarning != nil {
+		e.Events.OnWarning(epuboptions.WarningEvent{Input: e.Input, Page: page, Message: img.Error.Error()})
+	}
+	if e.Json {
+		epubevent.Emit(epubevent.Warning, map[string]any{
+			"input":   e.Input,
+			"page":    page,
+			"message": img.Error.Error(),
+		})
+		return
+	}
+	utils.Printf("Error on image %s: %v\n", page, img.Error)
+}
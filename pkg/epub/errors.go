@@ -0,0 +1,15 @@
+package epub
+
+import "github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+
+// errors of the conversion, for errors.Is
+var (
+	ErrNoImages          = utils.ErrNoImagesFound     // the input has no supported images
+	ErrUnsupportedFormat = utils.ErrUnsupportedFormat // the input is not a directory or a supported archive
+	ErrInterrupted       = utils.ErrInterrupted       // stopped by Ctrl-C, the context give its own error
+)
+
+// DecodeError an image of the input that can't be read, for errors.As.
+//
+// a corrupted image is usually replaced by an error page, reported by the Events, without failing the conversion.
+type DecodeError = utils.DecodeError
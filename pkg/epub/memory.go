@@ -0,0 +1,78 @@
+package epub
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// ConvertFS convert the input, a path in the file system ("." for its root), into the bytes of the EPUB
+// without touching the disk, for the serverless and sandboxed environments.
+//
+// the processed images and the EPUB are kept in memory: a single EPUB is returned without size limit,
+// and the options writing files (cache, image hook, post hook, temporary files kept) are disabled.
+// The avif format is rejected, avifenc only read and write files. The videos are given to ffmpeg through a pipe,
+// an mp4 that must seek (its index at the end) is replaced by an error page.
+// The Output only name the EPUB, it defaults to the name of the input.
+func ConvertFS(ctx context.Context, fsys fs.FS, input string, o epuboptions.EPUBOptions) ([]byte, error) {
+	if o.Image.Format == "avif" {
+		return nil, &epuboptions.ValidationError{Errors: []epuboptions.FieldError{{Field: "image.format", Message: errAvifInMemory}}}
+	}
+	var buf bytes.Buffer
+	name := cmp.Or(strings.TrimSuffix(path.Base(input), path.Ext(input)), "comic")
+	o.Input, o.InputFS, o.InMemory = input, fsys, true
+	o.Output = cmp.Or(o.Output, name+".epub")
+	o.Title = cmp.Or(o.Title, name)
+	o.OutputWriter = epuboptions.WriterOutput(&buf)
+	o.LimitMb, o.CacheDir, o.PostHook, o.Image.Hook, o.Calibre, o.Kobo, o.KindleMount, o.Upload = 0, "", "", "", "", "", "", ""
+	o.OutputFormat = epuboptions.OutputEPUB
+	o.Dry, o.DryVerbose, o.DryPlan, o.KeepTemp, o.Mihon = false, false, false, false, false
+	if err := New(o).WriteContext(ctx); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ConvertBytes convert an archive (cbz, zip, cbr, rar, pdf, or a registered reader) given by its content,
+// the extension of its name select the reader. See ConvertFS.
+func ConvertBytes(ctx context.Context, name string, data []byte, o epuboptions.EPUBOptions) ([]byte, error) {
+	name = path.Base(name)
+	return ConvertFS(ctx, bytesFS{name, data}, name, o)
+}
+
+// errAvifInMemory the avif need the temporary files of avifenc.
+const errAvifInMemory = "avif is encoded through temporary files, not available in memory"
+
+// bytesFS a file system of a single file, the archive given by its content.
+type bytesFS struct {
+	name string
+	data []byte
+}
+
+func (b bytesFS) Open(name string) (fs.File, error) {
+	if name != b.name {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytesFile{bytes.NewReader(b.data), b}, nil
+}
+
+// bytesFile the archive opened, the readers of zip and pdf read it at any offset.
+type bytesFile struct {
+	*bytes.Reader
+	fs bytesFS
+}
+
+func (f bytesFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f bytesFile) Close() error               { return nil }
+func (f bytesFile) Name() string               { return f.fs.name }
+func (f bytesFile) Size() int64                { return int64(len(f.fs.data)) }
+func (f bytesFile) Mode() fs.FileMode          { return 0444 }
+func (f bytesFile) ModTime() time.Time         { return time.Time{} }
+func (f bytesFile) IsDir() bool                { return false }
+func (f bytesFile) Sys() any                   { return nil }
@@ -0,0 +1,114 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// comic a cbz of n pages, the shade of the pages is given by the seed.
+func comic(t *testing.T, n int, seed uint8) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	wz := zip.NewWriter(&buf)
+	for i := 0; i < n; i++ {
+		img := image.NewGray(image.Rect(0, 0, 60, 90))
+		for p := range img.Pix {
+			img.Pix[p] = seed + uint8(i*8+p%32)
+		}
+		w, err := wz.Create(fmt.Sprintf("%03d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = png.Encode(w, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// memoryOptions the options of a small gray EPUB.
+func memoryOptions() epuboptions.EPUBOptions {
+	return epuboptions.EPUBOptions{
+		Image: epuboptions.Image{
+			Quality:      85,
+			Format:       "jpeg",
+			GrayScale:    true,
+			View:         epuboptions.View{Width: 60, Height: 90, Color: epuboptions.Color{Foreground: "000", Background: "FFF"}},
+			Border:       epuboptions.Border{Color: "000"},
+			Backend:      "gift",
+			JpegBackend:  "go",
+			DitherMatrix: 4,
+		},
+		SortPathMode: 1,
+		OutputFormat: epuboptions.OutputEPUB,
+		Workers:      2,
+		Quiet:        true,
+	}
+}
+
+// TestConvertBytesOptions the avif is rejected in memory, the archive is read from its content, the directory of its name ignored.
+func TestConvertBytesOptions(t *testing.T) {
+	o := memoryOptions()
+	o.Image.Format = "avif"
+	var v *epuboptions.ValidationError
+	if _, err := ConvertBytes(context.Background(), "comic.cbz", comic(t, 2, 0), o); !errors.As(err, &v) || v.Errors[0].Field != "image.format" {
+		t.Errorf("avif: error %v", err)
+	}
+
+	if _, err := ConvertBytes(context.Background(), "comic.cbz", []byte("not a zip"), memoryOptions()); err == nil {
+		t.Error("invalid archive: no error")
+	}
+	if _, err := ConvertBytes(context.Background(), "dir/comic.cbz", comic(t, 2, 0), memoryOptions()); err != nil {
+		t.Errorf("archive: %v", err)
+	}
+}
+
+// TestConvertBytesConcurrent the conversions in parallel of inputs with the same name keep their own pages.
+func TestConvertBytesConcurrent(t *testing.T) {
+	o := memoryOptions()
+	const n = 8
+	var wg sync.WaitGroup
+	results := make([][]byte, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// a different number of pages by conversion: a mixed storage would show
+			results[i], errs[i] = ConvertBytes(context.Background(), "comic.cbz", comic(t, 2+i, uint8(i*16)), o)
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("conversion %d: %v", i, errs[i])
+		}
+		fz, err := zip.NewReader(bytes.NewReader(results[i]), int64(len(results[i])))
+		if err != nil {
+			t.Fatalf("conversion %d: %v", i, err)
+		}
+		pages := 0
+		for _, f := range fz.File {
+			if strings.HasPrefix(f.Name, "OEBPS/Images/img_") {
+				pages++
+			}
+		}
+		if pages != 2+i {
+			t.Errorf("conversion %d: %d pages, want %d", i, pages, 2+i)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package epub
+
+import (
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubmetadata"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// built-in metadata providers, to use them apart from LookupMetadata
+var (
+	SidecarMetadata   = epubmetadata.Sidecar   // "Series v01.json" next to the input
+	ComicInfoMetadata = epubmetadata.ComicInfo // ComicInfo.xml at the root of the input
+	FileNameMetadata  = epubmetadata.FileName  // the name of the input: "Series v01", "Series 012"
+)
+
+// LookupMetadata the metadata of the input from the registered providers then the built-in ones,
+// each completing the fields left empty by the previous.
+//
+// the errors of the providers are returned with the metadata found by the others.
+func LookupMetadata(input string) (epuboptions.Metadata, error) {
+	return epubmetadata.Lookup(input)
+}
@@ -0,0 +1,136 @@
+package epub
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubhook"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubzip"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/utils"
+)
+
+// mihonDetails the details.json of a series of the local source of Mihon.
+type mihonDetails struct {
+	Title       string   `json:"title"`
+	Author      string   `json:"author"`
+	Artist      string   `json:"artist"`
+	Description string   `json:"description"`
+	Genre       []string `json:"genre"`
+	Status      string   `json:"status"` // 0 = unknown
+}
+
+// checkMihonChapter the chapter is removed before the rename, it must not be the input or hold it.
+func (e epub) checkMihonChapter() error {
+	input, err := filepath.Abs(e.Input)
+	if e.InputFS != nil || err != nil {
+		return nil
+	}
+	chapter, err := filepath.Abs(e.MihonChapter())
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(chapter, input); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("the chapter %s would replace the input, choose another output", e.MihonChapter())
+	}
+	return nil
+}
+
+// writeMihon write the pages into the chapter directory of the series, with the cover and the details of the series if missing.
+//
+// the chapter is written aside then renamed, a conversion again replace it.
+func (e epub) writeMihon(epubParts []epubPart, imgStorage epubzip.StorageImageReader) (string, error) {
+	start := time.Now()
+	chapter := e.MihonChapter()
+	series := filepath.Dir(chapter)
+	if err := os.MkdirAll(series, 0755); err != nil {
+		return "", err
+	}
+
+	cover := epubParts[0].Cover
+	pages, err := e.allPages(epubParts)
+	if err != nil {
+		return "", err
+	}
+
+	tmp := filepath.Join(series, "."+filepath.Base(chapter)+".tmp")
+	_ = os.RemoveAll(tmp)
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		return "", err
+	}
+	fmtLen := max(3, len(utils.IntToString(len(pages))))
+	for i, img := range pages {
+		name := fmt.Sprintf("%0*d.%s", fmtLen, i+1, img.Format)
+		if err := e.copyImage(imgStorage, img, filepath.Join(tmp, name)); err != nil {
+			_ = os.RemoveAll(tmp)
+			return "", err
+		}
+	}
+	_ = os.RemoveAll(chapter)
+	if err := os.Rename(tmp, chapter); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", err
+	}
+
+	// the cover and the details of the series are kept once written, they may be edited in Mihon
+	entries, err := os.ReadDir(series)
+	if err != nil {
+		return "", err
+	}
+	if !slices.ContainsFunc(entries, func(d os.DirEntry) bool { return strings.HasPrefix(d.Name(), "cover.") }) {
+		if err := e.copyImage(imgStorage, cover, filepath.Join(series, "cover."+cover.Format)); err != nil {
+			return "", err
+		}
+	}
+	details := filepath.Join(series, "details.json")
+	if _, err := os.Stat(details); os.IsNotExist(err) {
+		b, _ := json.MarshalIndent(mihonDetails{
+			Title:  cmp.Or(e.Series, e.Title),
+			Author: e.Author,
+			Artist: e.Author,
+			Genre:  []string{},
+			Status: "0",
+		}, "", "  ")
+		if err = os.WriteFile(details, b, 0644); err != nil {
+			return "", err
+		}
+	}
+
+	slog.Info("chapter written", "input", e.Input, "output", chapter, "images", len(pages), "duration", time.Since(start))
+	if e.PostHook != "" {
+		if err := epubhook.Run(e.PostHook, epubhook.Output{Input: e.Input, Path: chapter, Title: e.Title, Pages: len(pages), Part: 1, Parts: 1}); err != nil {
+			return "", err
+		}
+	}
+	return chapter, nil
+}
+
+// copyImage write the processed image into the file.
+func (e epub) copyImage(imgStorage epubzip.StorageImageReader, img epubimage.EPUBImage, name string) error {
+	f := imgStorage.Get(img.EPUBImgPath())
+	if f == nil {
+		return fmt.Errorf("image %d missing from the storage", img.Id)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package epub
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime/debug"
+
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// SettingsFile file of the EPUB with the options of the conversion, to run it again.
+const SettingsFile = "META-INF/go-comic-converter.json"
+
+// Settings of the conversion embedded into the EPUB.
+type Settings struct {
+	Version string                  `json:"version"`
+	Options epuboptions.EPUBOptions `json:"options"`
+}
+
+// settingsContent the options of the conversion, without what belongs to the machine that run it.
+//
+// the EPUB is shared: the commands (hooks), the destinations (calibre, kobo, kindle, upload, with their credentials)
+// and the local directories are removed, the input and the output are kept by name only.
+func (e epub) settingsContent() string {
+	s := Settings{Version: "unknown", Options: e.EPUBOptions}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		s.Version = bi.Main.Version
+	}
+	o := &s.Options
+	o.Input, o.Output, o.Overrides = filepath.Base(o.Input), filepath.Base(o.Output), ""
+	o.PostHook, o.Image.Hook, o.Calibre, o.Kobo, o.KindleMount, o.Upload, o.UploadRetries = "", "", "", "", "", "", 0
+	o.CacheDir, o.TempDir = "", ""
+	b, _ := json.MarshalIndent(s, "", "  ")
+	return string(b)
+}
+
+// ReadSettings read the settings embedded into an EPUB, any part of a split EPUB has them.
+func ReadSettings(filename string) (s Settings, err error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	f, err := r.Open(SettingsFile)
+	if err != nil {
+		return s, fmt.Errorf("%s: no settings, the EPUB was created by an older version or another tool", filename)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("%s: settings: %w", filename, err)
+	}
+	return
+}
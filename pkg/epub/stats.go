@@ -0,0 +1,63 @@
+package epub
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubhook"
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/epubimage"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+// stats of the conversion from the index of the images and the parts written.
+func (e epub) stats(index epubimage.Index, written []epubhook.Output, duration time.Duration) epuboptions.Stats {
+	s := epuboptions.Stats{
+		Input:      e.Input,
+		Outputs:    make([]string, 0, len(written)),
+		InputSize:  inputSize(e.InputFileSystem()),
+		Sources:    index.Sources(),
+		Pages:      index.Len(),
+		Format:     e.Image.Format,
+		Quality:    e.Image.Quality,
+		DurationMs: duration.Milliseconds(),
+	}
+	for _, o := range written {
+		s.Outputs = append(s.Outputs, o.Path)
+		s.OutputSize += o.Size
+	}
+	if s.InputSize > 0 {
+		s.Ratio = float64(s.OutputSize) / float64(s.InputSize)
+	}
+
+	// the parts of a split page follow the page itself
+	kept, split := map[int]bool{}, map[int]bool{}
+	for _, img := range index.All() {
+		kept[img.Id] = true
+		if img.Part > 0 {
+			split[img.Id] = true
+		}
+	}
+	s.Split, s.Dropped = len(split), max(0, s.Sources-len(kept))
+	return s
+}
+
+// inputSize the size of the archive, or of the files of the directory.
+func inputSize(fsys fs.FS, input string) int64 {
+	fi, err := fs.Stat(fsys, input)
+	if err != nil {
+		return 0
+	}
+	if !fi.IsDir() {
+		return fi.Size()
+	}
+	var size int64
+	_ = fs.WalkDir(fsys, input, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
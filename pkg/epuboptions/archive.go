@@ -0,0 +1,81 @@
+package epuboptions
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ArchiveReader an input container, read as a file system of images by the pipeline.
+type ArchiveReader struct {
+	Extensions []string // .cbx, ... lowercase with the dot
+	Signature  []byte   // first bytes of the file, to detect it whatever its extension, optional
+
+	// Open the content of the archive, walked like a directory of images.
+	// the file system is closed at the end of the conversion if it's an io.Closer.
+	Open func(fsys fs.FS, name string) (fs.FS, error)
+}
+
+var (
+	archiveReadersMu sync.RWMutex
+	archiveReaders   []ArchiveReader
+)
+
+// RegisterArchiveReader add an input container, after the built-in cbz, zip, cbr, rar and pdf.
+//
+// it panics on a built-in extension, a nil Open, or without extension and signature.
+func RegisterArchiveReader(r ArchiveReader) {
+	if r.Open == nil {
+		panic("epuboptions: RegisterArchiveReader with a nil Open")
+	}
+	if len(r.Extensions) == 0 && len(r.Signature) == 0 {
+		panic("epuboptions: RegisterArchiveReader without extension or signature")
+	}
+	exts := make([]string, len(r.Extensions))
+	for i, ext := range r.Extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if slices.Contains([]string{".cbz", ".zip", ".cbr", ".rar", ".pdf"}, ext) {
+			panic("epuboptions: RegisterArchiveReader of the built-in extension " + ext)
+		}
+		exts[i] = ext
+	}
+	r.Extensions = exts
+	archiveReadersMu.Lock()
+	defer archiveReadersMu.Unlock()
+	archiveReaders = append(archiveReaders, r)
+}
+
+// LookupArchiveReader the reader registered for the file, by its extension then by the first bytes of its content.
+func LookupArchiveReader(name string, header []byte) (ArchiveReader, bool) {
+	archiveReadersMu.RLock()
+	defer archiveReadersMu.RUnlock()
+	ext := strings.ToLower(path.Ext(name))
+	for _, r := range archiveReaders {
+		if slices.Contains(r.Extensions, ext) {
+			return r, true
+		}
+	}
+	for _, r := range archiveReaders {
+		if len(r.Signature) > 0 && bytes.HasPrefix(header, r.Signature) {
+			return r, true
+		}
+	}
+	return ArchiveReader{}, false
+}
+
+// ArchiveExtensions the extensions of the registered readers.
+func ArchiveExtensions() []string {
+	archiveReadersMu.RLock()
+	defer archiveReadersMu.RUnlock()
+	var res []string
+	for _, r := range archiveReaders {
+		res = append(res, r.Extensions...)
+	}
+	return res
+}
@@ -0,0 +1,6 @@
+package epuboptions
+
+type Border struct {
+	Width int    `yaml:"width" json:"width"` // 0 = disabled
+	Color string `yaml:"color" json:"color"`
+}
@@ -0,0 +1,169 @@
+package epuboptions
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/pagerange"
+)
+
+// FieldError an invalid option, the field is its json path: image.quality, limit_mb, ...
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError the invalid options, each one is a FieldError for errors.As.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msg := make([]string, 0, len(e.Errors))
+	for _, f := range e.Errors {
+		msg = append(msg, f.Error())
+	}
+	return "invalid options: " + strings.Join(msg, ", ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, f := range e.Errors {
+		errs = append(errs, f)
+	}
+	return errs
+}
+
+var checkColorRegex = regexp.MustCompile("^[0-9A-F]{3}$")
+
+// Check the options before the conversion, for the programs using the library.
+//
+// it returns a *ValidationError with every invalid option, nil if they are valid.
+// the files are not checked, a missing input still fail at the start of the conversion.
+// (Validate is the option to check the EPUB once written)
+func (o EPUBOptions) Check() error {
+	v := &ValidationError{}
+	fail := func(field string, format string, args ...any) {
+		v.Errors = append(v.Errors, FieldError{field, fmt.Sprintf(format, args...)})
+	}
+	between := func(field string, value, min, max int) {
+		if value < min || value > max {
+			fail(field, "should be between %d and %d", min, max)
+		}
+	}
+
+	if o.Input == "" && o.InputFS == nil {
+		fail("input", "missing")
+	}
+	if o.Output == "" && o.OutputWriter == nil {
+		fail("output", "missing")
+	}
+	if o.Mihon && o.OutputWriter != nil {
+		fail("mihon", "the pages are written into the directory of the output, not to the writer")
+	}
+	if !slices.Contains([]string{"", OutputEPUB, OutputKEPUB, OutputAZW3, OutputMOBI, OutputCBZ, OutputBoth}, o.OutputFormat) {
+		fail("output_format", "should be epub, kepub, azw3, mobi, cbz or both")
+	}
+	if o.Kindle() && o.OutputWriter != nil {
+		fail("output_format", "the EPUB is converted on the disk, not into the writer")
+	}
+	if o.HasCBZ() && o.OutputWriter != nil {
+		fail("output_format", "the CBZ is written next to the output, not to the writer")
+	}
+	if _, err := pagerange.Parse(o.Pages); err != nil {
+		fail("pages", "%v", err)
+	}
+	if _, err := pagerange.Parse(o.Chapters); err != nil {
+		fail("chapters", "%v", err)
+	}
+	if o.LimitMb < 20 && o.LimitMb != 0 {
+		fail("limit_mb", "should be 0 or >= 20")
+	}
+	between("title_page", o.TitlePage, 0, 2)
+	between("sort_path_mode", o.SortPathMode, 0, 2)
+	if o.MaxMemory < -1 || (o.MaxMemory > 0 && o.MaxMemory < 256) {
+		fail("max_memory", "should be -1, 0 or >= 256")
+	}
+
+	i := o.Image
+	if _, ok := LookupEncoder(i.Format); !ok && !slices.Contains([]string{"jpeg", "png", "webp", "avif", "copy"}, i.Format) {
+		fail("image.format", "should be jpeg, png, webp, avif, copy or a registered encoder")
+	}
+	if i.Format == "jpeg" || (i.Format == "webp" && !i.WebpLossless) || i.Format == "avif" {
+		between("image.quality", i.Quality, 1, 100)
+	}
+	if i.Format == "avif" {
+		between("image.avif_speed", i.AvifSpeed, 0, 10)
+	}
+	if i.Format != "copy" && (i.View.Width <= 0 || i.View.Height <= 0) {
+		fail("image.view", "width and height should be > 0")
+	}
+	if i.View.AspectRatio < 0 && i.View.AspectRatio != -1 {
+		fail("image.view.aspect_ratio", "should be -1, 0 or > 0")
+	}
+	between("image.brightness", i.Brightness, -100, 100)
+	between("image.contrast", i.Contrast, -100, 100)
+	between("image.despeckle", i.Despeckle, 0, 100)
+	between("image.gray_scale_mode", i.GrayScaleMode, 0, 2)
+	if i.Dither && !i.GrayScale {
+		fail("image.dither", "require grayscale")
+	}
+	if i.Dither {
+		between("image.dither_mode", i.DitherMode, 0, 1)
+	}
+	if i.Dither && i.DitherMode == 1 && !slices.Contains([]int{2, 4, 8}, i.DitherMatrix) {
+		fail("image.dither_matrix", "should be 2, 4 or 8")
+	}
+	between("image.border.width", i.Border.Width, 0, 50)
+	between("image.crop.limit", i.Crop.Limit, 0, 100)
+	between("image.crop.safe_area", i.Crop.SafeArea, 0, 50)
+	if i.ToneMapClip < 0 || i.ToneMapClip > 10 {
+		fail("image.tone_map_clip", "should be between 0 and 10")
+	}
+	if i.AutoLevelsClip < 0 || i.AutoLevelsClip > 10 {
+		fail("image.auto_levels_clip", "should be between 0 and 10")
+	}
+	if i.SplitParts < 0 || i.SplitParts == 1 {
+		fail("image.split_parts", "should be 0 or >= 2")
+	}
+	if i.MaxMegapixels < 0 {
+		fail("image.max_megapixels", "should be 0 or > 0")
+	}
+	if i.MaxDimension < 0 {
+		fail("image.max_dimension", "should be 0 or > 0")
+	}
+	if i.TileThreshold < 0 {
+		fail("image.tile_threshold", "should be 0 or > 0")
+	}
+	for _, c := range []struct{ field, value string }{
+		{"image.view.color.foreground", i.View.Color.Foreground},
+		{"image.view.color.background", i.View.Color.Background},
+		{"image.border.color", i.Border.Color},
+	} {
+		if !checkColorRegex.MatchString(c.value) {
+			fail(c.field, "should be an hexadecimal color: [0-9A-F]{3}")
+		}
+	}
+	if !slices.Contains([]string{"gift", "simd"}, i.Backend) {
+		fail("image.backend", "should be gift or simd")
+	}
+	if !slices.Contains([]string{"go", "libjpeg"}, i.JpegBackend) {
+		fail("image.jpeg_backend", "should be go or libjpeg")
+	}
+
+	// incompatible options
+	if i.AppleBookCompatibility && i.View.PortraitOnly {
+		fail("image.apple_book_compatibility", "incompatible with image.view.portrait_only")
+	}
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
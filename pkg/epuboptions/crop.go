@@ -8,4 +8,5 @@ type Crop struct {
 	Bottom             int  `yaml:"bottom" json:"bottom"`
 	Limit              int  `yaml:"limit" json:"limit"`
 	SkipIfLimitReached bool `yaml:"skip_if_limit_reached" json:"skip_if_limit_reached"`
+	SafeArea           int  `yaml:"safe_area" json:"safe_area"`
 }
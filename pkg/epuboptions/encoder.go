@@ -0,0 +1,44 @@
+package epuboptions
+
+import (
+	"image"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Encoder an output format of the images, registered by the programs using the library.
+type Encoder struct {
+	MediaType string                                                // image/webp, ...
+	Encode    func(w io.Writer, img image.Image, quality int) error // the quality of the options, 0-100
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{}
+)
+
+// RegisterEncoder add an output format, used with Image.Format.
+//
+// the name of the format is the extension of the images in the EPUB. The built-in formats (jpeg, png, copy) can't be replaced,
+// a webp or avif encoder replace the built-in one.
+// it panics on a built-in format or a nil Encode, like a duplicate driver of database/sql.
+func RegisterEncoder(format string, e Encoder) {
+	if slices.Contains([]string{"jpeg", "png", "copy"}, format) {
+		panic("epuboptions: RegisterEncoder of the built-in format " + format)
+	}
+	if e.Encode == nil {
+		panic("epuboptions: RegisterEncoder with a nil Encode for " + format)
+	}
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[format] = e
+}
+
+// LookupEncoder the encoder registered for the format.
+func LookupEncoder(format string) (Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	e, ok := encoders[format]
+	return e, ok
+}
@@ -1,26 +1,78 @@
 // Package epuboptions for EPUB creation.
 package epuboptions
 
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// characters not allowed in a directory name on windows and android
+var dirInvalid = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+
 type EPUBOptions struct {
 	// Output
-	Input  string `yaml:"-" json:"input"`
-	Output string `yaml:"-" json:"output"`
-	Author string `yaml:"-" json:"author"`
-	Title  string `yaml:"-" json:"title"`
+	Input     string `yaml:"-" json:"input"`
+	InputFS   fs.FS  `yaml:"-" json:"-"` // file system of the input, the Input is then a path in it ("." for its root), the disk if nil
+	Output    string `yaml:"-" json:"output"`
+	Author    string `yaml:"-" json:"author"`
+	Title     string `yaml:"-" json:"title"`
+	Series    string `yaml:"-" json:"series"`
+	Overrides string `yaml:"-" json:"overrides"`
+	Pages     string `yaml:"-" json:"pages"`    // selection of the sorted pages: 1-20,45,100-
+	Chapters  string `yaml:"-" json:"chapters"` // selection of the chapters, the directories of the pages: 1-3,7
+	Mihon     bool   `yaml:"-" json:"mihon"`    // write the pages in the layout of the local source of Mihon, instead of an EPUB
 
 	//Config
-	TitlePage                  int   `yaml:"title_page" json:"title_page"`
-	LimitMb                    int   `yaml:"limit_mb" json:"limit_mb"`
-	StripFirstDirectoryFromToc bool  `yaml:"strip_first_directory" json:"strip_first_directory"`
-	SortPathMode               int   `yaml:"sort_path_mode" json:"sort_path_mode"`
-	Image                      Image `yaml:"image" json:"image"`
+	TitlePage                  int    `yaml:"title_page" json:"title_page"`
+	LimitMb                    int    `yaml:"limit_mb" json:"limit_mb"`
+	StripFirstDirectoryFromToc bool   `yaml:"strip_first_directory" json:"strip_first_directory"`
+	SortPathMode               int    `yaml:"sort_path_mode" json:"sort_path_mode"`
+	Image                      Image  `yaml:"image" json:"image"`
+	CacheDir                   string `yaml:"cache_dir" json:"cache_dir"`
+	MaxMemory                  int    `yaml:"max_memory" json:"max_memory"` // Mb, 0 = auto, -1 = unlimited
+	TempDir                    string `yaml:"temp_dir" json:"temp_dir"`
+	PostHook                   string `yaml:"post_hook" json:"post_hook"`               // command run after each EPUB written
+	Calibre                    string `yaml:"calibre" json:"calibre"`                   // calibre library, a directory or a content server url, each EPUB written is added into
+	Kobo                       string `yaml:"kobo" json:"kobo"`                         // mounted Kobo, each EPUB written is copied onto
+	KoboCollections            bool   `yaml:"kobo_collections" json:"kobo_collections"` // add the EPUB copied onto the Kobo into the collection of its series
+	KindleMount                string `yaml:"kindle" json:"kindle"`                     // mounted Kindle, each AZW3 or MOBI converted is copied onto
+	Upload                     string `yaml:"upload" json:"upload"`                     // cloud folder (s3://bucket/prefix/, dropbox://path/, gdrive://folder_id/) each EPUB written is uploaded into
+	UploadRetries              int    `yaml:"upload_retries" json:"upload_retries"`     // retries of a failed request of the upload, with an increasing delay
+	OutputFormat               string `yaml:"output_format" json:"output_format"`       // epub, kepub, azw3, mobi, cbz or both: the EPUB for the Kobo or converted for the Kindle, or the processed pages into a CBZ next to the output, instead of or with the EPUB
 
 	// Other
-	Dry        bool `yaml:"-" json:"dry"`
-	DryVerbose bool `yaml:"-" json:"dry_verbose"`
-	Quiet      bool `yaml:"-" json:"-"`
-	Json       bool `yaml:"-" json:"-"`
-	Workers    int  `yaml:"-" json:"workers"`
+	Dry        bool   `yaml:"-" json:"dry"`
+	DryVerbose bool   `yaml:"-" json:"dry_verbose"`
+	DryPlan    bool   `yaml:"-" json:"dry_plan"`
+	Quiet      bool   `yaml:"-" json:"-"`
+	Json       bool   `yaml:"-" json:"-"`
+	Workers    int    `yaml:"-" json:"workers"`
+	KeepTemp   bool   `yaml:"-" json:"keep_temp"` // debug, keep the temporary files after the conversion
+	InMemory   bool   `yaml:"-" json:"-"`         // keep the processed images and their index in memory, instead of the temporary files (not for avif)
+	StorageId  string `yaml:"-" json:"-"`         // unique id of the conversion, set by epub.New: the storages in memory of parallel conversions never mix
+	Validate   bool   `yaml:"-" json:"validate"`  // check the structure of the EPUB once written
+
+	// Progress backend, default to the terminal bar or the json lines
+	Progress ProgressBackend `yaml:"-" json:"-"`
+
+	// OutputWriter receive the parts of the EPUB instead of the Output files, if set.
+	// the Output still name the parts and place the temporary files, the validation and the post hook are skipped.
+	OutputWriter OutputFunc `yaml:"-" json:"-"`
+
+	// Templates generate the files of the EPUB by name (TemplateContent, TemplatePage, ...), in place of the built-in ones
+	Templates map[string]TemplateFunc `yaml:"-" json:"-"`
+
+	// Events callbacks of the pipeline, if set
+	Events Events `yaml:"-" json:"-"`
+
+	// OnStats receive the stats of the conversion, if set
+	OnStats StatsFunc `yaml:"-" json:"-"`
 }
 
 func (o EPUBOptions) WorkersRatio(pct int) (nbWorkers int) {
@@ -31,6 +83,111 @@ func (o EPUBOptions) WorkersRatio(pct int) (nbWorkers int) {
 	return
 }
 
+// InputFileSystem the file system of the input and the name of the input in it.
+//
+// on the disk, it is the directory of the input, or the input itself for a directory.
+func (o EPUBOptions) InputFileSystem() (fs.FS, string) {
+	if o.InputFS != nil {
+		if o.Input == "" {
+			return o.InputFS, "."
+		}
+		return o.InputFS, o.Input
+	}
+	input := filepath.Clean(o.Input)
+	if fi, err := os.Stat(input); err == nil && fi.IsDir() {
+		return os.DirFS(input), "."
+	}
+	return os.DirFS(filepath.Dir(input)), filepath.Base(input)
+}
+
+// Output formats.
+const (
+	OutputEPUB  = "epub"
+	OutputKEPUB = "kepub"
+	OutputAZW3  = "azw3"
+	OutputMOBI  = "mobi"
+	OutputCBZ   = "cbz"
+	OutputBoth  = "both"
+)
+
+// HasEPUB the EPUB is written, the default.
+func (o EPUBOptions) HasEPUB() bool {
+	return o.OutputFormat != OutputCBZ
+}
+
+// KEPUB the EPUB is written as a KEPUB, with the markup of the Kobo.
+func (o EPUBOptions) KEPUB() bool {
+	return o.OutputFormat == OutputKEPUB
+}
+
+// Kindle the EPUB is converted into an AZW3 or a MOBI for the Kindle, then removed.
+func (o EPUBOptions) Kindle() bool {
+	return o.OutputFormat == OutputAZW3 || o.OutputFormat == OutputMOBI
+}
+
+// EPUBOutput the EPUB written: the output, or <output name>.kepub.epub for a KEPUB, the Kobo recognize it by its extension.
+func (o EPUBOptions) EPUBOutput() string {
+	if !o.KEPUB() {
+		return o.Output
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(o.Output, filepath.Ext(o.Output)), ".kepub") + ".kepub.epub"
+}
+
+// EPUBExt the extension of the EPUB written, kept after the number of the part.
+func (o EPUBOptions) EPUBExt() string {
+	if o.KEPUB() {
+		return ".kepub.epub"
+	}
+	return filepath.Ext(o.Output)
+}
+
+// HasCBZ the processed pages are written into a CBZ.
+func (o EPUBOptions) HasCBZ() bool {
+	return o.OutputFormat == OutputCBZ || o.OutputFormat == OutputBoth
+}
+
+// CBZOutput the CBZ written next to the output: <output name>.cbz.
+func (o EPUBOptions) CBZOutput() string {
+	return strings.TrimSuffix(o.Output, filepath.Ext(o.Output)) + ".cbz"
+}
+
+// MihonChapter the directory of the chapter in the layout of the local source of Mihon: <output dir>/<series>/<output name>.
+//
+// the series default to the title.
+func (o EPUBOptions) MihonChapter() string {
+	series := strings.Trim(dirInvalid.ReplaceAllString(cmp.Or(o.Series, o.Title), "_"), " .")
+	name := strings.TrimSuffix(filepath.Base(o.Output), filepath.Ext(o.Output))
+	return filepath.Join(filepath.Dir(o.Output), series, name)
+}
+
+// ImgStorage temporary storage of the processed images, next to the output or in the temp dir.
+//
+// in the temp dir, the hash of the output avoid conflicts between outputs with the same name.
 func (o EPUBOptions) ImgStorage() string {
-	return o.Output + ".tmp"
+	// in memory, it is only a key, unique by conversion
+	if o.InMemory {
+		return o.Output + "." + o.StorageId + ".tmp"
+	}
+	if o.TempDir == "" {
+		return o.Output + ".tmp"
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(o.Output))
+	return filepath.Join(o.TempDir, fmt.Sprintf("%s.%08x.tmp", filepath.Base(o.Output), h.Sum32()))
+}
+
+// ImgIndex temporary index of the processed images, next to their storage, empty to keep it in memory.
+func (o EPUBOptions) ImgIndex() string {
+	if o.InMemory {
+		return ""
+	}
+	return strings.TrimSuffix(o.ImgStorage(), ".tmp") + ".idx.tmp"
+}
+
+// ImgResume the pages kept by an interrupted conversion, next to their storage, empty in memory.
+func (o EPUBOptions) ImgResume() string {
+	if o.InMemory {
+		return ""
+	}
+	return strings.TrimSuffix(o.ImgStorage(), ".tmp") + ".resume.tmp"
 }
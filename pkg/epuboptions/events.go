@@ -0,0 +1,43 @@
+package epuboptions
+
+// Events callbacks of the pipeline, for the programs using the library to drive their own UI and logging.
+//
+// they are called from the processing goroutines: they should be safe for concurrent use and return quickly.
+type Events struct {
+	OnPageDecoded    func(p PageEvent)    // a source page read, before its transformation
+	OnPageProcessed  func(p PageEvent)    // a page transformed and encoded, once for each part of a split page
+	OnWarning        func(w WarningEvent) // a corrupted image or a validation message
+	OnVolumeFinished func(v VolumeEvent)  // a part written, once converted for the Kindle
+}
+
+// PageEvent a page of the conversion.
+type PageEvent struct {
+	Id     int    // position of the source page
+	Part   int    // 0 for the page, from 1 for the parts of a split double page
+	Path   string // directory of the source page
+	Name   string // file name of the source page
+	Width  int
+	Height int
+	Size   int   // bytes of the encoded image, once processed
+	Blank  bool  // blank page, removed with NoBlankImage
+	Error  error // the page is replaced by an error page
+}
+
+// WarningEvent a problem that does not stop the conversion.
+type WarningEvent struct {
+	Input   string
+	Output  string // the EPUB for the validation messages
+	Page    string
+	Message string
+}
+
+// VolumeEvent a part written, the Output is the AZW3 or the MOBI for the Kindle.
+type VolumeEvent struct {
+	Input  string
+	Output string
+	Title  string
+	Part   int
+	Parts  int
+	Pages  int
+	Size   int64
+}
@@ -0,0 +1,54 @@
+package epuboptions
+
+import "github.com/disintegration/gift"
+
+// Stage of the image pipeline where a custom filter is inserted.
+type Stage int
+
+const (
+	// StageStart before the built-in filters, the filter should keep the size of the image: the crop is detected on the source.
+	StageStart Stage = iota
+	// StageBeforeResize after the crop, the rotation and the contrast adjustments, before the resize.
+	StageBeforeResize
+	// StageAfterResize after the resize and the border, before the grayscale conversion.
+	StageAfterResize
+	// StageEnd after the grayscale conversion and the dithering, the last filter.
+	StageEnd
+)
+
+// names of the built-in filters a custom filter may replace
+const (
+	FilterToneMap      = "tone_map"
+	FilterAutoLevels   = "auto_levels"
+	FilterAutoRotate   = "auto_rotate"
+	FilterAutoContrast = "auto_contrast"
+	FilterContrast     = "contrast"
+	FilterBrightness   = "brightness"
+	FilterDespeckle    = "despeckle"
+	FilterResize       = "resize"
+	FilterBorder       = "border"
+	FilterGrayScale    = "grayscale"
+	FilterDither       = "dither"
+)
+
+// FilterContext the page transformed.
+type FilterContext struct {
+	Id     int    // position of the source page
+	Part   int    // 0 for the page, from 1 for the parts of a split double page
+	Parts  int    // number of parts of a split double page, 1 otherwise
+	Path   string // directory of the source page
+	Name   string // file name of the source page
+	Width  int    // size of the source page
+	Height int
+}
+
+// Filter a custom filter of the image pipeline, for the programs using the library.
+//
+// a filter named like a built-in one (FilterContrast, ...) replace it at its place, when the built-in is enabled by the options.
+// the other filters are inserted at their stage, in the order of the options.
+// the name is part of the settings of the EPUB and of the cache key: it should change with the behavior of the filter.
+type Filter struct {
+	Name  string                              `json:"name"`
+	Stage Stage                               `json:"stage"`
+	New   func(ctx FilterContext) gift.Filter `json:"-"` // the filter of the page, nil to skip the page
+}
@@ -1,22 +1,46 @@
 package epuboptions
 
 type Image struct {
-	Crop                      Crop   `yaml:"crop" json:"crop"`
-	Quality                   int    `yaml:"quality" json:"quality"`
-	Brightness                int    `yaml:"brightness" json:"brightness"`
-	Contrast                  int    `yaml:"contrast" json:"contrast"`
-	AutoContrast              bool   `yaml:"auto_contrast" json:"auto_contrast"`
-	AutoRotate                bool   `yaml:"auto_rotate" json:"auto_rotate"`
-	AutoSplitDoublePage       bool   `yaml:"auto_split_double_page" json:"auto_split_double_page"`
-	KeepDoublePageIfSplit     bool   `yaml:"keep_double_page_if_split" json:"keep_double_page_if_split"`
-	KeepSplitDoublePageAspect bool   `yaml:"keep_split_double_page_aspect" json:"keep_split_double_page_aspect"`
-	NoBlankImage              bool   `yaml:"no_blank_image" json:"no_blank_image"`
-	Manga                     bool   `yaml:"manga" json:"manga"`
-	HasCover                  bool   `yaml:"has_cover" json:"has_cover"`
-	View                      View   `yaml:"view" json:"view"`
-	GrayScale                 bool   `yaml:"grayscale" json:"grayscale"`
-	GrayScaleMode             int    `yaml:"grayscale_mode" json:"gray_scale_mode"` // 0 = normal, 1 = average, 2 = luminance
-	Resize                    bool   `yaml:"resize" json:"resize"`
-	Format                    string `yaml:"format" json:"format"`
-	AppleBookCompatibility    bool   `yaml:"apple_book_compatibility" json:"apple_book_compatibility"`
+	Crop                      Crop     `yaml:"crop" json:"crop"`
+	Border                    Border   `yaml:"border" json:"border"`
+	Quality                   int      `yaml:"quality" json:"quality"`
+	Brightness                int      `yaml:"brightness" json:"brightness"`
+	Contrast                  int      `yaml:"contrast" json:"contrast"`
+	AutoContrast              bool     `yaml:"auto_contrast" json:"auto_contrast"`
+	AutoLevels                bool     `yaml:"auto_levels" json:"auto_levels"`
+	AutoLevelsClip            float64  `yaml:"auto_levels_clip" json:"auto_levels_clip"`
+	Despeckle                 int      `yaml:"despeckle" json:"despeckle"` // max size of a speck in pixels, 0 = disabled
+	AutoRotate                bool     `yaml:"auto_rotate" json:"auto_rotate"`
+	AutoSplitDoublePage       bool     `yaml:"auto_split_double_page" json:"auto_split_double_page"`
+	SplitParts                int      `yaml:"split_parts" json:"split_parts"` // 0 = auto, based on aspect ratio
+	KeepDoublePageIfSplit     bool     `yaml:"keep_double_page_if_split" json:"keep_double_page_if_split"`
+	KeepSplitDoublePageAspect bool     `yaml:"keep_split_double_page_aspect" json:"keep_split_double_page_aspect"`
+	NoBlankImage              bool     `yaml:"no_blank_image" json:"no_blank_image"`
+	AnimationBadge            bool     `yaml:"animation_badge" json:"animation_badge"`
+	Manga                     bool     `yaml:"manga" json:"manga"`
+	Webtoon                   bool     `yaml:"webtoon" json:"webtoon"`
+	HasCover                  bool     `yaml:"has_cover" json:"has_cover"`
+	View                      View     `yaml:"view" json:"view"`
+	GrayScale                 bool     `yaml:"grayscale" json:"grayscale"`
+	GrayScaleMode             int      `yaml:"grayscale_mode" json:"gray_scale_mode"` // 0 = normal, 1 = average, 2 = luminance
+	Dither                    bool     `yaml:"dither" json:"dither"`                  // reduce to 16 levels of gray, after the grayscale
+	DitherMode                int      `yaml:"dither_mode" json:"dither_mode"`        // 0 = error diffusion (Floyd–Steinberg), 1 = ordered (Bayer)
+	DitherMatrix              int      `yaml:"dither_matrix" json:"dither_matrix"`    // size of the Bayer matrix: 2, 4 or 8
+	Resize                    bool     `yaml:"resize" json:"resize"`
+	Format                    string   `yaml:"format" json:"format"`
+	WebpLossless              bool     `yaml:"webp_lossless" json:"webp_lossless"`
+	AvifSpeed                 int      `yaml:"avif_speed" json:"avif_speed"` // 0 slowest and smallest, 10 fastest
+	CopyUnchanged             bool     `yaml:"copy_unchanged" json:"copy_unchanged"`
+	ColorProfile              bool     `yaml:"color_profile" json:"color_profile"`
+	EmbedSRGB                 bool     `yaml:"embed_srgb" json:"embed_srgb"`
+	ToneMap                   bool     `yaml:"tone_map" json:"tone_map"`
+	ToneMapClip               float64  `yaml:"tone_map_clip" json:"tone_map_clip"`
+	AppleBookCompatibility    bool     `yaml:"apple_book_compatibility" json:"apple_book_compatibility"`
+	Backend                   string   `yaml:"backend" json:"backend"`               // gift or simd
+	JpegBackend               string   `yaml:"jpeg_backend" json:"jpeg_backend"`     // go or libjpeg
+	TileThreshold             int      `yaml:"tile_threshold" json:"tile_threshold"` // in megapixels, larger source are reduced strip by strip first, 0 = disabled
+	MaxMegapixels             int      `yaml:"max_megapixels" json:"max_megapixels"` // larger source are rejected, 0 = unlimited
+	MaxDimension              int      `yaml:"max_dimension" json:"max_dimension"`   // source with a larger width or height are rejected, 0 = unlimited
+	Hook                      string   `yaml:"hook" json:"hook"`                     // command transforming each decoded image, PNG on stdin, image on stdout
+	Filters                   []Filter `yaml:"-" json:"filters,omitempty"`           // custom filters of the library users
 }
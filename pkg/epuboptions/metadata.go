@@ -0,0 +1,52 @@
+package epuboptions
+
+import "sync"
+
+// Metadata of an input, from the metadata providers.
+type Metadata struct {
+	Title     string `xml:"Title" json:"title,omitempty"`
+	Series    string `xml:"Series" json:"series,omitempty"`
+	Volume    string `xml:"Volume" json:"volume,omitempty"`
+	Number    string `xml:"Number" json:"number,omitempty"`
+	Language  string `xml:"LanguageISO" json:"language,omitempty"`
+	Author    string `xml:"Writer" json:"author,omitempty"`
+	Publisher string `xml:"Publisher" json:"publisher,omitempty"`
+}
+
+// MetadataProvider lookup the metadata of an input (archive or directory).
+//
+// the fields left empty are completed by the next providers. A provider without metadata for the input
+// return an empty Metadata, the errors are reported without stopping the lookup.
+type MetadataProvider interface {
+	Lookup(input string) (Metadata, error)
+}
+
+// MetadataProviderFunc a function as a MetadataProvider.
+type MetadataProviderFunc func(input string) (Metadata, error)
+
+func (f MetadataProviderFunc) Lookup(input string) (Metadata, error) {
+	return f(input)
+}
+
+var (
+	metadataProvidersMu sync.RWMutex
+	metadataProviders   []MetadataProvider
+)
+
+// RegisterMetadataProvider add a provider, looked up in the order of registration before the built-in ones
+// (sidecar, ComicInfo.xml, file name).
+func RegisterMetadataProvider(p MetadataProvider) {
+	if p == nil {
+		panic("epuboptions: RegisterMetadataProvider with a nil provider")
+	}
+	metadataProvidersMu.Lock()
+	defer metadataProvidersMu.Unlock()
+	metadataProviders = append(metadataProviders, p)
+}
+
+// MetadataProviders the registered providers.
+func MetadataProviders() []MetadataProvider {
+	metadataProvidersMu.RLock()
+	defer metadataProvidersMu.RUnlock()
+	return append([]MetadataProvider(nil), metadataProviders...)
+}
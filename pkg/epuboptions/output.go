@@ -0,0 +1,21 @@
+package epuboptions
+
+import (
+	"fmt"
+	"io"
+)
+
+// OutputFunc create the writer of a part of the EPUB, instead of the file at path.
+//
+// the zip is streamed, the writer does not need to seek. It is closed once the part is written if it is an io.Closer.
+type OutputFunc func(path string, part, parts int) (io.Writer, error)
+
+// WriterOutput write the EPUB into w, it should fit in a single part, without size limit.
+func WriterOutput(w io.Writer) OutputFunc {
+	return func(path string, part, parts int) (io.Writer, error) {
+		if parts > 1 {
+			return nil, fmt.Errorf("%s: %d parts for a single writer, disable the size limit", path, parts)
+		}
+		return w, nil
+	}
+}
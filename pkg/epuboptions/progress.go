@@ -0,0 +1,50 @@
+package epuboptions
+
+import "sync"
+
+// Progress of a step of the conversion.
+type Progress interface {
+	Add(num int) error
+	Close() error
+}
+
+// ProgressStep describe a step of the conversion.
+type ProgressStep struct {
+	Max         int
+	Description string
+	Unit        string // unit of the throughput: pages, parts, archives
+	CurrentJob  int
+	TotalJob    int
+}
+
+// ProgressBackend create the progress of each step of the conversion.
+//
+// by default, a terminal bar, json lines or nothing depending on the Quiet and Json options.
+// a GUI or a program using the library can set its own.
+type ProgressBackend func(step ProgressStep) Progress
+
+// ProgressFunc a backend that call fn each time a step progress.
+func ProgressFunc(fn func(step ProgressStep, current int)) ProgressBackend {
+	return func(step ProgressStep) Progress {
+		return &progressFunc{step: step, fn: fn}
+	}
+}
+
+type progressFunc struct {
+	mu      sync.Mutex
+	step    ProgressStep
+	current int
+	fn      func(step ProgressStep, current int)
+}
+
+func (p *progressFunc) Add(num int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current += num
+	p.fn(p.step, p.current)
+	return nil
+}
+
+func (p *progressFunc) Close() error {
+	return nil
+}
@@ -0,0 +1,20 @@
+package epuboptions
+
+// Stats of a conversion, reported once the EPUB is written.
+type Stats struct {
+	Input      string   `json:"input"`
+	Outputs    []string `json:"outputs"`
+	InputSize  int64    `json:"input_size"`  // bytes of the archive or the files of the directory
+	OutputSize int64    `json:"output_size"` // bytes of all the parts
+	Ratio      float64  `json:"ratio"`       // output / input, 0 if unknown
+	Sources    int      `json:"sources"`     // source pages
+	Pages      int      `json:"pages"`       // images of the EPUB, with the cover
+	Split      int      `json:"split"`       // source pages split into several pages
+	Dropped    int      `json:"dropped"`     // source pages removed (blank)
+	Format     string   `json:"format"`
+	Quality    int      `json:"quality"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// StatsFunc receive the stats of each conversion, it may be called by concurrent conversions.
+type StatsFunc func(s Stats)
@@ -0,0 +1,15 @@
+package epuboptions
+
+// names of the files generated from a template
+const (
+	TemplateContent = "content.opf" // the package: metadata, manifest, spine
+	TemplateToc     = "toc.xhtml"   // the table of content
+	TemplatePage    = "page.xhtml"  // each page with an image: cover, title, images
+	TemplateBlank   = "blank.xhtml" // each blank page, to align the double pages
+	TemplateStyle   = "style.css"
+)
+
+// TemplateFunc generate a file of the EPUB in place of the built-in one.
+//
+// data are the values used by the built-in template, content is its result, to be adjusted or replaced.
+type TemplateFunc func(data map[string]any, content string) (string, error)
@@ -0,0 +1,170 @@
+//go:build js && wasm
+
+// Command wasm the converter in a browser page, converting the archives client-side.
+//
+// build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o go-comic-converter.wasm ./wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// it register the global goComicConverter:
+//
+//	goComicConverter.profiles()                                        the devices: [{code, description, width, height}]
+//	goComicConverter.defaults()                                        the default options, like -show-json
+//	goComicConverter.convert(name, data, options, onProgress)          a promise of the EPUB (Uint8Array)
+//
+// data is the archive (Uint8Array), its name select the reader (cbz, zip, cbr, rar, pdf). The options are the json
+// options of the EPUB with the profile, and a signal (AbortSignal) to cancel the conversion:
+//
+//	{profile: "KS", title: "Series v01", image: {manga: true}, signal: controller.signal}
+//
+// onProgress(description, current, max) is called while the pages are processed and the EPUB written.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"syscall/js"
+
+	"github.com/ppkhoa/go-comic-converter/v3/internal/pkg/converter"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epub"
+	"github.com/ppkhoa/go-comic-converter/v3/pkg/epuboptions"
+)
+
+func main() {
+	c := converter.New()
+	c.InitParse()
+	c.Options.Quiet = true
+
+	js.Global().Set("goComicConverter", js.ValueOf(map[string]any{
+		"profiles": js.FuncOf(func(js.Value, []js.Value) any {
+			return profiles(c)
+		}),
+		"defaults": js.FuncOf(func(js.Value, []js.Value) any {
+			return toJs(c.Options.EPUBOptions)
+		}),
+		"convert": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			return promise(func() (any, error) {
+				return convert(c, args)
+			})
+		}),
+	}))
+
+	// keep the functions available
+	select {}
+}
+
+// profiles the devices, sorted by code.
+func profiles(c *converter.Converter) any {
+	info, err := c.ProfilesInfo()
+	if err != nil {
+		return js.Global().Get("Error").New(err.Error())
+	}
+	res := make([]any, 0, len(info.Devices))
+	for _, d := range info.Devices {
+		res = append(res, map[string]any{
+			"code":        d.Code,
+			"description": d.Description,
+			"width":       d.Width,
+			"height":      d.Height,
+		})
+	}
+	return res
+}
+
+// convert(name, data, options, onProgress) the archive into the EPUB.
+func convert(c *converter.Converter, args []js.Value) (any, error) {
+	if len(args) < 2 || args[1].Type() != js.TypeObject {
+		return nil, errors.New("convert(name, data, options, onProgress): the archive is required as an Uint8Array")
+	}
+	name := args[0].String()
+	data := make([]byte, args[1].Get("length").Int())
+	js.CopyBytesToGo(data, args[1])
+
+	o := c.Options.EPUBOptions
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	profile := c.Options.Profile
+	if len(args) > 2 && args[2].Type() == js.TypeObject {
+		opts := args[2]
+		// the options are given as their json
+		raw := js.Global().Get("JSON").Call("stringify", opts).String()
+		if err := json.Unmarshal([]byte(raw), &o); err != nil {
+			return nil, err
+		}
+		if p := opts.Get("profile"); p.Type() == js.TypeString {
+			profile = p.String()
+		}
+		if signal := opts.Get("signal"); signal.Type() == js.TypeObject {
+			if signal.Get("aborted").Bool() {
+				return nil, context.Canceled
+			}
+			onAbort := js.FuncOf(func(js.Value, []js.Value) any {
+				cancel()
+				return nil
+			})
+			defer onAbort.Release()
+			signal.Call("addEventListener", "abort", onAbort)
+			defer signal.Call("removeEventListener", "abort", onAbort)
+		}
+	}
+	p := c.Options.LookupProfile(profile)
+	if p == nil {
+		return nil, errors.New("unknown profile " + profile)
+	}
+	o.Image.View.Width, o.Image.View.Height = p.Width, p.Height
+	o.Quiet, o.Json = true, false
+	// the input and the output only name the EPUB in memory
+	o.Input = name
+	if o.Output == "" {
+		o.Output = strings.TrimSuffix(name, path.Ext(name)) + ".epub"
+	}
+	if len(args) > 3 && args[3].Type() == js.TypeFunction {
+		onProgress := args[3]
+		o.Progress = epuboptions.ProgressFunc(func(step epuboptions.ProgressStep, current int) {
+			onProgress.Invoke(step.Description, current, step.Max)
+		})
+	}
+	if err := o.Check(); err != nil {
+		return nil, err
+	}
+
+	out, err := epub.ConvertBytes(ctx, name, data, o)
+	if err != nil {
+		return nil, err
+	}
+	res := js.Global().Get("Uint8Array").New(len(out))
+	js.CopyBytesToJS(res, out)
+	return res, nil
+}
+
+// promise run fn in a goroutine, the calls from js should not block.
+func promise(fn func() (any, error)) js.Value {
+	var executor js.Func
+	executor = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		resolve, reject := args[0], args[1]
+		go func() {
+			defer executor.Release()
+			res, err := fn()
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(res)
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+// toJs the value through its json.
+func toJs(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return js.Global().Get("Error").New(err.Error())
+	}
+	return js.Global().Get("JSON").Call("parse", string(data))
+}